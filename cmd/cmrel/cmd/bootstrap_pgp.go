@@ -17,13 +17,12 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
-	"google.golang.org/api/cloudbuild/v1"
 
 	"github.com/cert-manager/release/pkg/gcb"
 	"github.com/cert-manager/release/pkg/release"
@@ -70,11 +69,12 @@ func (o *bootstrapPGPOptions) AddFlags(fs *flag.FlagSet, markRequired func(strin
 	markRequired("key")
 }
 
-func (o *bootstrapPGPOptions) print() {
-	log.Printf("bootstrap-pgp options:")
-	log.Printf("             Key: %q", o.Key)
-	log.Printf("         Project: %q", o.Project)
-	log.Printf("  CloudBuildFile: %q", o.CloudBuildFile)
+func (o *bootstrapPGPOptions) print(logger logr.Logger) {
+	logger.Info("bootstrap-pgp options",
+		"Key", o.Key,
+		"Project", o.Project,
+		"CloudBuildFile", o.CloudBuildFile,
+	)
 }
 
 func bootstrapPGPCmd(rootOpts *rootOptions) *cobra.Command {
@@ -86,8 +86,7 @@ func bootstrapPGPCmd(rootOpts *rootOptions) *cobra.Command {
 		Example:      bootstrapPGPExample,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runBootstrapPGP(rootOpts, o)
@@ -98,7 +97,8 @@ func bootstrapPGPCmd(rootOpts *rootOptions) *cobra.Command {
 }
 
 func runBootstrapPGP(rootOpts *rootOptions, o *bootstrapPGPOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	log.Printf("Bootstrapping PGP identity from %s", o.Key)
 
@@ -113,13 +113,13 @@ func runBootstrapPGP(rootOpts *rootOptions, o *bootstrapPGPOptions) error {
 
 	log.Printf("DEBUG: building google cloud build API client")
 
-	svc, err := cloudbuild.NewService(ctx)
+	svc, err := gcb.NewService(ctx, "", gcb.DefaultRetryOptions)
 	if err != nil {
 		return fmt.Errorf("error building google cloud build API client: %w", err)
 	}
 
 	log.Printf("Submitting GCB build job...")
-	build, err = gcb.SubmitBuild(svc, o.Project, build)
+	build, err = gcb.SubmitBuild(ctx, svc, o.Project, "", build)
 	if err != nil {
 		return fmt.Errorf("error submitting build to cloud build: %w", err)
 	}
@@ -129,8 +129,8 @@ func runBootstrapPGP(rootOpts *rootOptions, o *bootstrapPGPOptions) error {
 	log.Printf("  View logs at: %s", build.LogUrl)
 	log.Printf("  Log bucket: %s", build.LogsBucket)
 	log.Println("---")
-	log.Printf("Waiting for build to complete...")
-	build, err = gcb.WaitForBuild(svc, o.Project, build.Id)
+	rootOpts.progressLogger().Info("Waiting for build to complete...")
+	build, err = gcb.WaitForBuildWithProgress(ctx, svc, o.Project, build.Id, gcb.DefaultPollOptions, rootOpts.stepProgress())
 	if err != nil {
 		return fmt.Errorf("error waiting for cloud build to complete: %w", err)
 	}
@@ -0,0 +1,234 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/cert-manager/release/pkg/release"
+	"github.com/cert-manager/release/pkg/release/helm"
+)
+
+const (
+	chartCommand         = "chart"
+	chartDescription     = "Package a Helm chart and publish it to a chart repository in a GCS bucket"
+	chartLongDescription = `The chart command will package the Helm chart source directory at --chart-path,
+as 'helm package' would, stamping the chart's version and appVersion with the
+given release version.
+
+The packaged chart is uploaded to --bucket-path in the GCS bucket, and the
+index.yaml file in the same path is updated to include it, creating the index
+if it does not exist. Chart versions which have already been published are
+never overwritten.
+`
+
+	// defaultChartBucketPath is the default path within the bucket of the
+	// Helm chart repository.
+	defaultChartBucketPath = "charts"
+
+	// chartIndexFileName is the name of a Helm chart repository's index file.
+	chartIndexFileName = "index.yaml"
+)
+
+var (
+	chartExample = fmt.Sprintf(`
+To package and publish the v1.6.0 chart from a cert-manager checkout, run:
+
+	%s %s --chart-path=./deploy/charts/cert-manager --release-version=v1.6.0`, rootCommand, chartCommand)
+)
+
+type chartOptions struct {
+	// ChartPath is the path to the Helm chart's source directory
+	ChartPath string
+
+	// ReleaseVersion is the version the chart is stamped with
+	ReleaseVersion string
+
+	// The name of the GCS bucket containing the chart repository
+	Bucket string
+
+	// BucketPath is the path within the bucket of the chart repository
+	BucketPath string
+
+	// RepositoryURL is the public URL of the chart repository, used as the
+	// base of the URLs in its index
+	RepositoryURL string
+
+	// DryRun, if true, will package the chart and print the updated index
+	// without uploading anything
+	DryRun bool
+}
+
+func (o *chartOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.ChartPath, "chart-path", "", "Path to the source directory of the Helm chart to package.")
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The release version to stamp the chart's version and appVersion with.")
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the chart repository.")
+	fs.StringVar(&o.BucketPath, "bucket-path", defaultChartBucketPath, "The path within the GCS bucket of the chart repository.")
+	fs.StringVar(&o.RepositoryURL, "repository-url", "", "The public URL of the chart repository, used in the URLs of its index. Defaults to the public URL of --bucket-path in the GCS bucket.")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "If true, package the chart and print the updated index.yaml to stdout without uploading anything.")
+	markRequired("chart-path")
+	markRequired("release-version")
+}
+
+func (o *chartOptions) print(logger logr.Logger) {
+	logger.Info("Chart options",
+		"ChartPath", o.ChartPath,
+		"ReleaseVersion", o.ReleaseVersion,
+		"Bucket", o.Bucket,
+		"BucketPath", o.BucketPath,
+		"RepositoryURL", o.RepositoryURL,
+		"DryRun", o.DryRun,
+	)
+}
+
+func chartCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &chartOptions{}
+	cmd := &cobra.Command{
+		Use:          chartCommand,
+		Short:        chartDescription,
+		Long:         chartLongDescription,
+		Example:      chartExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChart(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runChart(rootOpts *rootOptions, o *chartOptions) error {
+	if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+		return validationErrorf("invalid --release-version: %w", err)
+	}
+
+	repositoryURL := o.RepositoryURL
+	if repositoryURL == "" {
+		repositoryURL = fmt.Sprintf("https://storage.googleapis.com/%s/%s", o.Bucket, o.BucketPath)
+	}
+
+	dir, err := os.MkdirTemp("", "cmrel-chart-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	chartPath, md, err := helm.PackageChart(o.ChartPath, o.ReleaseVersion, dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Packaged chart %q version %q to %q", md.Name, md.Version, chartPath)
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	bucket := gcs.Bucket(o.Bucket)
+	indexObj := bucket.Object(path.Join(o.BucketPath, chartIndexFileName))
+	index, indexConds, err := downloadChartIndex(ctx, indexObj, filepath.Join(dir, chartIndexFileName))
+	if err != nil {
+		return fmt.Errorf("failed to fetch chart repository index: %w", err)
+	}
+
+	if err := helm.AddChartToIndex(index, md, chartPath, repositoryURL); err != nil {
+		return err
+	}
+
+	indexPath := filepath.Join(dir, chartIndexFileName)
+	if err := index.WriteFile(indexPath, 0o644); err != nil {
+		return fmt.Errorf("failed to write chart repository index: %w", err)
+	}
+
+	if o.DryRun {
+		log.Printf("Dry run enabled, not uploading chart. Updated %s:", chartIndexFileName)
+		data, err := os.ReadFile(indexPath)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	// Published chart versions must never change, and the index must not be
+	// overwritten if it has been updated by someone else since it was read.
+	chartObj := bucket.Object(path.Join(o.BucketPath, filepath.Base(chartPath))).If(storage.Conditions{DoesNotExist: true})
+	log.Printf("Uploading chart to gs://%s/%s", o.Bucket, chartObj.ObjectName())
+	if err := uploadFile(ctx, chartObj, chartPath, release.ObjectMetadata{ReleaseVersion: o.ReleaseVersion}, release.DefaultUploadOptions); err != nil {
+		return fmt.Errorf("failed to upload chart: %w", err)
+	}
+
+	log.Printf("Uploading %s to gs://%s/%s", chartIndexFileName, o.Bucket, indexObj.ObjectName())
+	if err := uploadFile(ctx, indexObj.If(indexConds), indexPath, release.ObjectMetadata{}, release.DefaultUploadOptions); err != nil {
+		return fmt.Errorf("failed to upload chart repository index: %w", err)
+	}
+
+	log.Printf("Published chart %q version %q to %s", md.Name, md.Version, repositoryURL)
+
+	return nil
+}
+
+// downloadChartIndex downloads and parses the chart repository index stored
+// in obj, using tmpPath as a temporary location to store it. If obj does not
+// exist, an empty index is returned.
+// The returned conditions will only be met when writing the index back to
+// obj if it has not been changed since it was downloaded.
+func downloadChartIndex(ctx context.Context, obj *storage.ObjectHandle, tmpPath string) (*repo.IndexFile, storage.Conditions, error) {
+	r, err := obj.NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return repo.NewIndexFile(), storage.Conditions{DoesNotExist: true}, nil
+	}
+	if err != nil {
+		return nil, storage.Conditions{}, err
+	}
+	defer r.Close()
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, storage.Conditions{}, err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return nil, storage.Conditions{}, err
+	}
+
+	index, err := repo.LoadIndexFile(tmpPath)
+	if err != nil {
+		return nil, storage.Conditions{}, err
+	}
+
+	return index, storage.Conditions{GenerationMatch: r.Attrs.Generation}, nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	cleanCommand         = "clean"
+	cleanDescription     = "Delete old development builds from the GCS staging bucket"
+	cleanLongDescription = `The clean command will list all development builds in the staging bucket and
+select those which were last uploaded longer ago than --max-age, or which are
+not among the --keep-last most recently uploaded builds. At least one of these
+flags must be set.
+
+By default, the command runs in dry-run mode and only prints the builds which
+would be deleted. To delete them, --confirm must be specified.
+
+Release builds are never deleted by this command.
+`
+)
+
+var (
+	cleanExample = fmt.Sprintf(`
+To list the development builds which are more than 30 days old, keeping at least the 10 most recent, run:
+
+	%s %s --max-age=720h --keep-last=10
+
+To then delete them, run:
+
+	%s %s --max-age=720h --keep-last=10 --confirm`, rootCommand, cleanCommand, rootCommand, cleanCommand)
+)
+
+// cleanResult is printed to stdout for each selected build when the clean
+// command is run with --output=json.
+type cleanResult struct {
+	Name    string    `json:"name"`
+	GitRef  string    `json:"gitRef"`
+	Objects int       `json:"objects"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+	Deleted bool      `json:"deleted"`
+}
+
+type cleanOptions struct {
+	// The name of the GCS bucket containing the development builds
+	Bucket string
+
+	// MaxAge is the maximum amount of time since a build was last uploaded
+	// for it to be kept
+	MaxAge time.Duration
+
+	// KeepLast is the number of most recently uploaded builds to keep
+	KeepLast int
+
+	// DryRun, if true, will only print the builds which would be deleted
+	DryRun bool
+
+	// Confirm must be true for builds to actually be deleted
+	Confirm bool
+}
+
+func (o *cleanOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the development builds.")
+	fs.DurationVar(&o.MaxAge, "max-age", 0, "If set, delete development builds last uploaded longer ago than this duration, e.g. '720h'.")
+	fs.IntVar(&o.KeepLast, "keep-last", 0, "If set, delete all but this many of the most recently uploaded development builds.")
+	fs.BoolVar(&o.DryRun, "dry-run", true, "If true, only print the builds which would be deleted. Setting --confirm disables dry-run mode.")
+	fs.BoolVar(&o.Confirm, "confirm", false, "If true, delete the selected builds.")
+}
+
+func (o *cleanOptions) print(logger logr.Logger) {
+	logger.Info("Clean options",
+		"Bucket", o.Bucket,
+		"MaxAge", o.MaxAge,
+		"KeepLast", o.KeepLast,
+		"DryRun", o.DryRun,
+		"Confirm", o.Confirm,
+	)
+}
+
+func cleanCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &cleanOptions{}
+	cmd := &cobra.Command{
+		Use:          cleanCommand,
+		Short:        cleanDescription,
+		Long:         cleanLongDescription,
+		Example:      cleanExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runClean(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runClean(rootOpts *rootOptions, o *cleanOptions) error {
+	if o.MaxAge < 0 {
+		return validationErrorf("invalid --max-age %q: must not be negative", o.MaxAge)
+	}
+	if o.KeepLast < 0 {
+		return validationErrorf("invalid --keep-last %d: must not be negative", o.KeepLast)
+	}
+	if o.MaxAge == 0 && o.KeepLast == 0 {
+		return validationErrorf("at least one of --max-age or --keep-last must be set")
+	}
+	if !o.DryRun && !o.Confirm {
+		return fmt.Errorf("refusing to delete builds without --confirm")
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, release.BuildTypeDevel)
+	summaries, err := bucket.ListSummaries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed listing %s builds: %w", release.BuildTypeDevel, err)
+	}
+
+	expired := release.SelectExpired(summaries, time.Now(), o.MaxAge, o.KeepLast)
+	log.Printf("Selected %d of %d development builds for deletion", len(expired), len(summaries))
+
+	results := make([]cleanResult, len(expired))
+	lines := []string{"GIT REF\tUPLOADED\tOBJECTS\tSIZE"}
+	var totalSize int64
+	for i, s := range expired {
+		results[i] = cleanResult{
+			Name:    s.Name,
+			GitRef:  s.GitRef,
+			Objects: s.Objects,
+			Size:    s.Size,
+			Updated: s.Updated,
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%d\t%s", s.GitRef, s.Updated.Format(time.RFC3339), s.Objects, formatBytes(s.Size)))
+		totalSize += s.Size
+	}
+	logTable(lines...)
+
+	if !o.Confirm {
+		log.Printf("Dry run enabled, not deleting builds. Re-run with --confirm to free %s", formatBytes(totalSize))
+		if rootOpts.Output == outputJSON {
+			return printJSON(results)
+		}
+		return nil
+	}
+
+	for i, s := range expired {
+		log.Printf("Deleting development build %q", s.Name)
+		n, err := bucket.DeleteRelease(ctx, s.Name)
+		if err != nil {
+			return fmt.Errorf("failed to delete development build %q after deleting %d objects: %w", s.Name, n, err)
+		}
+		results[i].Deleted = true
+	}
+
+	log.Printf("Deleted %d development builds, freeing %s", len(expired), formatBytes(totalSize))
+
+	if rootOpts.Output == outputJSON {
+		return printJSON(results)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+// Shell completion scripts are generated by the 'completion' command which
+// cobra adds to the root command. The functions in this file provide dynamic
+// completion of flag values.
+
+// completionFunc is the type of function registered with
+// cobra.Command.RegisterFlagCompletionFunc.
+type completionFunc func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// branchCompletionTimeout bounds how long completing a branch name may spend
+// querying GitHub, so that the shell doesn't hang on a slow connection.
+const branchCompletionTimeout = time.Second * 5
+
+// mustRegisterFlagCompletionFunc registers f to complete the value of the
+// named flag of cmd, exiting if the flag does not exist.
+func mustRegisterFlagCompletionFunc(cmd *cobra.Command, name string, f completionFunc) {
+	if err := cmd.RegisterFlagCompletionFunc(name, f); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// completeBranches returns a completionFunc which completes the names of the
+// branches of the GitHub repository given by the org and repo flag values,
+// which are read once flags have been parsed. If list is true, the flag is
+// completed as a comma-separated list of branches.
+func completeBranches(org, repo, baseURL, token *string, list bool) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		ctx, cancel := context.WithTimeout(context.Background(), branchCompletionTimeout)
+		defer cancel()
+
+		t := *token
+		if t == "" {
+			t = os.Getenv("GITHUB_TOKEN")
+		}
+		branches, err := release.ListBranches(ctx, *baseURL, *org, *repo, t)
+		if err != nil {
+			cobra.CompDebugln(err.Error(), true)
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		if list {
+			return completeList(toComplete, branches, false), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		}
+		return branches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeTargetOSes is a completionFunc for the --target-os flag.
+func completeTargetOSes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeList(toComplete, release.AllOSes().List(), true), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeTargetArches returns a completionFunc for the --target-arch flag,
+// completing the arches supported by the OSes given by the --target-os flag
+// value, which is read once flags have been parsed.
+func completeTargetArches(targetOSes *string) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		osList, err := release.OSListFromString(*targetOSes)
+		if err != nil {
+			osList = release.AllOSes()
+		}
+		return completeList(toComplete, release.AllArchesForOSes(osList).List(), true), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+}
+
+// completeList completes the last item of a comma-separated list, returning
+// each of the options which could complete it prefixed with the earlier items
+// in the list. If targetList is true, the list is a target list as parsed by
+// release.OSListFromString, and so may also contain '*' and items prefixed
+// with '!'.
+func completeList(toComplete string, options []string, targetList bool) []string {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+	}
+	current := strings.TrimPrefix(toComplete, prefix)
+
+	given := make(map[string]bool)
+	for _, item := range strings.Split(prefix, ",") {
+		given[strings.TrimPrefix(item, "!")] = true
+	}
+
+	if targetList && strings.HasPrefix(current, "!") {
+		prefix += "!"
+		current = strings.TrimPrefix(current, "!")
+	}
+
+	var completions []string
+	if targetList && prefix == "" && strings.HasPrefix("*", current) {
+		completions = append(completions, "*")
+	}
+	for _, option := range options {
+		if !given[option] && strings.HasPrefix(option, current) {
+			completions = append(completions, prefix+option)
+		}
+	}
+	return completions
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompleteList(t *testing.T) {
+	options := []string{"darwin", "linux", "windows"}
+	tests := map[string]struct {
+		toComplete string
+		targetList bool
+		expected   []string
+	}{
+		"empty target list offers all options": {
+			toComplete: "",
+			targetList: true,
+			expected:   []string{"*", "darwin", "linux", "windows"},
+		},
+		"empty plain list does not offer wildcard": {
+			toComplete: "",
+			expected:   []string{"darwin", "linux", "windows"},
+		},
+		"partial item": {
+			toComplete: "li",
+			targetList: true,
+			expected:   []string{"linux"},
+		},
+		"later items exclude earlier items": {
+			toComplete: "linux,",
+			targetList: true,
+			expected:   []string{"linux,darwin", "linux,windows"},
+		},
+		"excluded item": {
+			toComplete: "*,!w",
+			targetList: true,
+			expected:   []string{"*,!windows"},
+		},
+		"exclusion is only supported in target lists": {
+			toComplete: "!w",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := completeList(test.toComplete, options, test.targetList)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}
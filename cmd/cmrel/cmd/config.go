@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// loadFlagsFromConfigFile will read a YAML file mapping flag names to values
+// and set each flag in fs accordingly. Flags which were explicitly set on the
+// command line are not overridden by the file, giving the precedence order
+// defaults < file < flags.
+// List values are joined with commas, e.g. 'target-os: [linux, darwin]' is
+// equivalent to '--target-os=linux,darwin', except for flags which may be
+// repeated but don't split their values on commas, which are set once for
+// each item in the list.
+// An error is returned if the file names a flag which does not exist in fs,
+// or any of the excluded flags.
+func loadFlagsFromConfigFile(fs *flag.FlagSet, path string, excluded ...string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var unknown []string
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || containsString(excluded, name) {
+			unknown = append(unknown, name)
+			continue
+		}
+
+		// flags set on the command line take precedence
+		if f.Changed {
+			continue
+		}
+
+		for _, value := range configValueStrings(f, values[name]) {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value for %q in config file %q: %w", name, path, err)
+			}
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown keys in config file %q: %s", path, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// configValueStrings returns the strings which should be passed to the Set
+// method of f to set it to a value decoded from a config file.
+func configValueStrings(f *flag.Flag, v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok || f.Value.Type() != "stringArray" {
+		return []string{configValueString(v)}
+	}
+
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = configValueString(item)
+	}
+	return values
+}
+
+// configValueString formats a value decoded from a config file as a string
+// which can be passed to flag.Value's Set method.
+func configValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = configValueString(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestLoadFlagsFromConfigFile(t *testing.T) {
+	tests := map[string]struct {
+		config    string
+		args      []string
+		expected  stageOptions
+		expectErr bool
+	}{
+		"defaults are used if not set in file or flags": {
+			config:   ``,
+			expected: stageOptions{Bucket: "default-bucket", Branch: "master", TargetOSes: "*", BuildTimeout: time.Hour},
+		},
+		"file overrides defaults": {
+			config: `
+bucket: file-bucket
+branch: release-1.6
+target-os: [linux, darwin]
+build-timeout: 90m
+skip-signing: true
+`,
+			expected: stageOptions{Bucket: "file-bucket", Branch: "release-1.6", TargetOSes: "linux,darwin", BuildTimeout: time.Minute * 90, SkipSigning: true},
+		},
+		"flags override file": {
+			config: `
+bucket: file-bucket
+branch: release-1.6
+`,
+			args:     []string{"--branch=release-1.7"},
+			expected: stageOptions{Bucket: "file-bucket", Branch: "release-1.7", TargetOSes: "*", BuildTimeout: time.Hour},
+		},
+		"lists are loaded into slice flags": {
+			config: `
+signing-kms-key: [key-1, key-2]
+`,
+			expected: stageOptions{Bucket: "default-bucket", Branch: "master", TargetOSes: "*", BuildTimeout: time.Hour, SigningKMSKeys: []string{"key-1", "key-2"}},
+		},
+		"lists are loaded item by item into array flags": {
+			config: `
+set-substitution: ["_A=1,2", "_B=3"]
+`,
+			expected: stageOptions{Bucket: "default-bucket", Branch: "master", TargetOSes: "*", BuildTimeout: time.Hour, Substitutions: []string{"_A=1,2", "_B=3"}},
+		},
+		"unknown keys are rejected": {
+			config: `
+bucket: file-bucket
+not-a-flag: true
+`,
+			expectErr: true,
+		},
+		"excluded keys are rejected": {
+			config: `
+config: other.yaml
+`,
+			expectErr: true,
+		},
+		"invalid values are rejected": {
+			config: `
+build-timeout: forever
+`,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "release.yaml")
+			if err := os.WriteFile(path, []byte(test.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			o := stageOptions{}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.StringVar(&o.Bucket, "bucket", "default-bucket", "")
+			fs.StringVar(&o.Branch, "branch", "master", "")
+			fs.StringVar(&o.TargetOSes, "target-os", "*", "")
+			fs.DurationVar(&o.BuildTimeout, "build-timeout", time.Hour, "")
+			fs.BoolVar(&o.SkipSigning, "skip-signing", false, "")
+			fs.StringSliceVar(&o.SigningKMSKeys, "signing-kms-key", nil, "")
+			fs.StringArrayVar(&o.Substitutions, "set-substitution", nil, "")
+			fs.StringVar(&o.ConfigFile, "config", "", "")
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loadFlagsFromConfigFile(fs, path, "config")
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(o, test.expected) {
+				t.Errorf("unexpected options:\ngot: %+v\nexp: %+v", o, test.expected)
+			}
+		})
+	}
+}
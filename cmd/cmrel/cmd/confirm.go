@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errNotConfirmed is returned when the user declines a confirmation prompt.
+var errNotConfirmed = fmt.Errorf("aborted as the prompt was not confirmed")
+
+// isTerminal returns true if f is a terminal, and so a user can be prompted
+// for input through it.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmOrRequireYes prompts the user on stdin to confirm the action
+// described by message, unless yes is true. If stdin is not a terminal, an
+// error is returned instead of prompting so that unattended runs must set
+// --yes explicitly.
+func confirmOrRequireYes(yes bool, message string) error {
+	if yes {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return validationErrorf("%s\n--yes must be set to continue when stdin is not a terminal", message)
+	}
+	return confirm(os.Stdin, os.Stderr, message)
+}
+
+// confirm writes message and a yes/no prompt to out, returning an error
+// unless the line read from in is 'y' or 'yes'.
+func confirm(in io.Reader, out io.Writer, message string) error {
+	fmt.Fprintf(out, "%s\nContinue? [y/N]: ", message)
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	}
+	return errNotConfirmed
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		confirmed bool
+	}{
+		"yes":                  {input: "yes\n", confirmed: true},
+		"y in upper case":      {input: " Y \n", confirmed: true},
+		"no":                   {input: "n\n", confirmed: false},
+		"anything else":        {input: "sure\n", confirmed: false},
+		"empty input defaults": {input: "\n", confirmed: false},
+		"end of input":         {input: "", confirmed: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := confirm(strings.NewReader(test.input), out, "About to stage release \"v1.6.0\"")
+			if test.confirmed != (err == nil) {
+				t.Errorf("confirmed=%v but got error: %v", test.confirmed, err)
+			}
+			if !strings.HasPrefix(out.String(), "About to stage release \"v1.6.0\"\nContinue? [y/N]: ") {
+				t.Errorf("unexpected prompt: %q", out.String())
+			}
+		})
+	}
+}
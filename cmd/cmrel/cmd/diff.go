@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	diffCommand         = "diff"
+	diffDescription     = "Compare the files of two staged releases"
+	diffLongDescription = `The diff command will list the objects of two staged releases in the staging
+bucket and report the files which were added or removed between them, as well
+as any files present in both whose size or checksum differs.
+
+Checksums are the CRC32C of each object as recorded by Google Cloud Storage, so
+no artifacts are downloaded. The command does not fail if the releases differ.
+`
+)
+
+var (
+	diffExample = fmt.Sprintf(`
+To compare the staged v1.6.0-beta.0 and v1.6.0 releases, run:
+
+	%s %s --from-release-version=v1.6.0-beta.0 --from-git-ref=2f3a1b0c --to-release-version=v1.6.0 --to-git-ref=6d3ce5e2`, rootCommand, diffCommand)
+)
+
+// diffResult is printed to stdout when the diff command is run with
+// --output=json.
+type diffResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	release.StagedDiff
+}
+
+type diffOptions struct {
+	// The name of the GCS bucket containing the staged releases
+	Bucket string
+
+	// FromReleaseVersion is the version of the staged release to compare from
+	FromReleaseVersion string
+
+	// FromGitRef is the commit ref that the release to compare from was built from
+	FromGitRef string
+
+	// ToReleaseVersion is the version of the staged release to compare to
+	ToReleaseVersion string
+
+	// ToGitRef is the commit ref that the release to compare to was built from
+	ToGitRef string
+}
+
+func (o *diffOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the staged releases.")
+	fs.StringVar(&o.FromReleaseVersion, "from-release-version", "", "The version of the staged release to compare from.")
+	fs.StringVar(&o.FromGitRef, "from-git-ref", "", "The git commit ref that the staged release to compare from was built from.")
+	fs.StringVar(&o.ToReleaseVersion, "to-release-version", "", "The version of the staged release to compare to.")
+	fs.StringVar(&o.ToGitRef, "to-git-ref", "", "The git commit ref that the staged release to compare to was built from.")
+	markRequired("from-release-version")
+	markRequired("from-git-ref")
+	markRequired("to-release-version")
+	markRequired("to-git-ref")
+}
+
+func (o *diffOptions) print(logger logr.Logger) {
+	logger.Info("Diff options",
+		"Bucket", o.Bucket,
+		"FromReleaseVersion", o.FromReleaseVersion,
+		"FromGitRef", o.FromGitRef,
+		"ToReleaseVersion", o.ToReleaseVersion,
+		"ToGitRef", o.ToGitRef,
+	)
+}
+
+func diffCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &diffOptions{}
+	cmd := &cobra.Command{
+		Use:          diffCommand,
+		Short:        diffDescription,
+		Long:         diffLongDescription,
+		Example:      diffExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runDiff(rootOpts *rootOptions, o *diffOptions) error {
+	if err := release.ValidateReleaseVersion(o.FromReleaseVersion); err != nil {
+		return validationErrorf("invalid --from-release-version: %w", err)
+	}
+	if err := release.ValidateReleaseVersion(o.ToReleaseVersion); err != nil {
+		return validationErrorf("invalid --to-release-version: %w", err)
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	bucket := gcs.Bucket(o.Bucket)
+
+	fromPath := release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeForVersion(o.FromReleaseVersion), o.FromReleaseVersion, o.FromGitRef)
+	toPath := release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeForVersion(o.ToReleaseVersion), o.ToReleaseVersion, o.ToGitRef)
+
+	from, err := listStagedObjects(ctx, bucket, fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := listStagedObjects(ctx, bucket, toPath)
+	if err != nil {
+		return err
+	}
+
+	diff := release.DiffStagedObjects(from, to)
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(diffResult{
+			From:       fmt.Sprintf("gs://%s/%s", o.Bucket, fromPath),
+			To:         fmt.Sprintf("gs://%s/%s", o.Bucket, toPath),
+			StagedDiff: diff,
+		}); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Compared %d files in gs://%s/%s with %d files in gs://%s/%s", len(from), o.Bucket, fromPath, len(to), o.Bucket, toPath)
+	log.Printf("%d added, %d removed, %d changed, %d unchanged", len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+	for _, name := range diff.Added {
+		log.Printf("  ADDED: %s", name)
+	}
+	for _, name := range diff.Removed {
+		log.Printf("  REMOVED: %s", name)
+	}
+	for _, c := range diff.Changed {
+		log.Printf("  CHANGED: %s (%d -> %d bytes, crc32c %s -> %s)", c.Name, c.FromSize, c.ToSize, c.FromChecksum, c.ToChecksum)
+	}
+
+	return nil
+}
+
+// listStagedObjects lists the files of the staged release at stagedPath in
+// bucket, returning an error if there are none.
+func listStagedObjects(ctx context.Context, bucket *storage.BucketHandle, stagedPath string) ([]release.StagedObject, error) {
+	objs, err := release.ListObjects(ctx, bucket, stagedPath+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged release at %q: %w", stagedPath, err)
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no staged release found at %q", stagedPath)
+	}
+
+	staged := make([]release.StagedObject, len(objs))
+	for i, obj := range objs {
+		staged[i] = release.StagedObject{
+			Name:     strings.TrimPrefix(obj.Name, stagedPath+"/"),
+			Size:     obj.Size,
+			Checksum: fmt.Sprintf("%08x", obj.CRC32C),
+		}
+	}
+	return staged, nil
+}
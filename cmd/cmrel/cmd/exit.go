@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by commands are classified as one of the following kinds,
+// which each cause cmrel to exit with a distinct exit code so that scripts
+// wrapping it can decide whether a failure is worth retrying. Use errors.Is
+// to check whether an error is of a given kind.
+var (
+	// ErrValidation is the kind of error returned when the flags or files
+	// given to a command are invalid. Retrying won't help.
+	ErrValidation = errors.New("invalid options")
+
+	// ErrAPIUnavailable is the kind of error returned when a Google Cloud
+	// API couldn't be reached or returned an error. Retrying may help.
+	ErrAPIUnavailable = errors.New("API unavailable")
+
+	// ErrBuildFailed is the kind of error returned when a build was
+	// submitted but didn't complete successfully.
+	ErrBuildFailed = errors.New("build failed")
+
+	// ErrTimeout is the kind of error returned when a command did not
+	// complete within --timeout.
+	ErrTimeout = errors.New("timed out")
+)
+
+// Exit codes returned by cmrel. Any error which isn't of one of the kinds
+// above exits with exitCodeError.
+const (
+	exitCodeError          = 1
+	exitCodeValidation     = 2
+	exitCodeAPIUnavailable = 3
+	exitCodeBuildFailed    = 4
+	exitCodeTimeout        = 5
+)
+
+// exitCodesDescription documents the exit codes in the root command's help.
+var exitCodesDescription = fmt.Sprintf(`Exit codes:
+  0  success
+  %d  unclassified error
+  %d  invalid flags or input files, retrying won't help
+  %d  a Google Cloud API couldn't be reached or returned an error
+  %d  a build was submitted but didn't succeed
+  %d  the command did not complete within --timeout`,
+	exitCodeError, exitCodeValidation, exitCodeAPIUnavailable, exitCodeBuildFailed, exitCodeTimeout)
+
+// exitCode returns the exit code the process should exit with after a
+// command returned err. A timeout takes precedence over the kind of error it
+// interrupted.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrTimeout):
+		return exitCodeTimeout
+	case errors.Is(err, ErrValidation):
+		return exitCodeValidation
+	case errors.Is(err, ErrBuildFailed):
+		return exitCodeBuildFailed
+	case errors.Is(err, ErrAPIUnavailable):
+		return exitCodeAPIUnavailable
+	}
+	return exitCodeError
+}
+
+// kindError classifies err as being of the given kind without changing its
+// message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// withKind returns err classified as the given kind, or nil if err is nil.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// validationErrorf formats an error as fmt.Errorf does and classifies it as
+// ErrValidation.
+func validationErrorf(format string, a ...interface{}) error {
+	return withKind(ErrValidation, fmt.Errorf(format, a...))
+}
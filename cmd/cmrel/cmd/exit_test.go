@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	o := &rootOptions{Timeout: time.Minute}
+
+	tests := map[string]struct {
+		err      error
+		expected int
+	}{
+		"no error": {
+			err:      nil,
+			expected: 0,
+		},
+		"unclassified error": {
+			err:      errors.New("boom"),
+			expected: exitCodeError,
+		},
+		"validation error": {
+			err:      validationErrorf("invalid --region: %w", errors.New("boom")),
+			expected: exitCodeValidation,
+		},
+		"wrapped API error": {
+			err:      fmt.Errorf("staging failed: %w", withKind(ErrAPIUnavailable, errors.New("boom"))),
+			expected: exitCodeAPIUnavailable,
+		},
+		"build failed": {
+			err:      withKind(ErrBuildFailed, errors.New("boom")),
+			expected: exitCodeBuildFailed,
+		},
+		"timeout takes precedence": {
+			err:      o.timeoutError(expired, "submitting build", withKind(ErrAPIUnavailable, errors.New("boom"))),
+			expected: exitCodeTimeout,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if code := exitCode(test.err); code != test.expected {
+				t.Errorf("expected exit code %d but got %d for error: %v", test.expected, code, test.err)
+			}
+		})
+	}
+}
+
+func TestWithKind_PreservesMessage(t *testing.T) {
+	err := withKind(ErrValidation, errors.New("invalid --region"))
+	if err.Error() != "invalid --region" {
+		t.Errorf("expected message to be unchanged but got %q", err.Error())
+	}
+	if withKind(ErrValidation, nil) != nil {
+		t.Errorf("expected nil error to remain nil")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/sign"
+)
+
+const (
+	exportKeyCommand         = "export-key"
+	exportKeyDescription     = "Export the PEM encoded public key of a GCP KMS signing key"
+	exportKeyLongDescription = `The export-key command fetches the public key of a GCP KMS key version using
+the KMS API, and writes it in PEM format to stdout or to --output-file, so that
+it can be bundled with a release for consumers to verify its signatures.
+
+Any version of the key may be named, and only the
+cloudkms.cryptoKeyVersions.viewPublicKey permission is required.`
+)
+
+var exportKeyExample = fmt.Sprintf(`To write the public key of a signing key version to cert-manager.pem:
+
+%s %s --signing-kms-key "projects/<PROJECT_NAME>/locations/<LOCATION>/keyRings/<KEYRING_NAME>/cryptoKeys/<KEY_NAME>/cryptoKeyVersions/<KEY_VERSION>" --output-file cert-manager.pem`, rootCommand, exportKeyCommand)
+
+// exportKeyResult is printed to stdout when the export-key command is run
+// with --output=json.
+type exportKeyResult struct {
+	Key        string `json:"key"`
+	PublicKey  string `json:"publicKey"`
+	OutputFile string `json:"outputFile,omitempty"`
+}
+
+type exportKeyOptions struct {
+	// SigningKMSKey is the full name of the GCP KMS key version whose public
+	// key is exported
+	SigningKMSKey string
+
+	// OutputFile, if set, is the path the public key is written to instead of
+	// stdout
+	OutputFile string
+}
+
+func (o *exportKeyOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.SigningKMSKey, "signing-kms-key", "", "Full name of the GCP KMS key version whose public key should be exported, including the version.")
+	fs.StringVar(&o.OutputFile, "output-file", "", "Optional path to write the PEM encoded public key to. If not set, it is written to stdout.")
+	markRequired("signing-kms-key")
+}
+
+func (o *exportKeyOptions) print(logger logr.Logger) {
+	logger.Info("Export key options",
+		"SigningKMSKey", o.SigningKMSKey,
+		"OutputFile", o.OutputFile,
+	)
+}
+
+func exportKeyCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &exportKeyOptions{}
+	cmd := &cobra.Command{
+		Use:          exportKeyCommand,
+		Short:        exportKeyDescription,
+		Long:         exportKeyLongDescription,
+		Example:      exportKeyExample,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExportKey(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runExportKey(rootOpts *rootOptions, o *exportKeyOptions) error {
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+
+	key, err := sign.NewGCPKMSKey(o.SigningKMSKey)
+	if err != nil {
+		return validationErrorf("invalid --signing-kms-key: %w", err)
+	}
+
+	log.Printf("Fetching public key of KMS key version %q", key)
+	pub, err := sign.PublicKeyPEM(ctx, key)
+	if err != nil {
+		return rootOpts.timeoutError(ctx, "fetching public key", withKind(ErrAPIUnavailable, err))
+	}
+
+	if o.OutputFile != "" {
+		if err := os.WriteFile(o.OutputFile, pub, 0o644); err != nil {
+			return fmt.Errorf("failed to write public key to --output-file: %w", err)
+		}
+		log.Printf("Wrote public key to %q", o.OutputFile)
+	}
+
+	if rootOpts.Output == outputJSON {
+		return printJSON(&exportKeyResult{Key: key.String(), PublicKey: string(pub), OutputFile: o.OutputFile})
+	}
+
+	if o.OutputFile == "" {
+		fmt.Print(string(pub))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	fetchCommand         = "fetch"
+	fetchDescription     = "Download the files of a staged build to a local directory"
+	fetchLongDescription = `The fetch command will download every object of a staged build to a local
+directory, preserving the structure of the objects beneath the build's path in
+the bucket.
+
+Once downloaded, every file listed in the build's SHA256SUMS file is checked
+against its checksum, and the command fails if any checksum does not match.
+If --release-version is not set, the development build of --git-ref is
+fetched.
+`
+)
+
+var (
+	fetchExample = fmt.Sprintf(`
+To download the staged v1.6.0 release built at commit 6d3ce5e to ./out, run:
+
+	%s %s --release-version=v1.6.0 --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0 --dest=./out`, rootCommand, fetchCommand)
+)
+
+// fetchResult is printed to stdout when the fetch command is run with
+// --output=json.
+type fetchResult struct {
+	Path     string   `json:"path"`
+	Dest     string   `json:"dest"`
+	Files    []string `json:"files"`
+	Verified bool     `json:"verified"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type fetchOptions struct {
+	// The name of the GCS bucket containing the staged build
+	Bucket string
+
+	// BucketPathPrefix is the path within the bucket under which the build
+	// was staged
+	BucketPathPrefix string
+
+	// ReleaseVersion is the version of the staged release to fetch. If not
+	// set, a devel build is fetched
+	ReleaseVersion string
+
+	// GitRef is the commit ref that the staged build was built from
+	GitRef string
+
+	// Dest is the local directory to download files to
+	Dest string
+}
+
+func (o *fetchOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the staged build.")
+	fs.StringVar(&o.BucketPathPrefix, "bucket-path-prefix", release.DefaultBucketPathPrefix, "The path within the bucket under which the build was staged, as passed to 'stage'.")
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The version of the staged release to fetch. If not set, the development build of --git-ref is fetched.")
+	fs.StringVar(&o.GitRef, "git-ref", "", "The git commit ref that the staged build was built from.")
+	fs.StringVar(&o.Dest, "dest", "", "The local directory to download files to. It is created if it does not exist.")
+	markRequired("git-ref")
+	markRequired("dest")
+}
+
+func (o *fetchOptions) print(logger logr.Logger) {
+	logger.Info("Fetch options",
+		"Bucket", o.Bucket,
+		"BucketPathPrefix", o.BucketPathPrefix,
+		"ReleaseVersion", o.ReleaseVersion,
+		"GitRef", o.GitRef,
+		"Dest", o.Dest,
+	)
+}
+
+func fetchCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &fetchOptions{}
+	cmd := &cobra.Command{
+		Use:          fetchCommand,
+		Short:        fetchDescription,
+		Long:         fetchLongDescription,
+		Example:      fetchExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFetch(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runFetch(rootOpts *rootOptions, o *fetchOptions) error {
+	bucketPathPrefix, err := release.NormalizeBucketPathPrefix(o.BucketPathPrefix)
+	if err != nil {
+		return validationErrorf("invalid --bucket-path-prefix: %w", err)
+	}
+
+	stagedPath := release.BucketPathForRelease(bucketPathPrefix, release.BuildTypeDevel, "", o.GitRef)
+	if o.ReleaseVersion != "" {
+		if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+			return validationErrorf("invalid --release-version: %w", err)
+		}
+		stagedPath = release.BucketPathForRelease(bucketPathPrefix, release.BuildTypeForVersion(o.ReleaseVersion), o.ReleaseVersion, o.GitRef)
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	bucket := gcs.Bucket(o.Bucket)
+
+	log.Printf("Listing staged build at gs://%s/%s", o.Bucket, stagedPath)
+	objs, err := release.ListObjects(ctx, bucket, stagedPath+"/")
+	if err != nil {
+		return rootOpts.timeoutError(ctx, "listing staged build", fmt.Errorf("failed to list staged build: %w", err))
+	}
+	if len(objs) == 0 {
+		return fmt.Errorf("no staged build found at gs://%s/%s", o.Bucket, stagedPath)
+	}
+
+	result := fetchResult{Path: fmt.Sprintf("gs://%s/%s", o.Bucket, stagedPath), Dest: o.Dest}
+	for _, obj := range objs {
+		name := strings.TrimPrefix(obj.Name, stagedPath+"/")
+		dst, err := release.LocalPathForObject(o.Dest, name)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Downloading %s (%d bytes)", name, obj.Size)
+		if err := release.DownloadObject(ctx, bucket.Object(obj.Name), dst); err != nil {
+			return rootOpts.timeoutError(ctx, "downloading staged build", fmt.Errorf("failed to download %q: %w", name, err))
+		}
+		result.Files = append(result.Files, name)
+	}
+	log.Printf("Downloaded %d files to %s", len(result.Files), o.Dest)
+
+	verifyErr := verifyFetchedChecksums(o.Dest)
+	if verifyErr != nil {
+		result.Error = verifyErr.Error()
+	} else {
+		result.Verified = true
+	}
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	}
+
+	if verifyErr != nil {
+		return fmt.Errorf("failed to verify files downloaded to %s: %w", o.Dest, verifyErr)
+	}
+
+	log.Printf("All files listed in %s match their checksums", release.ChecksumsFileName)
+
+	return nil
+}
+
+// verifyFetchedChecksums checks every file listed in the checksums file
+// downloaded to dir against its checksum.
+func verifyFetchedChecksums(dir string) error {
+	f, err := os.Open(filepath.Join(dir, release.ChecksumsFileName))
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", release.ChecksumsFileName, err)
+	}
+	defer f.Close()
+
+	return release.VerifyChecksumsFile(f, dir)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 )
@@ -33,15 +34,19 @@ type gcbOptions struct {
 func (o *gcbOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
 }
 
-func (o *gcbOptions) print() {
+func (o *gcbOptions) print(logger logr.Logger) {
 }
 
 func gcbCmd(o *rootOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   gcbCommand,
 		Short: gcbDescription,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.configure(); err != nil {
+				return err
+			}
 			o.print()
+			return nil
 		},
 		Long: gcbDescriptionLong,
 	}
@@ -51,6 +56,8 @@ func gcbCmd(o *rootOptions) *cobra.Command {
 	cmd.AddCommand(gcbStageCmd(o))
 	cmd.AddCommand(gcbPublishCmd(o))
 	cmd.AddCommand(gcbBootstrapPGPCmd(o))
+	cmd.AddCommand(gcbStatusCmd(o))
+	cmd.AddCommand(gcbCancelCmd(o))
 
 	return cmd
 }
@@ -19,8 +19,8 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
 
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 	"golang.org/x/oauth2/google"
@@ -62,9 +62,10 @@ func (o *gcbBootstrapPGPOptions) AddFlags(fs *flag.FlagSet, markRequired func(st
 	markRequired("key")
 }
 
-func (o *gcbBootstrapPGPOptions) print() {
-	log.Printf("bootstrap-pgp options:")
-	log.Printf("         Key: %q", o.Key)
+func (o *gcbBootstrapPGPOptions) print(logger logr.Logger) {
+	logger.Info("bootstrap-pgp options",
+		"Key", o.Key,
+	)
 }
 
 func gcbBootstrapPGPCmd(rootOpts *rootOptions) *cobra.Command {
@@ -76,8 +77,7 @@ func gcbBootstrapPGPCmd(rootOpts *rootOptions) *cobra.Command {
 		Example:      gcbBootstrapPGPExample,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runGCBBootstrapPGP(rootOpts, o)
@@ -109,7 +109,8 @@ func getPEMPubkey(ctx context.Context, key sign.GCPKMSKey) (string, error) {
 }
 
 func runGCBBootstrapPGP(rootOpts *rootOptions, o *gcbBootstrapPGPOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	parsedKey, err := sign.NewGCPKMSKey(o.Key)
 	if err != nil {
@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	gcbCancelCommand         = "cancel"
+	gcbCancelDescription     = "Cancel a running Google Cloud Build job"
+	gcbCancelLongDescription = `The cancel command will cancel an existing Google Cloud Build job by ID, and
+confirm that it has been cancelled before printing its final status.
+
+This can be used to stop a build started by a previous invocation of a command
+such as 'stage --no-wait'. Builds which have already completed are left as they
+are, and their status is printed.
+`
+)
+
+var (
+	gcbCancelExample = fmt.Sprintf(`
+To cancel the build with ID 'abc-123', run:
+
+	%s %s %s --id=abc-123`, rootCommand, gcbCommand, gcbCancelCommand)
+)
+
+type gcbCancelOptions struct {
+	// ID is the ID of the GCB build to cancel
+	ID string
+
+	// Project is the name of the GCP project the GCB job was run in
+	Project string
+}
+
+func (o *gcbCancelOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.ID, "id", "", "The ID of the GCB build to cancel. Builds run in a private worker pool must be specified using their full resource name, as printed by the stage command.")
+	fs.StringVar(&o.Project, "project", release.DefaultReleaseProject, "The GCP project the GCB build job was run in.")
+	markRequired("id")
+}
+
+func (o *gcbCancelOptions) print(logger logr.Logger) {
+	logger.Info("GCB Cancel options",
+		"ID", o.ID,
+		"Project", o.Project,
+	)
+}
+
+func gcbCancelCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &gcbCancelOptions{}
+	cmd := &cobra.Command{
+		Use:          gcbCancelCommand,
+		Short:        gcbCancelDescription,
+		Long:         gcbCancelLongDescription,
+		Example:      gcbCancelExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGCBCancel(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runGCBCancel(rootOpts *rootOptions, o *gcbCancelOptions) error {
+	rootCtx, cancel := rootOpts.context()
+	defer cancel()
+	ctx, stop := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("DEBUG: building google cloud build API client")
+	apiSvc, err := gcb.NewService(ctx, "", gcb.DefaultRetryOptions)
+	if err != nil {
+		return withKind(ErrAPIUnavailable, fmt.Errorf("error building google cloud build API client: %w", err))
+	}
+	svc := gcb.NewAPIService(apiSvc, gcb.DefaultPollOptions)
+
+	result, err := cancelGCBBuild(ctx, svc, o.Project, o.ID)
+	if err != nil {
+		return rootOpts.timeoutError(ctx, "cancelling build", err)
+	}
+
+	logBuildStatus(result)
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(newGCBStatusResult(result)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cancelGCBBuild cancels the build with the given ID if it hasn't already
+// completed, then fetches it again to confirm that it was cancelled,
+// returning a summary of its final state.
+func cancelGCBBuild(ctx context.Context, svc gcb.Service, projectID, id string) (*gcb.BuildResult, error) {
+	build, err := svc.GetBuild(ctx, projectID, id)
+	if err != nil {
+		return nil, withKind(ErrAPIUnavailable, fmt.Errorf("error fetching build %q: %w", id, err))
+	}
+
+	if gcb.IsTerminal(build.Status) {
+		log.Printf("Build %q has already finished with status %q, not cancelling it", id, build.Status)
+	} else {
+		log.Printf("Cancelling build %q with status %q", id, build.Status)
+		if _, err := svc.CancelBuild(ctx, projectID, id); err != nil {
+			return nil, withKind(ErrAPIUnavailable, fmt.Errorf("error cancelling build %q: %w", id, err))
+		}
+
+		if build, err = svc.GetBuild(ctx, projectID, id); err != nil {
+			return nil, withKind(ErrAPIUnavailable, fmt.Errorf("error fetching build %q after cancelling it: %w", id, err))
+		}
+		if !gcb.IsTerminal(build.Status) {
+			return nil, fmt.Errorf("build %q still has status %q after cancelling it", id, build.Status)
+		}
+	}
+
+	result, err := gcb.NewBuildResult(build)
+	if err != nil {
+		return nil, fmt.Errorf("error summarising build %q: %w", id, err)
+	}
+	return result, nil
+}
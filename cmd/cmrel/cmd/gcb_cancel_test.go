@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/cloudbuild/v1"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/gcb/gcbfake"
+)
+
+func TestCancelGCBBuild(t *testing.T) {
+	tests := map[string]struct {
+		build        *cloudbuild.Build
+		id           string
+		expStatus    string
+		expCancelled []string
+		expErr       bool
+	}{
+		"running build is cancelled": {
+			build:        &cloudbuild.Build{Id: "abc-123", Status: "WORKING"},
+			id:           "abc-123",
+			expStatus:    gcb.Cancelled,
+			expCancelled: []string{"abc-123"},
+		},
+		"build in a worker pool is cancelled by resource name": {
+			build:        &cloudbuild.Build{Id: "abc-123", Name: "projects/p/locations/us-central1/builds/abc-123", Status: "QUEUED"},
+			id:           "projects/p/locations/us-central1/builds/abc-123",
+			expStatus:    gcb.Cancelled,
+			expCancelled: []string{"projects/p/locations/us-central1/builds/abc-123"},
+		},
+		"completed build is not cancelled": {
+			build:     &cloudbuild.Build{Id: "abc-123", Status: gcb.Success},
+			id:        "abc-123",
+			expStatus: gcb.Success,
+		},
+		"unknown build errors": {
+			build:  &cloudbuild.Build{Id: "abc-123", Status: "WORKING"},
+			id:     "def-456",
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &gcbfake.Service{}
+			svc.AddBuild(test.build)
+
+			result, err := cancelGCBBuild(context.Background(), svc, "p", test.id)
+			if (err != nil) != test.expErr {
+				t.Fatalf("expectErr=%v but got err: %v", test.expErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if result.Status != test.expStatus {
+				t.Errorf("expected status %q but got %q", test.expStatus, result.Status)
+			}
+			if cancelled := svc.Cancelled(); !reflect.DeepEqual(cancelled, append([]string{}, test.expCancelled...)) {
+				t.Errorf("unexpected cancelled builds: got=%q, exp=%q", cancelled, test.expCancelled)
+			}
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
 	"github.com/google/go-github/v35/github"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
@@ -190,21 +191,22 @@ func (o *gcbPublishOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)
 	fs.StringSliceVar(&o.PublishActions, "publish-actions", []string{"*"}, fmt.Sprintf("Comma-separated list of actions to take, or '*' to do everything. Only meaningful if nomock is set. Operations are done in alphabetical order. Actions can be removed with a prefix of '-'. Options: %s", strings.Join(allPublishActionNames(), ", ")))
 }
 
-func (o *gcbPublishOptions) print() {
-	log.Printf("GCB Publish options:")
-	log.Printf("  Bucket: %q", o.Bucket)
-	log.Printf("  ReleaseName: %q", o.ReleaseName)
-	log.Printf("  NoMock: %t", o.NoMock)
-	log.Printf("  PublishedImageRepo: %q", o.PublishedImageRepository)
-	log.Printf("  PublishedHelmChartGitHubRepo: %q", o.PublishedHelmChartGitHubRepo)
-	log.Printf("  PublishedHelmChartGitHubOwner: %q", o.PublishedHelmChartGitHubOwner)
-	log.Printf("  PublishedHelmChartGitHubBranch: %q", o.PublishedHelmChartGitHubBranch)
-	log.Printf("  PublishedGitHubOrg: %q", o.PublishedGitHubOrg)
-	log.Printf("  PublishedGitHubRepo: %q", o.PublishedGitHubRepo)
-	log.Printf("  CosignPath: %q", o.CosignPath)
-	log.Printf("  SkipSigning: %v", o.SkipSigning)
-	log.Printf("  SigningKMSKey: %q", o.SigningKMSKey)
-	log.Printf("  PublishActions: %q", strings.Join(o.PublishActions, ","))
+func (o *gcbPublishOptions) print(logger logr.Logger) {
+	logger.Info("GCB Publish options",
+		"Bucket", o.Bucket,
+		"ReleaseName", o.ReleaseName,
+		"NoMock", o.NoMock,
+		"PublishedImageRepo", o.PublishedImageRepository,
+		"PublishedHelmChartGitHubRepo", o.PublishedHelmChartGitHubRepo,
+		"PublishedHelmChartGitHubOwner", o.PublishedHelmChartGitHubOwner,
+		"PublishedHelmChartGitHubBranch", o.PublishedHelmChartGitHubBranch,
+		"PublishedGitHubOrg", o.PublishedGitHubOrg,
+		"PublishedGitHubRepo", o.PublishedGitHubRepo,
+		"CosignPath", o.CosignPath,
+		"SkipSigning", o.SkipSigning,
+		"SigningKMSKey", o.SigningKMSKey,
+		"PublishActions", strings.Join(o.PublishActions, ","),
+	)
 }
 
 func allPublishActionNames() []string {
@@ -268,8 +270,7 @@ func gcbPublishCmd(rootOpts *rootOptions) *cobra.Command {
 		Long:         gcbPublishLongDescription,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runGCBPublish(rootOpts, o)
@@ -280,7 +281,8 @@ func gcbPublishCmd(rootOpts *rootOptions) *cobra.Command {
 }
 
 func runGCBPublish(rootOpts *rootOptions, o *gcbPublishOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	if o.SigningKMSKey != "" {
 		if _, err := sign.NewGCPKMSKey(o.SigningKMSKey); err != nil {
@@ -299,7 +301,9 @@ func runGCBPublish(rootOpts *rootOptions, o *gcbPublishOptions) error {
 		return fmt.Errorf("failed to create GCS client: %w", err)
 	}
 
-	bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, release.BuildTypeRelease)
+	// release candidates are staged apart from final releases
+	releaseVersion, _ := release.ParseReleaseName(release.BuildTypeRelease, o.ReleaseName)
+	bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, release.BuildTypeForVersion(releaseVersion))
 	staged, err := bucket.GetRelease(ctx, o.ReleaseName)
 	if err != nil {
 		return fmt.Errorf("failed to fetch release: %w", err)
@@ -552,7 +556,7 @@ func signRegistryContent(ctx context.Context, o *gcbPublishOptions, contentToSig
 		return err
 	}
 
-	if err := cosign.Sign(ctx, o.CosignPath, contentToSign, parsedKey); err != nil {
+	if err := cosign.NewKMSSigner(o.CosignPath, parsedKey).SignImages(ctx, contentToSign); err != nil {
 		return fmt.Errorf("failed to sign all container images / manifest lists: %w", err)
 	}
 
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -28,13 +29,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 
 	"github.com/cert-manager/release/pkg/release"
 	"github.com/cert-manager/release/pkg/sign"
+	"github.com/cert-manager/release/pkg/sign/cosign"
 )
 
 const (
@@ -55,6 +59,10 @@ type gcbStageOptions struct {
 	// The name of the GCS bucket to stage the release to.
 	Bucket string
 
+	// BucketPathPrefix is the path within the bucket under which release
+	// artifacts are staged.
+	BucketPathPrefix string
+
 	// RepoPath is the path to a checked out copy of the cert-manager
 	// repository at the desired ref to build for this release.
 	RepoPath string
@@ -77,46 +85,150 @@ type gcbStageOptions struct {
 	// SkipSigning, if true, will skip trying to sign artifacts using KMS
 	SkipSigning bool
 
-	// SigningKMSKey is the full name of the GCP KMS key to be used for signing, e.g.
+	// SigningKMSKeys are the full names of the GCP KMS keys to be used for signing, e.g.
 	// projects/<PROJECT_NAME>/locations/<LOCATION>/keyRings/<KEYRING_NAME>/cryptoKeys/<KEY_NAME>/cryptoKeyVersions/<KEY_VERSION>
-	// This must be set if SkipSigning is not set to true
-	SigningKMSKey string
+	// At least one must be set if SkipSigning is not set to true and
+	// SigningBackend is 'kms'. Artifacts are signed with every key given.
+	SigningKMSKeys []string
+
+	// SigningBackend is the backend used to sign artifacts, one of 'kms' or
+	// 'cosign'
+	SigningBackend string
+
+	// CosignPath points to the location of the cosign binary, used when
+	// SigningBackend is 'cosign'
+	CosignPath string
+
+	// GoPath points to the location of the go command, used to list the
+	// modules linked into the release binaries when SBOMFormat is set
+	GoPath string
+
+	// SBOMFormat, if set, is the format of an SBOM describing the Go module
+	// dependencies of the release which will be staged alongside the other
+	// artifacts
+	SBOMFormat string
+
+	// Compression is the format the release tarballs are staged in, one of
+	// 'gzip', 'zstd' or 'both'
+	Compression string
+
+	// ReleaseNotesObject, if set, is the name of an object in Bucket
+	// containing release notes which will be staged alongside the other
+	// artifacts
+	ReleaseNotesObject string
+
+	// BuildTags is a comma-separated list of additional Go build tags to
+	// build the release with
+	BuildTags string
+
+	// LDFlags is a space-separated list of additional Go linker flags to
+	// build the release with
+	LDFlags string
+
+	// GoVersion, if set, is the version of the Go SDK which rules_go builds
+	// the release with, e.g. '1.22.3'
+	GoVersion string
+
+	// BuildID, if set, is the ID of the GCB build running this command,
+	// recorded in the release manifest
+	BuildID string
+
+	// CmrelVersion, if set, is the version of cmrel which submitted the GCB
+	// build running this command, recorded in the release manifest
+	CmrelVersion string
+
+	// ArtifactTypes is a comma-separated list of the types of artifact which
+	// should be built in this invocation
+	ArtifactTypes string
 
 	// TargetOSes is a comma-separated list of OSes which should be built for in this invocation
 	TargetOSes string
 
 	// TargetArches is a comma-separated list of architectures which should be built for in this invocation
 	TargetArches string
+
+	// Shard, if set, is the name of the shard of a sharded stage build which
+	// this invocation builds. The release metadata, checksums and manifest
+	// files are written under names given by release.ShardFileName, to be
+	// merged and signed by the stage command once every shard has completed
+	Shard string
+
+	// UploadChunkSize is the size in bytes of each request of the resumable
+	// uploads used to upload artifacts to GCS
+	UploadChunkSize int
+
+	// UploadMaxRetries is the maximum number of times an upload to GCS is
+	// restarted if it fails with a transient error
+	UploadMaxRetries int
 }
 
 func (o *gcbStageOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
 	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket to stage the release to.")
+	fs.StringVar(&o.BucketPathPrefix, "bucket-path-prefix", release.DefaultBucketPathPrefix, "The path within the bucket under which to stage the release.")
 	fs.StringVar(&o.RepoPath, "repo-path", "", "Path to the cert-manager repository stored in disk to be built and published. This must already be checked out at the appropriate revision.")
 	fs.StringVar(&o.ReleaseVersion, "release-version", "", "Optional release version override used to force the version strings used during the release to a specific value.")
 	fs.StringVar(&o.PublishedImageRepository, "published-image-repo", release.DefaultImageRepository, "The docker image repository set when building the release.")
-	fs.StringVar(&o.SigningKMSKey, "signing-kms-key", defaultKMSKey, "Full name of the GCP KMS key to use for signing")
+	fs.StringSliceVar(&o.SigningKMSKeys, "signing-kms-key", []string{defaultKMSKey}, "Full name of the GCP KMS key to use for signing. May be repeated or given as a comma-separated list to sign with multiple keys, e.g. whilst rotating keys. Empty and duplicate values are ignored.")
 	fs.BoolVar(&o.SkipPush, "skip-push", false, "Skip pushing the staged release to a GCS bucket.")
 	fs.BoolVar(&o.SkipSigning, "skip-signing", false, "Skip signing release artifacts.")
+	fs.StringVar(&o.SigningBackend, "signing-backend", sign.SigningBackendKMS, fmt.Sprintf("The backend used to sign release artifacts. If 'cosign', the %s file is signed using cosign's keyless mode, with the identity of the build's service account, and neither the Helm chart nor the container images are signed. Options: %s", release.ChecksumsFileName, strings.Join(sign.SigningBackends, ", ")))
+	fs.StringVar(&o.CosignPath, "cosign-path", "cosign", "Full path to the cosign binary, used if --signing-backend=cosign. Defaults to searching in $PATH for a binary called 'cosign'")
+	fs.StringVar(&o.GoPath, "go-path", "go", "Full path to the go binary, used to list the modules linked into the release binaries if --sbom-format is set. Defaults to searching in $PATH for a binary called 'go'")
+
+	fs.StringVar(&o.SBOMFormat, "sbom-format", "", fmt.Sprintf("If set, generate an SBOM in the given format and stage it alongside the release artifacts. Options: %s", strings.Join(release.SBOMFormats, ", ")))
+
+	fs.StringVar(&o.Compression, "compression", release.CompressionGzip, fmt.Sprintf("Format to stage the release tarballs in. zstd tarballs are recompressed from the gzip tarballs produced by the build. Options: %s", strings.Join(release.Compressions, ", ")))
+
+	fs.StringVar(&o.ReleaseNotesObject, "release-notes-object", "", fmt.Sprintf("If set, the name of an object in --bucket containing release notes, which are staged alongside the release artifacts as %q.", release.ReleaseNotesFileName))
+
+	fs.StringVar(&o.BuildTags, "build-tags", "", "Optional comma-separated list of additional Go build tags to build the release with.")
+	fs.StringVar(&o.LDFlags, "ldflags", "", "Optional space-separated list of additional Go linker flags to build the release with.")
+	fs.StringVar(&o.GoVersion, "go-version", "", "Optional version of the Go SDK to build the release with, e.g. '1.22.3'. If not set, the SDK registered by the cert-manager repository's WORKSPACE is used.")
+
+	fs.StringVar(&o.BuildID, "build-id", "", "The ID of the GCB build running this command, recorded in the staged release manifest.")
+	fs.StringVar(&o.CmrelVersion, "cmrel-version", "", "The version of cmrel which submitted the GCB build running this command, recorded in the staged release manifest.")
 
 	allOSList := release.AllOSes()
 
 	allOSes := strings.Join(allOSList.List(), ", ")
 	allArches := strings.Join(release.AllArchesForOSes(allOSList).List(), ", ")
 
-	fs.StringVar(&o.TargetOSes, "target-os", "*", fmt.Sprintf("Comma-separated list of OSes to target, or '*' for all. Options: %s", allOSes))
-	fs.StringVar(&o.TargetArches, "target-arch", "*", fmt.Sprintf("Comma-separated list of arches to target, or '*' for all. Options: %s", allArches))
+	fs.StringVar(&o.ArtifactTypes, "artifact-types", "*", fmt.Sprintf("Comma-separated list of the types of artifact to build, or '*' for all. Types prefixed with '!' are excluded, e.g. '*,!charts'. Options: %s", strings.Join(release.ArtifactTypes, ", ")))
+	fs.StringVar(&o.TargetOSes, "target-os", "*", fmt.Sprintf("Comma-separated list of OSes to target, or '*' for all. OSes prefixed with '!' are excluded, e.g. '*,!windows'. Options: %s", allOSes))
+	fs.StringVar(&o.TargetArches, "target-arch", "*", fmt.Sprintf("Comma-separated list of arches to target, or '*' for all. Arches prefixed with '!' are excluded, e.g. '*,!s390x'. Options: %s", allArches))
+	fs.StringVar(&o.Shard, "shard", "", fmt.Sprintf("If set, the name of the shard of a sharded stage build being built. The release metadata, %s and manifest files are staged under shard-specific names and the %s file is not signed, as they're merged and signed once every shard has completed.", release.ChecksumsFileName, release.ChecksumsFileName))
+
+	fs.IntVar(&o.UploadChunkSize, "upload-chunk-size", release.DefaultUploadOptions.ChunkSize, "Size in bytes of each chunk of the resumable uploads used to upload artifacts to GCS, rounded up to a multiple of 256KiB. If 0, each artifact is uploaded in a single request which must be restarted from the beginning if it fails.")
+	fs.IntVar(&o.UploadMaxRetries, "upload-max-retries", release.DefaultUploadOptions.MaxRetries, "Maximum number of times an upload to GCS is restarted if it fails with a transient error.")
 }
 
-func (o *gcbStageOptions) print() {
-	log.Printf("GCB Stage options:")
-	log.Printf("  Bucket: %q", o.Bucket)
-	log.Printf("  RepoPath: %q", o.RepoPath)
-	log.Printf("  SkipPush: %v", o.SkipPush)
-	log.Printf("  SkipSigning: %v", o.SkipSigning)
-	log.Printf("  SigningKMSKey: %q", o.SigningKMSKey)
-	log.Printf("  ReleaseVersion: %q", o.ReleaseVersion)
-	log.Printf("  TargetOSes: %q", o.TargetOSes)
-	log.Printf("  TargetArches: %q", o.TargetArches)
+func (o *gcbStageOptions) print(logger logr.Logger) {
+	logger.Info("GCB Stage options",
+		"Bucket", o.Bucket,
+		"BucketPathPrefix", o.BucketPathPrefix,
+		"RepoPath", o.RepoPath,
+		"SkipPush", o.SkipPush,
+		"SkipSigning", o.SkipSigning,
+		"SigningKMSKeys", o.SigningKMSKeys,
+		"SigningBackend", o.SigningBackend,
+		"CosignPath", o.CosignPath,
+		"GoPath", o.GoPath,
+		"ReleaseVersion", o.ReleaseVersion,
+		"SBOMFormat", o.SBOMFormat,
+		"Compression", o.Compression,
+		"ReleaseNotesObject", o.ReleaseNotesObject,
+		"BuildTags", o.BuildTags,
+		"LDFlags", o.LDFlags,
+		"GoVersion", o.GoVersion,
+		"BuildID", o.BuildID,
+		"CmrelVersion", o.CmrelVersion,
+		"ArtifactTypes", o.ArtifactTypes,
+		"TargetOSes", o.TargetOSes,
+		"TargetArches", o.TargetArches,
+		"Shard", o.Shard,
+		"UploadChunkSize", o.UploadChunkSize,
+		"UploadMaxRetries", o.UploadMaxRetries,
+	)
 }
 
 func gcbStageCmd(rootOpts *rootOptions) *cobra.Command {
@@ -127,31 +239,94 @@ func gcbStageCmd(rootOpts *rootOptions) *cobra.Command {
 		Long:         gcbStageLongDescription,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runGCBStage(rootOpts, o)
 		},
 	}
 	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	mustRegisterFlagCompletionFunc(cmd, "target-os", completeTargetOSes)
+	mustRegisterFlagCompletionFunc(cmd, "target-arch", completeTargetArches(&o.TargetOSes))
 	return cmd
 }
 
 func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	gitRef, err := readGitRef(o.RepoPath)
 	if err != nil {
 		return fmt.Errorf("failed to read git ref from repository: %v", err)
 	}
 
-	if o.SigningKMSKey != "" {
-		if _, err := sign.NewGCPKMSKey(o.SigningKMSKey); err != nil {
+	bucketPathPrefix, err := release.NormalizeBucketPathPrefix(o.BucketPathPrefix)
+	if err != nil {
+		return validationErrorf("invalid --bucket-path-prefix: %w", err)
+	}
+
+	if err := sign.ValidateSigningBackend(o.SigningBackend); err != nil {
+		return err
+	}
+
+	if o.SBOMFormat != "" {
+		if err := release.ValidateSBOMFormat(o.SBOMFormat); err != nil {
 			return err
 		}
 	}
 
+	if err := release.ValidateCompression(o.Compression); err != nil {
+		return validationErrorf("invalid --compression: %w", err)
+	}
+
+	if err := release.ValidateBuildTags(o.BuildTags); err != nil {
+		return validationErrorf("invalid --build-tags: %w", err)
+	}
+
+	if err := release.ValidateLDFlags(o.LDFlags); err != nil {
+		return validationErrorf("invalid --ldflags: %w", err)
+	}
+
+	if err := release.ValidateGoVersion(o.GoVersion); err != nil {
+		return validationErrorf("invalid --go-version: %w", err)
+	}
+
+	if o.Shard != "" {
+		if err := release.ValidateShardName(o.Shard); err != nil {
+			return validationErrorf("invalid --shard: %w", err)
+		}
+	}
+
+	if o.UploadChunkSize < 0 {
+		return validationErrorf("invalid --upload-chunk-size %d: must not be negative", o.UploadChunkSize)
+	}
+
+	if o.UploadMaxRetries < 0 {
+		return validationErrorf("invalid --upload-max-retries %d: must not be negative", o.UploadMaxRetries)
+	}
+
+	uploadOpts := release.UploadOptions{
+		ChunkSize:  o.UploadChunkSize,
+		MaxRetries: o.UploadMaxRetries,
+		BaseDelay:  release.DefaultUploadOptions.BaseDelay,
+	}
+
+	signingKeys, err := sign.NewGCPKMSKeys(o.SigningKMSKeys)
+	if err != nil {
+		return err
+	}
+
+	if !o.SkipSigning && o.SigningBackend == sign.SigningBackendKMS && len(signingKeys) == 0 {
+		return fmt.Errorf("must set signing-kms-key or skip-signing in order to sign artifacts")
+	}
+
+	if !o.SkipSigning && o.SigningBackend == sign.SigningBackendCosign {
+		log.Printf("getting cosign version information")
+		if err := cosign.Version(ctx, o.CosignPath); err != nil {
+			return fmt.Errorf("failed to query cosign version: %w", err)
+		}
+	}
+
 	if o.ReleaseVersion != "" {
 		if err := runGit(o.RepoPath, "tag", "-f", o.ReleaseVersion); err != nil {
 			return err
@@ -170,9 +345,9 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 	// If --release-version is not explicitly set, we treat this build as a
 	// 'devel' build and output into the development directory.
 	if o.ReleaseVersion == "" {
-		outputDir = release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeDevel, releaseVersion, gitRef)
+		outputDir = release.BucketPathForRelease(bucketPathPrefix, release.BuildTypeDevel, releaseVersion, gitRef)
 	} else {
-		outputDir = release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeRelease, releaseVersion, gitRef)
+		outputDir = release.BucketPathForRelease(bucketPathPrefix, release.BuildTypeForVersion(releaseVersion), releaseVersion, gitRef)
 	}
 
 	log.Printf("Built artifacts will be published to 'gs://%s/%s' once complete", o.Bucket, outputDir)
@@ -183,49 +358,60 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 	// This will mean we don't have to update this release tool whenever we add an additional
 	// release artifact.
 
+	artifactTypes, err := release.ArtifactTypesFromString(o.ArtifactTypes)
+	if err != nil {
+		return validationErrorf("invalid --artifact-types list: %w", err)
+	}
+
 	targetOSes, err := release.OSListFromString(o.TargetOSes)
 	if err != nil {
-		return fmt.Errorf("invalid --target-os list: %w", err)
+		return validationErrorf("invalid --target-os list: %w", err)
 	}
 
 	targetArches, err := release.ArchListFromString(o.TargetArches, targetOSes)
 	if err != nil {
-		return fmt.Errorf("invalid --target-arch list: %w", err)
+		return validationErrorf("invalid --target-arch list: %w", err)
 	}
 
 	var artifacts []release.ArtifactMetadata
 
-	for _, osVariant := range targetOSes.List() {
-		for _, arch := range release.ArchitecturesPerOS[osVariant] {
-			if !targetArches.Has(arch) {
-				continue
-			}
+	buildImages := artifactTypes.Has(release.ArtifactTypeImages)
+	buildTarballs := artifactTypes.Has(release.ArtifactTypeTarballs)
+	buildCharts := artifactTypes.Has(release.ArtifactTypeCharts)
 
-			log.Printf("Building %q target for %q OS for %q architecture", release.TarsBazelTarget, osVariant, arch)
+	for _, platform := range release.TargetPlatforms(targetOSes, targetArches) {
+		osVariant, arch := platform.OS, platform.Arch
 
-			if err := runBazel(o.RepoPath, bazelBuildEnv(o), "build", "--stamp", platformFlagForOSArch(osVariant, arch), release.TarsBazelTarget); err != nil {
-				return fmt.Errorf("failed building release artifacts for architecture %q: %w", arch, err)
+		// Skip building for platforms which wouldn't produce any of the
+		// requested artifact types.
+		if !(buildImages && release.IsServerOS(osVariant)) && !(buildTarballs && release.IsClientOS(osVariant)) {
+			continue
+		}
+
+		log.Printf("Building %q target for %q OS for %q architecture", release.TarsBazelTarget, osVariant, arch)
+
+		if err := runBazel(o.RepoPath, bazelBuildEnv(o), bazelBuildArgs(o, platformFlagForOSArch(osVariant, arch), release.TarsBazelTarget)...); err != nil {
+			return fmt.Errorf("failed building release artifacts for architecture %q: %w", arch, err)
+		}
+
+		if buildImages && release.IsServerOS(osVariant) {
+			// add an artifact for the arch specific 'server' release tarball
+			serverArtifactName := release.ServerArtifactName(arch)
+			// Add the arch-specific .tar.gz file to the list of artifacts
+			if err := appendArtifact(&artifacts, o.RepoPath, serverArtifactName, osVariant, arch); err != nil {
+				return err
 			}
+		}
 
-			if release.IsServerOS(osVariant) {
-				// add an artifact for the arch specific 'server' release tarball
-				serverArtifactName := fmt.Sprintf("cert-manager-server-linux-%s.tar.gz", arch)
+		if buildTarballs && release.IsClientOS(osVariant) {
+			// add an artifact for the os and arch specific 'cmctl' and 'kubectl-cert_manager' release tarball
+			for _, kind := range release.ClientArtifactKinds {
+				clientArtifactName := release.ClientArtifactName(kind, osVariant, arch)
 				// Add the arch-specific .tar.gz file to the list of artifacts
-				if err := appendArtifact(&artifacts, o.RepoPath, serverArtifactName, osVariant, arch); err != nil {
+				if err := appendArtifact(&artifacts, o.RepoPath, clientArtifactName, osVariant, arch); err != nil {
 					return err
 				}
 			}
-
-			if release.IsClientOS(osVariant) {
-				// add an artifact for the os and arch specific 'cmctl' and 'kubectl-cert_manager' release tarball
-				for _, kind := range []string{"kubectl-cert_manager", "cmctl"} {
-					clientArtifactName := fmt.Sprintf("cert-manager-%s-%s-%s.tar.gz", kind, osVariant, arch)
-					// Add the arch-specific .tar.gz file to the list of artifacts
-					if err := appendArtifact(&artifacts, o.RepoPath, clientArtifactName, osVariant, arch); err != nil {
-						return err
-					}
-				}
-			}
 		}
 	}
 
@@ -235,16 +421,37 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 			return nil
 		}
 
-		parsedKey, err := sign.NewGCPKMSKey(o.SigningKMSKey)
-		if err != nil {
+		if o.SigningBackend != sign.SigningBackendKMS {
+			log.Printf("skipping signing helm chart in cert-manager-manifests.tar.gz as it requires the %q signing backend", sign.SigningBackendKMS)
+			return nil
+		}
+
+		return sign.CertManagerManifests(ctx, signingKeys, path, o.ReleaseVersion)
+	}
+
+	if buildCharts {
+		// The manifests are built as part of the release tarballs target, so
+		// if no platform-specific artifacts were built it must be run once
+		// for the host platform.
+		if len(artifacts) == 0 {
+			log.Printf("Building %q target to produce %q", release.TarsBazelTarget, release.ManifestsArtifactName)
+			if err := runBazel(o.RepoPath, bazelBuildEnv(o), bazelBuildArgs(o, release.TarsBazelTarget)...); err != nil {
+				return fmt.Errorf("failed building release manifests: %w", err)
+			}
+		}
+
+		// add 'manifests' (helm chart, k8s YAML manifests)
+		if err := appendArtifactWithPostprocess(&artifacts, o.RepoPath, release.ManifestsArtifactName, "", "", manifestPostProcessor); err != nil {
 			return err
 		}
+	}
 
-		return sign.CertManagerManifests(ctx, parsedKey, path, o.ReleaseVersion)
+	if len(artifacts) == 0 {
+		return fmt.Errorf("no artifacts of types %q are built for the targeted OSes and architectures", artifactTypes.List())
 	}
 
-	// add 'manifests' (helm chart, k8s YAML manifests)
-	if err := appendArtifactWithPostprocess(&artifacts, o.RepoPath, "cert-manager-manifests.tar.gz", "", "", manifestPostProcessor); err != nil {
+	artifacts, err = compressArtifacts(artifacts, o.RepoPath, o.Compression)
+	if err != nil {
 		return err
 	}
 
@@ -259,6 +466,87 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 
 	log.Printf("Built release artifacts for all architectures: %v", artifacts)
 
+	artifactPaths := make([]string, len(artifacts))
+	for i, artifact := range artifacts {
+		artifactPaths[i] = buildArtifactPath(o.RepoPath, "build", "release-tars", artifact.Name)
+	}
+
+	// The files generated to be staged alongside the artifacts are written
+	// to a temporary directory, which is removed once they've been uploaded.
+	tmpDir, err := os.MkdirTemp("", "cmrel-gcb-stage-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sbomPath := ""
+	if o.SBOMFormat != "" {
+		sbomPath, err = writeSBOM(tmpDir, o.RepoPath, o.GoPath, o.SBOMFormat, releaseVersion)
+		if err != nil {
+			return fmt.Errorf("failed to generate SBOM: %w", err)
+		}
+		log.Printf("Generated %s SBOM at %q", o.SBOMFormat, sbomPath)
+		artifactPaths = append(artifactPaths, sbomPath)
+	}
+
+	notesPath := ""
+	if o.ReleaseNotesObject != "" {
+		notesPath, err = downloadReleaseNotes(ctx, tmpDir, o.Bucket, o.ReleaseNotesObject)
+		if err != nil {
+			return fmt.Errorf("failed to download release notes: %w", err)
+		}
+		log.Printf("Downloaded release notes from gs://%s/%s to %q", o.Bucket, o.ReleaseNotesObject, notesPath)
+		artifactPaths = append(artifactPaths, notesPath)
+	}
+
+	sums, err := release.ComputeChecksums(artifactPaths)
+	if err != nil {
+		return fmt.Errorf("failed to compute release artifact checksums: %w", err)
+	}
+	checksums := &bytes.Buffer{}
+	if err := release.WriteChecksumsFile(checksums, sums); err != nil {
+		return fmt.Errorf("failed to encode %s file: %w", release.ChecksumsFileName, err)
+	}
+
+	var checksumSignatures []string
+	checksumsSignature := ""
+	switch {
+	case o.SkipSigning:
+	case o.Shard != "":
+		log.Printf("Not signing %s file of shard %q, as it is signed once merged with those of the other shards", release.ChecksumsFileName, o.Shard)
+	case o.SigningBackend == sign.SigningBackendCosign:
+		// cosign can't obtain an identity token itself inside Cloud Build, so
+		// the build's service account is used as the signer's identity
+		identityToken, err := cosign.MetadataIdentityToken()
+		if err != nil {
+			return fmt.Errorf("failed to get an identity for keyless signing: %w", err)
+		}
+		checksumSignatures, err = signChecksumsFile(ctx, tmpDir, cosign.NewKeylessSigner(o.CosignPath, identityToken), checksums.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to sign %s file: %w", release.ChecksumsFileName, err)
+		}
+		for _, sigPath := range checksumSignatures {
+			if filepath.Ext(sigPath) == ".sig" {
+				checksumsSignature = filepath.Base(sigPath)
+			}
+		}
+	case o.SigningBackend == sign.SigningBackendKMS:
+		checksumSignatures, err = signChecksumsFileKMS(ctx, tmpDir, signingKeys, checksums.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to sign %s file: %w", release.ChecksumsFileName, err)
+		}
+		checksumsSignature = release.ChecksumsKMSSignatureFileName(0)
+	}
+
+	manifest, err := buildReleaseManifest(o, releaseVersion, gitRef, outputDir, artifactPaths, artifacts, sums, checksums.Bytes(), checksumsSignature)
+	if err != nil {
+		return fmt.Errorf("failed to build release manifest: %w", err)
+	}
+	manifestData, err := manifest.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode release manifest: %w", err)
+	}
+
 	if o.SkipPush {
 		log.Printf("Skipping pushing staged release as --skip-push=true")
 		return nil
@@ -267,7 +555,16 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 	// Build Google Cloud Storage API client for uploading artifacts
 	gcs, err := storage.NewClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create GCS client: %w", err)
+		return withKind(ErrAPIUnavailable, fmt.Errorf("failed to create GCS client: %w", err))
+	}
+	defer gcs.Close()
+
+	// Every staged object is labelled with the release it belongs to, so
+	// that it can be identified without parsing its path.
+	objectMeta := release.ObjectMetadata{
+		ReleaseVersion: releaseVersion,
+		GitRef:         gitRef,
+		BuildID:        o.BuildID,
 	}
 
 	// Upload all built release artifacts
@@ -275,35 +572,58 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 		filePath := buildArtifactPath(o.RepoPath, "build", "release-tars", artifact.Name)
 		gcsPath := buildObjectName(outputDir, artifact.Name)
 		log.Printf("Uploading artifact %q to GCS at path: %s", artifact, gcsPath)
-		if err := func(filePath, gcsPath string) error {
-			r, err := os.Open(filePath)
-			if err != nil {
-				return err
-			}
-			defer r.Close()
-
-			w := gcs.Bucket(o.Bucket).Object(gcsPath).NewWriter(ctx)
-			if _, err := io.Copy(w, r); err != nil {
-				return err
-			}
-			if err := w.Close(); err != nil {
-				return err
-			}
-			log.Printf("Uploaded artifact %q to GCS", artifact)
-
-			return nil
-		}(filePath, gcsPath); err != nil {
+		if err := uploadFile(ctx, gcs.Bucket(o.Bucket).Object(gcsPath), filePath, objectMeta, uploadOpts); err != nil {
 			return fmt.Errorf("failed to copy output artifact to GCS staging location: %w", err)
 		}
+		log.Printf("Uploaded artifact %q to GCS", artifact)
+	}
+
+	// Each shard of a sharded build writes its own copy of the files which
+	// describe the whole release, to be merged once all shards complete.
+	releaseFileName := func(name string) string {
+		if o.Shard == "" {
+			return name
+		}
+		return release.ShardFileName(name, o.Shard)
 	}
 
 	log.Printf("Uploading release metadata")
-	w := gcs.Bucket(o.Bucket).Object(buildObjectName(outputDir, release.MetadataFileName)).NewWriter(ctx)
-	if _, err := w.Write(meta); err != nil {
+	if err := release.UploadObject(ctx, gcs.Bucket(o.Bucket).Object(buildObjectName(outputDir, releaseFileName(release.MetadataFileName))), bytes.NewReader(meta), objectMeta, uploadOpts); err != nil {
 		return fmt.Errorf("failed to write release metadata to GCS staging location: %w", err)
 	}
-	if err := w.Close(); err != nil {
-		return err
+
+	log.Printf("Uploading %s file", release.ChecksumsFileName)
+	if err := release.UploadObject(ctx, gcs.Bucket(o.Bucket).Object(buildObjectName(outputDir, releaseFileName(release.ChecksumsFileName))), bytes.NewReader(checksums.Bytes()), objectMeta, uploadOpts); err != nil {
+		return fmt.Errorf("failed to write %s file to GCS staging location: %w", release.ChecksumsFileName, err)
+	}
+
+	log.Printf("Uploading %s file", release.ManifestFileName)
+	if err := release.UploadObject(ctx, gcs.Bucket(o.Bucket).Object(buildObjectName(outputDir, releaseFileName(release.ManifestFileName))), bytes.NewReader(manifestData), objectMeta, uploadOpts); err != nil {
+		return fmt.Errorf("failed to write %s file to GCS staging location: %w", release.ManifestFileName, err)
+	}
+
+	if sbomPath != "" {
+		gcsPath := buildObjectName(outputDir, filepath.Base(sbomPath))
+		log.Printf("Uploading SBOM to GCS at path: %s", gcsPath)
+		if err := uploadFile(ctx, gcs.Bucket(o.Bucket).Object(gcsPath), sbomPath, objectMeta, uploadOpts); err != nil {
+			return fmt.Errorf("failed to copy SBOM to GCS staging location: %w", err)
+		}
+	}
+
+	if notesPath != "" {
+		gcsPath := buildObjectName(outputDir, release.ReleaseNotesFileName)
+		log.Printf("Uploading release notes to GCS at path: %s", gcsPath)
+		if err := uploadFile(ctx, gcs.Bucket(o.Bucket).Object(gcsPath), notesPath, objectMeta, uploadOpts); err != nil {
+			return fmt.Errorf("failed to copy release notes to GCS staging location: %w", err)
+		}
+	}
+
+	for _, sigPath := range checksumSignatures {
+		gcsPath := buildObjectName(outputDir, filepath.Base(sigPath))
+		log.Printf("Uploading signature file %q to GCS at path: %s", filepath.Base(sigPath), gcsPath)
+		if err := uploadFile(ctx, gcs.Bucket(o.Bucket).Object(gcsPath), sigPath, objectMeta, uploadOpts); err != nil {
+			return fmt.Errorf("failed to copy signature file to GCS staging location: %w", err)
+		}
 	}
 
 	log.Printf("Successfully staged release with version %q", releaseVersion)
@@ -311,10 +631,183 @@ func runGCBStage(rootOpts *rootOptions, o *gcbStageOptions) error {
 	return nil
 }
 
+// buildReleaseManifest constructs the manifest describing every file staged
+// for the release: each of the artifacts at artifactPaths, which includes any
+// SBOM and release notes, along with the checksums file itself. If
+// checksumsSignature is set, it is recorded as the signature of every file as
+// they are all covered by the signed checksums file.
+func buildReleaseManifest(o *gcbStageOptions, releaseVersion, gitRef, outputDir string, artifactPaths []string, artifacts []release.ArtifactMetadata, sums map[string]string, checksums []byte, checksumsSignature string) (*release.Manifest, error) {
+	platforms := map[string]release.ArtifactMetadata{}
+	for _, artifact := range artifacts {
+		platforms[artifact.Name] = artifact
+	}
+
+	manifest := &release.Manifest{
+		ReleaseVersion: releaseVersion,
+		GitCommitRef:   gitRef,
+		BuildID:        o.BuildID,
+		CmrelVersion:   o.CmrelVersion,
+		Created:        time.Now().UTC(),
+	}
+
+	for _, path := range artifactPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.Base(path)
+		manifest.Artifacts = append(manifest.Artifacts, release.ManifestArtifact{
+			Name:         name,
+			Path:         fmt.Sprintf("gs://%s/%s", o.Bucket, buildObjectName(outputDir, name)),
+			Size:         info.Size(),
+			SHA256:       sums[name],
+			OS:           platforms[name].OS,
+			Architecture: platforms[name].Architecture,
+			Compression:  release.ArtifactCompression(name),
+			Signature:    checksumsSignature,
+		})
+	}
+
+	checksumsSum := sha256.Sum256(checksums)
+	manifest.Artifacts = append(manifest.Artifacts, release.ManifestArtifact{
+		Name:      release.ChecksumsFileName,
+		Path:      fmt.Sprintf("gs://%s/%s", o.Bucket, buildObjectName(outputDir, release.ChecksumsFileName)),
+		Size:      int64(len(checksums)),
+		SHA256:    hex.EncodeToString(checksumsSum[:]),
+		Signature: checksumsSignature,
+	})
+
+	return manifest, nil
+}
+
+// signChecksumsFile writes the given checksums file content to dir and signs
+// it using signer, returning the paths of the files containing the signature.
+func signChecksumsFile(ctx context.Context, dir string, signer sign.Signer, checksums []byte) ([]string, error) {
+	path := filepath.Join(dir, release.ChecksumsFileName)
+	if err := os.WriteFile(path, checksums, 0o644); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Signing %s file", release.ChecksumsFileName)
+	return signer.SignBlob(ctx, path)
+}
+
+// signChecksumsFileKMS signs the given checksums file content with each of the
+// GCP KMS keys, writing each detached signature and the public key which
+// verifies it to dir and returning the paths of the files, named as by
+// release.ChecksumsKMSSignatureFileName and
+// release.ChecksumsKMSPublicKeyFileName.
+func signChecksumsFileKMS(ctx context.Context, dir string, keys []sign.GCPKMSKey, checksums []byte) ([]string, error) {
+	var paths []string
+	for i, key := range keys {
+		log.Printf("Signing %s file with KMS key %q", release.ChecksumsFileName, key)
+		sig, err := sign.SignBytes(ctx, key, checksums)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, err := sign.PublicKeyPEM(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		sigPath := filepath.Join(dir, release.ChecksumsKMSSignatureFileName(i))
+		if err := os.WriteFile(sigPath, sig, 0o644); err != nil {
+			return nil, err
+		}
+
+		pubPath := filepath.Join(dir, release.ChecksumsKMSPublicKeyFileName(i))
+		if err := os.WriteFile(pubPath, pub, 0o644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, sigPath, pubPath)
+	}
+
+	return paths, nil
+}
+
+// downloadReleaseNotes downloads the release notes uploaded by 'stage' to the
+// given object in bucket, writing them to dir and returning their path. The notes are checked to be non-empty, as they are
+// when uploaded.
+func downloadReleaseNotes(ctx context.Context, dir, bucket, objectName string) (string, error) {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+
+	path := filepath.Join(dir, release.ReleaseNotesFileName)
+	if err := release.DownloadObject(ctx, gcs.Bucket(bucket).Object(objectName), path); err != nil {
+		return "", err
+	}
+	if _, err := release.InspectReleaseNotes(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeSBOM generates an SBOM in the given format for the binaries built from
+// the cert-manager repository at repoPath, listing the modules they link
+// using the go command at goPath, writing it to dir and returning its path.
+func writeSBOM(dir, repoPath, goPath, format, releaseVersion string) (string, error) {
+	sbom, err := release.GenerateSBOM(release.SBOMOptions{
+		RepoPath:  repoPath,
+		Packages:  release.SBOMPackages,
+		GoCommand: goPath,
+		Format:    format,
+		Name:      "cert-manager",
+		Version:   releaseVersion,
+		Created:   time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, release.SBOMFileName(format))
+	if err := os.WriteFile(path, sbom, 0o644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// uploadFile copies the local file at filePath to the given GCS object,
+// setting meta as its metadata.
+func uploadFile(ctx context.Context, obj *storage.ObjectHandle, filePath string, meta release.ObjectMetadata, opts release.UploadOptions) error {
+	r, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return release.UploadObject(ctx, obj, r, meta, opts)
+}
+
 func bazelBuildEnv(opts *gcbStageOptions) []string {
 	return append(os.Environ(), "DOCKER_REGISTRY="+opts.PublishedImageRepository)
 }
 
+// bazelBuildArgs returns the arguments to run a stamped 'bazel build' with
+// the given additional arguments, passing any extra Go build tags, linker
+// flags and Go SDK version on to rules_go.
+func bazelBuildArgs(opts *gcbStageOptions, args ...string) []string {
+	buildArgs := []string{"build", "--stamp"}
+	if opts.BuildTags != "" {
+		buildArgs = append(buildArgs, "--@io_bazel_rules_go//go/config:tags="+opts.BuildTags)
+	}
+	// rules_go takes a comma-separated list of linker flags
+	if ldflags := strings.Fields(opts.LDFlags); len(ldflags) > 0 {
+		buildArgs = append(buildArgs, "--@io_bazel_rules_go//go/config:gc_linkopts="+strings.Join(ldflags, ","))
+	}
+	// the SDK must also be registered by the WORKSPACE, e.g. with
+	// go_download_sdk, for rules_go to select it
+	if opts.GoVersion != "" {
+		buildArgs = append(buildArgs, "--@io_bazel_rules_go//go/toolchain:sdk_version="+opts.GoVersion)
+	}
+	return append(buildArgs, args...)
+}
+
 // build an artifact using the given name, and append it to the given list after running
 // postprocess to modify it in-place; postprocessing requires the path to the artifact
 func appendArtifactWithPostprocess(artifacts *[]release.ArtifactMetadata, repoPath, name, os, arch string, postprocess postprocessFunc) error {
@@ -342,6 +835,33 @@ func appendArtifactWithPostprocess(artifacts *[]release.ArtifactMetadata, repoPa
 	return nil
 }
 
+// compressArtifacts returns the artifacts to stage in the formats given by
+// compression. The gzip tarballs produced by the build are recompressed with
+// zstd alongside the originals, and are left out if only zstd tarballs are
+// staged.
+func compressArtifacts(artifacts []release.ArtifactMetadata, repoPath, compression string) ([]release.ArtifactMetadata, error) {
+	var out []release.ArtifactMetadata
+	for _, format := range release.CompressionFormats(compression) {
+		if format == release.CompressionGzip {
+			out = append(out, artifacts...)
+			continue
+		}
+
+		for _, artifact := range artifacts {
+			name := release.ZstdArtifactName(artifact.Name)
+			log.Printf("Recompressing %q as %q", artifact.Name, name)
+			src := buildArtifactPath(repoPath, "build", "release-tars", artifact.Name)
+			if err := release.RecompressZstd(src, buildArtifactPath(repoPath, "build", "release-tars", name)); err != nil {
+				return nil, err
+			}
+			if err := appendArtifact(&out, repoPath, name, artifact.OS, artifact.Architecture); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
 // build an artifact using the given name, and append it to the given list
 func appendArtifact(artifacts *[]release.ArtifactMetadata, repoPath, name, os, arch string) error {
 	return appendArtifactWithPostprocess(artifacts, repoPath, name, os, arch, nil)
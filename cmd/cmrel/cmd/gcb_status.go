@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"google.golang.org/api/cloudbuild/v1"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	gcbStatusCommand         = "status"
+	gcbStatusDescription     = "Inspect the status of an existing Google Cloud Build job"
+	gcbStatusLongDescription = `The status command will fetch an existing Google Cloud Build job by ID and
+print its status, timing and log URL.
+
+If --wait is specified, the command will wait for the build to complete before
+printing its final status. This can be used to reconnect to a build started by
+a previous invocation of a command such as 'stage'.
+
+The command exits with an error if the build has completed unsuccessfully.
+`
+)
+
+var (
+	gcbStatusExample = fmt.Sprintf(`
+To wait for the build with ID 'abc-123' to complete, run:
+
+	%s %s %s --id=abc-123 --wait`, rootCommand, gcbCommand, gcbStatusCommand)
+)
+
+// gcbStatusResult is printed to stdout when the status command is run with
+// --output=json.
+type gcbStatusResult struct {
+	BuildID    string `json:"buildID"`
+	LogURL     string `json:"logURL"`
+	Status     string `json:"status"`
+	StartTime  string `json:"startTime,omitempty"`
+	FinishTime string `json:"finishTime,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+}
+
+type gcbStatusOptions struct {
+	// ID is the ID of the GCB build to inspect
+	ID string
+
+	// Project is the name of the GCP project the GCB job was run in
+	Project string
+
+	// Wait, if true, will wait for the build to complete before printing its
+	// status
+	Wait bool
+
+	// PollInterval is the delay before the build is first polled when Wait
+	// is set, doubling after each poll up to PollMaxInterval
+	PollInterval time.Duration
+
+	// PollMaxInterval is the longest delay between polls of the build
+	PollMaxInterval time.Duration
+}
+
+func (o *gcbStatusOptions) pollOptions() gcb.PollOptions {
+	return gcb.PollOptions{Interval: o.PollInterval, MaxInterval: o.PollMaxInterval}
+}
+
+func (o *gcbStatusOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.ID, "id", "", "The ID of the GCB build to inspect. Builds run in a private worker pool must be specified using their full resource name, as printed by the stage command.")
+	fs.StringVar(&o.Project, "project", release.DefaultReleaseProject, "The GCP project the GCB build job was run in.")
+	fs.BoolVar(&o.Wait, "wait", false, "If true, wait for the build to complete before printing its status.")
+	fs.DurationVar(&o.PollInterval, "poll-interval", gcb.DefaultPollOptions.Interval, "Delay before first polling the status of the build when --wait is set, doubled after each poll up to --poll-max-interval.")
+	fs.DurationVar(&o.PollMaxInterval, "poll-max-interval", gcb.DefaultPollOptions.MaxInterval, "Longest delay between polls of the status of the build when --wait is set.")
+	markRequired("id")
+}
+
+func (o *gcbStatusOptions) print(logger logr.Logger) {
+	logger.Info("GCB Status options",
+		"ID", o.ID,
+		"Project", o.Project,
+		"Wait", o.Wait,
+		"PollInterval", o.PollInterval,
+		"PollMaxInterval", o.PollMaxInterval,
+	)
+}
+
+func gcbStatusCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &gcbStatusOptions{}
+	cmd := &cobra.Command{
+		Use:          gcbStatusCommand,
+		Short:        gcbStatusDescription,
+		Long:         gcbStatusLongDescription,
+		Example:      gcbStatusExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGCBStatus(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runGCBStatus(rootOpts *rootOptions, o *gcbStatusOptions) error {
+	if err := o.pollOptions().Validate(); err != nil {
+		return validationErrorf("invalid --poll-interval or --poll-max-interval: %w", err)
+	}
+
+	rootCtx, cancel := rootOpts.context()
+	defer cancel()
+	ctx, stop := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("DEBUG: building google cloud build API client")
+	svc, err := gcb.NewService(ctx, "", gcb.DefaultRetryOptions)
+	if err != nil {
+		return fmt.Errorf("error building google cloud build API client: %w", err)
+	}
+
+	var build *cloudbuild.Build
+	if o.Wait {
+		rootOpts.progressLogger().Info(fmt.Sprintf("Waiting for build %q to complete", o.ID))
+		build, err = gcb.WaitForBuildWithProgress(ctx, svc, o.Project, o.ID, o.pollOptions(), rootOpts.stepProgress())
+	} else {
+		build, err = gcb.GetBuild(ctx, svc, o.Project, o.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching build %q: %w", o.ID, err)
+	}
+
+	result, err := gcb.NewBuildResult(build)
+	if err != nil {
+		return fmt.Errorf("error summarising build %q: %w", o.ID, err)
+	}
+
+	logBuildStatus(result)
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(newGCBStatusResult(result)); err != nil {
+			return err
+		}
+	}
+
+	if gcb.IsTerminal(result.Status) && !result.Succeeded() {
+		return fmt.Errorf("build %q finished with status %q", build.Id, result.Status)
+	}
+
+	return nil
+}
+
+// newGCBStatusResult returns the JSON representation of result printed by
+// the status and cancel commands.
+func newGCBStatusResult(result *gcb.BuildResult) gcbStatusResult {
+	out := gcbStatusResult{
+		BuildID: result.Build.Id,
+		LogURL:  result.Build.LogUrl,
+		Status:  result.Status,
+	}
+	if !result.StartTime.IsZero() {
+		out.StartTime = result.StartTime.Format(time.RFC3339)
+	}
+	if !result.FinishTime.IsZero() {
+		out.FinishTime = result.FinishTime.Format(time.RFC3339)
+		out.Duration = result.Duration.Round(time.Second).String()
+	}
+	return out
+}
+
+// logBuildStatus will log the status, timing and log URL of a build, which
+// may still be in progress.
+func logBuildStatus(result *gcb.BuildResult) {
+	log.Printf("Build %q", result.Build.Id)
+	log.Printf("  Status: %s", result.Status)
+	if !result.StartTime.IsZero() {
+		log.Printf("  Started: %s", result.StartTime.Format(time.RFC3339))
+	}
+	if !result.FinishTime.IsZero() {
+		log.Printf("  Finished: %s (took %s)", result.FinishTime.Format(time.RFC3339), result.Duration.Round(time.Second))
+	} else if !result.StartTime.IsZero() {
+		log.Printf("  Running for: %s", time.Since(result.StartTime).Round(time.Second))
+	}
+	if slowest := result.SlowestStep(); slowest != nil && slowest.Duration > 0 {
+		log.Printf("  Slowest step: %q (%s)", slowest.Name, slowest.Duration.Round(time.Second))
+	}
+	log.Printf("  Logs: %s", result.Build.LogUrl)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	listCommand         = "list"
+	listDescription     = "List all builds in the GCS staging bucket, including development builds"
+	listLongDescription = `The list command will enumerate all objects in the staging bucket and print a
+summary of each staged build, including its version and git commit ref, when it
+was last uploaded and its total size. Builds are sorted with the most recently
+uploaded first.
+
+Unlike the 'staged' command, the metadata of each build is not downloaded, so
+builds which are incomplete or failed to upload are also listed.
+`
+
+	// buildTypeAll is accepted by --build-type to list builds of all types.
+	buildTypeAll = "all"
+)
+
+var (
+	listExample = fmt.Sprintf(`
+To list all development builds in the default staging bucket, run:
+
+	%s %s --build-type=devel`, rootCommand, listCommand)
+)
+
+// listResult is printed to stdout for each build when the list command is
+// run with --output=json.
+type listResult struct {
+	Name           string    `json:"name"`
+	BuildType      string    `json:"buildType"`
+	ReleaseVersion string    `json:"releaseVersion,omitempty"`
+	GitRef         string    `json:"gitRef"`
+	Objects        int       `json:"objects"`
+	Size           int64     `json:"size"`
+	Updated        time.Time `json:"updated"`
+}
+
+type listOptions struct {
+	// The name of the GCS bucket containing the staged builds
+	Bucket string
+
+	// BuildType is the type of build to list, one of 'release', 'devel' or
+	// 'all'
+	BuildType string
+}
+
+func (o *listOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the staged builds.")
+	fs.StringVar(&o.BuildType, "build-type", buildTypeAll, fmt.Sprintf("The type of build to list, one of %q, %q, %q or %q.", release.BuildTypeRelease, release.BuildTypePrerelease, release.BuildTypeDevel, buildTypeAll))
+}
+
+func (o *listOptions) print(logger logr.Logger) {
+	logger.Info("List options",
+		"Bucket", o.Bucket,
+		"BuildType", o.BuildType,
+	)
+}
+
+func listCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &listOptions{}
+	cmd := &cobra.Command{
+		Use:          listCommand,
+		Short:        listDescription,
+		Long:         listLongDescription,
+		Example:      listExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runList(rootOpts *rootOptions, o *listOptions) error {
+	var buildTypes []string
+	switch o.BuildType {
+	case buildTypeAll:
+		buildTypes = []string{release.BuildTypeRelease, release.BuildTypePrerelease, release.BuildTypeDevel}
+	case release.BuildTypeRelease, release.BuildTypePrerelease, release.BuildTypeDevel:
+		buildTypes = []string{o.BuildType}
+	default:
+		return validationErrorf("invalid --build-type %q, must be one of %q, %q, %q or %q", o.BuildType, release.BuildTypeRelease, release.BuildTypePrerelease, release.BuildTypeDevel, buildTypeAll)
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	var summaries []release.Summary
+	for _, buildType := range buildTypes {
+		bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, buildType)
+		s, err := bucket.ListSummaries(ctx)
+		if err != nil {
+			return fmt.Errorf("failed listing %s builds: %w", buildType, err)
+		}
+		summaries = append(summaries, s...)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Updated.After(summaries[j].Updated)
+	})
+
+	if rootOpts.Output == outputJSON {
+		results := make([]listResult, len(summaries))
+		for i, s := range summaries {
+			results[i] = listResult{
+				Name:           s.Name,
+				BuildType:      s.BuildType,
+				ReleaseVersion: s.ReleaseVersion,
+				GitRef:         s.GitRef,
+				Objects:        s.Objects,
+				Size:           s.Size,
+				Updated:        s.Updated,
+			}
+		}
+		return printJSON(results)
+	}
+
+	lines := []string{"TYPE\tVERSION\tGIT REF\tUPLOADED\tOBJECTS\tSIZE"}
+	for _, s := range summaries {
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%s", s.BuildType, s.ReleaseVersion, s.GitRef, s.Updated.Format(time.RFC3339), s.Objects, formatBytes(s.Size)))
+	}
+
+	logTable(lines...)
+
+	return nil
+}
+
+// formatBytes formats a size in bytes as a human readable string using
+// binary (1024-based) units, e.g. 1.5 MiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
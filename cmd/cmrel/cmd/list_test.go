@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[string]struct {
+		size int64
+		exp  string
+	}{
+		"bytes":     {size: 512, exp: "512 B"},
+		"kibibytes": {size: 1536, exp: "1.5 KiB"},
+		"mebibytes": {size: 10 * 1024 * 1024, exp: "10.0 MiB"},
+		"gibibytes": {size: 3 * 1024 * 1024 * 1024, exp: "3.0 GiB"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := formatBytes(test.size); got != test.exp {
+				t.Errorf("unexpected output: got=%q, exp=%q", got, test.exp)
+			}
+		})
+	}
+}
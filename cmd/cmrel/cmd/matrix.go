@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	matrixCommand         = "matrix"
+	matrixDescription     = "Print the OSes and architectures a release can target"
+	matrixLongDescription = `The matrix command will print every OS which a release can be built for, along
+with the architectures which are valid for that OS and which of them server
+images and client binaries are built for.
+
+These are the values accepted by the --target-os and --target-arch flags of
+commands such as 'stage'. Use --output=json to enumerate them from scripts.
+`
+)
+
+// matrixEntry is a single row of the output of the matrix command, which is
+// printed as a JSON array when run with --output=json.
+type matrixEntry struct {
+	OS           string   `json:"os"`
+	Arches       []string `json:"arches"`
+	ServerArches []string `json:"serverArches"`
+	ClientArches []string `json:"clientArches"`
+}
+
+func matrixCmd(rootOpts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          matrixCommand,
+		Short:        matrixDescription,
+		Long:         matrixLongDescription,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMatrix(rootOpts)
+		},
+	}
+	return cmd
+}
+
+func runMatrix(rootOpts *rootOptions) error {
+	matrix := platformMatrix()
+
+	lines := []string{"OS\tARCHES\tSERVER\tCLIENT"}
+	for _, entry := range matrix {
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s", entry.OS, joinOrNone(entry.Arches), joinOrNone(entry.ServerArches), joinOrNone(entry.ClientArches)))
+	}
+	logTable(lines...)
+
+	if rootOpts.Output == outputJSON {
+		return printJSON(matrix)
+	}
+
+	return nil
+}
+
+// platformMatrix returns an entry for each OS returned by release.AllOSes,
+// sorted by OS, listing the architectures which can be targeted on it.
+func platformMatrix() []matrixEntry {
+	var matrix []matrixEntry
+	for _, os := range release.AllOSes().List() {
+		matrix = append(matrix, matrixEntry{
+			OS:           os,
+			Arches:       release.AllArchesForOSes(sets.NewString(os)).List(),
+			ServerArches: sets.NewString(release.ServerPlatforms[os]...).List(),
+			ClientArches: sets.NewString(release.ClientPlatforms[os]...).List(),
+		})
+	}
+	return matrix
+}
+
+// joinOrNone returns the comma-separated list of values, or "-" if there are
+// none.
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
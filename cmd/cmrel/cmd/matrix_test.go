@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlatformMatrix(t *testing.T) {
+	matrix := platformMatrix()
+
+	entries := map[string]matrixEntry{}
+	var oses []string
+	for _, entry := range matrix {
+		entries[entry.OS] = entry
+		oses = append(oses, entry.OS)
+	}
+
+	if exp := []string{"darwin", "freebsd", "linux", "windows"}; !reflect.DeepEqual(oses, exp) {
+		t.Fatalf("unexpected OSes: got=%q, exp=%q", oses, exp)
+	}
+
+	tests := map[string]matrixEntry{
+		"linux": {
+			OS:           "linux",
+			Arches:       []string{"amd64", "arm", "arm64", "ppc64le", "s390x"},
+			ServerArches: []string{"amd64", "arm", "arm64", "ppc64le", "s390x"},
+			ClientArches: []string{"amd64", "arm", "arm64", "ppc64le", "s390x"},
+		},
+		"windows": {
+			OS:           "windows",
+			Arches:       []string{"amd64"},
+			ServerArches: []string{},
+			ClientArches: []string{"amd64"},
+		},
+	}
+
+	for os, exp := range tests {
+		t.Run(os, func(t *testing.T) {
+			if got := entries[os]; !reflect.DeepEqual(got, exp) {
+				t.Errorf("unexpected entry:\ngot: %+v\nexp: %+v", got, exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	pathCommand         = "path"
+	pathDescription     = "Print the bucket path a build is staged to"
+	pathLongDescription = `The path command will print the path within the bucket that a build of the
+given version and git commit ref is staged to, exactly as computed by the
+stage command, without running a build or accessing the bucket.
+
+If --build-type is not set, it is 'release' if --release-version is set and
+'devel' otherwise. If --qualified is set, the full gs:// URL of the path in
+--bucket is printed instead.
+`
+)
+
+var (
+	pathExample = fmt.Sprintf(`
+To print the path the v1.6.0 release built at commit 6d3ce5e is staged to, run:
+
+	%s %s --release-version=v1.6.0 --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0
+
+To print the gs:// URL of the development build of the same commit, run:
+
+	%s %s --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0 --qualified`, rootCommand, pathCommand, rootCommand, pathCommand)
+)
+
+// pathResult is printed to stdout when the path command is run with
+// --output=json.
+type pathResult struct {
+	BuildType string `json:"buildType"`
+	Bucket    string `json:"bucket"`
+	Path      string `json:"path"`
+	URL       string `json:"url"`
+}
+
+type pathOptions struct {
+	// The name of the GCS bucket the build is staged to
+	Bucket string
+
+	// BucketPathPrefix is the path within the bucket under which the build
+	// is staged
+	BucketPathPrefix string
+
+	// BuildType is the type of the build, one of 'release' or 'devel'. If
+	// not set, it is inferred from ReleaseVersion
+	BuildType string
+
+	// ReleaseVersion is the version of the release, which must be set for
+	// release builds
+	ReleaseVersion string
+
+	// GitRef is the commit ref the build is built from
+	GitRef string
+
+	// Qualified, if true, prints the full gs:// URL of the path
+	Qualified bool
+}
+
+func (o *pathOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket the build is staged to, used with --qualified.")
+	fs.StringVar(&o.BucketPathPrefix, "bucket-path-prefix", release.DefaultBucketPathPrefix, "The path within the bucket under which the build is staged, as passed to 'stage'.")
+	fs.StringVar(&o.BuildType, "build-type", "", fmt.Sprintf("The type of the build, one of %q, %q or %q. If not set, it is %q if --release-version is set to a version with a prerelease component such as v1.6.0-beta.0, %q if --release-version is otherwise set and %q if not.", release.BuildTypeRelease, release.BuildTypePrerelease, release.BuildTypeDevel, release.BuildTypePrerelease, release.BuildTypeRelease, release.BuildTypeDevel))
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The version of the release. Required for release builds, and can't be set for devel builds.")
+	fs.StringVar(&o.GitRef, "git-ref", "", "The git commit ref that the build is built from.")
+	fs.BoolVar(&o.Qualified, "qualified", false, "If true, print the full gs:// URL of the path in --bucket rather than the path within the bucket.")
+	markRequired("git-ref")
+}
+
+func (o *pathOptions) print(logger logr.Logger) {
+	logger.Info("Path options",
+		"Bucket", o.Bucket,
+		"BucketPathPrefix", o.BucketPathPrefix,
+		"BuildType", o.BuildType,
+		"ReleaseVersion", o.ReleaseVersion,
+		"GitRef", o.GitRef,
+		"Qualified", o.Qualified,
+	)
+}
+
+func pathCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &pathOptions{}
+	cmd := &cobra.Command{
+		Use:          pathCommand,
+		Short:        pathDescription,
+		Long:         pathLongDescription,
+		Example:      pathExample,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPath(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runPath(rootOpts *rootOptions, o *pathOptions) error {
+	result, err := resolveBucketPath(o)
+	if err != nil {
+		return err
+	}
+
+	if rootOpts.Output == outputJSON {
+		return printJSON(result)
+	}
+
+	// the path is printed to stdout, rather than logged, so that it can be
+	// captured by scripts
+	if o.Qualified {
+		fmt.Println(result.URL)
+	} else {
+		fmt.Println(result.Path)
+	}
+	return nil
+}
+
+// resolveBucketPath validates the options and returns the path they describe.
+func resolveBucketPath(o *pathOptions) (*pathResult, error) {
+	bucketPathPrefix, err := release.NormalizeBucketPathPrefix(o.BucketPathPrefix)
+	if err != nil {
+		return nil, validationErrorf("invalid --bucket-path-prefix: %w", err)
+	}
+
+	buildType := o.BuildType
+	if buildType == "" {
+		buildType = release.BuildTypeForVersion(o.ReleaseVersion)
+	}
+
+	switch buildType {
+	case release.BuildTypeRelease, release.BuildTypePrerelease:
+		if o.ReleaseVersion == "" {
+			return nil, validationErrorf("--release-version must be set for %s builds", buildType)
+		}
+		if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+			return nil, validationErrorf("invalid --release-version: %w", err)
+		}
+	case release.BuildTypeDevel:
+		if o.ReleaseVersion != "" {
+			return nil, validationErrorf("--release-version can't be set for %s builds", buildType)
+		}
+	default:
+		return nil, validationErrorf("invalid --build-type %q, must be one of: %s, %s, %s", buildType, release.BuildTypeRelease, release.BuildTypePrerelease, release.BuildTypeDevel)
+	}
+
+	path := release.BucketPathForRelease(bucketPathPrefix, buildType, o.ReleaseVersion, o.GitRef)
+	return &pathResult{
+		BuildType: buildType,
+		Bucket:    o.Bucket,
+		Path:      path,
+		URL:       fmt.Sprintf("gs://%s/%s", o.Bucket, path),
+	}, nil
+}
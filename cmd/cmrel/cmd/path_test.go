@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestResolveBucketPath(t *testing.T) {
+	tests := map[string]struct {
+		opts      pathOptions
+		expected  string
+		expectErr bool
+	}{
+		"devel build is inferred": {
+			opts:     pathOptions{BucketPathPrefix: "stage/gcb", GitRef: "abc"},
+			expected: "stage/gcb/devel/abc",
+		},
+		"release build is inferred": {
+			opts:     pathOptions{BucketPathPrefix: "stage/gcb", ReleaseVersion: "v1.6.0", GitRef: "abc"},
+			expected: "stage/gcb/release/v1.6.0-abc",
+		},
+		"prerelease build is inferred": {
+			opts:     pathOptions{BucketPathPrefix: "stage/gcb", ReleaseVersion: "v1.15.0-beta.0", GitRef: "abc"},
+			expected: "stage/gcb/prerelease/v1.15.0-beta.0-abc",
+		},
+		"explicit release build with normalized prefix": {
+			opts:     pathOptions{BucketPathPrefix: "/stage/gcb/", BuildType: "release", ReleaseVersion: "v1.6.0", GitRef: "abc"},
+			expected: "stage/gcb/release/v1.6.0-abc",
+		},
+		"release build without a version": {
+			opts:      pathOptions{BucketPathPrefix: "stage/gcb", BuildType: "release", GitRef: "abc"},
+			expectErr: true,
+		},
+		"devel build with a version": {
+			opts:      pathOptions{BucketPathPrefix: "stage/gcb", BuildType: "devel", ReleaseVersion: "v1.6.0", GitRef: "abc"},
+			expectErr: true,
+		},
+		"invalid build type": {
+			opts:      pathOptions{BucketPathPrefix: "stage/gcb", BuildType: "nightly", GitRef: "abc"},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.opts.Bucket = "bucket"
+			result, err := resolveBucketPath(&test.opts)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("expected an error but got path %q", result.Path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Path != test.expected || result.URL != "gs://bucket/"+test.expected {
+				t.Errorf("expected path %q but got %+v", test.expected, result)
+			}
+		})
+	}
+}
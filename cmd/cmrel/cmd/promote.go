@@ -0,0 +1,483 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	promoteCommand         = "promote"
+	promoteDescription     = "Promote a staged release to a public release bucket"
+	promoteLongDescription = `The promote command will copy the artifacts of a previously staged
+release from the staging bucket into a public release bucket.
+
+The staged release is located using the given release version and git commit
+ref, and all artifacts named in its metadata file must be present before any
+objects are copied. The staged release must also pass the same checks as the
+'validate' command, so the --artifact-types, --target-os, --target-arch,
+--signing-backend, --signing-kms-key, --skip-signing and --sbom-format flags
+should match those used when the release was staged. Every file which those
+checks expect, including the checksums file and its signatures, is promoted
+along with the artifacts. Objects are copied server-side within Google Cloud
+Storage.
+
+The command will refuse to overwrite a release version which has already been
+promoted unless --force is specified.
+
+Once promoted, a record of who promoted the release, from which git ref and
+build, and when, is appended to the promotion log at releases/promotions.jsonl
+in the release bucket. Each record includes the checksum of the log before it
+was appended, so that any later modification of the log can be detected.
+
+If --create-tag is set, an annotated git tag named after the release version
+is created in the GitHub repository given by --org and --repo, pointing at
+--git-ref, once the release has been promoted. Promotion is refused before
+any objects are copied if the tag already exists, unless --force-tag is set.
+A GitHub token with permission to push to the repository is required.
+
+If --dry-run is set the staged release is checked as usual and every object
+which would be copied is listed along with its size and whether it already
+exists in the release bucket, but nothing is copied, tagged or recorded in
+the promotion log.
+`
+)
+
+var (
+	promoteExample = fmt.Sprintf(`
+To promote the staged v1.6.0 release built at commit 6d3ce5e into the 'my-public-bucket' bucket, run:
+
+	%s %s --release-version=v1.6.0 --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0 --release-bucket=my-public-bucket`, rootCommand, promoteCommand)
+)
+
+// promoteResult is printed to stdout when the promote command is run with
+// --output=json.
+type promoteResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Forced      bool   `json:"forced"`
+	TagSHA      string `json:"tagSHA,omitempty"`
+
+	// DryRun is true if nothing was promoted as --dry-run was set, in which
+	// case Copies lists the copies which would have been made.
+	DryRun bool                    `json:"dryRun,omitempty"`
+	Copies []release.PromotionCopy `json:"copies,omitempty"`
+}
+
+type promoteOptions struct {
+	// The name of the GCS bucket containing the staged release
+	Bucket string
+
+	// The name of the GCS bucket to promote the release to
+	ReleaseBucket string
+
+	// ReleaseVersion is the version of the staged release to promote
+	ReleaseVersion string
+
+	// GitRef is the commit ref that the staged release was built from
+	GitRef string
+
+	// Force, if true, will overwrite a release that has already been promoted
+	Force bool
+
+	// PromotedBy identifies who is promoting the release, and is recorded in
+	// the promotion log
+	PromotedBy string
+
+	// CreateTag, if true, will create an annotated git tag for the release
+	// version at GitRef once the release has been promoted
+	CreateTag bool
+
+	// ForceTag, if true, will move an existing git tag for the release
+	// version instead of refusing to promote the release
+	ForceTag bool
+
+	// Name of the GitHub org of the repository to create the tag in
+	Org string
+
+	// Name of the GitHub repo to create the tag in
+	Repo string
+
+	// GitHubToken is used to authenticate requests to the GitHub API when
+	// creating the tag. If not set, the GITHUB_TOKEN environment variable is
+	// used.
+	GitHubToken string
+
+	// GitHubBaseURL is the base URL of the GitHub API used to create the
+	// tag, for repositories hosted on GitHub Enterprise.
+	GitHubBaseURL string
+
+	// DryRun, if true, will list the objects which would be copied without
+	// promoting the release
+	DryRun bool
+
+	stagedFileOptions
+}
+
+func (o *promoteOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the staged release.")
+	fs.StringVar(&o.ReleaseBucket, "release-bucket", "", "The name of the GCS bucket to promote the release to.")
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The version of the staged release to promote.")
+	fs.StringVar(&o.GitRef, "git-ref", "", "The git commit ref that the staged release was built from.")
+	fs.BoolVar(&o.Force, "force", false, "If true, overwrite the release in the release bucket if it has already been promoted.")
+	fs.StringVar(&o.PromotedBy, "promoted-by", "", "Identifies who is promoting the release in the promotion log. Defaults to the name of the current user.")
+	fs.BoolVar(&o.CreateTag, "create-tag", false, "If true, create an annotated git tag named after --release-version at --git-ref in the GitHub repository once the release has been promoted. Requires a GitHub token.")
+	fs.BoolVar(&o.ForceTag, "force-tag", false, "If true, move the git tag created by --create-tag if it already exists instead of refusing to promote the release.")
+	fs.StringVar(&o.Org, "org", "jetstack", "Name of the GitHub org of the repository to create the git tag in.")
+	fs.StringVar(&o.Repo, "repo", "cert-manager", "Name of the GitHub repo to create the git tag in.")
+	fs.StringVar(&o.GitHubToken, "github-token", "", "GitHub token used to create the git tag if --create-tag is set. Defaults to the value of the GITHUB_TOKEN environment variable.")
+	fs.StringVar(&o.GitHubBaseURL, "github-base-url", release.DefaultGitHubAPIURL, "Base URL of the GitHub API used to create the git tag. For GitHub Enterprise, the host's URL may be given and '/api/v3' will be appended.")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "If true, check the staged release and print every object which would be copied to the release bucket without copying anything.")
+	o.stagedFileOptions.AddFlags(fs)
+	markRequired("release-bucket")
+	markRequired("release-version")
+	markRequired("git-ref")
+}
+
+func (o *promoteOptions) print(logger logr.Logger) {
+	logger.Info("Promote options", append([]interface{}{
+		"Bucket", o.Bucket,
+		"ReleaseBucket", o.ReleaseBucket,
+		"ReleaseVersion", o.ReleaseVersion,
+		"GitRef", o.GitRef,
+		"Force", o.Force,
+		"PromotedBy", o.PromotedBy,
+		"CreateTag", o.CreateTag,
+		"ForceTag", o.ForceTag,
+		"Org", o.Org,
+		"Repo", o.Repo,
+		"GitHubBaseURL", o.GitHubBaseURL,
+		"DryRun", o.DryRun,
+	}, o.stagedFileOptions.keysAndValues()...)...)
+}
+
+func promoteCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &promoteOptions{}
+	cmd := &cobra.Command{
+		Use:          promoteCommand,
+		Short:        promoteDescription,
+		Long:         promoteLongDescription,
+		Example:      promoteExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPromote(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	mustRegisterFlagCompletionFunc(cmd, "target-os", completeTargetOSes)
+	mustRegisterFlagCompletionFunc(cmd, "target-arch", completeTargetArches(&o.TargetOSes))
+	return cmd
+}
+
+func runPromote(rootOpts *rootOptions, o *promoteOptions) error {
+	expected, err := expectedStagedFiles(&o.stagedFileOptions)
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := expectedStagedArtifacts(&o.stagedFileOptions)
+	if err != nil {
+		return err
+	}
+
+	promotedBy := o.PromotedBy
+	if promotedBy == "" {
+		promotedBy, err = currentUserName()
+		if err != nil {
+			return fmt.Errorf("failed to determine the current user, set --promoted-by: %w", err)
+		}
+	}
+
+	if o.ForceTag && !o.CreateTag {
+		return validationErrorf("--force-tag can only be used with --create-tag")
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+
+	var tagger *releaseTagger
+	if o.CreateTag {
+		if tagger, err = newReleaseTagger(ctx, o); err != nil {
+			return err
+		}
+	}
+
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return withKind(ErrAPIUnavailable, fmt.Errorf("failed to create GCS client: %w", err))
+	}
+	defer gcs.Close()
+
+	buildType := release.BuildTypeForVersion(o.ReleaseVersion)
+	stagedPath := release.BucketPathForRelease(release.DefaultBucketPathPrefix, buildType, o.ReleaseVersion, o.GitRef)
+	log.Printf("Loading staged release from gs://%s/%s", o.Bucket, stagedPath)
+
+	// GetRelease will fail if any artifact named in the release metadata is
+	// not present in the bucket.
+	bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, buildType)
+	staged, err := bucket.GetRelease(ctx, path.Base(stagedPath))
+	if err != nil {
+		return fmt.Errorf("failed to fetch staged release: %w", err)
+	}
+	log.Printf("Found staged release %q with %d artifacts", staged.Name(), len(staged.Artifacts()))
+
+	src := gcs.Bucket(o.Bucket)
+	missing, extra, sizes, err := diffStagedFiles(ctx, src, stagedPath, expected)
+	if err != nil {
+		return err
+	}
+	undersized := release.UndersizedArtifacts(artifacts, sizes, o.MinArtifactBytes)
+	logStagedFilesDiff(expected, missing, extra)
+	logStagedArtifacts(artifacts, missing, undersized, o.MinArtifactBytes)
+	if len(missing) > 0 {
+		return fmt.Errorf("refusing to promote release %q as the staged release is missing %d expected files", o.ReleaseVersion, len(missing))
+	}
+	if len(undersized) > 0 {
+		return fmt.Errorf("refusing to promote release %q as the staged release has %d release artifacts smaller than --min-artifact-bytes=%d", o.ReleaseVersion, len(undersized), o.MinArtifactBytes)
+	}
+
+	buildID, err := stagedBuildID(ctx, src.Object(path.Join(stagedPath, release.ManifestFileName)))
+	if err != nil {
+		return err
+	}
+
+	destPath := release.PublishedBucketPathForRelease(release.DefaultPublishedBucketPathPrefix, o.ReleaseVersion)
+	dst := gcs.Bucket(o.ReleaseBucket)
+
+	existing, err := release.ListObjects(ctx, dst, destPath+"/")
+	if err != nil {
+		return fmt.Errorf("failed to list existing objects in release bucket: %w", err)
+	}
+
+	// Every file which the staged release was checked to contain is
+	// promoted, so the published release carries its checksums, signatures,
+	// manifest, SBOM and release notes alongside the artifacts.
+	plan, err := release.PlanPromotion(staged, expected, destPath, sizes, existing)
+	if err != nil {
+		return fmt.Errorf("failed to plan promotion: %w", err)
+	}
+	if o.DryRun {
+		logPromotionPlan(plan, existing)
+	}
+
+	if err := checkPromotionDestination(o, destPath, existing); err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		if tagger != nil {
+			log.Printf("Would create git tag %q at %s in %s/%s", o.ReleaseVersion, tagger.commitSHA, o.Org, o.Repo)
+		}
+		log.Printf("Dry run enabled, not promoting release %q. Re-run without --dry-run to copy %d objects", o.ReleaseVersion, len(plan))
+		if rootOpts.Output == outputJSON {
+			return printJSON(promoteResult{
+				Source:      fmt.Sprintf("gs://%s/%s", o.Bucket, stagedPath),
+				Destination: fmt.Sprintf("gs://%s/%s", o.ReleaseBucket, destPath),
+				Forced:      len(existing) > 0,
+				DryRun:      true,
+				Copies:      plan,
+			})
+		}
+		return nil
+	}
+
+	if err := release.PromoteRelease(ctx, staged, expected, dst, destPath); err != nil {
+		return fmt.Errorf("failed to promote release: %w", err)
+	}
+
+	log.Printf("Release %q promoted to gs://%s/%s", o.ReleaseVersion, o.ReleaseBucket, destPath)
+
+	tagSHA := ""
+	if tagger != nil {
+		if tagSHA, err = tagger.createTag(ctx); err != nil {
+			return fmt.Errorf("release was promoted but creating git tag %q failed: %w", o.ReleaseVersion, err)
+		}
+	}
+
+	logPath := path.Join(release.DefaultPublishedBucketPathPrefix, release.PromotionLogFileName)
+	if err := release.AppendPromotionLog(ctx, dst.Object(logPath), release.PromotionRecord{
+		ReleaseVersion: o.ReleaseVersion,
+		GitCommitRef:   o.GitRef,
+		BuildID:        buildID,
+		Source:         fmt.Sprintf("gs://%s/%s", o.Bucket, stagedPath),
+		Destination:    fmt.Sprintf("gs://%s/%s", o.ReleaseBucket, destPath),
+		PromotedBy:     promotedBy,
+		PromotedAt:     time.Now().UTC(),
+		Forced:         len(existing) > 0,
+		TagSHA:         tagSHA,
+	}); err != nil {
+		return fmt.Errorf("release was promoted but recording it in the promotion log gs://%s/%s failed: %w", o.ReleaseBucket, logPath, err)
+	}
+
+	log.Printf("Recorded promotion in gs://%s/%s", o.ReleaseBucket, logPath)
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(promoteResult{
+			Source:      fmt.Sprintf("gs://%s/%s", o.Bucket, stagedPath),
+			Destination: fmt.Sprintf("gs://%s/%s", o.ReleaseBucket, destPath),
+			Forced:      len(existing) > 0,
+			TagSHA:      tagSHA,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPromotionDestination refuses to promote the release over the objects
+// already existing at destPath in the release bucket, unless --force is set.
+func checkPromotionDestination(o *promoteOptions, destPath string, existing []*storage.ObjectAttrs) error {
+	if len(existing) == 0 {
+		return nil
+	}
+	if !o.Force {
+		return fmt.Errorf("release %q has already been promoted to gs://%s/%s - refusing to overwrite without --force", o.ReleaseVersion, o.ReleaseBucket, destPath)
+	}
+	log.Printf("WARNING: overwriting %d existing objects at gs://%s/%s as --force is set", len(existing), o.ReleaseBucket, destPath)
+	return nil
+}
+
+// logPromotionPlan logs a table of the copies which would be made to promote
+// a release, and any existing objects in the release bucket which would be
+// left in place as they aren't overwritten.
+func logPromotionPlan(plan []release.PromotionCopy, existing []*storage.ObjectAttrs) {
+	lines := []string{"SOURCE\tDESTINATION\tSIZE\tEXISTS"}
+	overwritten := make(map[string]bool, len(plan))
+	var totalSize int64
+	for _, c := range plan {
+		exists := "no"
+		if c.Exists {
+			exists = "yes"
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s", c.Source, c.Destination, formatBytes(c.Size), exists))
+		overwritten[c.Destination] = true
+		totalSize += c.Size
+	}
+	log.Printf("Promoting would copy %d objects totalling %s", len(plan), formatBytes(totalSize))
+	logTable(lines...)
+
+	for _, attrs := range existing {
+		if !overwritten[attrs.Name] {
+			log.Printf("  UNCHANGED: %s already exists in the release bucket and would not be overwritten", attrs.Name)
+		}
+	}
+}
+
+// releaseTagger creates the git tag of a promoted release.
+type releaseTagger struct {
+	o         *promoteOptions
+	baseURL   string
+	token     string
+	commitSHA string
+}
+
+// newReleaseTagger checks that the git tag for the release being promoted can
+// be created, before any objects are promoted. The tag must not already
+// exist unless --force-tag is set.
+func newReleaseTagger(ctx context.Context, o *promoteOptions) (*releaseTagger, error) {
+	if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+		return nil, validationErrorf("invalid --release-version: %w", err)
+	}
+
+	baseURL, err := release.NormalizeGitHubBaseURL(o.GitHubBaseURL)
+	if err != nil {
+		return nil, validationErrorf("invalid --github-base-url: %w", err)
+	}
+	token := o.GitHubToken
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	if token == "" {
+		return nil, validationErrorf("--create-tag requires a GitHub token to be set with --github-token or GITHUB_TOKEN")
+	}
+
+	// the tag must point at the full SHA of the commit
+	commitSHA, err := release.LookupCommit(ctx, baseURL, o.Org, o.Repo, o.GitRef, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find --git-ref %q in %s/%s: %w", o.GitRef, o.Org, o.Repo, err)
+	}
+
+	exists, err := release.TagExists(ctx, baseURL, o.Org, o.Repo, o.ReleaseVersion, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check whether git tag %q exists: %w", o.ReleaseVersion, err)
+	}
+	if exists {
+		if !o.ForceTag {
+			return nil, fmt.Errorf("git tag %q already exists in %s/%s - refusing to promote without --force-tag", o.ReleaseVersion, o.Org, o.Repo)
+		}
+		log.Printf("WARNING: git tag %q already exists in %s/%s and will be moved as --force-tag is set", o.ReleaseVersion, o.Org, o.Repo)
+	}
+
+	return &releaseTagger{o: o, baseURL: baseURL, token: token, commitSHA: commitSHA}, nil
+}
+
+// createTag creates the release's git tag, returning the SHA of the tag
+// object.
+func (t *releaseTagger) createTag(ctx context.Context) (string, error) {
+	log.Printf("Creating git tag %q at %s in %s/%s", t.o.ReleaseVersion, t.commitSHA, t.o.Org, t.o.Repo)
+	message := fmt.Sprintf("%s %s", t.o.Repo, t.o.ReleaseVersion)
+	sha, err := release.CreateTag(ctx, t.baseURL, t.o.Org, t.o.Repo, t.o.ReleaseVersion, t.commitSHA, message, t.token, t.o.ForceTag)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Created git tag %q with SHA %s", t.o.ReleaseVersion, sha)
+	return sha, nil
+}
+
+// currentUserName returns the name of the user running the command, to be
+// recorded as the user who promoted a release.
+func currentUserName() (string, error) {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username, nil
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("no user name found")
+}
+
+// stagedBuildID returns the ID of the build which staged a release, read from
+// its release manifest.
+func stagedBuildID(ctx context.Context, obj *storage.ObjectHandle) (string, error) {
+	data, err := readObject(ctx, obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to read release manifest: %w", err)
+	}
+
+	var manifest release.Manifest
+	if err := manifest.Unmarshal(data); err != nil {
+		return "", fmt.Errorf("failed to parse release manifest: %w", err)
+	}
+	return manifest.BuildID, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestCheckPromotionDestination(t *testing.T) {
+	tests := map[string]struct {
+		existing []*storage.ObjectAttrs
+		force    bool
+		expErr   string
+	}{
+		"nothing promoted yet": {},
+		"nothing promoted yet with --force": {
+			force: true,
+		},
+		"already promoted is refused without --force": {
+			existing: []*storage.ObjectAttrs{{Name: "releases/v1.6.0/metadata.json"}},
+			expErr:   `release "v1.6.0" has already been promoted to gs://my-public-bucket/releases/v1.6.0 - refusing to overwrite without --force`,
+		},
+		"already promoted is overwritten with --force": {
+			existing: []*storage.ObjectAttrs{{Name: "releases/v1.6.0/metadata.json"}},
+			force:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := &promoteOptions{
+				ReleaseVersion: "v1.6.0",
+				ReleaseBucket:  "my-public-bucket",
+				Force:          test.force,
+			}
+			err := checkPromotionDestination(o, "releases/v1.6.0", test.existing)
+			if test.expErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
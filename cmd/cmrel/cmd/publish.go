@@ -17,15 +17,14 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
-	"google.golang.org/api/cloudbuild/v1"
 
 	"github.com/cert-manager/release/pkg/gcb"
 	"github.com/cert-manager/release/pkg/release"
@@ -124,20 +123,21 @@ func (o *publishOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
 	fs.StringSliceVar(&o.PublishActions, "publish-actions", []string{"*"}, fmt.Sprintf("Comma-separated list of actions to take, or '*' to do everything. Only meaningful if nomock is set. Order of operations is preserved if given, or is alphabetical by default. Actions can be removed with a prefix of '-'. Options: %s", strings.Join(allPublishActionNames(), ", ")))
 }
 
-func (o *publishOptions) print() {
-	log.Printf("Publish options:")
-	log.Printf("  Bucket: %q", o.Bucket)
-	log.Printf("  ReleaseName: %q", o.ReleaseName)
-	log.Printf("  CloudBuildFile: %q", o.CloudBuildFile)
-	log.Printf("  Project: %q", o.Project)
-	log.Printf("  NoMock: %t", o.NoMock)
-	log.Printf("  PublishedImageRepo: %q", o.PublishedImageRepository)
-	log.Printf("  PublishedHelmChartGitHubRepo: %q", o.PublishedHelmChartGitHubRepo)
-	log.Printf("  PublishedHelmChartGitHubOwner: %q", o.PublishedHelmChartGitHubOwner)
-	log.Printf("  PublishedHelmChartGitHubBranch: %q", o.PublishedHelmChartGitHubBranch)
-	log.Printf("  PublishedGitHubOrg: %q", o.PublishedGitHubOrg)
-	log.Printf("  PublishedGitHubRepo: %q", o.PublishedGitHubRepo)
-	log.Printf("  PublishActions: %q", strings.Join(o.PublishActions, ","))
+func (o *publishOptions) print(logger logr.Logger) {
+	logger.Info("Publish options",
+		"Bucket", o.Bucket,
+		"ReleaseName", o.ReleaseName,
+		"CloudBuildFile", o.CloudBuildFile,
+		"Project", o.Project,
+		"NoMock", o.NoMock,
+		"PublishedImageRepo", o.PublishedImageRepository,
+		"PublishedHelmChartGitHubRepo", o.PublishedHelmChartGitHubRepo,
+		"PublishedHelmChartGitHubOwner", o.PublishedHelmChartGitHubOwner,
+		"PublishedHelmChartGitHubBranch", o.PublishedHelmChartGitHubBranch,
+		"PublishedGitHubOrg", o.PublishedGitHubOrg,
+		"PublishedGitHubRepo", o.PublishedGitHubRepo,
+		"PublishActions", strings.Join(o.PublishActions, ","),
+	)
 }
 
 func publishCmd(rootOpts *rootOptions) *cobra.Command {
@@ -149,8 +149,7 @@ func publishCmd(rootOpts *rootOptions) *cobra.Command {
 		Example:      publishExample,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runPublish(rootOpts, o)
@@ -161,7 +160,8 @@ func publishCmd(rootOpts *rootOptions) *cobra.Command {
 }
 
 func runPublish(rootOpts *rootOptions, o *publishOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	gcs, err := storage.NewClient(ctx)
 	if err != nil {
@@ -174,7 +174,9 @@ func runPublish(rootOpts *rootOptions, o *publishOptions) error {
 		}
 	}
 
-	bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, release.BuildTypeRelease)
+	// release candidates are staged apart from final releases
+	releaseVersion, _ := release.ParseReleaseName(release.BuildTypeRelease, o.ReleaseName)
+	bucket := release.NewBucket(gcs.Bucket(o.Bucket), release.DefaultBucketPathPrefix, release.BuildTypeForVersion(releaseVersion))
 	rel, err := bucket.GetRelease(ctx, o.ReleaseName)
 	if err != nil {
 		return fmt.Errorf("failed to fetch release: %w", err)
@@ -207,13 +209,13 @@ func runPublish(rootOpts *rootOptions, o *publishOptions) error {
 	build.Substitutions["_KMS_KEY"] = o.SigningKMSKey
 
 	log.Printf("DEBUG: building google cloud build API client")
-	svc, err := cloudbuild.NewService(ctx)
+	svc, err := gcb.NewService(ctx, "", gcb.DefaultRetryOptions)
 	if err != nil {
 		return fmt.Errorf("error building google cloud build API client: %w", err)
 	}
 
 	log.Printf("Submitting GCB build job...")
-	build, err = gcb.SubmitBuild(svc, o.Project, build)
+	build, err = gcb.SubmitBuild(ctx, svc, o.Project, "", build)
 	if err != nil {
 		return fmt.Errorf("error submitting build to cloud build: %w", err)
 	}
@@ -223,8 +225,8 @@ func runPublish(rootOpts *rootOptions, o *publishOptions) error {
 	log.Printf("  View logs at: %s", build.LogUrl)
 	log.Printf("  Log bucket: %s", build.LogsBucket)
 	log.Println("---")
-	log.Printf("Waiting for publish job to complete, this may take a while...")
-	build, err = gcb.WaitForBuild(svc, o.Project, build.Id)
+	rootOpts.progressLogger().Info("Waiting for publish job to complete, this may take a while...")
+	build, err = gcb.WaitForBuildWithProgress(ctx, svc, o.Project, build.Id, gcb.DefaultPollOptions, rootOpts.stepProgress())
 	if err != nil {
 		return fmt.Errorf("error waiting for cloud build to complete: %w", err)
 	}
@@ -0,0 +1,245 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	reproduceCommand         = "reproduce"
+	reproduceDescription     = "Check that staging a git ref twice produces identical artifacts"
+	reproduceLongDescription = `The reproduce command will stage two builds of the same git commit ref
+concurrently, exactly as they would be by the stage command, and compare the
+SHA256SUMS files of the two builds once both have completed.
+
+Each build is staged under its own path beneath --bucket-path-prefix, i.e.
+'<prefix>/reproduce/1' and '<prefix>/reproduce/2', so that neither overwrites
+the other or an existing staged build. Any artifact whose checksum differs
+between the two builds, or which was only built once, is listed and the
+command fails.
+`
+)
+
+var (
+	reproduceExample = fmt.Sprintf(`
+To check that the v1.6.0 release built at commit 6d3ce5e is reproducible, run:
+
+	%s %s --branch=release-1.6 --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0 --release-version=v1.6.0`, rootCommand, reproduceCommand)
+)
+
+// reproduceBuilds is the number of builds staged and compared by the
+// reproduce command.
+const reproduceBuilds = 2
+
+// reproduceExcludedFlags are the flags of the stage command which can't be
+// used with the reproduce command, as it must submit and wait for each of
+// its builds itself.
+var reproduceExcludedFlags = []string{"source-tarball", "attach-build-id", "no-wait", "dry-run", "summary-format", "mirror-bucket", "yes", "shard-by-os", "shard-concurrency"}
+
+// reproduceResult is printed to stdout when the reproduce command is run
+// with --output=json.
+type reproduceResult struct {
+	GitRef       string         `json:"gitRef"`
+	Builds       []*stageResult `json:"builds"`
+	Reproducible bool           `json:"reproducible"`
+	Differing    []string       `json:"differing"`
+	Missing      []string       `json:"missing"`
+}
+
+type reproduceOptions struct {
+	stageOptions
+}
+
+func (o *reproduceOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	o.stageOptions.AddFlags(fs, markRequired)
+	for _, name := range reproduceExcludedFlags {
+		if err := fs.MarkHidden(name); err != nil {
+			panic(err)
+		}
+	}
+
+	markRequired("git-ref")
+}
+
+func (o *reproduceOptions) print(logger logr.Logger) {
+	o.stageOptions.print(logger)
+}
+
+func reproduceCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &reproduceOptions{}
+	cmd := &cobra.Command{
+		Use:          reproduceCommand,
+		Short:        reproduceDescription,
+		Long:         reproduceLongDescription,
+		Example:      reproduceExample,
+		SilenceUsage: true,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range reproduceExcludedFlags {
+				if cmd.Flags().Changed(name) {
+					return validationErrorf("--%s cannot be used with %s", name, reproduceCommand)
+				}
+			}
+			if o.ConfigFile != "" {
+				excluded := append([]string{"config"}, reproduceExcludedFlags...)
+				if err := loadFlagsFromConfigFile(cmd.Flags(), o.ConfigFile, excluded...); err != nil {
+					return err
+				}
+			}
+			if err := applySmokeFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			warnLegacyOrg(cmd.Flags())
+			rootOpts.printOptions(o.print)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReproduce(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	mustRegisterFlagCompletionFunc(cmd, "branch", completeBranches(&o.Org, &o.Repo, &o.GitHubBaseURL, &o.GitHubToken, false))
+	mustRegisterFlagCompletionFunc(cmd, "target-os", completeTargetOSes)
+	mustRegisterFlagCompletionFunc(cmd, "target-arch", completeTargetArches(&o.TargetOSes))
+	return cmd
+}
+
+func runReproduce(rootOpts *rootOptions, o *reproduceOptions) error {
+	if o.GitRef == "" {
+		return validationErrorf("--git-ref must be set")
+	}
+
+	bucketPathPrefix, err := release.NormalizeBucketPathPrefix(o.BucketPathPrefix)
+	if err != nil {
+		return validationErrorf("invalid --bucket-path-prefix: %w", err)
+	}
+
+	// Cancel the context when the process is interrupted, so that all
+	// in-flight builds can be cancelled before exiting.
+	rootCtx, cancel := rootOpts.context()
+	defer cancel()
+	ctx, stop := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results := make([]*stageResult, reproduceBuilds)
+	errs := make([]error, reproduceBuilds)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			buildOpts := o.stageOptions
+			buildOpts.BucketPathPrefix = fmt.Sprintf("%s/reproduce/%d", bucketPathPrefix, i+1)
+			// builds are staged away from any real release, so there's
+			// nothing to confirm overwriting and they're never published
+			// even if unsigned
+			buildOpts.Yes = true
+			buildOpts.AllowUnsignedRelease = true
+
+			log.Printf("Staging build %d of %d to %q", i+1, reproduceBuilds, buildOpts.BucketPathPrefix)
+			results[i], errs[i] = stage(ctx, stop, rootOpts, &buildOpts)
+			if errs[i] != nil {
+				log.Printf("Staging build %d of %d failed: %v", i+1, reproduceBuilds, errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("staging build %d of %d failed: %w", i+1, reproduceBuilds, err)
+		}
+	}
+
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return withKind(ErrAPIUnavailable, fmt.Errorf("failed to create GCS client: %w", err))
+	}
+	defer gcs.Close()
+	bucket := gcs.Bucket(o.Bucket)
+
+	sums := make([]map[string]string, len(results))
+	for i, result := range results {
+		outputDir := strings.TrimPrefix(result.OutputPath, fmt.Sprintf("gs://%s/", o.Bucket))
+		if sums[i], err = readStagedChecksums(ctx, bucket, outputDir); err != nil {
+			return rootOpts.timeoutError(ctx, "reading checksums", withKind(ErrAPIUnavailable, fmt.Errorf("failed to read checksums of build %d: %w", i+1, err)))
+		}
+	}
+
+	differing, missing := release.CompareChecksums(sums[0], sums[1])
+	reproducible := len(differing) == 0 && len(missing) == 0
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(reproduceResult{
+			GitRef:       o.GitRef,
+			Builds:       results,
+			Reproducible: reproducible,
+			Differing:    differing,
+			Missing:      missing,
+		}); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("---")
+	log.Printf("Compared %d and %d artifacts of builds %s and %s", len(sums[0]), len(sums[1]), results[0].OutputPath, results[1].OutputPath)
+	for _, name := range differing {
+		log.Printf("  NOT REPRODUCIBLE: %s (%s != %s)", name, sums[0][name], sums[1][name])
+	}
+	for _, name := range missing {
+		log.Printf("  ONLY BUILT ONCE: %s", name)
+	}
+
+	if !reproducible {
+		return fmt.Errorf("builds of %q are not reproducible: %d artifacts differ and %d were only built once", o.GitRef, len(differing), len(missing))
+	}
+
+	log.Printf("All %d artifacts are reproducible", len(sums[0]))
+
+	return nil
+}
+
+// readStagedChecksums downloads and parses the checksums file of the build
+// staged at stagedPath in bucket.
+func readStagedChecksums(ctx context.Context, bucket *storage.BucketHandle, stagedPath string) (map[string]string, error) {
+	checksums, err := readObject(ctx, bucket.Object(stagedPath+"/"+release.ChecksumsFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s file: %w", release.ChecksumsFileName, err)
+	}
+
+	sums, err := release.ReadChecksumsFile(bytes.NewReader(checksums))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s file: %w", release.ChecksumsFileName, err)
+	}
+	return sums, nil
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+const (
+	rollbackCommand         = "rollback"
+	rollbackDescription     = "Remove a mistakenly promoted release from a public release bucket"
+	rollbackLongDescription = `The rollback command will remove every object of a release version which
+has been promoted to a public release bucket, so that it is no longer
+published.
+
+By default each object is moved under the rolled-back/ prefix of the release
+bucket, named after the time of the rollback, so that the release can still
+be inspected later. If --delete is set the objects are deleted instead.
+
+By default, the command runs in dry-run mode and only prints the objects
+which would be removed. To remove them, --confirm must be specified.
+
+Once rolled back, a record of who rolled back the release, when and why is
+appended to the promotion log at releases/promotions.jsonl in the release
+bucket, in the same way as promotions are recorded.
+
+Only releases promoted under releases/ are ever removed by this command;
+development builds are never touched.
+`
+)
+
+var (
+	rollbackExample = fmt.Sprintf(`
+To list the objects of the v1.6.0 release which would be rolled back from the 'my-public-bucket' bucket, run:
+
+	%s %s --release-version=v1.6.0 --release-bucket=my-public-bucket
+
+To then roll it back, run:
+
+	%s %s --release-version=v1.6.0 --release-bucket=my-public-bucket --reason="bad manifests" --confirm`, rootCommand, rollbackCommand, rootCommand, rollbackCommand)
+)
+
+// rollbackResult is printed to stdout when the rollback command is run with
+// --output=json.
+type rollbackResult struct {
+	ReleaseVersion string `json:"releaseVersion"`
+	Source         string `json:"source"`
+	Destination    string `json:"destination,omitempty"`
+
+	// RolledBack is false if nothing was removed as --confirm wasn't set, in
+	// which case Actions lists the actions which would have been taken.
+	RolledBack bool                     `json:"rolledBack"`
+	Actions    []release.RollbackAction `json:"actions"`
+}
+
+type rollbackOptions struct {
+	// The name of the GCS bucket the release was promoted to
+	ReleaseBucket string
+
+	// ReleaseVersion is the version of the promoted release to roll back
+	ReleaseVersion string
+
+	// Delete, if true, will delete the objects of the release instead of
+	// moving them under the rolled-back/ prefix
+	Delete bool
+
+	// RolledBackBy identifies who is rolling back the release, and is
+	// recorded in the promotion log
+	RolledBackBy string
+
+	// Reason describes why the release is being rolled back, and is recorded
+	// in the promotion log
+	Reason string
+
+	// DryRun, if true, will only print the objects which would be removed
+	DryRun bool
+
+	// Confirm must be true for the release to actually be rolled back
+	Confirm bool
+}
+
+func (o *rollbackOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.ReleaseBucket, "release-bucket", "", "The name of the GCS bucket the release was promoted to.")
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The version of the promoted release to roll back.")
+	fs.BoolVar(&o.Delete, "delete", false, fmt.Sprintf("If true, delete the objects of the release instead of moving them under the %s/ prefix of the release bucket.", release.RolledBackBucketPathPrefix))
+	fs.StringVar(&o.RolledBackBy, "rolled-back-by", "", "Identifies who is rolling back the release in the promotion log. Defaults to the name of the current user.")
+	fs.StringVar(&o.Reason, "reason", "", "Describes why the release is being rolled back in the promotion log.")
+	fs.BoolVar(&o.DryRun, "dry-run", true, "If true, only print the objects which would be removed. Setting --confirm disables dry-run mode.")
+	fs.BoolVar(&o.Confirm, "confirm", false, "If true, roll back the release.")
+	markRequired("release-bucket")
+	markRequired("release-version")
+}
+
+func (o *rollbackOptions) print(logger logr.Logger) {
+	logger.Info("Rollback options",
+		"ReleaseBucket", o.ReleaseBucket,
+		"ReleaseVersion", o.ReleaseVersion,
+		"Delete", o.Delete,
+		"RolledBackBy", o.RolledBackBy,
+		"Reason", o.Reason,
+		"DryRun", o.DryRun,
+		"Confirm", o.Confirm,
+	)
+}
+
+func rollbackCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &rollbackOptions{}
+	cmd := &cobra.Command{
+		Use:          rollbackCommand,
+		Short:        rollbackDescription,
+		Long:         rollbackLongDescription,
+		Example:      rollbackExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRollback(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runRollback(rootOpts *rootOptions, o *rollbackOptions) error {
+	// only versioned releases are ever published, so this also ensures that
+	// a devel path can't be rolled back
+	if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+		return validationErrorf("invalid --release-version: %w", err)
+	}
+	if !o.DryRun && !o.Confirm {
+		return validationErrorf("refusing to roll back release without --confirm")
+	}
+
+	rolledBackBy := o.RolledBackBy
+	if rolledBackBy == "" {
+		var err error
+		rolledBackBy, err = currentUserName()
+		if err != nil {
+			return fmt.Errorf("failed to determine the current user, set --rolled-back-by: %w", err)
+		}
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return withKind(ErrAPIUnavailable, fmt.Errorf("failed to create GCS client: %w", err))
+	}
+	bucket := gcs.Bucket(o.ReleaseBucket)
+
+	publishedPath := release.PublishedBucketPathForRelease(release.DefaultPublishedBucketPathPrefix, o.ReleaseVersion)
+	objs, err := release.ListObjects(ctx, bucket, publishedPath+"/")
+	if err != nil {
+		return rootOpts.timeoutError(ctx, "listing published release", withKind(ErrAPIUnavailable, fmt.Errorf("failed to list objects of published release: %w", err)))
+	}
+	if len(objs) == 0 {
+		return fmt.Errorf("release %q has not been promoted to gs://%s/%s", o.ReleaseVersion, o.ReleaseBucket, publishedPath)
+	}
+
+	now := time.Now().UTC()
+	rolledBackPath := ""
+	if !o.Delete {
+		rolledBackPath = release.RolledBackBucketPath(publishedPath, now)
+	}
+	plan, err := release.PlanRollback(objs, publishedPath, rolledBackPath)
+	if err != nil {
+		return err
+	}
+	logRollbackPlan(plan)
+
+	result := rollbackResult{
+		ReleaseVersion: o.ReleaseVersion,
+		Source:         fmt.Sprintf("gs://%s/%s", o.ReleaseBucket, publishedPath),
+		Actions:        plan,
+	}
+	if rolledBackPath != "" {
+		result.Destination = fmt.Sprintf("gs://%s/%s", o.ReleaseBucket, rolledBackPath)
+	}
+
+	if !o.Confirm {
+		log.Printf("Dry run enabled, not rolling back release %q. Re-run with --confirm to remove %d objects", o.ReleaseVersion, len(plan))
+		if rootOpts.Output == outputJSON {
+			return printJSON(result)
+		}
+		return nil
+	}
+
+	n, err := release.RollbackRelease(ctx, bucket, plan)
+	if err != nil {
+		return rootOpts.timeoutError(ctx, "rolling back release", withKind(ErrAPIUnavailable, fmt.Errorf("failed to roll back release %q after removing %d of %d objects: %w", o.ReleaseVersion, n, len(plan), err)))
+	}
+	result.RolledBack = true
+
+	log.Printf("Release %q rolled back from gs://%s/%s", o.ReleaseVersion, o.ReleaseBucket, publishedPath)
+
+	logPath := path.Join(release.DefaultPublishedBucketPathPrefix, release.PromotionLogFileName)
+	if err := release.AppendPromotionLog(ctx, bucket.Object(logPath), release.PromotionRecord{
+		Action:         release.PromotionActionRollback,
+		ReleaseVersion: o.ReleaseVersion,
+		GitCommitRef:   objectGitRef(objs),
+		Source:         result.Source,
+		Destination:    result.Destination,
+		PromotedBy:     rolledBackBy,
+		PromotedAt:     now,
+		Reason:         o.Reason,
+	}); err != nil {
+		return fmt.Errorf("release was rolled back but recording it in the promotion log gs://%s/%s failed: %w", o.ReleaseBucket, logPath, err)
+	}
+
+	log.Printf("Recorded rollback in gs://%s/%s", o.ReleaseBucket, logPath)
+
+	if rootOpts.Output == outputJSON {
+		return printJSON(result)
+	}
+
+	return nil
+}
+
+// logRollbackPlan logs a table of the objects which would be moved or
+// deleted to roll back a release.
+func logRollbackPlan(plan []release.RollbackAction) {
+	lines := []string{"SOURCE\tDESTINATION\tSIZE"}
+	var totalSize int64
+	for _, action := range plan {
+		dst := action.Destination
+		if dst == "" {
+			dst = "(deleted)"
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s", action.Source, dst, formatBytes(action.Size)))
+		totalSize += action.Size
+	}
+	log.Printf("Rolling back would remove %d published objects totalling %s", len(plan), formatBytes(totalSize))
+	logTable(lines...)
+}
+
+// objectGitRef returns the git commit ref recorded in the metadata of the
+// given published objects, to be recorded in the promotion log, or an empty
+// string if none of them record one.
+func objectGitRef(objs []*storage.ObjectAttrs) string {
+	for _, attrs := range objs {
+		if ref := release.ObjectMetadataFromMap(attrs.Metadata).GitRef; ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
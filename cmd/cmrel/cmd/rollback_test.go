@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+func TestObjectGitRef(t *testing.T) {
+	tests := map[string]struct {
+		objs []*storage.ObjectAttrs
+		exp  string
+	}{
+		"no objects": {},
+		"objects without metadata": {
+			objs: []*storage.ObjectAttrs{{Name: "releases/v1.6.0/metadata.json"}},
+		},
+		"first recorded git ref is used": {
+			objs: []*storage.ObjectAttrs{
+				{Name: "releases/v1.6.0/metadata.json"},
+				{Name: "releases/v1.6.0/cert-manager.yaml", Metadata: release.ObjectMetadata{ReleaseVersion: "v1.6.0", GitRef: "abc"}.Map()},
+			},
+			exp: "abc",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := objectGitRef(test.objs); got != test.exp {
+				t.Errorf("unexpected git ref: got=%q, exp=%q", got, test.exp)
+			}
+		})
+	}
+}
@@ -17,12 +17,23 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/httpclient"
+	"github.com/cert-manager/release/pkg/logging"
 )
 
 const (
@@ -31,30 +42,255 @@ const (
 	rootDescriptionLong = `Use to prepare, build and publish cert-manager release artifacts.`
 )
 
+const (
+	// outputText is the default output format, which logs human-readable
+	// progress messages.
+	outputText = "text"
+
+	// outputJSON suppresses all log output and instead prints a single JSON
+	// document describing the result of the command to stdout. Any error is
+	// written to stderr as an errorResult.
+	outputJSON = "json"
+)
+
+var outputFormats = []string{outputText, outputJSON}
+
+// logWriter is where log messages are written with --output=text. It is
+// overridden in tests.
+var logWriter io.Writer = os.Stderr
+
+// errorResult is written to stderr when a command run with --output=json
+// fails, so that the failure can be parsed in the same way as the command's
+// output.
+type errorResult struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exitCode"`
+}
+
 type rootOptions struct {
 	// Debug configures whether output from subcommands should be directly
 	// piped to stderr of the process.
 	Debug bool
+
+	// Verbose configures whether additional progress information, such as
+	// the start and end of each step of a build, is logged.
+	Verbose bool
+
+	// Quiet configures whether only the outcome of each command, such as the
+	// ID and final status of a build, is logged. Progress messages, the
+	// options of the command and debug messages aren't logged if it is set.
+	Quiet bool
+
+	// Output is the format that commands should produce output in, one of
+	// 'text' or 'json'.
+	Output string
+
+	// LogLevel is the minimum level of log messages which are written, one of
+	// 'error', 'info' or 'debug'. If empty, debug messages are written unless
+	// Quiet is set, as they always were before log levels were introduced.
+	LogLevel string
+
+	// LogFormat is the format log messages are written in, one of 'text' or
+	// 'json'.
+	LogFormat string
+
+	// Logger is configured from the other root options before any
+	// subcommand is run.
+	Logger logr.Logger
+
+	// Timeout, if non-zero, is the maximum amount of time a command is
+	// allowed to run for before any outstanding work is cancelled.
+	Timeout time.Duration
+
+	// CACert, if set, is the path to a PEM bundle of additional CA
+	// certificates to trust for all outbound HTTPS requests, e.g. those of
+	// an egress proxy.
+	CACert string
 }
 
 func (o *rootOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
 	fs.BoolVar(&o.Debug, "debug", false, "If true, output from sub-commands will be directly piped to stderr.")
+	fs.BoolVar(&o.Verbose, "verbose", false, "If true, log additional progress information such as the start and end of each step whilst waiting for a build to complete, and the slowest steps of the build once it has completed.")
+	fs.BoolVar(&o.Quiet, "quiet", false, "If true, only log the outcome of the command, such as the ID and final status of a build, and any warnings. The options of the command, progress and debug messages aren't logged. Errors are still written to stderr. Cannot be used with --verbose or --log-level=debug.")
+	fs.DurationVar(&o.Timeout, "timeout", 0, "If non-zero, the maximum amount of time the whole command is allowed to run for, e.g. '2h'. Outstanding work is cancelled and an error returned once it has passed.")
+	fs.StringVar(&o.LogLevel, "log-level", "", fmt.Sprintf("The minimum level of log messages to write to stderr. Defaults to '%s', or '%s' if --quiet is set. Options: %s", logging.LevelDebug, logging.LevelInfo, strings.Join(logging.Levels, ", ")))
+	fs.StringVar(&o.LogFormat, "log-format", logging.FormatText, fmt.Sprintf("The format to write log messages to stderr in. Options: %s", strings.Join(logging.Formats, ", ")))
+	fs.StringVar(&o.CACert, "ca-cert", "", "Optional path to a PEM bundle of CA certificates to trust, in addition to the system's, for all requests to GitHub and Google Cloud, e.g. when running behind an egress proxy. The proxy itself is configured with the HTTPS_PROXY and NO_PROXY environment variables.")
+	fs.StringVar(&o.Output, "output", outputText, fmt.Sprintf("Output format. If 'json', log output is suppressed and a JSON document describing the result is printed to stdout by commands which support it, and any error is written to stderr as a JSON object. Options: %s", strings.Join(outputFormats, ", ")))
 }
 
 func (o *rootOptions) print() {
-	log.Printf("Root options:")
-	log.Printf("  Debug: %t", o.Debug)
+	if o.Quiet {
+		return
+	}
+	o.Logger.Info("Root options",
+		"Debug", o.Debug,
+		"Verbose", o.Verbose,
+		"Quiet", o.Quiet,
+		"Output", o.Output,
+		"LogLevel", o.LogLevel,
+		"LogFormat", o.LogFormat,
+		"Timeout", o.Timeout,
+		"CACert", o.CACert,
+	)
+}
+
+// printOptions logs the options of a command using print, followed by a
+// separator from the command's own output, unless --quiet is set.
+func (o *rootOptions) printOptions(print func(logr.Logger)) {
+	if o.Quiet {
+		return
+	}
+	print(o.Logger)
+	log.Printf("---")
+}
+
+// context returns a context to be used for the entire execution of a
+// command, which expires once --timeout has passed if it is set.
+func (o *rootOptions) context() (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), o.Timeout)
+}
+
+// timeoutError returns an error naming the phase a command was in if ctx
+// expired because --timeout passed, or else returns err unchanged.
+func (o *rootOptions) timeoutError(ctx context.Context, phase string, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return withKind(ErrTimeout, fmt.Errorf("command did not complete within --timeout=%s, timed out whilst %s: %w", o.Timeout, phase, err))
+}
+
+// stepProgress returns a StepProgress which logs a debug message each time a
+// build is polled whilst waiting for it to complete, and also logs the
+// progress of the build's steps if --verbose is set.
+func (o *rootOptions) stepProgress() *gcb.StepProgress {
+	progress := &gcb.StepProgress{Waitingf: logf(o.Logger.V(logging.DebugLevel))}
+	if o.Verbose {
+		progress.Logf = logf(o.progressLogger())
+	}
+	return progress
+}
+
+// progressLogger returns the logger which progress messages are logged with,
+// as opposed to the outcome of a command which is logged with Logger.
+// Progress is logged at DebugLevel if --quiet is set, so that it's discarded.
+func (o *rootOptions) progressLogger() logr.Logger {
+	if o.Quiet {
+		return o.Logger.V(logging.DebugLevel)
+	}
+	return o.Logger
+}
+
+// logf returns a function which formats a message as fmt.Sprintf does and
+// logs it as an informational message of logger.
+func logf(logger logr.Logger) func(format string, args ...interface{}) {
+	return func(format string, args ...interface{}) {
+		logger.Info(fmt.Sprintf(format, args...))
+	}
+}
+
+// configure validates the root options and configures the logger, and the
+// global logger of the log package, to match. It must be called before any
+// subcommand is run.
+func (o *rootOptions) configure() error {
+	var logOutput io.Writer
+	switch o.Output {
+	case outputText:
+		logOutput = logWriter
+	case outputJSON:
+		logOutput = io.Discard
+	default:
+		return validationErrorf("invalid --output %q, must be one of: %s", o.Output, strings.Join(outputFormats, ", "))
+	}
+
+	if o.Quiet && o.Verbose {
+		return validationErrorf("--quiet cannot be used with --verbose")
+	}
+	if o.Quiet && o.LogLevel == logging.LevelDebug {
+		return validationErrorf("--quiet cannot be used with --log-level=%s", logging.LevelDebug)
+	}
+
+	logLevel := o.LogLevel
+	if logLevel == "" {
+		logLevel = logging.LevelDebug
+		if o.Quiet {
+			logLevel = logging.LevelInfo
+		}
+	}
+
+	logger, err := logging.New(logOutput, o.LogFormat, logLevel)
+	if err != nil {
+		return withKind(ErrValidation, err)
+	}
+	o.Logger = logger
+
+	// Messages which are still written using the log package are written
+	// through the logger so that they are formatted and filtered the same way.
+	// They're treated as progress, as any outcome is logged with the logger.
+	stdVerbosity := 0
+	if o.Quiet {
+		stdVerbosity = logging.DebugLevel
+	}
+	log.SetFlags(0)
+	log.SetOutput(logging.NewStdWriter(logger, stdVerbosity))
+
+	if o.Timeout < 0 {
+		return validationErrorf("invalid --timeout %q: must not be negative", o.Timeout)
+	}
+
+	// All API clients are built on the default transport, so configuring it
+	// here applies the proxy and CA settings to every outbound request.
+	if err := httpclient.SetDefault(o.CACert); err != nil {
+		return validationErrorf("invalid --ca-cert: %w", err)
+	}
+	return nil
+}
+
+// printJSON will print the given value to stdout as an indented JSON document.
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// printError writes err, as returned by a command, to w. If output is
+// 'json' it is written as an errorResult, otherwise as plain text.
+func printError(w io.Writer, output string, err error) {
+	if output != outputJSON {
+		fmt.Fprintln(w, err)
+		return
+	}
+	// a string and an int can always be encoded
+	out, _ := json.Marshal(errorResult{Error: err.Error(), ExitCode: exitCode(err)})
+	fmt.Fprintln(w, string(out))
 }
 
 func rootCmd(o *rootOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   rootCommand,
 		Short: rootDescription,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.configure(); err != nil {
+				return err
+			}
 			o.print()
+			return nil
 		},
-		Long: rootDescriptionLong,
+		Long: rootDescriptionLong + "\n\n" + exitCodesDescription,
+		// errors are written by Execute, so that they're only written once
+		// and in the format chosen with --output
+		SilenceErrors: true,
 	}
+	// errors parsing flags are always the user's to fix
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return withKind(ErrValidation, err)
+	})
 	o.AddFlags(cmd.PersistentFlags(), mustMarkRequired(cmd.MarkPersistentFlagRequired))
 	return cmd
 }
@@ -66,7 +302,7 @@ func rootCmd(o *rootOptions) *cobra.Command {
 func mustMarkRequired(markRequired func(string) error) func(string) {
 	return func(s string) {
 		if err := markRequired(s); err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 	}
@@ -76,13 +312,28 @@ func Execute() {
 	o := &rootOptions{}
 	cmd := rootCmd(o)
 	cmd.AddCommand(stagedCmd(o))
+	cmd.AddCommand(listCmd(o))
+	cmd.AddCommand(cleanCmd(o))
 	cmd.AddCommand(stageCmd(o))
+	cmd.AddCommand(stageAllCmd(o))
+	cmd.AddCommand(reproduceCmd(o))
 	cmd.AddCommand(gcbCmd(o))
 	cmd.AddCommand(publishCmd(o))
+	cmd.AddCommand(promoteCmd(o))
+	cmd.AddCommand(rollbackCmd(o))
+	cmd.AddCommand(validateCmd(o))
+	cmd.AddCommand(diffCmd(o))
+	cmd.AddCommand(fetchCmd(o))
+	cmd.AddCommand(pathCmd(o))
+	cmd.AddCommand(matrixCmd(o))
+	cmd.AddCommand(verifyCmd(o))
+	cmd.AddCommand(chartCmd(o))
 	cmd.AddCommand(bootstrapPGPCmd(o))
 	cmd.AddCommand(signCmd(o))
+	cmd.AddCommand(exportKeyCmd(o))
+	cmd.AddCommand(versionCmd(o))
 	if err := cmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		printError(os.Stderr, o.Output, err)
+		os.Exit(exitCode(err))
 	}
 }
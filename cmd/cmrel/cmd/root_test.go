@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/cert-manager/release/pkg/logging"
+)
+
+func TestRootOptionsTimeoutError(t *testing.T) {
+	errFailed := errors.New("request failed")
+
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]struct {
+		ctx         context.Context
+		err         error
+		expectPhase bool
+	}{
+		"nil error is unchanged": {
+			ctx: expired,
+		},
+		"error is unchanged if the context has not expired": {
+			ctx: context.Background(),
+			err: errFailed,
+		},
+		"error is unchanged if the context was cancelled": {
+			ctx: cancelled,
+			err: errFailed,
+		},
+		"error names the phase if the deadline passed": {
+			ctx:         expired,
+			err:         errFailed,
+			expectPhase: true,
+		},
+	}
+
+	o := &rootOptions{Timeout: time.Minute}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := o.timeoutError(test.ctx, "submitting build", test.err)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error to wrap %v but got: %v", test.err, err)
+			}
+			if test.expectPhase != (err != nil && strings.Contains(err.Error(), "timed out whilst submitting build")) {
+				t.Errorf("expectPhase=%v but got error: %v", test.expectPhase, err)
+			}
+		})
+	}
+}
+
+func TestRootOptionsPrintOptions(t *testing.T) {
+	tests := map[string]struct {
+		quiet     bool
+		expOutput bool
+	}{
+		"options are logged by default": {
+			expOutput: true,
+		},
+		"options aren't logged with --quiet": {
+			quiet: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger, err := logging.New(buf, logging.FormatText, logging.LevelInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			o := &rootOptions{Quiet: test.quiet, Logger: logger}
+			o.printOptions(func(l logr.Logger) {
+				l.Info("Stage options", "Bucket", "my-bucket")
+			})
+			if test.expOutput != strings.Contains(buf.String(), "my-bucket") {
+				t.Errorf("expOutput=%v but got output: %q", test.expOutput, buf.String())
+			}
+		})
+	}
+}
+
+func TestRootOptionsConfigure_Quiet(t *testing.T) {
+	tests := map[string]*rootOptions{
+		"quiet with verbose": {
+			Quiet:   true,
+			Verbose: true,
+		},
+		"quiet with debug logs": {
+			Quiet:    true,
+			LogLevel: logging.LevelDebug,
+		},
+	}
+
+	for name, o := range tests {
+		t.Run(name, func(t *testing.T) {
+			o.Output = outputText
+			if err := o.configure(); !errors.Is(err, ErrValidation) {
+				t.Errorf("expected a validation error but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestRootOptionsConfigure_DefaultLogLevel(t *testing.T) {
+	tests := map[string]struct {
+		opts     *rootOptions
+		expDebug bool
+	}{
+		"debug messages are logged by default": {
+			opts:     &rootOptions{},
+			expDebug: true,
+		},
+		"debug messages aren't logged with --quiet": {
+			opts: &rootOptions{Quiet: true},
+		},
+		"debug messages aren't logged with --log-level=info": {
+			opts: &rootOptions{LogLevel: logging.LevelInfo},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.opts.Output = outputText
+			test.opts.LogFormat = logging.FormatText
+			if err := test.opts.configure(); err != nil {
+				t.Fatal(err)
+			}
+			if got := test.opts.Logger.V(logging.DebugLevel).Enabled(); got != test.expDebug {
+				t.Errorf("expected debug messages to be enabled=%v but got %v", test.expDebug, got)
+			}
+		})
+	}
+}
+
+func TestPrintError(t *testing.T) {
+	tests := map[string]struct {
+		output string
+		err    error
+		exp    string
+	}{
+		"text output": {
+			output: outputText,
+			err:    errors.New("build failed"),
+			exp:    "build failed\n",
+		},
+		"unrecognised output is written as text": {
+			output: "yaml",
+			err:    errors.New("build failed"),
+			exp:    "build failed\n",
+		},
+		"json output": {
+			output: outputJSON,
+			err:    validationErrorf("invalid --bucket %q", "my bucket"),
+			exp:    `{"error":"invalid --bucket \"my bucket\"","exitCode":2}` + "\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			printError(buf, test.output, test.err)
+			if buf.String() != test.exp {
+				t.Errorf("unexpected output: got=%q, exp=%q", buf.String(), test.exp)
+			}
+		})
+	}
+}
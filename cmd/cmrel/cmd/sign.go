@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 )
@@ -38,7 +39,7 @@ type signOptions struct {
 func (o *signOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
 }
 
-func (o *signOptions) print() {
+func (o *signOptions) print(logger logr.Logger) {
 }
 
 func signCmd(o *rootOptions) *cobra.Command {
@@ -46,8 +47,12 @@ func signCmd(o *rootOptions) *cobra.Command {
 		Use:   signCommand,
 		Short: signDescription,
 		Long:  signDescriptionLong,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.configure(); err != nil {
+				return err
+			}
 			o.print()
+			return nil
 		},
 	}
 
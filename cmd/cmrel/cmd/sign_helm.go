@@ -17,12 +17,12 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 
@@ -64,10 +64,11 @@ func (o *signHelmOptions) AddFlags(fs *flag.FlagSet, markRequired func(string))
 	markRequired("chart-path")
 }
 
-func (o *signHelmOptions) print() {
-	log.Printf("sign helm options:")
-	log.Printf("        Key: %q", o.Key)
-	log.Printf("  ChartPath: %q", o.ChartPath)
+func (o *signHelmOptions) print(logger logr.Logger) {
+	logger.Info("sign helm options",
+		"Key", o.Key,
+		"ChartPath", o.ChartPath,
+	)
 }
 
 func signHelmCmd(rootOpts *rootOptions) *cobra.Command {
@@ -79,8 +80,7 @@ func signHelmCmd(rootOpts *rootOptions) *cobra.Command {
 		Example:      signHelmExample,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runSignHelm(rootOpts, o)
@@ -93,7 +93,8 @@ func signHelmCmd(rootOpts *rootOptions) *cobra.Command {
 }
 
 func runSignHelm(rootOpts *rootOptions, o *signHelmOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	parsedKey, err := sign.NewGCPKMSKey(o.Key)
 	if err != nil {
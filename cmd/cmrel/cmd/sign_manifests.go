@@ -17,10 +17,10 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 
@@ -72,12 +72,12 @@ func (o *signManifestsOptions) AddFlags(fs *flag.FlagSet, markRequired func(stri
 	markRequired("release-version")
 }
 
-func (o *signManifestsOptions) print() {
-	log.Printf("sign manifests options:")
-	log.Printf("   Key: %q", o.Key)
-	log.Printf("  Path: %q", o.Path)
-
-	log.Printf("  ReleaseVersion: %q", o.ReleaseVersion)
+func (o *signManifestsOptions) print(logger logr.Logger) {
+	logger.Info("sign manifests options",
+		"Key", o.Key,
+		"Path", o.Path,
+		"ReleaseVersion", o.ReleaseVersion,
+	)
 }
 
 func signManifestsCmd(rootOpts *rootOptions) *cobra.Command {
@@ -89,8 +89,7 @@ func signManifestsCmd(rootOpts *rootOptions) *cobra.Command {
 		Example:      signManifestsExample,
 		SilenceUsage: true,
 		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runSignManifests(rootOpts, o)
@@ -103,14 +102,15 @@ func signManifestsCmd(rootOpts *rootOptions) *cobra.Command {
 }
 
 func runSignManifests(rootOpts *rootOptions, o *signManifestsOptions) error {
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 
 	parsedKey, err := sign.NewGCPKMSKey(o.Key)
 	if err != nil {
 		return err
 	}
 
-	err = sign.CertManagerManifests(ctx, parsedKey, o.Path, o.ReleaseVersion)
+	err = sign.CertManagerManifests(ctx, []sign.GCPKMSKey{parsedKey}, o.Path, o.ReleaseVersion)
 	if err != nil {
 		return fmt.Errorf("failed to complete signing of %q: %w", o.Path, err)
 	}
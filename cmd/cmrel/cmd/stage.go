@@ -18,17 +18,29 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 	"google.golang.org/api/cloudbuild/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/notify"
 	"github.com/cert-manager/release/pkg/release"
 	"github.com/cert-manager/release/pkg/sign"
+	"github.com/cert-manager/release/pkg/version"
 )
 
 const (
@@ -38,6 +50,41 @@ const (
 Google Cloud Storage bucket. It will create a Google Cloud Build job
 which will run a full cross-build and publish the artifacts to the
 staging release bucket.
+
+If --release-version is set the build is staged as a release, overwriting any
+release already staged for the same version and git ref, so the command
+prompts for confirmation first unless --yes is set.
+
+If --shard-by-os is set a separate build is created for each target OS and
+the builds are run concurrently. Once every build has succeeded their
+metadata and checksums are merged into a single release, which is signed
+using the KMS key given by --signing-kms-key. If some of the builds fail,
+run the command again with the same flags and --retry-missing to rebuild
+only the OSes whose artifacts weren't staged.
+
+If --generate-provenance is set, once the release has been staged an in-toto
+statement with a SLSA provenance predicate is generated, describing the
+builds which staged it, the git commit they were built from and the digest
+of every artifact and image. It is signed with each --signing-kms-key and
+uploaded alongside the artifacts as a DSSE envelope.
+
+Executables given by --pre-stage-hook and --post-stage-hook are run
+immediately before the build is submitted and once it has completed
+successfully, with the following environment variables set:
+
+  CMREL_HOOK             'pre-stage' or 'post-stage'
+  CMREL_RELEASE_VERSION  the release version, empty for devel builds
+  CMREL_GIT_REF          the git commit ref being built
+  CMREL_BRANCH           the branch being built
+  CMREL_PROJECT          the GCP project the build runs in
+  CMREL_OUTPUT_PATH      the GCS path artifacts are staged to
+  CMREL_BUILD_ID         the ID of the build (post-stage only)
+  CMREL_LOG_URL          the URL of the build's logs (post-stage only)
+  CMREL_STATUS           the status of the build (post-stage only)
+
+The command exits with a distinct exit code if its flags are invalid, if
+Google Cloud couldn't be reached or if the build failed, as listed in the
+help for the '` + rootCommand + `' command.
 `
 )
 
@@ -53,10 +100,112 @@ overriding the release version as 'v0.14.0', run:
 	%s %s --branch=release-0.14 --release-version=v0.14.0`, rootCommand, stageCommand, rootCommand, stageCommand)
 )
 
+// stageResult is printed to stdout when the stage command is run with
+// --output=json.
+type stageResult struct {
+	BuildID    string `json:"buildID"`
+	LogURL     string `json:"logURL"`
+	Status     string `json:"status"`
+	OutputPath string `json:"outputPath"`
+	GitRef     string `json:"gitRef"`
+	Project    string `json:"project"`
+
+	// Shard is the name of the shard, if the build is one of the shards of a
+	// --shard-by-os build
+	Shard string `json:"shard,omitempty"`
+
+	// Shards are the results of each shard of a --shard-by-os build
+	Shards []*stageResult `json:"shards,omitempty"`
+
+	// Labels are the labels recorded on the build with --label
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Failure describes why the build did not succeed, once it has completed
+	Failure string `json:"failure,omitempty"`
+
+	// LogFile is the local path the build's log was downloaded to with
+	// --output-dir, once the build has completed
+	LogFile string `json:"logFile,omitempty"`
+
+	// MirrorPaths are the GCS paths the artifacts were mirrored to, once the
+	// build has completed
+	MirrorPaths []string `json:"mirrorPaths,omitempty"`
+
+	// Images is only set once the build has completed
+	Images []stageImage `json:"images,omitempty"`
+
+	// Provenance is the GCS path of the signed provenance of the release,
+	// if --generate-provenance is set
+	Provenance string `json:"provenance,omitempty"`
+
+	// provenanceBuild describes the completed build in the provenance of
+	// the release
+	provenanceBuild release.ProvenanceBuild
+}
+
+// stageImage is a container image pushed by a stage build.
+type stageImage struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+// defaultStageMachineType is the machine type used for stage builds if none is
+// set in the cloudbuild.yaml file or with --machine-type.
+const defaultStageMachineType = "n1-highcpu-32"
+
+// stageBuildTag is the tag set on all builds submitted by the stage
+// command by its cloudbuild.yaml.
+const stageBuildTag = "cert-manager-release-stage"
+
+// defaultStageRetryPattern matches the failures of a build which are
+// caused by Cloud Build itself rather than the build's steps, and so may
+// succeed if the build is retried.
+const defaultStageRetryPattern = `^(INTERNAL_ERROR|TIMEOUT)`
+
+// stageSubstitutions is the list of substitutions which are set on the
+// cloudbuild.yaml by the stage command.
+var stageSubstitutions = []string{
+	"_CM_REPO",
+	"_CM_REF",
+	"_RELEASE_VERSION",
+	"_RELEASE_BUCKET",
+	"_BUCKET_PATH_PREFIX",
+	"_TAG_RELEASE_BRANCH",
+	"_PUBLISHED_IMAGE_REPO",
+	"_KMS_KEY",
+	"_KMS_KEYS",
+	"_SKIP_SIGNING",
+	"_SIGNING_BACKEND",
+	"_SBOM_FORMAT",
+	"_COMPRESSION",
+	"_BUILD_TAGS",
+	"_LDFLAGS",
+	"_GO_VERSION",
+	"_ARTIFACT_TYPES",
+	"_TARGET_OSES",
+	"_TARGET_ARCHES",
+	"_SOURCE_TARBALL",
+	"_RELEASE_NOTES_OBJECT",
+	"_CMREL_VERSION",
+	"_SHARD",
+}
+
 type stageOptions struct {
+	// ConfigFile is the path to an optional YAML file containing values for
+	// any of the other flags, keyed by flag name
+	ConfigFile string
+
 	// The name of the GCS bucket to stage the release to
 	Bucket string
 
+	// MirrorBuckets are the names of additional GCS buckets the staged
+	// release is copied to once the build has succeeded
+	MirrorBuckets []string
+
+	// BucketPathPrefix is the path within the bucket under which release
+	// artifacts are staged
+	BucketPathPrefix string
+
 	// Name of the GitHub org to fetch cert-manager sources from
 	Org string
 
@@ -66,15 +215,31 @@ type stageOptions struct {
 	// Name of the branch in the GitHub repo to build cert-manager sources from
 	Branch string
 
+	// TagReleaseBranch, if set, is the branch recorded in the build's tags
+	// instead of Branch, e.g. when GitRef isn't on a matching branch
+	TagReleaseBranch string
+
 	// Optional commit ref of cert-manager that should be staged
 	GitRef string
 
+	// ExpectedGitRef, if set, is the full or abbreviated commit SHA which the
+	// HEAD of Branch must match when it is looked up
+	ExpectedGitRef string
+
 	// The path to the cloudbuild.yaml file used to perform the cert-manager crossbuild
 	CloudBuildFile string
 
+	// CloudBuildSHA256, if set, is the hex-encoded SHA256 checksum which the
+	// content of CloudBuildFile must match
+	CloudBuildSHA256 string
+
 	// Project is the name of the GCP project to run the GCB job in
 	Project string
 
+	// Region, if set, is the region to run the GCB job in using the regional
+	// Cloud Build endpoint
+	Region string
+
 	// ReleaseVersion, if set, overrides the version git version tag used
 	// during the build. This is used to force a build's version number to be
 	// the final release tag before a tag has actually been created in the
@@ -90,58 +255,383 @@ type stageOptions struct {
 	// SkipSigning, if true, will skip trying to sign artifacts using KMS
 	SkipSigning bool
 
-	// SigningKMSKey is the full name of the GCP KMS key to be used for signing, e.g.
+	// AllowUnsignedRelease, if true, permits SkipSigning to be set when
+	// staging a release, i.e. when ReleaseVersion is set
+	AllowUnsignedRelease bool
+
+	// Smoke, if true, configures a quick smoke test build of a single
+	// OS and architecture, without signing and with a shorter build timeout
+	Smoke bool
+
+	// SigningKMSKeys are the full names of the GCP KMS keys to be used for signing, e.g.
 	// projects/<PROJECT_NAME>/locations/<LOCATION>/keyRings/<KEYRING_NAME>/cryptoKeys/<KEY_NAME>/cryptoKeyVersions/<KEY_VERSION>
-	// This must be set if SkipSigning is not set to true
-	SigningKMSKey string
+	// At least one must be set if SkipSigning is not set to true and
+	// SigningBackend is 'kms'
+	SigningKMSKeys []string
+
+	// SBOMFormat, if set, is the format of an SBOM which will be generated
+	// and staged alongside the release artifacts
+	SBOMFormat string
+
+	// Compression is the format the release tarballs are staged in, one of
+	// 'gzip', 'zstd' or 'both'
+	Compression string
+
+	// GenerateProvenance, if true, generates, signs and uploads the SLSA
+	// provenance of the release once it has been staged
+	GenerateProvenance bool
+
+	// BuildTags is a comma-separated list of additional Go build tags to
+	// build the release with
+	BuildTags string
+
+	// LDFlags is a space-separated list of additional Go linker flags to
+	// build the release with
+	LDFlags string
+
+	// GoVersion, if set, is the version of the Go SDK the release is built
+	// with, e.g. '1.22.3'
+	GoVersion string
+
+	// ArtifactTypes is a comma-separated list of the types of artifact which
+	// should be built in this invocation
+	ArtifactTypes string
 
 	// TargetOSes is a comma-separated list of OSes which should be built for in this invocation
 	TargetOSes string
 
 	// TargetArches is a comma-separated list of architectures which should be built for in this invocation
 	TargetArches string
+
+	// WorkerPool, if set, is the full resource name of a private worker pool
+	// to run the GCB job in
+	WorkerPool string
+
+	// MachineType, if set, overrides the machine type the GCB job is run on
+	MachineType string
+
+	// LogsBucket, if set, is the GCS bucket, optionally followed by a path,
+	// which the logs of the GCB job are written to instead of the Cloud
+	// Build default logs bucket
+	LogsBucket string
+
+	// Substitutions are additional user-defined substitutions of the form
+	// KEY=VALUE which are set on the build after those set by cmrel, for
+	// substitutions declared by the cloudbuild.yaml which cmrel doesn't
+	// otherwise know about
+	Substitutions []string
+
+	// SubstitutionFile, if set, is the path to a YAML or JSON file of
+	// additional user-defined substitutions, which are overridden by any set
+	// with Substitutions
+	SubstitutionFile string
+
+	// AllowOverride, if true, allows Substitutions and SubstitutionFile to
+	// override the substitutions set by cmrel itself
+	AllowOverride bool
+
+	// SubstitutionsAsEnv, if true, also sets each of the build's
+	// substitutions as an environment variable of its steps
+	SubstitutionsAsEnv bool
+
+	// Labels are labels of the form KEY=VALUE which are recorded as tags on
+	// the build, so that it can be found in the Cloud Build console
+	Labels []string
+
+	// DiskSizeGB, if set, overrides the disk size requested for the GCB job
+	DiskSizeGB int64
+
+	// BuildTimeout is the maximum amount of time the GCB job is allowed to
+	// run for. It is set as the timeout on the submitted build, and is also
+	// used to bound how long the command will wait for the build to complete.
+	BuildTimeout time.Duration
+
+	// RetryOnFailure is the maximum number of times the build is resubmitted
+	// if it fails in a way which matches RetryPattern
+	RetryOnFailure int
+
+	// RetryPattern is a regular expression matched against the description
+	// of a failed build to determine whether the failure is transient and so
+	// the build should be retried
+	RetryPattern string
+
+	// ShardByOS, if true, submits a separate build for each target OS which
+	// are run in parallel, merging their results once all have succeeded
+	ShardByOS bool
+
+	// ShardConcurrency is the maximum number of builds run at once when
+	// ShardByOS is set
+	ShardConcurrency int
+
+	// RetryMissing, if true, only submits the shards of a ShardByOS build
+	// which are missing any of their files at the output path, e.g. to
+	// resume a release whose build failed for some OSes
+	RetryMissing bool
+
+	// APIMaxRetries is the maximum number of times a request to the Cloud
+	// Build API will be retried if it fails with a transient error.
+	APIMaxRetries int
+
+	// APIRetryDelay is the delay before the first retry of a failed request
+	// to the Cloud Build API, doubling after each subsequent attempt.
+	APIRetryDelay time.Duration
+
+	// PollInterval is the delay before a build is first polled whilst
+	// waiting for it to complete, doubling after each poll up to
+	// PollMaxInterval.
+	PollInterval time.Duration
+
+	// PollMaxInterval is the longest delay between polls of a build.
+	PollMaxInterval time.Duration
+
+	// StreamLogs, if true, will stream the GCB job's log output to stderr
+	// whilst waiting for the build to complete.
+	StreamLogs bool
+
+	// LogOutputDir, if set, is a local directory that the build's full log
+	// is downloaded to once the build has completed.
+	LogOutputDir string
+
+	// NoWait, if true, will return as soon as the build has been submitted
+	// instead of waiting for it to complete.
+	NoWait bool
+
+	// Lock, if true, acquires a lock object in the bucket before submitting
+	// the build, so that the same build can't be staged by anyone else until
+	// it has completed.
+	Lock bool
+
+	// ForceLock, if true, overrides a stale lock left by a previous
+	// invocation which didn't release it.
+	ForceLock bool
+
+	// AttachBuildID, if set, is the ID of an existing stage build to wait
+	// for instead of submitting a new build
+	AttachBuildID string
+
+	// DryRun, if true, will print the fully resolved build to stdout instead
+	// of submitting it to Cloud Build.
+	DryRun bool
+
+	// PrintSubstitutions, if true, will log the final substitutions set on
+	// the build before it is submitted
+	PrintSubstitutions bool
+
+	// Yes, if true, skips prompting for confirmation before staging a
+	// release build, which is required when stdin is not a terminal
+	Yes bool
+
+	// SigningBackend is the backend used to sign artifacts during the build,
+	// one of 'kms' or 'cosign'
+	SigningBackend string
+
+	// SkipPreflight, if true, will skip checking that the caller has access
+	// to the signing KMS key and can write to the bucket before submitting
+	// the build.
+	SkipPreflight bool
+
+	// SummaryFormat is the format the result of the build is summarised in
+	// once it has been submitted, one of 'text', 'json' or 'github-actions'
+	SummaryFormat string
+
+	// SlackWebhook, if set, is the URL of a Slack incoming webhook which is
+	// posted a message describing the outcome of the build once it completes
+	SlackWebhook string
+
+	// PreStageHook, if set, is the path to an executable which is run
+	// immediately before the build is submitted. The build is not submitted
+	// if it fails.
+	PreStageHook string
+
+	// PostStageHook, if set, is the path to an executable which is run once
+	// the build has completed successfully. Its failure only logs a warning.
+	PostStageHook string
+
+	// SourceTarball, if set, is the path to a gzipped tar archive of a local
+	// cert-manager checkout which is uploaded and built instead of cloning
+	// the repository from GitHub
+	SourceTarball string
+
+	// ReleaseNotesFile, if set, is the path to a release notes file which is
+	// uploaded and staged alongside the release artifacts
+	ReleaseNotesFile string
+
+	// SkipRefCheck, if true, will skip checking that the commit given by
+	// GitRef exists in the repository on GitHub before submitting the build.
+	SkipRefCheck bool
+
+	// SkipBranchCheck, if true, will skip checking that the commit given by
+	// GitRef is on Branch before submitting the build
+	SkipBranchCheck bool
+
+	// GitHubToken is used to authenticate requests to the GitHub API when
+	// looking up the commit ref of the given branch or checking GitRef
+	// exists. If not set, the
+	// GITHUB_TOKEN environment variable is used.
+	GitHubToken string
+
+	// GitHubBaseURL is the base URL of the GitHub API used to look up the
+	// commit ref of the given branch, for repositories hosted on GitHub
+	// Enterprise.
+	GitHubBaseURL string
 }
 
 func (o *stageOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.ConfigFile, "config", "", "Path to a YAML file containing values for any of the other flags of this command, keyed by flag name, e.g. 'branch: release-1.6'. Flags set on the command line take precedence over values in the file.")
 	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket to stage the release to.")
-	fs.StringVar(&o.Org, "org", "jetstack", "Name of the GitHub org to fetch cert-manager sources from.")
+	fs.StringSliceVar(&o.MirrorBuckets, "mirror-bucket", nil, "Name of an additional GCS bucket to mirror the staged release to once the build has succeeded, at the same path as in --bucket. Objects are copied server-side. May be repeated or given as a comma-separated list, and the command fails if mirroring to any bucket fails.")
+	fs.StringVar(&o.BucketPathPrefix, "bucket-path-prefix", release.DefaultBucketPathPrefix, "The path within the bucket under which to stage the release, e.g. to stage test builds away from the shared devel path.")
+	fs.StringVar(&o.Org, "org", defaultStageOrg(), fmt.Sprintf("Name of the GitHub org to fetch cert-manager sources from. Defaults to the value of the %s environment variable if set. The legacy default of %q is deprecated in favour of %q.", stageOrgEnvVar, release.DefaultGitHubOrg, release.CanonicalGitHubOrg))
 	fs.StringVar(&o.Repo, "repo", "cert-manager", "Name of the GitHub repo to fetch cert-manager sources from.")
 	fs.StringVar(&o.Branch, "branch", "master", "The git branch to build the release from. If --git-ref is not specified, the HEAD of this branch will be looked up on GitHub.")
+	fs.StringVar(&o.TagReleaseBranch, "tag-release-branch", "", "Optional branch to record in the build's tags, and so use when tagging the release, instead of --branch, e.g. when staging a --git-ref such as a pull request merge commit which isn't on the branch it will be released from.")
 	fs.StringVar(&o.GitRef, "git-ref", "", "The git commit ref of cert-manager that should be staged.")
+	fs.StringVar(&o.ExpectedGitRef, "expected-git-ref", "", "Optional full or abbreviated commit SHA which the HEAD of --branch must match when it is looked up, failing otherwise, e.g. to guard against a commit landing on the branch after it was inspected. Cannot be used with --git-ref or --source-tarball.")
+	fs.StringVar(&o.SourceTarball, "source-tarball", "", "Optional path to a gzipped tar archive of a local cert-manager checkout, including its .git directory, to build instead of cloning the repository from GitHub, e.g. created with 'tar -czf source.tar.gz -C cert-manager .'. The archive is uploaded to --bucket and the git commit ref is read from it.")
+	fs.StringVar(&o.ReleaseNotesFile, "release-notes-file", "", fmt.Sprintf("Optional path to a release notes file, e.g. written in Markdown, which is staged alongside the release artifacts as %q and recorded in the release manifest so that it is versioned with the release. The file must not be empty. If not set, no release notes are staged.", release.ReleaseNotesFileName))
+	fs.BoolVar(&o.SkipRefCheck, "skip-ref-check", false, "Skip checking that --git-ref exists in the GitHub repository before submitting the build, e.g. when GitHub can't be reached.")
+	fs.BoolVar(&o.SkipBranchCheck, "skip-branch-check", false, "Skip checking that --git-ref is the HEAD of --branch, or one of its ancestors, before submitting the build, e.g. to intentionally stage a commit from another branch. Always skipped with --skip-ref-check.")
 	fs.StringVar(&o.CloudBuildFile, "cloudbuild", "./gcb/stage/cloudbuild.yaml", "The path to the cloudbuild.yaml file used to perform the cert-manager crossbuild. "+
 		"The default value assumes that this tool is run from the root of the release repository.")
+	fs.StringVar(&o.CloudBuildSHA256, "cloudbuild-sha256", "", "Optional hex-encoded SHA256 checksum which the content of the --cloudbuild file must match before the build is submitted, e.g. as printed by 'sha256sum', to pin the exact build definition which is run.")
 	fs.StringVar(&o.Project, "project", release.DefaultReleaseProject, "The GCP project to run the GCB build jobs in.")
+	fs.StringVar(&o.Region, "region", "", "Optional region to run the GCB build job in, e.g. 'us-central1', using the regional Cloud Build endpoint. If --worker-pool is set, the pool must be in this region. If not set, the global endpoint is used.")
 	fs.StringVar(&o.ReleaseVersion, "release-version", "", "Optional release version override used to force the version strings used during the release to a specific value. If not set, build is treated as development build and artifacts staged to 'devel' path.")
 	fs.StringVar(&o.PublishedImageRepository, "published-image-repo", release.DefaultImageRepository, "The docker image repository set when building the release.")
-	fs.StringVar(&o.SigningKMSKey, "signing-kms-key", defaultKMSKey, "Full name of the GCP KMS key to use for signing")
-	fs.BoolVar(&o.SkipSigning, "skip-signing", false, "Skip signing release artifacts.")
+	fs.StringSliceVar(&o.SigningKMSKeys, "signing-kms-key", []string{defaultKMSKey}, "Full name of the GCP KMS key to use for signing. May be repeated or given as a comma-separated list to sign with multiple keys, e.g. whilst rotating keys.")
+	fs.BoolVar(&o.SkipSigning, "skip-signing", false, "Skip signing release artifacts. Cannot be used with --release-version unless --allow-unsigned-release is set.")
+	fs.BoolVar(&o.AllowUnsignedRelease, "allow-unsigned-release", false, "If true, allow --skip-signing to be used when staging a release with --release-version, producing unsigned release artifacts.")
+	fs.BoolVar(&o.Smoke, "smoke", false, fmt.Sprintf("If true, stage a quick smoke test build for %s/%s only, with --skip-signing and a --build-timeout of %s unless either is set explicitly. Cannot be used with --target-os or --target-arch.", smokeTargetOS, smokeTargetArch, smokeBuildTimeout))
+	fs.StringVar(&o.SigningBackend, "signing-backend", sign.SigningBackendKMS, fmt.Sprintf("The backend used to sign release artifacts. If 'cosign', the staged %s file is signed using cosign's keyless mode with the identity of the build's service account, producing signatures recorded in the Sigstore transparency log, and --signing-kms-key is ignored. Container images aren't signed by the cosign backend, since they aren't pushed when staging. Options: %s", release.ChecksumsFileName, strings.Join(sign.SigningBackends, ", ")))
+	fs.BoolVar(&o.SkipPreflight, "skip-preflight", false, "Skip checking that the caller has permission to sign using the KMS key, and to write to --bucket and any --mirror-bucket, before submitting the build.")
+
+	fs.StringVar(&o.SBOMFormat, "sbom-format", "", fmt.Sprintf("If set, generate an SBOM in the given format of the Go modules linked into the release's binaries and stage it alongside the release artifacts. Options: %s", strings.Join(release.SBOMFormats, ", ")))
+	fs.StringVar(&o.Compression, "compression", release.CompressionGzip, fmt.Sprintf("Format to stage the release tarballs in. 'zstd' tarballs are recompressed from the gzip tarballs produced by the build, and 'both' stages both. Releases staged with only zstd tarballs can't be published, as publishing reads the gzip tarballs. Options: %s", strings.Join(release.Compressions, ", ")))
+
+	fs.StringVar(&o.BuildTags, "build-tags", "", "Optional comma-separated list of additional Go build tags to build the release with, e.g. 'fips'.")
+	fs.StringVar(&o.LDFlags, "ldflags", "", "Optional space-separated list of additional Go linker flags to build the release with, e.g. '-X main.variant=fips'. Values can't be quoted, so must not contain spaces.")
+	fs.StringVar(&o.GoVersion, "go-version", "", "If set, the version of the Go SDK to build the release with, e.g. '1.22.3', allowing a single cloudbuild.yaml to serve release branches which pin different Go versions. It is selected as the rules_go SDK of the Bazel build, so must be registered by the cert-manager repository's WORKSPACE, and is also used to build the cosign and cmrel helpers. If not set, the SDK registered by the WORKSPACE is used.")
 
 	allOSList := release.AllOSes()
 
 	allOSes := strings.Join(allOSList.List(), ", ")
 	allArches := strings.Join(release.AllArchesForOSes(allOSList).List(), ", ")
 
-	fs.StringVar(&o.TargetOSes, "target-os", "*", fmt.Sprintf("Comma-separated list of OSes to target, or '*' for all. Options: %s", allOSes))
-	fs.StringVar(&o.TargetArches, "target-arch", "*", fmt.Sprintf("Comma-separated list of arches to target, or '*' for all. Options: %s", allArches))
+	fs.StringVar(&o.ArtifactTypes, "artifact-types", "*", fmt.Sprintf("Comma-separated list of the types of artifact to build, or '*' for all. Types prefixed with '!' are excluded, e.g. '*,!charts'. Options: %s", strings.Join(release.ArtifactTypes, ", ")))
+	fs.StringVar(&o.TargetOSes, "target-os", "*", fmt.Sprintf("Comma-separated list of OSes to target, or '*' for all. OSes prefixed with '!' are excluded, e.g. '*,!windows'. Options: %s", allOSes))
+	fs.StringVar(&o.TargetArches, "target-arch", "*", fmt.Sprintf("Comma-separated list of arches to target, or '*' for all. Arches prefixed with '!' are excluded, e.g. '*,!s390x'. Options: %s", allArches))
+	fs.StringVar(&o.WorkerPool, "worker-pool", "", "Optional full resource name of a Cloud Build private worker pool to run the GCB build job in, of the form projects/{project}/locations/{location}/workerPools/{name}. The pool must be in the same project as --project.")
+	fs.StringVar(&o.MachineType, "machine-type", "", fmt.Sprintf("The machine type to run the GCB build job on. If not set, the machine type in the cloudbuild.yaml file is used, or %s if none is set. Options: %s", defaultStageMachineType, strings.Join(gcb.MachineTypes, ", ")))
+	fs.StringVar(&o.LogsBucket, "logs-bucket", "", "Optional GCS bucket to write the logs of the GCB build job to, e.g. gs://my-logs or gs://my-logs/cert-manager to write them under a path, so that they're retained according to the bucket's policy. The build's service account must be able to write to the bucket. If not set, logs are written to the Cloud Build default logs bucket.")
+	fs.Int64Var(&o.DiskSizeGB, "disk-size-gb", 0, "The disk size in GB to request for the GCB build job. If not set, the disk size in the cloudbuild.yaml file is used, or the Cloud Build default if none is set.")
+	fs.StringArrayVar(&o.Substitutions, "set-substitution", nil, "Additional Cloud Build substitution to set on the build, of the form _KEY=VALUE, e.g. to set a substitution declared by the cloudbuild.yaml file which has no corresponding flag. May be repeated, and takes precedence over --substitution-file. Substitutions set by cmrel itself can't be overridden unless --allow-override is set.")
+	fs.StringVar(&o.SubstitutionFile, "substitution-file", "", "Optional path to a YAML or JSON file, chosen by its .yaml, .yml or .json extension, mapping additional Cloud Build substitution keys to string values to set on the build, as with --set-substitution.")
+	fs.StringArrayVar(&o.Labels, "label", nil, "Label of the form key=value to record on the Cloud Build job, so that builds can be filtered by it in the console. Keys and values may only contain lowercase letters, digits, '_' and '-', and each label is stored as a build tag of the form 'key.value'. May be repeated.")
+	fs.BoolVar(&o.AllowOverride, "allow-override", false, "If true, allow --set-substitution and --substitution-file to override the substitutions set by cmrel itself, such as _CM_REF. Use with care, as the build may no longer match the other flags.")
+	fs.BoolVar(&o.SubstitutionsAsEnv, "substitutions-as-env", false, "If true, also set every substitution of the build, including those set by cmrel, as an environment variable of the same name in each of the build's steps, e.g. so that _CM_REF can be read from the environment of a script.")
+	fs.DurationVar(&o.BuildTimeout, "build-timeout", time.Minute*60, "Maximum amount of time the GCB build job is allowed to run for. If exceeded, the build will be cancelled.")
+	fs.IntVar(&o.RetryOnFailure, "retry-on-failure", 0, "Maximum number of times to resubmit the build if it fails in a way matching --retry-pattern, e.g. due to a transient Cloud Build infrastructure issue. Each attempt is logged, and the build is never retried if it fails for any other reason.")
+	fs.BoolVar(&o.GenerateProvenance, "generate-provenance", false, fmt.Sprintf("If true, generate a SLSA provenance statement describing how the release was built once it has been staged, sign it with each --signing-kms-key and upload it alongside the artifacts as %q. Requires the 'kms' signing backend.", release.ProvenanceFileName))
+	fs.BoolVar(&o.ShardByOS, "shard-by-os", false, "If true, submit a separate build for each target OS, restricted to that OS, and wait for them to complete in parallel. Artifacts of all builds are staged to the same path, and the release metadata and checksums are merged and signed once every build has succeeded, so the release is only staged if all builds succeed. Requires the 'kms' signing backend unless --skip-signing is set.")
+	fs.IntVar(&o.ShardConcurrency, "shard-concurrency", defaultShardConcurrency, "Maximum number of builds run at once with --shard-by-os.")
+	fs.BoolVar(&o.RetryMissing, "retry-missing", false, "If true, list the files already staged by an earlier --shard-by-os build of the same release and only submit the shards which are missing any of their artifacts, e.g. after some of the shards failed, before merging the files of every shard. Each shard builds one OS, so all targeted arches of an OS are rebuilt if any of its artifacts are missing. Requires --shard-by-os, and the other flags must match those of the earlier build.")
+	fs.StringVar(&o.RetryPattern, "retry-pattern", defaultStageRetryPattern, "Regular expression matched against the description of a failed build, made up of its status, failure type and failure detail, e.g. 'FAILURE (USER_BUILD_STEP): Build step failure', to decide whether it should be retried with --retry-on-failure.")
+	fs.StringVar(&o.AttachBuildID, "attach-build-id", "", "If set, attach to the existing stage build with the given ID or full resource name instead of submitting a new build, e.g. to resume waiting for a build after losing connection. All flags describing the build are ignored.")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "If true, print the resolved cloudbuild.yaml that would be submitted to stdout and exit without submitting a build.")
+	fs.BoolVar(&o.PrintSubstitutions, "print-substitutions", false, "If true, log the final substitutions set on the build as sorted KEY=VALUE lines before it is submitted, and continue staging as normal. The values of sensitive substitutions are redacted.")
+	fs.BoolVar(&o.Yes, "yes", false, "If true, don't prompt for confirmation before staging a release build when --release-version is set. Required when stdin is not a terminal, e.g. in CI.")
+	fs.IntVar(&o.APIMaxRetries, "api-max-retries", gcb.DefaultRetryOptions.MaxRetries, "Maximum number of times a request to the Cloud Build API is retried if it fails with a transient error: 429 for any request, or 5xx for requests which are safe to replay, i.e. not the request submitting a build.")
+	fs.DurationVar(&o.APIRetryDelay, "api-retry-delay", gcb.DefaultRetryOptions.BaseDelay, "Delay before retrying a failed request to the Cloud Build API, doubled after each attempt.")
+	fs.DurationVar(&o.PollInterval, "poll-interval", gcb.DefaultPollOptions.Interval, "Delay before first polling the status of the build whilst waiting for it to complete, doubled after each poll up to --poll-max-interval.")
+	fs.DurationVar(&o.PollMaxInterval, "poll-max-interval", gcb.DefaultPollOptions.MaxInterval, "Longest delay between polls of the status of the build whilst waiting for it to complete.")
+	fs.StringVar(&o.LogOutputDir, "output-dir", "", "Optional local directory to download the build's full log to once it has completed, as a file named after the build ID. Can be used with --stream-logs to keep an archived copy of the log.")
+	fs.BoolVar(&o.Lock, "lock", false, "If true, acquire a lock object in --bucket for the release version and git ref before submitting the build, refusing to stage if anyone else holds the lock. The lock is released once the build has completed.")
+	fs.BoolVar(&o.ForceLock, "force-lock", false, "If true, override a stale lock which has expired without being released, e.g. if a previous invocation was killed. Locks which haven't expired are never overridden.")
+	fs.BoolVar(&o.NoWait, "no-wait", false, "If true, exit as soon as the build has been submitted instead of waiting for it to complete. The build can be inspected later using 'gcb status'.")
+	fs.BoolVar(&o.StreamLogs, "stream-logs", false, "If true, stream the build's log output to stderr whilst waiting for it to complete.")
+	fs.StringVar(&o.SummaryFormat, "summary-format", summaryFormatText, fmt.Sprintf("Format of the summary of the build's result. If 'json', the result is printed to stdout as with --output=json but logs are not suppressed. If 'github-actions', the build_id, log_url, output_path and status are set as GitHub Actions step outputs, written to $GITHUB_OUTPUT if set. Options: %s", strings.Join(summaryFormats, ", ")))
+	fs.StringVar(&o.SlackWebhook, "slack-webhook", "", "Optional URL of a Slack incoming webhook to post the version, branch, status, duration and log URL of the build to once it completes, whether or not it succeeds. Failing to post the message does not fail the command.")
+	fs.StringVar(&o.PreStageHook, "pre-stage-hook", "", "Optional path to an executable to run immediately before the build is submitted, e.g. to update an issue tracker. The build is not submitted if it exits with a non-zero status. The release version, git ref, branch and output path are passed to it in the CMREL_* environment variables.")
+	fs.StringVar(&o.PostStageHook, "post-stage-hook", "", "Optional path to an executable to run once the build has completed successfully. It is passed the same environment as --pre-stage-hook, as well as the build's ID and log URL. If it fails, a warning is logged but the command does not fail.")
+
+	fs.StringVar(&o.GitHubToken, "github-token", "", "GitHub token used to authenticate the lookup of the branch's commit ref when --git-ref is not specified, or the check that --git-ref exists. Defaults to the value of the GITHUB_TOKEN environment variable.")
+	fs.StringVar(&o.GitHubBaseURL, "github-base-url", release.DefaultGitHubAPIURL, "Base URL of the GitHub API used to look up the branch's commit ref when --git-ref is not specified, or to check that --git-ref exists. For GitHub Enterprise, the host's URL may be given and '/api/v3' will be appended.")
 
 	markRequired("branch")
 }
 
-func (o *stageOptions) print() {
-	log.Printf("Stage options:")
-	log.Printf("  Bucket: %q", o.Bucket)
-	log.Printf("  Org: %q", o.Org)
-	log.Printf("  Repo: %q", o.Repo)
-	log.Printf("  Branch: %q", o.Branch)
-	log.Printf("  GitRef: %q", o.GitRef)
-	log.Printf("  CloudBuildFile: %q", o.CloudBuildFile)
-	log.Printf("  SkipSigning: %v", o.SkipSigning)
-	log.Printf("  Project: %q", o.Project)
-	log.Printf("  SigningKMSKey: %q", o.SigningKMSKey)
-	log.Printf("  ReleaseVersion: %q", o.ReleaseVersion)
-	log.Printf("  PublishedImageRepo: %q", o.PublishedImageRepository)
-	log.Printf("  TargetOSes: %q", o.TargetOSes)
-	log.Printf("  TargetArches: %q", o.TargetArches)
+func (o *stageOptions) print(logger logr.Logger) {
+	logger.Info("Stage options",
+		"ConfigFile", o.ConfigFile,
+		"Bucket", o.Bucket,
+		"MirrorBuckets", o.MirrorBuckets,
+		"BucketPathPrefix", o.BucketPathPrefix,
+		"Org", o.Org,
+		"Repo", o.Repo,
+		"Branch", o.Branch,
+		"TagReleaseBranch", o.TagReleaseBranch,
+		"GitRef", o.GitRef,
+		"ExpectedGitRef", o.ExpectedGitRef,
+		"SourceTarball", o.SourceTarball,
+		"ReleaseNotesFile", o.ReleaseNotesFile,
+		"SkipRefCheck", o.SkipRefCheck,
+		"SkipBranchCheck", o.SkipBranchCheck,
+		"CloudBuildFile", o.CloudBuildFile,
+		"CloudBuildSHA256", o.CloudBuildSHA256,
+		"SkipSigning", o.SkipSigning,
+		"AllowUnsignedRelease", o.AllowUnsignedRelease,
+		"Smoke", o.Smoke,
+		"Project", o.Project,
+		"Region", o.Region,
+		"SigningKMSKeys", o.SigningKMSKeys,
+		"SigningBackend", o.SigningBackend,
+		"SkipPreflight", o.SkipPreflight,
+		"ReleaseVersion", o.ReleaseVersion,
+		"PublishedImageRepo", o.PublishedImageRepository,
+		"SBOMFormat", o.SBOMFormat,
+		"Compression", o.Compression,
+		"GenerateProvenance", o.GenerateProvenance,
+		"BuildTags", o.BuildTags,
+		"LDFlags", o.LDFlags,
+		"GoVersion", o.GoVersion,
+		"ArtifactTypes", o.ArtifactTypes,
+		"TargetOSes", o.TargetOSes,
+		"TargetArches", o.TargetArches,
+		"WorkerPool", o.WorkerPool,
+		"MachineType", o.MachineType,
+		"LogsBucket", o.LogsBucket,
+		"DiskSizeGB", o.DiskSizeGB,
+		"Substitutions", o.Substitutions,
+		"SubstitutionFile", o.SubstitutionFile,
+		"AllowOverride", o.AllowOverride,
+		"SubstitutionsAsEnv", o.SubstitutionsAsEnv,
+		"Labels", o.Labels,
+		"BuildTimeout", o.BuildTimeout,
+		"RetryOnFailure", o.RetryOnFailure,
+		"RetryPattern", o.RetryPattern,
+		"ShardByOS", o.ShardByOS,
+		"ShardConcurrency", o.ShardConcurrency,
+		"RetryMissing", o.RetryMissing,
+		"APIMaxRetries", o.APIMaxRetries,
+		"APIRetryDelay", o.APIRetryDelay,
+		"PollInterval", o.PollInterval,
+		"PollMaxInterval", o.PollMaxInterval,
+		"StreamLogs", o.StreamLogs,
+		"LogOutputDir", o.LogOutputDir,
+		"NoWait", o.NoWait,
+		"Lock", o.Lock,
+		"ForceLock", o.ForceLock,
+		"AttachBuildID", o.AttachBuildID,
+		"DryRun", o.DryRun,
+		"PrintSubstitutions", o.PrintSubstitutions,
+		"Yes", o.Yes,
+		"SummaryFormat", o.SummaryFormat,
+		"SlackWebhookSet", o.SlackWebhook != "",
+		"PreStageHook", o.PreStageHook,
+		"PostStageHook", o.PostStageHook,
+		"GitHubTokenSet", o.GitHubToken != "",
+		"GitHubBaseURL", o.GitHubBaseURL,
+	)
 }
 
 func stageCmd(rootOpts *rootOptions) *cobra.Command {
@@ -152,107 +642,1449 @@ func stageCmd(rootOpts *rootOptions) *cobra.Command {
 		Long:         stageLongDescription,
 		Example:      stageExample,
 		SilenceUsage: true,
-		PreRun: func(cmd *cobra.Command, args []string) {
-			o.print()
-			log.Printf("---")
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if o.ConfigFile != "" {
+				if err := loadFlagsFromConfigFile(cmd.Flags(), o.ConfigFile, "config"); err != nil {
+					return withKind(ErrValidation, err)
+				}
+			}
+			if err := applySmokeFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			warnLegacyOrg(cmd.Flags())
+			rootOpts.printOptions(o.print)
+			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runStage(rootOpts, o)
 		},
 	}
 	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	mustRegisterFlagCompletionFunc(cmd, "branch", completeBranches(&o.Org, &o.Repo, &o.GitHubBaseURL, &o.GitHubToken, false))
+	mustRegisterFlagCompletionFunc(cmd, "target-os", completeTargetOSes)
+	mustRegisterFlagCompletionFunc(cmd, "target-arch", completeTargetArches(&o.TargetOSes))
 	return cmd
 }
 
 func runStage(rootOpts *rootOptions, o *stageOptions) error {
-	if o.GitRef == "" {
-		log.Printf("git-ref flag not specified, looking up git commit ref for %s/%s@%s", o.Org, o.Repo, o.Branch)
-		ref, err := release.LookupBranchRef(o.Org, o.Repo, o.Branch)
-		if err != nil {
-			return fmt.Errorf("error looking up git commit ref: %w", err)
-		}
-		o.GitRef = ref
+	// Cancel the context when the process is interrupted, so that any
+	// in-flight build can be cancelled before exiting.
+	rootCtx, cancel := rootOpts.context()
+	defer cancel()
+	ctx, stop := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := validateSummaryFormat(o.SummaryFormat); err != nil {
+		return validationErrorf("invalid --summary-format: %w", err)
 	}
 
-	if o.SigningKMSKey != "" {
-		if _, err := sign.NewGCPKMSKey(o.SigningKMSKey); err != nil {
+	result, err := stage(ctx, stop, rootOpts, o)
+	if result != nil {
+		if err := printStageSummary(rootOpts, o.SummaryFormat, result); err != nil {
 			return err
 		}
 	}
+	return err
+}
 
-	log.Printf("Staging build for %s/%s@%s", o.Org, o.Repo, o.GitRef)
+const (
+	// smokeTargetOS and smokeTargetArch are the only platform built by a
+	// --smoke build, chosen as the quickest to build
+	smokeTargetOS   = "linux"
+	smokeTargetArch = "amd64"
 
-	log.Printf("DEBUG: Loading cloudbuild.yaml file from %q", o.CloudBuildFile)
-	build, err := gcb.LoadBuild(o.CloudBuildFile)
+	// smokeBuildTimeout is the --build-timeout of a --smoke build
+	smokeBuildTimeout = 20 * time.Minute
+)
+
+// stageOrgEnvVar is the environment variable which, if set, is the default
+// value of --org.
+const stageOrgEnvVar = "CMREL_ORG"
+
+// defaultStageOrg returns the default value of --org.
+func defaultStageOrg() string {
+	if org := os.Getenv(stageOrgEnvVar); org != "" {
+		return org
+	}
+	return release.DefaultGitHubOrg
+}
+
+// legacyOrgWarning returns a warning if --org in fs is the deprecated legacy
+// default, because it was neither set explicitly nor by stageOrgEnvVar, or
+// else an empty string.
+func legacyOrgWarning(fs *flag.FlagSet) string {
+	f := fs.Lookup("org")
+	if f == nil || f.Changed || os.Getenv(stageOrgEnvVar) != "" || f.Value.String() != release.DefaultGitHubOrg {
+		return ""
+	}
+	return fmt.Sprintf("--org defaults to the legacy %q org, but cert-manager has moved to the %q org. "+
+		"The default will change in future, so set --org=%s, or the %s environment variable, explicitly.",
+		release.DefaultGitHubOrg, release.CanonicalGitHubOrg, release.CanonicalGitHubOrg, stageOrgEnvVar)
+}
+
+// warnLegacyOrg logs the warning returned by legacyOrgWarning, if any.
+func warnLegacyOrg(fs *flag.FlagSet) {
+	if warning := legacyOrgWarning(fs); warning != "" {
+		log.Printf("WARNING: %s", warning)
+	}
+}
+
+// applySmokeFlags sets the flags implied by --smoke if it is set in fs.
+// Flags which were set explicitly, or by a config file, take precedence,
+// except for the target platform flags which can't be used with --smoke at
+// all.
+func applySmokeFlags(fs *flag.FlagSet) error {
+	if smoke, err := fs.GetBool("smoke"); err != nil || !smoke {
+		return err
+	}
+
+	for _, name := range []string{"target-os", "target-arch"} {
+		if fs.Changed(name) {
+			return validationErrorf("--%s cannot be used with --smoke", name)
+		}
+	}
+
+	implied := map[string]string{
+		"target-os":     smokeTargetOS,
+		"target-arch":   smokeTargetArch,
+		"skip-signing":  "true",
+		"build-timeout": smokeBuildTimeout.String(),
+	}
+	for _, name := range []string{"target-os", "target-arch", "skip-signing", "build-timeout"} {
+		if fs.Changed(name) {
+			continue
+		}
+		if err := fs.Set(name, implied[name]); err != nil {
+			return fmt.Errorf("failed to set --%s for --smoke: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// stageBuildSubstitutions returns the value of each of stageSubstitutions
+// to set on a stage build, as configured by the given options.
+func stageBuildSubstitutions(o *stageOptions, bucketPathPrefix string, signingKeys []sign.GCPKMSKey, artifactTypes, targetOSes, targetArches sets.String) map[string]string {
+	substitutions := make(map[string]string, len(stageSubstitutions))
+	substitutions["_CM_REPO"] = fmt.Sprintf("https://github.com/%s/%s.git", o.Org, o.Repo)
+	substitutions["_CM_REF"] = o.GitRef
+	substitutions["_RELEASE_VERSION"] = o.ReleaseVersion
+	substitutions["_RELEASE_BUCKET"] = o.Bucket
+	substitutions["_BUCKET_PATH_PREFIX"] = bucketPathPrefix
+	substitutions["_TAG_RELEASE_BRANCH"] = o.Branch
+	if o.TagReleaseBranch != "" {
+		substitutions["_TAG_RELEASE_BRANCH"] = o.TagReleaseBranch
+	}
+	substitutions["_PUBLISHED_IMAGE_REPO"] = o.PublishedImageRepository
+	// _KMS_KEY is still set to the first key for compatibility with
+	// cloudbuild.yaml files which don't support multiple keys
+	signingKeyNames := make([]string, len(signingKeys))
+	for i, key := range signingKeys {
+		signingKeyNames[i] = key.String()
+	}
+	substitutions["_KMS_KEY"] = ""
+	if len(signingKeyNames) > 0 {
+		substitutions["_KMS_KEY"] = signingKeyNames[0]
+	}
+	substitutions["_KMS_KEYS"] = strings.Join(signingKeyNames, ",")
+	substitutions["_SKIP_SIGNING"] = fmt.Sprintf("%v", o.SkipSigning)
+	substitutions["_SIGNING_BACKEND"] = o.SigningBackend
+	substitutions["_SBOM_FORMAT"] = o.SBOMFormat
+	substitutions["_COMPRESSION"] = o.Compression
+	substitutions["_BUILD_TAGS"] = o.BuildTags
+	substitutions["_LDFLAGS"] = o.LDFlags
+	substitutions["_GO_VERSION"] = o.GoVersion
+	substitutions["_ARTIFACT_TYPES"] = strings.Join(artifactTypes.List(), ",")
+	substitutions["_TARGET_OSES"] = strings.Join(targetOSes.List(), ",")
+	substitutions["_TARGET_ARCHES"] = strings.Join(targetArches.List(), ",")
+	substitutions["_SOURCE_TARBALL"] = ""
+	substitutions["_RELEASE_NOTES_OBJECT"] = ""
+	substitutions["_CMREL_VERSION"] = version.Get().Version
+	substitutions["_SHARD"] = ""
+	return substitutions
+}
+
+// userSubstitutions returns the user-defined substitutions to set on a stage
+// build, loaded from --substitution-file and then overridden by any given
+// with --set-substitution.
+func userSubstitutions(o *stageOptions) (map[string]string, error) {
+	reserved := stageSubstitutions
+	if o.AllowOverride {
+		reserved = nil
+	}
+
+	substitutions := map[string]string{}
+	if o.SubstitutionFile != "" {
+		fromFile, err := gcb.LoadSubstitutionsFile(o.SubstitutionFile, reserved)
+		if err != nil {
+			return nil, validationErrorf("invalid --substitution-file: %w", err)
+		}
+		substitutions = fromFile
+	}
+
+	fromFlags, err := gcb.ParseSubstitutions(o.Substitutions, reserved)
 	if err != nil {
-		return fmt.Errorf("error loading cloudbuild.yaml file: %w", err)
+		return nil, validationErrorf("invalid --set-substitution: %w", err)
+	}
+	for key, value := range fromFlags {
+		substitutions[key] = value
 	}
 
-	if build.Options == nil {
-		build.Options = &cloudbuild.BuildOptions{MachineType: "n1-highcpu-32"}
+	return substitutions, nil
+}
+
+// printStageSummary prints the result of a stage build to stdout in the given
+// summary format. The result is always printed as JSON if --output=json is set.
+func printStageSummary(rootOpts *rootOptions, format string, result *stageResult) error {
+	switch {
+	case rootOpts.Output == outputJSON, format == summaryFormatJSON:
+		return printJSON(result)
+	case format == summaryFormatGitHubActions:
+		return printGitHubActionsOutputs(result.summaryOutputs())
 	}
+	return nil
+}
 
-	targetOSes, err := release.OSListFromString(o.TargetOSes)
+// summaryOutputs returns the fields of the result which are set as outputs
+// when summarised for GitHub Actions.
+func (r *stageResult) summaryOutputs() []summaryOutput {
+	return []summaryOutput{
+		{Name: "build_id", Value: r.BuildID},
+		{Name: "log_url", Value: r.LogURL},
+		{Name: "output_path", Value: r.OutputPath},
+		{Name: "status", Value: r.Status},
+	}
+}
+
+// stage will stage a release of a single branch as configured by o, waiting
+// for the build to complete unless --no-wait is set. The returned result is
+// nil if no build was submitted or its outcome is unknown. stop is called to
+// restore the default signal behaviour if ctx is cancelled by an interrupt.
+func stage(ctx context.Context, stop func(), rootOpts *rootOptions, o *stageOptions) (*stageResult, error) {
+	if o.BuildTimeout <= 0 {
+		return nil, validationErrorf("invalid --build-timeout %q: must be a positive duration", o.BuildTimeout)
+	}
+
+	if o.ReleaseVersion != "" {
+		if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+			return nil, validationErrorf("invalid --release-version: %w", err)
+		}
+	}
+
+	if err := validateReleaseSigning(o); err != nil {
+		return nil, withKind(ErrValidation, err)
+	}
+
+	bucketPathPrefix, err := release.NormalizeBucketPathPrefix(o.BucketPathPrefix)
 	if err != nil {
-		return fmt.Errorf("invalid --target-os list: %w", err)
+		return nil, validationErrorf("invalid --bucket-path-prefix: %w", err)
 	}
 
-	targetArches, err := release.ArchListFromString(o.TargetArches, targetOSes)
+	if err := gcb.ValidateRegion(o.Region); err != nil {
+		return nil, validationErrorf("invalid --region: %w", err)
+	}
+
+	if o.CloudBuildSHA256 != "" {
+		if err := gcb.ValidateSHA256(o.CloudBuildSHA256); err != nil {
+			return nil, validationErrorf("invalid --cloudbuild-sha256: %w", err)
+		}
+	}
+
+	if o.APIMaxRetries < 0 {
+		return nil, validationErrorf("invalid --api-max-retries %d: must not be negative", o.APIMaxRetries)
+	}
+	if o.APIRetryDelay <= 0 {
+		return nil, validationErrorf("invalid --api-retry-delay %s: must be positive", o.APIRetryDelay)
+	}
+
+	if err := o.pollOptions().Validate(); err != nil {
+		return nil, validationErrorf("invalid --poll-interval or --poll-max-interval: %w", err)
+	}
+
+	substitutions, err := userSubstitutions(o)
 	if err != nil {
-		return fmt.Errorf("invalid --target-arch list: %w", err)
+		return nil, err
 	}
 
-	build.Substitutions["_CM_REPO"] = fmt.Sprintf("https://github.com/%s/%s.git", o.Org, o.Repo)
-	build.Substitutions["_CM_REF"] = o.GitRef
-	build.Substitutions["_RELEASE_VERSION"] = o.ReleaseVersion
-	build.Substitutions["_RELEASE_BUCKET"] = o.Bucket
-	build.Substitutions["_TAG_RELEASE_BRANCH"] = o.Branch
-	build.Substitutions["_PUBLISHED_IMAGE_REPO"] = o.PublishedImageRepository
-	build.Substitutions["_KMS_KEY"] = o.SigningKMSKey
-	build.Substitutions["_SKIP_SIGNING"] = fmt.Sprintf("%v", o.SkipSigning)
-	build.Substitutions["_TARGET_OSES"] = strings.Join(targetOSes.List(), ",")
-	build.Substitutions["_TARGET_ARCHES"] = strings.Join(targetArches.List(), ",")
+	if o.MachineType != "" {
+		machineType, err := gcb.NormalizeMachineType(o.MachineType)
+		if err != nil {
+			return nil, validationErrorf("invalid --machine-type: %w", err)
+		}
+		o.MachineType = machineType
+	}
 
-	outputDir := ""
-	// If --release-version is not explicitly set, we treat this build as a
-	// 'devel' build and output into the development directory.
-	if o.ReleaseVersion == "" {
-		outputDir = release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeDevel, "", o.GitRef)
-	} else {
-		outputDir = release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeRelease, o.ReleaseVersion, o.GitRef)
+	if o.WorkerPool != "" {
+		pool, err := gcb.ParseWorkerPoolName(o.WorkerPool)
+		if err != nil {
+			return nil, validationErrorf("invalid --worker-pool: %w", err)
+		}
+		if pool.Project != o.Project {
+			return nil, validationErrorf("invalid --worker-pool: pool is in project %q but builds are submitted to --project=%q", pool.Project, o.Project)
+		}
+		if o.Region != "" && pool.Location != o.Region {
+			return nil, validationErrorf("invalid --worker-pool: pool is in region %q but builds are submitted in --region=%q", pool.Location, o.Region)
+		}
 	}
 
-	log.Printf("DEBUG: building google cloud build API client")
-	ctx := context.Background()
-	svc, err := cloudbuild.NewService(ctx)
+	if o.LogsBucket != "" {
+		logsBucket, err := gcb.NormalizeLogsBucket(o.LogsBucket)
+		if err != nil {
+			return nil, validationErrorf("invalid --logs-bucket: %w", err)
+		}
+		o.LogsBucket = logsBucket
+	}
+
+	if o.DiskSizeGB != 0 {
+		if err := gcb.ValidateDiskSizeGB(o.DiskSizeGB); err != nil {
+			return nil, validationErrorf("invalid --disk-size-gb: %w", err)
+		}
+	}
+
+	if o.SBOMFormat != "" {
+		if err := release.ValidateSBOMFormat(o.SBOMFormat); err != nil {
+			return nil, validationErrorf("invalid --sbom-format: %w", err)
+		}
+	}
+
+	if err := release.ValidateCompression(o.Compression); err != nil {
+		return nil, validationErrorf("invalid --compression: %w", err)
+	}
+
+	if err := release.ValidateBuildTags(o.BuildTags); err != nil {
+		return nil, validationErrorf("invalid --build-tags: %w", err)
+	}
+
+	if err := release.ValidateLDFlags(o.LDFlags); err != nil {
+		return nil, validationErrorf("invalid --ldflags: %w", err)
+	}
+
+	if err := release.ValidateGoVersion(o.GoVersion); err != nil {
+		return nil, validationErrorf("invalid --go-version: %w", err)
+	}
+
+	if o.ExpectedGitRef != "" {
+		if o.GitRef != "" || o.SourceTarball != "" {
+			return nil, validationErrorf("--expected-git-ref cannot be used with --git-ref or --source-tarball")
+		}
+		if err := release.ValidateExpectedGitRef(o.ExpectedGitRef); err != nil {
+			return nil, validationErrorf("invalid --expected-git-ref: %w", err)
+		}
+	}
+
+	if o.NoWait && o.StreamLogs {
+		return nil, validationErrorf("--stream-logs cannot be used with --no-wait")
+	}
+	if o.NoWait && o.LogOutputDir != "" {
+		return nil, validationErrorf("--output-dir cannot be used with --no-wait")
+	}
+	if o.GenerateProvenance {
+		if o.NoWait {
+			return nil, validationErrorf("--generate-provenance cannot be used with --no-wait")
+		}
+		if o.SkipSigning || o.SigningBackend != sign.SigningBackendKMS {
+			return nil, validationErrorf("--generate-provenance requires --signing-backend=%s and cannot be used with --skip-signing", sign.SigningBackendKMS)
+		}
+	}
+	if o.ForceLock && !o.Lock {
+		return nil, validationErrorf("--force-lock can only be used with --lock")
+	}
+	if o.Lock && o.NoWait {
+		return nil, validationErrorf("--lock cannot be used with --no-wait, as the lock is held until the build completes")
+	}
+	if o.Lock && o.AttachBuildID != "" {
+		return nil, validationErrorf("--lock cannot be used with --attach-build-id")
+	}
+
+	if o.SlackWebhook != "" {
+		if o.NoWait {
+			return nil, validationErrorf("--slack-webhook cannot be used with --no-wait")
+		}
+		if err := notify.ValidateSlackWebhookURL(o.SlackWebhook); err != nil {
+			return nil, validationErrorf("invalid --slack-webhook: %w", err)
+		}
+	}
+
+	if err := validateMirrorBuckets(o.Bucket, o.MirrorBuckets); err != nil {
+		return nil, validationErrorf("invalid --mirror-bucket: %w", err)
+	}
+	if len(o.MirrorBuckets) > 0 && o.NoWait {
+		return nil, validationErrorf("--mirror-bucket cannot be used with --no-wait")
+	}
+
+	if o.PostStageHook != "" && o.NoWait {
+		return nil, validationErrorf("--post-stage-hook cannot be used with --no-wait")
+	}
+
+	for _, hook := range []struct {
+		flag string
+		path *string
+	}{{"pre-stage-hook", &o.PreStageHook}, {"post-stage-hook", &o.PostStageHook}} {
+		if *hook.path == "" {
+			continue
+		}
+		path, err := exec.LookPath(*hook.path)
+		if err != nil {
+			return nil, validationErrorf("invalid --%s: %w", hook.flag, err)
+		}
+		*hook.path = path
+	}
+
+	if o.AttachBuildID != "" && o.DryRun {
+		return nil, validationErrorf("--dry-run cannot be used with --attach-build-id")
+	}
+
+	if o.RetryOnFailure < 0 {
+		return nil, validationErrorf("invalid --retry-on-failure %d: must not be negative", o.RetryOnFailure)
+	}
+	retryPattern, err := regexp.Compile(o.RetryPattern)
 	if err != nil {
-		return fmt.Errorf("error building google cloud build API client: %w", err)
+		return nil, validationErrorf("invalid --retry-pattern: %w", err)
+	}
+	if o.RetryOnFailure > 0 && o.NoWait {
+		return nil, validationErrorf("--retry-on-failure cannot be used with --no-wait")
+	}
+	if o.RetryOnFailure > 0 && o.AttachBuildID != "" {
+		return nil, validationErrorf("--retry-on-failure cannot be used with --attach-build-id")
+	}
+
+	if o.ShardByOS {
+		if err := validateShardByOS(o); err != nil {
+			return nil, err
+		}
+	}
+	if o.RetryMissing {
+		if err := validateRetryMissing(o); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Printf("Submitting GCB build job...")
-	build, err = gcb.SubmitBuild(svc, o.Project, build)
+	labels, err := gcb.ParseLabels(o.Labels)
 	if err != nil {
-		return fmt.Errorf("error submitting build to cloud build: %w", err)
+		return nil, validationErrorf("invalid --label: %w", err)
+	}
+	if len(labels) > 0 && o.AttachBuildID != "" {
+		return nil, validationErrorf("--label cannot be used with --attach-build-id")
+	}
+	if o.SubstitutionsAsEnv && o.AttachBuildID != "" {
+		return nil, validationErrorf("--substitutions-as-env cannot be used with --attach-build-id")
+	}
+	if o.LogsBucket != "" && o.AttachBuildID != "" {
+		return nil, validationErrorf("--logs-bucket cannot be used with --attach-build-id")
 	}
 
-	log.Println("---")
-	log.Printf("Submitted build with name: %q", build.Id)
-	log.Printf("  View logs at: %s", build.LogUrl)
-	log.Printf("  Log bucket: %s", build.LogsBucket)
-	log.Printf("  Once complete, view artifacts at: gs://%s/%s", o.Bucket, outputDir)
-	log.Println("---")
-	log.Printf("Waiting for build to complete, this may take a while...")
-	build, err = gcb.WaitForBuild(svc, o.Project, build.Id)
+	var source *release.SourceTarball
+	if o.SourceTarball != "" {
+		if o.AttachBuildID != "" {
+			return nil, validationErrorf("--source-tarball cannot be used with --attach-build-id")
+		}
+
+		log.Printf("Inspecting source tarball %q", o.SourceTarball)
+		source, err = release.InspectSourceTarball(o.SourceTarball)
+		if err != nil {
+			return nil, validationErrorf("invalid --source-tarball: %w", err)
+		}
+		if o.GitRef != "" && !strings.HasPrefix(source.GitRef, o.GitRef) {
+			return nil, validationErrorf("--git-ref %q does not match commit %q checked out in --source-tarball", o.GitRef, source.GitRef)
+		}
+		// the commit may not have been pushed to GitHub, so there's nothing
+		// to check it against
+		o.GitRef = source.GitRef
+		log.Printf("Building commit %q from source tarball %q", o.GitRef, o.SourceTarball)
+	}
+
+	var notes *release.ReleaseNotes
+	if o.ReleaseNotesFile != "" {
+		if o.AttachBuildID != "" {
+			return nil, validationErrorf("--release-notes-file cannot be used with --attach-build-id")
+		}
+
+		notes, err = release.InspectReleaseNotes(o.ReleaseNotesFile)
+		if err != nil {
+			return nil, validationErrorf("invalid --release-notes-file: %w", err)
+		}
+	}
+
+	// A dry run doesn't talk to Google Cloud, but otherwise check that the
+	// user is authenticated before spending time looking up the git ref.
+	if !o.DryRun {
+		if err := gcb.CheckCredentials(ctx); err != nil {
+			return nil, withKind(ErrAPIUnavailable, err)
+		}
+	}
+
+	if o.AttachBuildID != "" {
+		return attachStageBuild(ctx, stop, rootOpts, o)
+	}
+
+	timings := &stageTimings{}
+
+	if source == nil && (o.GitRef == "" || !o.SkipRefCheck) {
+		stopTimer := timings.start("look up git ref")
+		baseURL, err := release.NormalizeGitHubBaseURL(o.GitHubBaseURL)
+		if err != nil {
+			return nil, validationErrorf("invalid --github-base-url: %w", err)
+		}
+		token := o.GitHubToken
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		if token == "" {
+			log.Printf("WARNING: no GitHub token set with --github-token or GITHUB_TOKEN - unauthenticated GitHub API requests are heavily rate limited")
+		}
+
+		if o.GitRef == "" {
+			log.Printf("git-ref flag not specified, looking up git commit ref for %s/%s@%s", o.Org, o.Repo, o.Branch)
+			ref, err := release.LookupBranchRef(ctx, baseURL, o.Org, o.Repo, o.Branch, token)
+			if err != nil {
+				return nil, rootOpts.timeoutError(ctx, "looking up git commit ref", fmt.Errorf("error looking up git commit ref: %w", err))
+			}
+			if o.ExpectedGitRef != "" {
+				if !release.GitRefMatches(ref, o.ExpectedGitRef) {
+					return nil, validationErrorf("HEAD of %s/%s@%s is %q, which does not match --expected-git-ref %q; the branch may have changed since it was inspected", o.Org, o.Repo, o.Branch, ref, o.ExpectedGitRef)
+				}
+				log.Printf("HEAD of %s/%s@%s matches --expected-git-ref %q", o.Org, o.Repo, o.Branch, o.ExpectedGitRef)
+			}
+			o.GitRef = ref
+		} else {
+			log.Printf("Checking that git commit ref %q exists in %s/%s", o.GitRef, o.Org, o.Repo)
+			if _, err := release.LookupCommit(ctx, baseURL, o.Org, o.Repo, o.GitRef, token); err != nil {
+				return nil, rootOpts.timeoutError(ctx, "checking git commit ref", fmt.Errorf("failed to find --git-ref %q in %s/%s (use --skip-ref-check to bypass): %w", o.GitRef, o.Org, o.Repo, err))
+			}
+
+			if !o.SkipBranchCheck {
+				// otherwise _TAG_RELEASE_BRANCH wouldn't match the source
+				log.Printf("Checking that git commit ref %q is on branch %q", o.GitRef, o.Branch)
+				onBranch, err := release.IsAncestor(ctx, baseURL, o.Org, o.Repo, o.GitRef, o.Branch, token)
+				if err != nil {
+					return nil, rootOpts.timeoutError(ctx, "checking git commit ref", fmt.Errorf("failed to compare --git-ref %q with --branch %q (use --skip-branch-check to bypass): %w", o.GitRef, o.Branch, err))
+				}
+				if !onBranch {
+					return nil, validationErrorf("--git-ref %q is not on --branch %q in %s/%s (use --skip-branch-check to bypass)", o.GitRef, o.Branch, o.Org, o.Repo)
+				}
+			}
+		}
+		stopTimer()
+	}
+
+	if err := sign.ValidateSigningBackend(o.SigningBackend); err != nil {
+		return nil, withKind(ErrValidation, err)
+	}
+
+	signingKeys, err := sign.NewGCPKMSKeys(o.SigningKMSKeys)
 	if err != nil {
-		return fmt.Errorf("error waiting for cloud build to complete: %w", err)
+		return nil, withKind(ErrValidation, err)
 	}
 
-	if build.Status == gcb.Success {
-		log.Printf("Release build complete - artifacts available at: gs://%s/%s", o.Bucket, outputDir)
-	} else {
-		log.Printf("An error occurred building the release. Check the log files for more information: %s", build.LogUrl)
-		return fmt.Errorf("building release tarballs failed")
+	if !o.SkipSigning && o.SigningBackend == sign.SigningBackendKMS && len(signingKeys) == 0 {
+		return nil, validationErrorf("at least one --signing-kms-key must be set unless --skip-signing is set")
 	}
 
+	log.Printf("Staging build for %s/%s@%s", o.Org, o.Repo, o.GitRef)
+
+	log.Printf("DEBUG: Loading cloudbuild.yaml file from %q", o.CloudBuildFile)
+	stopTimer := timings.start("load cloudbuild.yaml")
+	build, err := gcb.LoadBuildWithChecksum(o.CloudBuildFile, o.CloudBuildSHA256)
+	if err != nil {
+		return nil, validationErrorf("error loading cloudbuild.yaml file: %w", err)
+	}
+	stopTimer()
+
+	if err := gcb.ValidateSubstitutions(build, stageSubstitutions); err != nil {
+		return nil, validationErrorf("invalid cloudbuild.yaml file %q: %w", o.CloudBuildFile, err)
+	}
+
+	if err := gcb.ValidateSubstitutions(build, sets.StringKeySet(substitutions).List()); err != nil {
+		return nil, validationErrorf("invalid --set-substitution or --substitution-file for cloudbuild.yaml file %q: %w", o.CloudBuildFile, err)
+	}
+
+	if build.Substitutions == nil {
+		build.Substitutions = map[string]string{}
+	}
+
+	if build.Options == nil {
+		build.Options = &cloudbuild.BuildOptions{MachineType: defaultStageMachineType}
+	}
+	if o.MachineType != "" {
+		build.Options.MachineType = o.MachineType
+	}
+	if o.DiskSizeGB != 0 {
+		build.Options.DiskSizeGb = o.DiskSizeGB
+	}
+	if o.WorkerPool != "" {
+		build.Options.Pool = &cloudbuild.PoolOption{Name: o.WorkerPool}
+	}
+	if o.LogsBucket != "" {
+		// logs aren't written to any bucket with these logging modes
+		if logging := build.Options.Logging; logging == "CLOUD_LOGGING_ONLY" || logging == "NONE" {
+			return nil, validationErrorf("--logs-bucket cannot be used with cloudbuild.yaml file %q as it sets logging mode %q", o.CloudBuildFile, logging)
+		}
+		build.LogsBucket = o.LogsBucket
+	}
+
+	build.Timeout = fmt.Sprintf("%ds", int64(o.BuildTimeout/time.Second))
+	build.Tags = append(build.Tags, gcb.LabelTags(labels)...)
+
+	artifactTypes, err := release.ArtifactTypesFromString(o.ArtifactTypes)
+	if err != nil {
+		return nil, validationErrorf("invalid --artifact-types list: %w", err)
+	}
+
+	targetOSes, err := release.OSListFromString(o.TargetOSes)
+	if err != nil {
+		return nil, validationErrorf("invalid --target-os list: %w", err)
+	}
+
+	targetArches, err := release.ArchListFromString(o.TargetArches, targetOSes)
+	if err != nil {
+		return nil, validationErrorf("invalid --target-arch list: %w", err)
+	}
+
+	for key, value := range stageBuildSubstitutions(o, bucketPathPrefix, signingKeys, artifactTypes, targetOSes, targetArches) {
+		build.Substitutions[key] = value
+	}
+	for key, value := range substitutions {
+		build.Substitutions[key] = value
+	}
+
+	if source != nil {
+		objectName := release.SourceTarballObjectName(bucketPathPrefix, source.SHA256)
+		build.Source = &cloudbuild.Source{
+			StorageSource: &cloudbuild.StorageSource{Bucket: o.Bucket, Object: objectName},
+		}
+		build.Substitutions["_SOURCE_TARBALL"] = fmt.Sprintf("gs://%s/%s", o.Bucket, objectName)
+	}
+
+	if notes != nil {
+		build.Substitutions["_RELEASE_NOTES_OBJECT"] = release.ReleaseNotesObjectName(bucketPathPrefix, notes.SHA256)
+	}
+
+	// If --release-version is not explicitly set, we treat this build as a
+	// 'devel' build and output into the development directory. Release
+	// candidates are output into the prerelease directory.
+	outputDir := release.BucketPathForRelease(bucketPathPrefix, release.BuildTypeForVersion(o.ReleaseVersion), o.ReleaseVersion, o.GitRef)
+
+	var shards []stageShard
+	if o.ShardByOS {
+		shards = stageShardBuilds(build, artifactTypes, targetOSes, targetArches)
+	}
+
+	if o.SubstitutionsAsEnv {
+		// each shard has its own substitutions, so they're all set after
+		// sharding
+		builds := []*cloudbuild.Build{build}
+		for _, shard := range shards {
+			builds = append(builds, shard.Build)
+		}
+		for _, b := range builds {
+			if err := setSubstitutionsEnv(b); err != nil {
+				return nil, validationErrorf("invalid --substitutions-as-env for cloudbuild.yaml file %q: %w", o.CloudBuildFile, err)
+			}
+		}
+	}
+
+	if o.DryRun {
+		rootOpts.Logger.Info(fmt.Sprintf("Dry run enabled, not submitting build. Artifacts would be staged to: gs://%s/%s", o.Bucket, outputDir))
+		if shards == nil {
+			encoded, err := gcb.EncodeBuild(build)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding resolved build: %w", err)
+			}
+			fmt.Print(string(encoded))
+			return nil, nil
+		}
+
+		// each shard's build is printed as a separate YAML document
+		for i, shard := range shards {
+			encoded, err := gcb.EncodeBuild(shard.Build)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding resolved build of shard %q: %w", shard.Name, err)
+			}
+			if i > 0 {
+				fmt.Println("---")
+			}
+			fmt.Print(string(encoded))
+		}
+		return nil, nil
+	}
+
+	if o.ReleaseVersion != "" {
+		if err := confirmOrRequireYes(o.Yes, releaseStageConfirmation(o, outputDir)); err != nil {
+			return nil, err
+		}
+	}
+
+	if !o.SkipPreflight {
+		if err := checkStageBucketAccess(ctx, append([]string{o.Bucket}, o.MirrorBuckets...)); err != nil {
+			return nil, rootOpts.timeoutError(ctx, "checking access to buckets", fmt.Errorf("bucket preflight check failed (use --skip-preflight to bypass): %w", err))
+		}
+	}
+
+	if !o.SkipSigning && !o.SkipPreflight && o.SigningBackend == sign.SigningBackendKMS {
+		for _, signingKey := range signingKeys {
+			log.Printf("Checking access to signing KMS key %q", signingKey)
+			if err := signingKey.CheckSigningAccess(ctx); err != nil {
+				return nil, rootOpts.timeoutError(ctx, "checking access to signing keys", fmt.Errorf("signing key preflight check failed (use --skip-preflight to bypass): %w", err))
+			}
+		}
+	}
+
+	if o.Lock {
+		lock, err := acquireStageLock(ctx, o, bucketPathPrefix, len(shards))
+		if err != nil {
+			return nil, rootOpts.timeoutError(ctx, "acquiring stage lock", err)
+		}
+		defer releaseStageLock(lock)
+	}
+
+	if o.RetryMissing {
+		log.Printf("Listing files already staged at gs://%s/%s", o.Bucket, outputDir)
+		retry, err := markStagedShardFiles(ctx, o.Bucket, outputDir, shards)
+		if err != nil {
+			return nil, rootOpts.timeoutError(ctx, "listing staged files", err)
+		}
+		log.Printf("%d of %d shards are missing files and will be rebuilt: %s", len(retry), len(shards), strings.Join(retry, ", "))
+	}
+
+	if source != nil {
+		log.Printf("Uploading source tarball to %s", build.Substitutions["_SOURCE_TARBALL"])
+		stopTimer := timings.start("upload source tarball")
+		generation, err := uploadSourceTarball(ctx, o.SourceTarball, build.Source.StorageSource, source)
+		if err != nil {
+			return nil, rootOpts.timeoutError(ctx, "uploading source tarball", withKind(ErrAPIUnavailable, fmt.Errorf("failed to upload --source-tarball: %w", err)))
+		}
+		// pin the build to the uploaded object in case it is overwritten
+		build.Source.StorageSource.Generation = generation
+		stopTimer()
+	}
+
+	if notes != nil {
+		objectName := build.Substitutions["_RELEASE_NOTES_OBJECT"]
+		log.Printf("Uploading release notes to gs://%s/%s", o.Bucket, objectName)
+		stopTimer := timings.start("upload release notes")
+		if err := uploadReleaseNotes(ctx, o.ReleaseNotesFile, o.Bucket, objectName, o.GitRef); err != nil {
+			return nil, rootOpts.timeoutError(ctx, "uploading release notes", withKind(ErrAPIUnavailable, fmt.Errorf("failed to upload --release-notes-file: %w", err)))
+		}
+		stopTimer()
+	}
+
+	log.Printf("DEBUG: building google cloud build API client")
+	svc, err := newStageService(ctx, o)
+	if err != nil {
+		return nil, rootOpts.timeoutError(ctx, "building cloud build API client", withKind(ErrAPIUnavailable, fmt.Errorf("error building google cloud build API client: %w", err)))
+	}
+
+	if o.PreStageHook != "" {
+		log.Printf("Running --pre-stage-hook %q", o.PreStageHook)
+		env := stageHookEnv(preStageHookName, o, &stageResult{OutputPath: fmt.Sprintf("gs://%s/%s", o.Bucket, outputDir), GitRef: o.GitRef, Project: o.Project})
+		if err := runStageHook(ctx, o.PreStageHook, env); err != nil {
+			return nil, rootOpts.timeoutError(ctx, "running --pre-stage-hook", fmt.Errorf("--pre-stage-hook failed, not submitting build: %w", err))
+		}
+	}
+
+	if o.PrintSubstitutions {
+		if shards == nil {
+			logSubstitutions("", build.Substitutions)
+		}
+		for _, shard := range shards {
+			logSubstitutions(shard.Name, shard.Build.Substitutions)
+		}
+	}
+
+	if shards != nil {
+		return stageShardedBuild(ctx, stop, rootOpts, o, svc, shards, outputDir, retryPattern, signingKeys)
+	}
+	return submitStageBuild(ctx, stop, rootOpts, o, svc, build, outputDir, timings, retryPattern)
+}
+
+// sensitiveSubstitutions is the list of substitutions whose values are
+// redacted when printed with --print-substitutions.
+var sensitiveSubstitutions = sets.NewString()
+
+// redactedSubstitution replaces the value of sensitive substitutions when
+// they're printed.
+const redactedSubstitution = "<redacted>"
+
+// formatSubstitutions returns each of the given substitutions as a KEY=VALUE
+// line, sorted by key, with the values of sensitiveSubstitutions redacted.
+func formatSubstitutions(substitutions map[string]string) []string {
+	lines := make([]string, 0, len(substitutions))
+	for _, key := range sets.StringKeySet(substitutions).List() {
+		value := substitutions[key]
+		if sensitiveSubstitutions.Has(key) {
+			value = redactedSubstitution
+		}
+		lines = append(lines, key+"="+value)
+	}
+	return lines
+}
+
+// logSubstitutions logs the substitutions of a build for --print-substitutions,
+// naming the shard they belong to if the build is sharded.
+func logSubstitutions(shard string, substitutions map[string]string) {
+	if shard == "" {
+		log.Printf("Build substitutions:")
+	} else {
+		log.Printf("Build substitutions for shard %q:", shard)
+	}
+	for _, line := range formatSubstitutions(substitutions) {
+		log.Printf("  %s", line)
+	}
+}
+
+// stageLockGracePeriod is added to the time that a stage build may take to
+// complete when setting the expiry of its lock, to allow for the time spent
+// submitting the build and running hooks.
+const stageLockGracePeriod = 15 * time.Minute
+
+// acquireStageLock acquires the lock object for the build configured by o,
+// which expires once the build, including any retries and each wave of
+// shards when --shard-by-os is set, could no longer be running.
+func acquireStageLock(ctx context.Context, o *stageOptions, bucketPathPrefix string, shards int) (*release.HeldStageLock, error) {
+	holder, err := currentUserName()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the current user to record as the holder of the lock: %w", err)
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		holder = holder + "@" + hostname
+	}
+
+	waves := 1
+	if shards > 0 {
+		waves = (shards + o.ShardConcurrency - 1) / o.ShardConcurrency
+	}
+	ttl := time.Duration(waves*(o.RetryOnFailure+1))*o.BuildTimeout + stageLockGracePeriod
+
+	objectName := release.StageLockObjectName(bucketPathPrefix, release.BuildTypeForVersion(o.ReleaseVersion), o.ReleaseVersion, o.GitRef)
+
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, withKind(ErrAPIUnavailable, fmt.Errorf("failed to create GCS client: %w", err))
+	}
+
+	now := time.Now().UTC()
+	log.Printf("Acquiring lock gs://%s/%s, expiring in %s", o.Bucket, objectName, ttl)
+	lock, err := release.AcquireStageLock(ctx, gcs.Bucket(o.Bucket).Object(objectName), release.StageLock{
+		Holder:         holder,
+		ReleaseVersion: o.ReleaseVersion,
+		GitRef:         o.GitRef,
+		AcquiredAt:     now,
+		ExpiresAt:      now.Add(ttl),
+	}, o.ForceLock)
+	var locked *release.StageLockedError
+	switch {
+	case errors.As(err, &locked) && locked.Stale:
+		return nil, fmt.Errorf("refusing to stage build as it may already be being staged, set --force-lock to override the %w", err)
+	case errors.As(err, &locked):
+		return nil, fmt.Errorf("refusing to stage build as it is already being staged: %w", err)
+	case err != nil:
+		return nil, withKind(ErrAPIUnavailable, err)
+	}
+	return lock, nil
+}
+
+// releaseStageLock releases a lock acquired by acquireStageLock. Errors are
+// logged rather than returned, as the lock will expire regardless.
+func releaseStageLock(lock *release.HeldStageLock) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if err := lock.Release(ctx); err != nil {
+		log.Printf("WARNING: %v", err)
+		return
+	}
+	log.Printf("Released stage lock")
+}
+
+// validateShardByOS checks that the other options can be used with
+// --shard-by-os.
+func validateShardByOS(o *stageOptions) error {
+	if o.ShardConcurrency < 1 {
+		return validationErrorf("invalid --shard-concurrency %d: must be at least 1", o.ShardConcurrency)
+	}
+	for _, excluded := range []struct {
+		flag string
+		set  bool
+	}{{"no-wait", o.NoWait}, {"attach-build-id", o.AttachBuildID != ""}, {"stream-logs", o.StreamLogs}} {
+		if excluded.set {
+			return validationErrorf("--%s cannot be used with --shard-by-os", excluded.flag)
+		}
+	}
+	// the merged checksums file is signed by this command rather than by
+	// the build, which is only possible using KMS
+	if !o.SkipSigning && o.SigningBackend != sign.SigningBackendKMS {
+		return validationErrorf("--shard-by-os requires --signing-backend=%s unless --skip-signing is set", sign.SigningBackendKMS)
+	}
+	return nil
+}
+
+// validateRetryMissing checks that the other options can be used with
+// --retry-missing.
+func validateRetryMissing(o *stageOptions) error {
+	if !o.ShardByOS {
+		return validationErrorf("--retry-missing requires --shard-by-os")
+	}
+	if o.DryRun {
+		return validationErrorf("--dry-run cannot be used with --retry-missing")
+	}
+	// the shards staged by an earlier build aren't known, so the provenance
+	// of the release can't be generated
+	if o.GenerateProvenance {
+		return validationErrorf("--generate-provenance cannot be used with --retry-missing")
+	}
 	return nil
 }
+
+// newStageService builds the Cloud Build API client used to submit and wait
+// for stage builds in --region.
+func newStageService(ctx context.Context, o *stageOptions) (gcb.Service, error) {
+	svc, err := gcb.NewService(ctx, o.Region, gcb.RetryOptions{MaxRetries: o.APIMaxRetries, BaseDelay: o.APIRetryDelay})
+	if err != nil {
+		return nil, err
+	}
+	return gcb.NewAPIService(svc, o.pollOptions()), nil
+}
+
+func (o *stageOptions) pollOptions() gcb.PollOptions {
+	return gcb.PollOptions{Interval: o.PollInterval, MaxInterval: o.PollMaxInterval}
+}
+
+// submitStageBuild will submit the resolved stage build to svc and wait for
+// it to complete, resubmitting it up to --retry-on-failure times if it fails
+// in a way matching retryPattern.
+func submitStageBuild(ctx context.Context, stop func(), rootOpts *rootOptions, o *stageOptions, svc gcb.Service, build *cloudbuild.Build, outputDir string, timings *stageTimings, retryPattern *regexp.Regexp) (*stageResult, error) {
+	for attempt := 1; ; attempt++ {
+		log.Printf("Submitting GCB build job...")
+		stopTimer := timings.start("submit build")
+		submitted, err := svc.SubmitBuild(ctx, o.Project, o.Region, build)
+		if err != nil {
+			return nil, rootOpts.timeoutError(ctx, "submitting build", withKind(ErrAPIUnavailable, fmt.Errorf("error submitting build to cloud build: %w", err)))
+		}
+		stopTimer()
+
+		log.Println("---")
+		buildRef := gcb.BuildRef(submitted)
+		rootOpts.Logger.Info(fmt.Sprintf("Submitted build with name: %q", buildRef))
+		rootOpts.Logger.Info(fmt.Sprintf("  View logs at: %s", submitted.LogUrl))
+		log.Printf("  Log bucket: %s", submitted.LogsBucket)
+		log.Printf("  Once complete, view artifacts at: gs://%s/%s", o.Bucket, outputDir)
+		log.Println("---")
+
+		result, err := waitForStageBuild(ctx, stop, rootOpts, o, svc, submitted, outputDir, timings)
+		if !shouldRetryStageBuild(result, err, retryPattern) || attempt > o.RetryOnFailure {
+			return result, err
+		}
+		log.Printf("Build attempt %d failed with %q, which matches --retry-pattern, resubmitting (retry %d of %d). Logs of the failed attempt: %s", attempt, result.Failure, attempt, o.RetryOnFailure, result.LogURL)
+	}
+}
+
+// shouldRetryStageBuild returns true if a stage build completed but failed
+// in a way matching retryPattern. Builds which could not be waited for, e.g.
+// because they timed out or were interrupted, are never retried.
+func shouldRetryStageBuild(result *stageResult, err error, retryPattern *regexp.Regexp) bool {
+	if err == nil || result == nil || result.Failure == "" || !errors.Is(err, ErrBuildFailed) {
+		return false
+	}
+	return retryPattern.MatchString(result.Failure)
+}
+
+// uploadSourceTarball uploads the source tarball at path to the object given
+// by dst, returning the generation of the uploaded object.
+func uploadSourceTarball(ctx context.Context, path string, dst *cloudbuild.StorageSource, source *release.SourceTarball) (int64, error) {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	obj := gcs.Bucket(dst.Bucket).Object(dst.Object)
+	if err := release.UploadObject(ctx, obj, f, release.ObjectMetadata{GitRef: source.GitRef}, release.DefaultUploadOptions); err != nil {
+		return 0, err
+	}
+
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return attrs.Generation, nil
+}
+
+// uploadReleaseNotes uploads the release notes file at path to the given
+// object in bucket, to be staged by the build.
+func uploadReleaseNotes(ctx context.Context, path, bucket, objectName, gitRef string) error {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return release.UploadObject(ctx, gcs.Bucket(bucket).Object(objectName), f, release.ObjectMetadata{GitRef: gitRef}, release.DefaultUploadOptions)
+}
+
+// attachStageBuild will look up the existing stage build given by
+// --attach-build-id and wait for it to complete, as if it had just been
+// submitted.
+func attachStageBuild(ctx context.Context, stop func(), rootOpts *rootOptions, o *stageOptions) (*stageResult, error) {
+	svc, err := newStageService(ctx, o)
+	if err != nil {
+		return nil, withKind(ErrAPIUnavailable, fmt.Errorf("error building google cloud build API client: %w", err))
+	}
+
+	log.Printf("Looking up existing build %q in project %q", o.AttachBuildID, o.Project)
+	build, err := svc.GetBuild(ctx, o.Project, gcb.BuildName(o.Project, o.Region, o.AttachBuildID))
+	if err != nil {
+		return nil, rootOpts.timeoutError(ctx, "looking up build", withKind(ErrAPIUnavailable, fmt.Errorf("failed to find build %q in project %q: %w", o.AttachBuildID, o.Project, err)))
+	}
+
+	outputDir, err := stageOutputDirForBuild(build)
+	if err != nil {
+		return nil, err
+	}
+
+	// the bucket, ref, version and branch are taken from the build so that
+	// they are reported correctly in the command's output and notifications
+	o.Bucket = build.Substitutions["_RELEASE_BUCKET"]
+	o.GitRef = build.Substitutions["_CM_REF"]
+	o.ReleaseVersion = build.Substitutions["_RELEASE_VERSION"]
+	o.Branch = build.Substitutions["_TAG_RELEASE_BRANCH"]
+
+	log.Println("---")
+	rootOpts.Logger.Info(fmt.Sprintf("Attached to build with name: %q", gcb.BuildRef(build)))
+	rootOpts.Logger.Info(fmt.Sprintf("  Status: %s", build.Status))
+	rootOpts.Logger.Info(fmt.Sprintf("  View logs at: %s", build.LogUrl))
+	log.Printf("  Log bucket: %s", build.LogsBucket)
+	log.Printf("  Once complete, view artifacts at: gs://%s/%s", o.Bucket, outputDir)
+	log.Println("---")
+
+	return waitForStageBuild(ctx, stop, rootOpts, o, svc, build, outputDir, &stageTimings{})
+}
+
+// stageOutputDirForBuild returns the path within the release bucket which
+// the given stage build will upload artifacts to, based on the substitutions
+// set on it by the stage command. An error is returned if the build was not
+// submitted by the stage command.
+func stageOutputDirForBuild(build *cloudbuild.Build) (string, error) {
+	isStageBuild := false
+	for _, tag := range build.Tags {
+		if tag == stageBuildTag {
+			isStageBuild = true
+		}
+	}
+	gitRef := build.Substitutions["_CM_REF"]
+	if !isStageBuild || gitRef == "" {
+		return "", fmt.Errorf("build %q is not a stage build", build.Id)
+	}
+
+	// builds submitted before --bucket-path-prefix was added always used
+	// the default prefix
+	bucketPathPrefix := build.Substitutions["_BUCKET_PATH_PREFIX"]
+	if bucketPathPrefix == "" {
+		bucketPathPrefix = release.DefaultBucketPathPrefix
+	}
+
+	releaseVersion := build.Substitutions["_RELEASE_VERSION"]
+	return release.BucketPathForRelease(bucketPathPrefix, release.BuildTypeForVersion(releaseVersion), releaseVersion, gitRef), nil
+}
+
+// waitForStageBuild will wait for the given stage build to complete, unless
+// --no-wait is set, cancelling it if it does not complete in time. stop is
+// called to restore the default signal behaviour if ctx is cancelled by an
+// interrupt. The returned result is nil if the outcome of the build is unknown.
+// Once the build completes, the time taken by each phase recorded in timings
+// is logged along with the time spent waiting for the build.
+func waitForStageBuild(ctx context.Context, stop func(), rootOpts *rootOptions, o *stageOptions, svc gcb.Service, build *cloudbuild.Build, outputDir string, timings *stageTimings) (*stageResult, error) {
+	buildRef := gcb.BuildRef(build)
+
+	if o.NoWait {
+		rootOpts.Logger.Info(fmt.Sprintf("Not waiting for build to complete as --no-wait is set. Check its status with: %s %s %s --project=%s --id=%s", rootCommand, gcbCommand, gcbStatusCommand, o.Project, buildRef))
+		return &stageResult{
+			BuildID:    buildRef,
+			LogURL:     build.LogUrl,
+			Status:     build.Status,
+			OutputPath: fmt.Sprintf("gs://%s/%s", o.Bucket, outputDir),
+			GitRef:     o.GitRef,
+			Project:    o.Project,
+			Labels:     gcb.LabelsFromTags(build.Tags),
+		}, nil
+	}
+
+	rootOpts.progressLogger().Info("Waiting for build to complete, this may take a while...")
+	stopTimer := timings.start("wait for build")
+	waitCtx, cancelWait := context.WithTimeout(ctx, o.BuildTimeout)
+	defer cancelWait()
+	submitted := build
+	submittedRef := buildRef
+	var streamDone <-chan struct{}
+	if o.StreamLogs {
+		streamDone = streamBuildLogs(waitCtx, svc, o.Project, submittedRef)
+	}
+	result, err := gcb.WaitForBuildResult(waitCtx, svc, o.Project, submittedRef, rootOpts.stepProgress())
+	if streamDone != nil {
+		if err != nil {
+			cancelWait()
+		}
+		// wait for any remaining log output to be written before continuing
+		<-streamDone
+	}
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		rootOpts.progressLogger().Info(fmt.Sprintf("Command did not complete within --timeout=%s, cancelling build %q...", rootOpts.Timeout, submitted.Id))
+		cancelBuild(svc, o.Project, submittedRef)
+		return nil, rootOpts.timeoutError(ctx, fmt.Sprintf("waiting for build %q to complete", submitted.Id), err)
+	case errors.Is(err, context.DeadlineExceeded):
+		rootOpts.progressLogger().Info(fmt.Sprintf("Build %q did not complete within %s, cancelling...", submitted.Id, o.BuildTimeout))
+		cancelBuild(svc, o.Project, submittedRef)
+		return nil, withKind(ErrBuildFailed, fmt.Errorf("build %q did not complete within --build-timeout=%s, check the log files for more information: %s", submitted.Id, o.BuildTimeout, submitted.LogUrl))
+	case errors.Is(err, context.Canceled):
+		// Restore the default signal behaviour so that a second interrupt
+		// will force the process to exit if cancelling the build hangs.
+		stop()
+		rootOpts.progressLogger().Info(fmt.Sprintf("Interrupted, cancelling build %q...", submitted.Id))
+		cancelBuild(svc, o.Project, submittedRef)
+		return nil, fmt.Errorf("interrupted while waiting for build %q to complete", submitted.Id)
+	case err != nil:
+		return nil, withKind(ErrAPIUnavailable, fmt.Errorf("error waiting for cloud build to complete: %w", err))
+	}
+
+	stopTimer()
+
+	logFile := ""
+	if o.LogOutputDir != "" {
+		logFile = downloadBuildLog(ctx, result.Build, o.LogOutputDir)
+	}
+
+	logBuildSummary(rootOpts.Logger, result)
+	logStageTimings(timings, result, rootOpts.Verbose)
+	notifyStageBuild(ctx, o, result)
+
+	staged := &stageResult{
+		BuildID:    submittedRef,
+		LogURL:     result.Build.LogUrl,
+		Status:     result.Status,
+		Failure:    result.Failure(),
+		OutputPath: fmt.Sprintf("gs://%s/%s", o.Bucket, outputDir),
+		GitRef:     o.GitRef,
+		Project:    o.Project,
+		Labels:     gcb.LabelsFromTags(build.Tags),
+		LogFile:    logFile,
+		provenanceBuild: release.ProvenanceBuild{
+			ID:            result.Build.Id,
+			Substitutions: result.Build.Substitutions,
+			StartedOn:     result.StartTime,
+			FinishedOn:    result.FinishTime,
+		},
+	}
+	for _, image := range result.Images {
+		staged.Images = append(staged.Images, stageImage{Name: image.Name, Digest: image.Digest})
+	}
+
+	if !result.Succeeded() {
+		rootOpts.Logger.Info(fmt.Sprintf("An error occurred building the release. Check the log files for more information: %s", result.Build.LogUrl))
+		return staged, withKind(ErrBuildFailed, fmt.Errorf("building release tarballs failed with status %q", result.Status))
+	}
+
+	rootOpts.Logger.Info(fmt.Sprintf("Release build complete - artifacts available at: gs://%s/%s", o.Bucket, outputDir))
+
+	if o.GenerateProvenance {
+		provenance, err := stageProvenance(ctx, o, outputDir, []release.ProvenanceBuild{staged.provenanceBuild}, staged.Images)
+		if err != nil {
+			return staged, rootOpts.timeoutError(ctx, "generating provenance", withKind(ErrAPIUnavailable, fmt.Errorf("failed to generate provenance: %w", err)))
+		}
+		staged.Provenance = provenance
+	}
+
+	if len(o.MirrorBuckets) > 0 {
+		mirrorPaths, err := mirrorStagedRelease(ctx, o.Bucket, o.MirrorBuckets, outputDir)
+		staged.MirrorPaths = mirrorPaths
+		if err != nil {
+			return staged, rootOpts.timeoutError(ctx, "mirroring artifacts", withKind(ErrAPIUnavailable, err))
+		}
+	}
+
+	if o.PostStageHook != "" {
+		log.Printf("Running --post-stage-hook %q", o.PostStageHook)
+		if err := runStageHook(ctx, o.PostStageHook, stageHookEnv(postStageHookName, o, staged)); err != nil {
+			log.Printf("WARNING: --post-stage-hook failed: %v", err)
+		}
+	}
+
+	return staged, nil
+}
+
+// releaseStageConfirmation describes the release build about to be staged,
+// for the user to confirm before any existing release artifacts at the same
+// path are overwritten.
+func releaseStageConfirmation(o *stageOptions, outputDir string) string {
+	return fmt.Sprintf(`About to stage release %q, overwriting any release already staged at the same path:
+  Branch:      %s
+  Git ref:     %s
+  Destination: gs://%s/%s`, o.ReleaseVersion, o.Branch, o.GitRef, o.Bucket, outputDir)
+}
+
+// setSubstitutionsEnv sets each of the substitutions of build as an
+// environment variable of its steps. The build's options are copied first,
+// as they may be shared with other builds.
+func setSubstitutionsEnv(build *cloudbuild.Build) error {
+	env, err := gcb.SubstitutionsEnv(build.Substitutions, build.Options.Env)
+	if err != nil {
+		return err
+	}
+	options := *build.Options
+	options.Env = env
+	build.Options = &options
+	return nil
+}
+
+// validateReleaseSigning checks that a release, as opposed to a devel build,
+// is only staged without signing if that has been explicitly allowed, so
+// that unsigned release artifacts aren't published by accident.
+func validateReleaseSigning(o *stageOptions) error {
+	if o.ReleaseVersion == "" || !o.SkipSigning || o.AllowUnsignedRelease {
+		return nil
+	}
+	return fmt.Errorf("refusing to stage release %q with --skip-signing as its artifacts would be unsigned, set --allow-unsigned-release to override", o.ReleaseVersion)
+}
+
+// validateMirrorBuckets checks that each of the mirror buckets is distinct
+// from the primary bucket and from each other.
+func validateMirrorBuckets(bucket string, mirrors []string) error {
+	seen := sets.NewString(bucket)
+	for _, mirror := range mirrors {
+		if mirror == "" {
+			return fmt.Errorf("bucket name must not be empty")
+		}
+		if seen.Has(mirror) {
+			return fmt.Errorf("bucket %q is given more than once, including as --bucket", mirror)
+		}
+		seen.Insert(mirror)
+	}
+	return nil
+}
+
+// checkStageBucketAccess checks that each of the named buckets exists and can
+// be written to by the caller, before any time is spent running a build.
+func checkStageBucketAccess(ctx context.Context, buckets []string) error {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+
+	for _, bucket := range buckets {
+		log.Printf("Checking access to bucket %q", bucket)
+		if err := release.CheckBucketWriteAccess(ctx, gcs, bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorStagedRelease copies every object staged under outputDir in bucket to
+// the same path in each of the mirror buckets, returning the paths which were
+// mirrored to successfully.
+func mirrorStagedRelease(ctx context.Context, bucket string, mirrors []string, outputDir string) ([]string, error) {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+
+	var mirrored []string
+	for _, mirror := range mirrors {
+		log.Printf("Mirroring artifacts to gs://%s/%s", mirror, outputDir)
+		n, err := release.MirrorObjects(ctx, gcs.Bucket(bucket), gcs.Bucket(mirror), outputDir+"/")
+		if err != nil {
+			return mirrored, fmt.Errorf("failed to mirror artifacts to --mirror-bucket %q after %d objects: %w", mirror, n, err)
+		}
+		log.Printf("Mirrored %d objects to gs://%s/%s", n, mirror, outputDir)
+		mirrored = append(mirrored, fmt.Sprintf("gs://%s/%s", mirror, outputDir))
+	}
+	return mirrored, nil
+}
+
+const (
+	preStageHookName  = "pre-stage"
+	postStageHookName = "post-stage"
+)
+
+// stageHookEnv returns the environment variables describing a stage build
+// which are passed to the --pre-stage-hook and --post-stage-hook
+// executables. The build's ID and log URL are only set once it has been
+// submitted.
+func stageHookEnv(hook string, o *stageOptions, result *stageResult) []string {
+	return []string{
+		"CMREL_HOOK=" + hook,
+		"CMREL_RELEASE_VERSION=" + o.ReleaseVersion,
+		"CMREL_GIT_REF=" + result.GitRef,
+		"CMREL_BRANCH=" + o.Branch,
+		"CMREL_PROJECT=" + result.Project,
+		"CMREL_OUTPUT_PATH=" + result.OutputPath,
+		"CMREL_BUILD_ID=" + result.BuildID,
+		"CMREL_LOG_URL=" + result.LogURL,
+		"CMREL_STATUS=" + result.Status,
+	}
+}
+
+// runStageHook runs the given hook executable with env added to the
+// environment of the current process. The hook's output is written to
+// stderr, so that it can't be confused with the command's own output.
+func runStageHook(ctx context.Context, path string, env []string) error {
+	c := exec.CommandContext(ctx, path)
+	c.Env = append(os.Environ(), env...)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// logBuildSummary will log a short summary of how long a completed build took
+// and the digests of any images it pushed. The build's final status is
+// logged with logger, as it's the outcome of the build.
+func logBuildSummary(logger logr.Logger, result *gcb.BuildResult) {
+	logger.Info(fmt.Sprintf("Build %q finished with status %q in %s", result.Build.Id, result.Status, result.Duration.Round(time.Second)))
+	if slowest := result.SlowestStep(); slowest != nil {
+		log.Printf("  Slowest step: %q (%s)", slowest.Name, slowest.Duration.Round(time.Second))
+	}
+	if len(result.Images) > 0 {
+		log.Printf("  Pushed images:")
+		for _, image := range result.Images {
+			log.Printf("    %s@%s", image.Name, image.Digest)
+		}
+	}
+}
+
+// stageTimings records how long each phase of staging a build took, so that
+// they can be summarised once the build completes.
+type stageTimings struct {
+	phases []stagePhase
+}
+
+// stagePhase is a single timed phase of staging a build.
+type stagePhase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// start starts timing the named phase, returning a function which records
+// the phase's duration when called.
+func (t *stageTimings) start(name string) func() {
+	started := time.Now()
+	return func() {
+		t.phases = append(t.phases, stagePhase{Name: name, Duration: time.Since(started)})
+	}
+}
+
+// verboseSlowestSteps is the number of slowest build steps logged by
+// logStageTimings when --verbose is set.
+const verboseSlowestSteps = 5
+
+// logStageTimings logs a table of how long each recorded phase of staging a
+// build took. If verbose is true, the slowest steps of the build are also
+// logged.
+func logStageTimings(timings *stageTimings, result *gcb.BuildResult, verbose bool) {
+	lines := []string{"---", "PHASE\tDURATION"}
+	for _, phase := range timings.phases {
+		lines = append(lines, fmt.Sprintf("%s\t%s", phase.Name, phase.Duration.Round(time.Millisecond)))
+	}
+	if verbose {
+		lines = append(lines, "", "BUILD STEP\tDURATION")
+		for _, step := range result.SlowestSteps(verboseSlowestSteps) {
+			lines = append(lines, fmt.Sprintf("%s\t%s", step.Name, step.Duration.Round(time.Second)))
+		}
+	}
+	logTable(lines...)
+}
+
+// slackNotifyTimeout bounds how long posting a message to --slack-webhook may
+// take, so that a slow webhook can't delay the command exiting.
+const slackNotifyTimeout = 10 * time.Second
+
+// notifyStageBuild will post a message describing the completed build to
+// --slack-webhook, if set. Failing to post the message only logs a warning,
+// since the outcome of the build is unaffected.
+func notifyStageBuild(ctx context.Context, o *stageOptions, result *gcb.BuildResult) {
+	if o.SlackWebhook == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, slackNotifyTimeout)
+	defer cancel()
+
+	msg := notify.NewStageBuildMessage(notify.StageBuildInfo{ReleaseVersion: o.ReleaseVersion, Branch: o.Branch}, result)
+	if err := notify.PostSlackMessage(ctx, o.SlackWebhook, msg); err != nil {
+		log.Printf("WARNING: failed to post build notification to --slack-webhook: %v", err)
+		return
+	}
+	log.Printf("DEBUG: posted build notification to --slack-webhook")
+}
+
+// streamBuildLogs will start streaming the log output of the given build to
+// stderr in the background. The returned channel is closed once streaming
+// has stopped. If the logs cannot be read, a warning is logged and the caller
+// is expected to continue polling for the build status as usual.
+func streamBuildLogs(ctx context.Context, svc gcb.Service, projectID, id string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		gcs, err := storage.NewClient(ctx)
+		if err != nil {
+			log.Printf("WARNING: unable to create GCS client for streaming build logs: %v", err)
+			return
+		}
+		defer gcs.Close()
+
+		if err := gcb.StreamBuildLogs(ctx, svc, gcs, projectID, id, os.Stderr); err != nil && ctx.Err() == nil {
+			log.Printf("WARNING: unable to stream build logs, falling back to polling for build status only: %v", err)
+		}
+	}()
+	return done
+}
+
+// downloadBuildLog downloads the full log of a completed build into dir,
+// returning the path of the downloaded file. Errors are logged rather than
+// returned so that the outcome of the build is still reported, and an empty
+// path is returned.
+func downloadBuildLog(ctx context.Context, build *cloudbuild.Build, dir string) string {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Printf("WARNING: unable to create GCS client for downloading build log: %v", err)
+		return ""
+	}
+	defer gcs.Close()
+
+	logFile, err := gcb.DownloadBuildLog(ctx, gcs, build, dir)
+	if err != nil {
+		log.Printf("WARNING: unable to download log of build %q to --output-dir=%s: %v", build.Id, dir, err)
+		return ""
+	}
+	log.Printf("Downloaded log of build %q to %s", build.Id, logFile)
+	return logFile
+}
+
+// cancelBuild will attempt to cancel the build with the given ID, waiting a
+// short amount of time for the Cloud Build API to confirm the cancellation.
+// Errors are logged rather than returned as this is only ever called when
+// already handling a failure.
+func cancelBuild(svc gcb.Service, projectID, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	build, err := svc.CancelBuild(ctx, projectID, id)
+	if err != nil {
+		log.Printf("Failed to cancel build %q: %v", id, err)
+		return
+	}
+
+	log.Printf("Cancelled build %q, status is now %q", id, build.Status)
+}
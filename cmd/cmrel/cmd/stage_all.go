@@ -0,0 +1,297 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	stageAllCommand         = "stage-all"
+	stageAllDescription     = "Stage releases of several branches to a GCS release bucket concurrently"
+	stageAllLongDescription = `The stage-all command will build and stage cert-manager releases of
+several branches at once, e.g. when cutting a coordinated security release.
+A Google Cloud Build job is submitted for each branch exactly as it would be
+by the stage command, and the command waits for all of them to complete
+before printing a summary. The command fails if staging any branch fails.
+`
+)
+
+var (
+	stageAllExample = fmt.Sprintf(`
+To stage development builds of the 'release-1.5' and 'master' branches, run:
+
+	%s %s --branches=release-1.5,master
+
+To stage releases 'v1.5.4' and 'v1.6.1' of the 'release-1.5' and 'release-1.6' branches, run:
+
+	%s %s --branches=release-1.5=v1.5.4,release-1.6=v1.6.1`, rootCommand, stageAllCommand, rootCommand, stageAllCommand)
+)
+
+// stageAllExcludedFlags are the flags of the stage command which describe a
+// single branch or the result of staging it, and so can't be used with
+// stage-all.
+var stageAllExcludedFlags = []string{"branch", "git-ref", "skip-ref-check", "source-tarball", "release-version", "attach-build-id", "summary-format", "tag-release-branch"}
+
+// stageAllResult is printed to stdout for each branch when the stage-all
+// command is run with --output=json.
+type stageAllResult struct {
+	Branch         string `json:"branch"`
+	ReleaseVersion string `json:"releaseVersion,omitempty"`
+	Error          string `json:"error,omitempty"`
+
+	*stageResult
+}
+
+type stageAllOptions struct {
+	stageOptions
+
+	// Branches is the list of branches to stage, each optionally followed by
+	// '=' and the release version to stage the branch as
+	Branches []string
+
+	// MaxParallel is the maximum number of branches which will be staged at
+	// the same time
+	MaxParallel int
+}
+
+func (o *stageAllOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	o.stageOptions.AddFlags(fs, func(string) {})
+	for _, name := range stageAllExcludedFlags {
+		if err := fs.MarkHidden(name); err != nil {
+			panic(err)
+		}
+	}
+
+	fs.StringSliceVar(&o.Branches, "branches", nil, "Comma-separated list of the git branches to build releases from. Each branch may be followed by '=' and a release version to stage it as a release instead of a development build, e.g. 'release-1.6=v1.6.1'.")
+	fs.IntVar(&o.MaxParallel, "max-parallel", 4, "Maximum number of branches to stage at the same time.")
+
+	markRequired("branches")
+}
+
+func (o *stageAllOptions) print(logger logr.Logger) {
+	o.stageOptions.print(logger)
+	logger.Info("Stage all options",
+		"Branches", o.Branches,
+		"MaxParallel", o.MaxParallel,
+	)
+}
+
+func stageAllCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &stageAllOptions{}
+	cmd := &cobra.Command{
+		Use:          stageAllCommand,
+		Short:        stageAllDescription,
+		Long:         stageAllLongDescription,
+		Example:      stageAllExample,
+		SilenceUsage: true,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range stageAllExcludedFlags {
+				if cmd.Flags().Changed(name) {
+					return validationErrorf("--%s cannot be used with %s, use --branches instead", name, stageAllCommand)
+				}
+			}
+			if o.ConfigFile != "" {
+				excluded := append([]string{"config"}, stageAllExcludedFlags...)
+				if err := loadFlagsFromConfigFile(cmd.Flags(), o.ConfigFile, excluded...); err != nil {
+					return err
+				}
+			}
+			if err := applySmokeFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			warnLegacyOrg(cmd.Flags())
+			rootOpts.printOptions(o.print)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStageAll(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	mustRegisterFlagCompletionFunc(cmd, "branches", completeBranches(&o.Org, &o.Repo, &o.GitHubBaseURL, &o.GitHubToken, true))
+	mustRegisterFlagCompletionFunc(cmd, "target-os", completeTargetOSes)
+	mustRegisterFlagCompletionFunc(cmd, "target-arch", completeTargetArches(&o.TargetOSes))
+	return cmd
+}
+
+// stageBranch is a branch to be staged by the stage-all command.
+type stageBranch struct {
+	Branch         string
+	ReleaseVersion string
+}
+
+// parseStageBranches parses the values of the --branches flag, of the form
+// 'branch' or 'branch=release-version'.
+func parseStageBranches(values []string) ([]stageBranch, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("at least one branch must be given")
+	}
+
+	seen := make(map[string]bool)
+	branches := make([]stageBranch, 0, len(values))
+	for _, value := range values {
+		b := stageBranch{Branch: value}
+		if i := strings.Index(value, "="); i >= 0 {
+			b.Branch, b.ReleaseVersion = value[:i], value[i+1:]
+			if b.ReleaseVersion == "" {
+				return nil, fmt.Errorf("invalid branch %q: release version must not be empty", value)
+			}
+		}
+		if b.Branch == "" {
+			return nil, fmt.Errorf("invalid branch %q: branch name must not be empty", value)
+		}
+		if seen[b.Branch] {
+			return nil, fmt.Errorf("branch %q is given more than once", b.Branch)
+		}
+		seen[b.Branch] = true
+
+		branches = append(branches, b)
+	}
+
+	return branches, nil
+}
+
+func runStageAll(rootOpts *rootOptions, o *stageAllOptions) error {
+	branches, err := parseStageBranches(o.Branches)
+	if err != nil {
+		return validationErrorf("invalid --branches: %w", err)
+	}
+
+	if o.MaxParallel < 1 {
+		return validationErrorf("invalid --max-parallel %d: must be at least 1", o.MaxParallel)
+	}
+
+	// Cancel the context when the process is interrupted, so that all
+	// in-flight builds can be cancelled before exiting.
+	rootCtx, cancel := rootOpts.context()
+	defer cancel()
+	ctx, stop := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Builds are staged concurrently, so any release builds are confirmed
+	// together up front rather than prompting from each.
+	if message := releaseBranchesConfirmation(&o.stageOptions, branches); message != "" {
+		if err := confirmOrRequireYes(o.Yes, message); err != nil {
+			return err
+		}
+		o.Yes = true
+	}
+
+	results := make([]stageAllResult, len(branches))
+	sem := make(chan struct{}, o.MaxParallel)
+	var wg sync.WaitGroup
+	for i, b := range branches {
+		wg.Add(1)
+		go func(i int, b stageBranch) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// each branch is staged with its own copy of the options, as
+			// stage sets the git ref it looked up on them
+			branchOpts := o.stageOptions
+			branchOpts.Branch = b.Branch
+			branchOpts.ReleaseVersion = b.ReleaseVersion
+
+			log.Printf("Staging branch %q", b.Branch)
+			result, err := stage(ctx, stop, rootOpts, &branchOpts)
+			results[i] = stageAllResult{
+				Branch:         b.Branch,
+				ReleaseVersion: b.ReleaseVersion,
+				stageResult:    result,
+			}
+			if err != nil {
+				log.Printf("Staging branch %q failed: %v", b.Branch, err)
+				results[i].Error = err.Error()
+			}
+		}(i, b)
+	}
+	wg.Wait()
+
+	logStageAllSummary(results)
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	}
+
+	var failed []string
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, r.Branch)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("staging %d of %d branches failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// logStageAllSummary logs a table describing the outcome of staging each
+// branch.
+func logStageAllSummary(results []stageAllResult) {
+	lines := []string{"---", "BRANCH\tRELEASE VERSION\tGIT REF\tBUILD\tSTATUS\tOUTPUT"}
+	for _, r := range results {
+		version := r.ReleaseVersion
+		if version == "" {
+			version = "(devel)"
+		}
+		gitRef, buildID, status, output := "-", "-", "", "-"
+		if r.stageResult != nil {
+			gitRef, buildID, status, output = r.GitRef, r.BuildID, r.Status, r.OutputPath
+		}
+		switch {
+		case r.Error != "" && status == "":
+			status = "ERROR"
+		case status == "":
+			// no build is submitted for a dry run
+			status = "NOT SUBMITTED"
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", r.Branch, version, gitRef, buildID, status, output))
+	}
+	logTable(lines...)
+}
+
+// releaseBranchesConfirmation describes the release builds about to be staged
+// by stage-all, for the user to confirm before any existing release artifacts
+// are overwritten. It returns an empty string if no release builds are to be
+// staged.
+func releaseBranchesConfirmation(o *stageOptions, branches []stageBranch) string {
+	var lines []string
+	for _, b := range branches {
+		if b.ReleaseVersion != "" {
+			lines = append(lines, fmt.Sprintf("  %s from branch %q", b.ReleaseVersion, b.Branch))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("About to stage %d releases to gs://%s, overwriting any releases already staged at the same paths:\n%s", len(lines), o.Bucket, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStageBranches(t *testing.T) {
+	tests := map[string]struct {
+		values    []string
+		expected  []stageBranch
+		expectErr bool
+	}{
+		"devel builds": {
+			values:   []string{"release-1.5", "master"},
+			expected: []stageBranch{{Branch: "release-1.5"}, {Branch: "master"}},
+		},
+		"release versions": {
+			values: []string{"release-1.5=v1.5.4", "master"},
+			expected: []stageBranch{
+				{Branch: "release-1.5", ReleaseVersion: "v1.5.4"},
+				{Branch: "master"},
+			},
+		},
+		"no branches": {
+			expectErr: true,
+		},
+		"empty release version": {
+			values:    []string{"release-1.5="},
+			expectErr: true,
+		},
+		"empty branch": {
+			values:    []string{"=v1.5.4"},
+			expectErr: true,
+		},
+		"duplicate branch": {
+			values:    []string{"release-1.5=v1.5.4", "release-1.5"},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseStageBranches(test.values)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if !test.expectErr && !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %+v but got %+v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cert-manager/release/pkg/release"
+	"github.com/cert-manager/release/pkg/sign"
+)
+
+// stageProvenance generates the SLSA provenance of the release staged to
+// outputDir by the given builds, signs it with each --signing-kms-key and
+// uploads it alongside the release artifacts, returning its GCS path. The
+// subjects of the provenance are read from the staged release manifest, so
+// it must be called once the release has been fully staged.
+func stageProvenance(ctx context.Context, o *stageOptions, outputDir string, builds []release.ProvenanceBuild, images []stageImage) (string, error) {
+	keys, err := sign.NewGCPKMSKeys(o.SigningKMSKeys)
+	if err != nil {
+		return "", err
+	}
+
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+	bucket := gcs.Bucket(o.Bucket)
+
+	data, err := readObject(ctx, bucket.Object(buildObjectName(outputDir, release.ManifestFileName)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s file: %w", release.ManifestFileName, err)
+	}
+	manifest := &release.Manifest{}
+	if err := manifest.Unmarshal(data); err != nil {
+		return "", err
+	}
+
+	statement, err := release.GenerateProvenance(stageProvenanceOptions(o, builds, images), manifest)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Signing provenance with %d KMS key(s)", len(keys))
+	envelope, err := sign.SignDSSE(ctx, keys, release.ProvenancePayloadType, statement)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign provenance: %w", err)
+	}
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode signed provenance: %w", err)
+	}
+
+	objectName := buildObjectName(outputDir, release.ProvenanceFileName)
+	log.Printf("Uploading provenance to gs://%s/%s", o.Bucket, objectName)
+	objectMeta := release.ObjectMetadata{ReleaseVersion: o.ReleaseVersion, GitRef: o.GitRef}
+	if err := release.UploadObject(ctx, bucket.Object(objectName), bytes.NewReader(append(encoded, '\n')), objectMeta, release.DefaultUploadOptions); err != nil {
+		return "", fmt.Errorf("failed to upload provenance: %w", err)
+	}
+
+	return fmt.Sprintf("gs://%s/%s", o.Bucket, objectName), nil
+}
+
+// stageProvenanceOptions describes the stage builds which staged a release
+// with the given images for its provenance.
+func stageProvenanceOptions(o *stageOptions, builds []release.ProvenanceBuild, images []stageImage) release.ProvenanceOptions {
+	opts := release.ProvenanceOptions{
+		BuilderID:  release.CloudBuildBuilderID,
+		SourceRepo: fmt.Sprintf("https://github.com/%s/%s", o.Org, o.Repo),
+		GitRef:     o.GitRef,
+		ConfigFile: o.CloudBuildFile,
+		Builds:     builds,
+	}
+	if len(images) > 0 {
+		opts.Images = make(map[string]string, len(images))
+		for _, image := range images {
+			opts.Images[image.Name] = image.Digest
+		}
+	}
+	return opts
+}
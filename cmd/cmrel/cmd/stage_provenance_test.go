@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cert-manager/release/pkg/release"
+)
+
+func TestStageProvenanceOptions(t *testing.T) {
+	o := &stageOptions{Org: "jetstack", Repo: "cert-manager", GitRef: "abc", CloudBuildFile: "gcb/stage/cloudbuild.yaml"}
+	builds := []release.ProvenanceBuild{{ID: "build-1"}}
+
+	tests := map[string]struct {
+		images    []stageImage
+		expImages map[string]string
+	}{
+		"no images": {},
+		"images are recorded by name": {
+			images:    []stageImage{{Name: "quay.io/jetstack/cert-manager-controller-amd64:v1.6.0", Digest: "sha256:abc"}},
+			expImages: map[string]string{"quay.io/jetstack/cert-manager-controller-amd64:v1.6.0": "sha256:abc"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := stageProvenanceOptions(o, builds, test.images)
+			if opts.SourceRepo != "https://github.com/jetstack/cert-manager" {
+				t.Errorf("unexpected source repo %q", opts.SourceRepo)
+			}
+			if opts.GitRef != "abc" || opts.ConfigFile != "gcb/stage/cloudbuild.yaml" || opts.BuilderID != release.CloudBuildBuilderID {
+				t.Errorf("unexpected provenance options: %+v", opts)
+			}
+			if len(opts.Builds) != 1 || opts.Builds[0].ID != "build-1" {
+				t.Errorf("unexpected builds: %+v", opts.Builds)
+			}
+			if len(opts.Images) != len(test.expImages) {
+				t.Fatalf("unexpected images: %v", opts.Images)
+			}
+			for name, digest := range test.expImages {
+				if opts.Images[name] != digest {
+					t.Errorf("expected image %q to have digest %q but got %q", name, digest, opts.Images[name])
+				}
+			}
+		})
+	}
+}
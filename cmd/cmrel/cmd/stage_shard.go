@@ -0,0 +1,550 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/cloudbuild/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/release"
+	"github.com/cert-manager/release/pkg/sign"
+)
+
+// defaultShardConcurrency is the default maximum number of shards of a
+// --shard-by-os build which run at once.
+const defaultShardConcurrency = 3
+
+// stageShard is one of the builds submitted by the stage command when
+// --shard-by-os is set, each of which builds the artifacts of a single OS.
+type stageShard struct {
+	// Name is the name of the shard, which is the OS it builds for
+	Name string
+
+	// Build is the build to submit for the shard
+	Build *cloudbuild.Build
+
+	// Staged is true if every file of the shard was already staged by an
+	// earlier build, in which case it isn't submitted again with
+	// --retry-missing and its files are only merged
+	Staged bool
+
+	// BuildID is the ID of the earlier build which staged the shard, as
+	// recorded in its manifest, if Staged is true
+	BuildID string
+}
+
+// stageShardBuilds splits the resolved stage build into one build per OS in
+// targetOSes which produces any of artifactTypes, each restricted to that
+// OS and the arches in targetArches it supports. Artifacts which aren't
+// specific to an OS, i.e. the charts and any SBOM or release notes, are only
+// built by the first shard, so that every artifact is staged by exactly one
+// shard.
+func stageShardBuilds(build *cloudbuild.Build, artifactTypes, targetOSes, targetArches sets.String) []stageShard {
+	var names []string
+	shardTypes := map[string]sets.String{}
+	for _, os := range targetOSes.List() {
+		types := sets.NewString()
+		if artifactTypes.Has(release.ArtifactTypeImages) && release.IsServerOS(os) {
+			types.Insert(release.ArtifactTypeImages)
+		}
+		if artifactTypes.Has(release.ArtifactTypeTarballs) && release.IsClientOS(os) {
+			types.Insert(release.ArtifactTypeTarballs)
+		}
+		if types.Len() == 0 {
+			continue
+		}
+		names = append(names, os)
+		shardTypes[os] = types
+	}
+	if artifactTypes.Has(release.ArtifactTypeCharts) {
+		if len(names) == 0 {
+			names = append(names, targetOSes.List()[0])
+			shardTypes[names[0]] = sets.NewString()
+		}
+		shardTypes[names[0]].Insert(release.ArtifactTypeCharts)
+	}
+
+	shards := make([]stageShard, len(names))
+	for i, name := range names {
+		shardBuild := *build
+		shardBuild.Tags = append(append([]string{}, build.Tags...), "shard-"+name)
+		shardBuild.Substitutions = make(map[string]string, len(build.Substitutions))
+		for key, value := range build.Substitutions {
+			shardBuild.Substitutions[key] = value
+		}
+
+		arches := targetArches.Intersection(sets.NewString(release.ArchitecturesPerOS[name]...))
+		shardBuild.Substitutions["_SHARD"] = name
+		shardBuild.Substitutions["_TARGET_OSES"] = name
+		shardBuild.Substitutions["_TARGET_ARCHES"] = strings.Join(arches.List(), ",")
+		shardBuild.Substitutions["_ARTIFACT_TYPES"] = strings.Join(shardTypes[name].List(), ",")
+		if i > 0 {
+			shardBuild.Substitutions["_SBOM_FORMAT"] = ""
+			shardBuild.Substitutions["_RELEASE_NOTES_OBJECT"] = ""
+		}
+
+		shards[i] = stageShard{Name: name, Build: &shardBuild}
+	}
+	return shards
+}
+
+// stageShardedBuild submits each of the shards of a --shard-by-os build
+// which isn't already Staged, running at most --shard-concurrency at once,
+// and waits for them all to complete. The results of Staged shards are
+// looked up from the builds which staged them, so that the images of every
+// shard are reported. Once every shard has succeeded, the files describing
+// the whole release are merged and staged, followed by any mirroring and the
+// --post-stage-hook. If any shard fails, the others are still waited for so
+// that the outcome of each is reported, but the release is not staged.
+func stageShardedBuild(ctx context.Context, stop func(), rootOpts *rootOptions, o *stageOptions, svc gcb.Service, shards []stageShard, outputDir string, retryPattern *regexp.Regexp, signingKeys []sign.GCPKMSKey) (*stageResult, error) {
+	// provenance, mirroring and the post-stage hook only apply to the merged
+	// release
+	shardOpts := *o
+	shardOpts.GenerateProvenance = false
+	shardOpts.MirrorBuckets = nil
+	shardOpts.PostStageHook = ""
+
+	var pending, skipped []stageShard
+	for _, shard := range shards {
+		if shard.Staged {
+			skipped = append(skipped, shard)
+			continue
+		}
+		pending = append(pending, shard)
+	}
+	if len(skipped) > 0 {
+		log.Printf("Not submitting %d shards which are already staged (%s)", len(skipped), strings.Join(shardNames(skipped), ", "))
+	}
+	if len(pending) > 0 {
+		log.Printf("Submitting %d shards (%s), running at most %d at once", len(pending), strings.Join(shardNames(pending), ", "), o.ShardConcurrency)
+	}
+
+	results := make([]*stageResult, len(shards))
+	errs := make([]error, len(shards))
+	for i, shard := range shards {
+		if !shard.Staged {
+			continue
+		}
+		result, err := stagedShardResult(ctx, o, svc, shard, outputDir)
+		if err != nil {
+			return nil, rootOpts.timeoutError(ctx, "looking up staged shards", withKind(ErrAPIUnavailable, fmt.Errorf("failed to look up the build which staged shard %q: %w", shard.Name, err)))
+		}
+		results[i] = result
+	}
+
+	sem := make(chan struct{}, o.ShardConcurrency)
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		if shard.Staged {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, shard stageShard) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			log.Printf("Starting shard %q", shard.Name)
+			results[i], errs[i] = submitStageBuild(ctx, stop, rootOpts, &shardOpts, svc, shard.Build, outputDir, &stageTimings{}, retryPattern)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	staged, err := mergeStageShardResults(o, shards, outputDir, results, errs)
+	if err != nil {
+		return staged, err
+	}
+
+	log.Printf("All %d shards succeeded, merging release files", len(shards))
+	if err := collateStageShards(ctx, o, outputDir, shardNames(shards), signingKeys); err != nil {
+		staged.Status = gcb.Failure
+		return staged, rootOpts.timeoutError(ctx, "merging shards", withKind(ErrAPIUnavailable, fmt.Errorf("failed to merge release files of shards: %w", err)))
+	}
+
+	rootOpts.Logger.Info(fmt.Sprintf("Release build complete - artifacts available at: gs://%s/%s", o.Bucket, outputDir))
+
+	if o.GenerateProvenance {
+		var builds []release.ProvenanceBuild
+		for _, result := range results {
+			builds = append(builds, result.provenanceBuild)
+		}
+		provenance, err := stageProvenance(ctx, o, outputDir, builds, staged.Images)
+		if err != nil {
+			return staged, rootOpts.timeoutError(ctx, "generating provenance", withKind(ErrAPIUnavailable, fmt.Errorf("failed to generate provenance: %w", err)))
+		}
+		staged.Provenance = provenance
+	}
+
+	if len(o.MirrorBuckets) > 0 {
+		mirrorPaths, err := mirrorStagedRelease(ctx, o.Bucket, o.MirrorBuckets, outputDir)
+		staged.MirrorPaths = mirrorPaths
+		if err != nil {
+			return staged, rootOpts.timeoutError(ctx, "mirroring artifacts", withKind(ErrAPIUnavailable, err))
+		}
+	}
+
+	if o.PostStageHook != "" {
+		log.Printf("Running --post-stage-hook %q", o.PostStageHook)
+		if err := runStageHook(ctx, o.PostStageHook, stageHookEnv(postStageHookName, o, staged)); err != nil {
+			log.Printf("WARNING: --post-stage-hook failed: %v", err)
+		}
+	}
+
+	return staged, nil
+}
+
+// stagedShardResult returns the result of the earlier build which staged the
+// given Staged shard.
+func stagedShardResult(ctx context.Context, o *stageOptions, svc gcb.Service, shard stageShard, outputDir string) (*stageResult, error) {
+	build, err := svc.GetBuild(ctx, o.Project, gcb.BuildName(o.Project, o.Region, shard.BuildID))
+	if err != nil {
+		return nil, err
+	}
+	result, err := gcb.NewBuildResult(build)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Succeeded() {
+		return nil, fmt.Errorf("build %q has status %q, but the shard's files are all staged", shard.BuildID, result.Status)
+	}
+
+	staged := &stageResult{
+		BuildID:    shard.BuildID,
+		LogURL:     build.LogUrl,
+		Status:     result.Status,
+		OutputPath: fmt.Sprintf("gs://%s/%s", o.Bucket, outputDir),
+		GitRef:     o.GitRef,
+		Project:    o.Project,
+		Labels:     gcb.LabelsFromTags(build.Tags),
+	}
+	for _, image := range result.Images {
+		staged.Images = append(staged.Images, stageImage{Name: image.Name, Digest: image.Digest})
+	}
+	return staged, nil
+}
+
+// mergeStageShardResults collates the result of each shard into the result
+// of the whole build. The result of each shard is recorded in Shards, and
+// the build IDs and images of every shard are combined. An error is returned
+// if any shard failed, which wraps the error of the first failed shard.
+func mergeStageShardResults(o *stageOptions, shards []stageShard, outputDir string, results []*stageResult, errs []error) (*stageResult, error) {
+	staged := &stageResult{
+		Status:     gcb.Success,
+		OutputPath: fmt.Sprintf("gs://%s/%s", o.Bucket, outputDir),
+		GitRef:     o.GitRef,
+		Project:    o.Project,
+		Labels:     gcb.LabelsFromTags(shards[0].Build.Tags),
+	}
+
+	var buildIDs, failed []string
+	var firstErr error
+	for i, shard := range shards {
+		result, err := results[i], errs[i]
+		if result != nil {
+			result.Shard = shard.Name
+			staged.Shards = append(staged.Shards, result)
+			buildIDs = append(buildIDs, result.BuildID)
+			staged.Images = append(staged.Images, result.Images...)
+		}
+		if err == nil {
+			continue
+		}
+
+		failed = append(failed, shard.Name)
+		if firstErr == nil {
+			firstErr = fmt.Errorf("shard %q: %w", shard.Name, err)
+			staged.Status = gcb.Failure
+			if result != nil && result.Status != "" {
+				staged.Status = result.Status
+			}
+			if result != nil {
+				staged.Failure = result.Failure
+			}
+		}
+	}
+	staged.BuildID = strings.Join(buildIDs, ",")
+
+	if firstErr != nil {
+		log.Printf("%d of %d shards failed (%s), not merging shards", len(failed), len(shards), strings.Join(failed, ", "))
+		return staged, fmt.Errorf("%d of %d shards failed, the release was not staged: %w", len(failed), len(shards), firstErr)
+	}
+	return staged, nil
+}
+
+// collateStageShards merges the metadata, checksums and manifest files
+// written by each of the shards into those of the whole release, signing the
+// merged checksums file with each of signingKeys unless --skip-signing is set.
+// The metadata file is written last, since a release isn't found until it
+// exists, and the files written by each shard are then removed.
+func collateStageShards(ctx context.Context, o *stageOptions, outputDir string, shards []string, signingKeys []sign.GCPKMSKey) error {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+	bucket := gcs.Bucket(o.Bucket)
+
+	var metas []release.Metadata
+	var sums []map[string]string
+	var manifests []*release.Manifest
+	for _, shard := range shards {
+		data, err := readObject(ctx, bucket.Object(buildObjectName(outputDir, release.ShardFileName(release.MetadataFileName, shard))))
+		if err != nil {
+			return fmt.Errorf("failed to read release metadata of shard %q: %w", shard, err)
+		}
+		var meta release.Metadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("invalid release metadata of shard %q: %w", shard, err)
+		}
+		metas = append(metas, meta)
+
+		data, err = readObject(ctx, bucket.Object(buildObjectName(outputDir, release.ShardFileName(release.ChecksumsFileName, shard))))
+		if err != nil {
+			return fmt.Errorf("failed to read %s file of shard %q: %w", release.ChecksumsFileName, shard, err)
+		}
+		shardSums, err := release.ReadChecksumsFile(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("invalid %s file of shard %q: %w", release.ChecksumsFileName, shard, err)
+		}
+		sums = append(sums, shardSums)
+
+		data, err = readObject(ctx, bucket.Object(buildObjectName(outputDir, release.ShardFileName(release.ManifestFileName, shard))))
+		if err != nil {
+			return fmt.Errorf("failed to read %s file of shard %q: %w", release.ManifestFileName, shard, err)
+		}
+		manifest := &release.Manifest{}
+		if err := manifest.Unmarshal(data); err != nil {
+			return fmt.Errorf("invalid %s file of shard %q: %w", release.ManifestFileName, shard, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	meta, err := release.MergeMetadata(metas...)
+	if err != nil {
+		return err
+	}
+	metaData, err := json.MarshalIndent(meta, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata output: %w", err)
+	}
+
+	mergedSums, err := release.MergeChecksums(sums...)
+	if err != nil {
+		return err
+	}
+	checksums := &bytes.Buffer{}
+	if err := release.WriteChecksumsFile(checksums, mergedSums); err != nil {
+		return fmt.Errorf("failed to encode %s file: %w", release.ChecksumsFileName, err)
+	}
+
+	var signatures []string
+	checksumsSignature := ""
+	if !o.SkipSigning {
+		tmpDir, err := os.MkdirTemp("", "cmrel-merge-shards-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		signatures, err = signChecksumsFileKMS(ctx, tmpDir, signingKeys, checksums.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to sign %s file: %w", release.ChecksumsFileName, err)
+		}
+		checksumsSignature = release.ChecksumsKMSSignatureFileName(0)
+	}
+
+	manifest, err := release.MergeManifests(manifests...)
+	if err != nil {
+		return err
+	}
+	manifest.Created = time.Now().UTC()
+	checksumsSum := sha256.Sum256(checksums.Bytes())
+	manifest.Artifacts = append(manifest.Artifacts, release.ManifestArtifact{
+		Name:   release.ChecksumsFileName,
+		Path:   fmt.Sprintf("gs://%s/%s", o.Bucket, buildObjectName(outputDir, release.ChecksumsFileName)),
+		Size:   int64(checksums.Len()),
+		SHA256: hex.EncodeToString(checksumsSum[:]),
+	})
+	for i := range manifest.Artifacts {
+		manifest.Artifacts[i].Signature = checksumsSignature
+	}
+	manifestData, err := manifest.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode release manifest: %w", err)
+	}
+
+	objectMeta := release.ObjectMetadata{ReleaseVersion: meta.ReleaseVersion, GitRef: meta.GitCommitRef}
+	for _, sigPath := range signatures {
+		log.Printf("Uploading signature file %q", filepath.Base(sigPath))
+		if err := uploadFile(ctx, bucket.Object(buildObjectName(outputDir, filepath.Base(sigPath))), sigPath, objectMeta, release.DefaultUploadOptions); err != nil {
+			return fmt.Errorf("failed to upload signature file: %w", err)
+		}
+	}
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{release.ChecksumsFileName, checksums.Bytes()},
+		{release.ManifestFileName, manifestData},
+		{release.MetadataFileName, metaData},
+	} {
+		log.Printf("Uploading merged %s file", file.name)
+		if err := release.UploadObject(ctx, bucket.Object(buildObjectName(outputDir, file.name)), bytes.NewReader(file.data), objectMeta, release.DefaultUploadOptions); err != nil {
+			return fmt.Errorf("failed to write %s file: %w", file.name, err)
+		}
+	}
+
+	for _, shard := range shards {
+		for _, name := range []string{release.MetadataFileName, release.ChecksumsFileName, release.ManifestFileName} {
+			obj := bucket.Object(buildObjectName(outputDir, release.ShardFileName(name, shard)))
+			if err := obj.Delete(ctx); err != nil {
+				log.Printf("WARNING: failed to remove %q of shard %q: %v", obj.ObjectName(), shard, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// markStagedShardFiles lists the files already staged at outputDir in
+// bucket by the shards of an earlier --shard-by-os build, marking each of
+// shards whose files are all staged with markStagedShards and recording
+// the ID of the build which staged it from its manifest. The names of the
+// shards which must be built again are returned. An error is returned if
+// the release has already been staged, since the files written by its shards
+// have then been removed.
+func markStagedShardFiles(ctx context.Context, bucket, outputDir string, shards []stageShard) ([]string, error) {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, withKind(ErrAPIUnavailable, fmt.Errorf("failed to create GCS client: %w", err))
+	}
+	defer gcs.Close()
+
+	objs, err := release.ListObjects(ctx, gcs.Bucket(bucket), outputDir+"/")
+	if err != nil {
+		return nil, withKind(ErrAPIUnavailable, fmt.Errorf("failed to list staged files: %w", err))
+	}
+
+	present := sets.NewString()
+	for _, obj := range objs {
+		present.Insert(strings.TrimPrefix(obj.Name, outputDir+"/"))
+	}
+	if present.Has(release.MetadataFileName) {
+		return nil, validationErrorf("release at gs://%s/%s has already been staged, --retry-missing only resumes a --shard-by-os build which failed", bucket, outputDir)
+	}
+
+	retry, err := markStagedShards(shards, present)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, shard := range shards {
+		if !shard.Staged {
+			continue
+		}
+		data, err := readObject(ctx, gcs.Bucket(bucket).Object(buildObjectName(outputDir, release.ShardFileName(release.ManifestFileName, shard.Name))))
+		if err != nil {
+			return nil, withKind(ErrAPIUnavailable, fmt.Errorf("failed to read %s file of shard %q: %w", release.ManifestFileName, shard.Name, err))
+		}
+		manifest := &release.Manifest{}
+		if err := manifest.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("invalid %s file of shard %q: %w", release.ManifestFileName, shard.Name, err)
+		}
+		// the build is needed to report the images of the shard
+		if manifest.BuildID == "" {
+			return nil, fmt.Errorf("%s file of shard %q doesn't record the build which staged it, so the shard must be staged again without --retry-missing", release.ManifestFileName, shard.Name)
+		}
+		shards[i].BuildID = manifest.BuildID
+	}
+
+	return retry, nil
+}
+
+// markStagedShards marks each of shards as Staged if all of the files it
+// would stage are in present, returning the names of the shards which
+// must be built again. Shards are the unit of retry since the files written
+// by a shard must describe all of its artifacts, so a shard is rebuilt for
+// every targeted arch of its OS even if only some of its artifacts are
+// missing.
+func markStagedShards(shards []stageShard, present sets.String) ([]string, error) {
+	var retry []string
+	for i, shard := range shards {
+		expected, err := expectedShardFiles(shard)
+		if err != nil {
+			return nil, fmt.Errorf("shard %q: %w", shard.Name, err)
+		}
+		shards[i].Staged = present.HasAll(expected...)
+		if !shards[i].Staged {
+			retry = append(retry, shard.Name)
+		}
+	}
+	return retry, nil
+}
+
+// expectedShardFiles returns the names of the files that the shard is
+// expected to stage, as determined by the substitutions of its build.
+func expectedShardFiles(shard stageShard) ([]string, error) {
+	subs := shard.Build.Substitutions
+	artifactTypes, err := release.ArtifactTypesFromString(subs["_ARTIFACT_TYPES"])
+	if err != nil {
+		return nil, err
+	}
+	targetOSes, err := release.OSListFromString(subs["_TARGET_OSES"])
+	if err != nil {
+		return nil, err
+	}
+	targetArches, err := release.ArchListFromString(subs["_TARGET_ARCHES"], targetOSes)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := release.CompressedArtifactNames(release.ExpectedArtifactNames(artifactTypes, targetOSes, targetArches), subs["_COMPRESSION"])
+	for _, name := range []string{release.MetadataFileName, release.ChecksumsFileName, release.ManifestFileName} {
+		expected = append(expected, release.ShardFileName(name, shard.Name))
+	}
+	if format := subs["_SBOM_FORMAT"]; format != "" {
+		expected = append(expected, release.SBOMFileName(format))
+	}
+	if subs["_RELEASE_NOTES_OBJECT"] != "" {
+		expected = append(expected, release.ReleaseNotesFileName)
+	}
+	return expected, nil
+}
+
+func shardNames(shards []stageShard) []string {
+	names := make([]string, len(shards))
+	for i, shard := range shards {
+		names[i] = shard.Name
+	}
+	return names
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/api/cloudbuild/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/gcb/gcbfake"
+)
+
+func TestStageShardBuilds(t *testing.T) {
+	type shard struct {
+		Name          string
+		TargetOSes    string
+		TargetArches  string
+		ArtifactTypes string
+		SBOMFormat    string
+	}
+
+	tests := map[string]struct {
+		artifactTypes sets.String
+		targetOSes    sets.String
+		targetArches  sets.String
+		expected      []shard
+	}{
+		"charts and SBOM are only built by the first shard": {
+			artifactTypes: sets.NewString("images", "tarballs", "charts"),
+			targetOSes:    sets.NewString("darwin", "linux", "windows"),
+			targetArches:  sets.NewString("amd64", "arm64"),
+			expected: []shard{
+				{Name: "darwin", TargetOSes: "darwin", TargetArches: "amd64,arm64", ArtifactTypes: "charts,tarballs", SBOMFormat: "spdx"},
+				{Name: "linux", TargetOSes: "linux", TargetArches: "amd64,arm64", ArtifactTypes: "images,tarballs"},
+				{Name: "windows", TargetOSes: "windows", TargetArches: "amd64", ArtifactTypes: "tarballs"},
+			},
+		},
+		"OSes which build no artifacts are skipped": {
+			artifactTypes: sets.NewString("images"),
+			targetOSes:    sets.NewString("darwin", "linux"),
+			targetArches:  sets.NewString("amd64"),
+			expected: []shard{
+				{Name: "linux", TargetOSes: "linux", TargetArches: "amd64", ArtifactTypes: "images", SBOMFormat: "spdx"},
+			},
+		},
+		"charts only": {
+			artifactTypes: sets.NewString("charts"),
+			targetOSes:    sets.NewString("darwin", "linux"),
+			targetArches:  sets.NewString("amd64"),
+			expected: []shard{
+				{Name: "darwin", TargetOSes: "darwin", TargetArches: "amd64", ArtifactTypes: "charts", SBOMFormat: "spdx"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			build := &cloudbuild.Build{
+				Tags:          []string{stageBuildTag},
+				Substitutions: map[string]string{"_CM_REF": "abc", "_SBOM_FORMAT": "spdx"},
+			}
+
+			var got []shard
+			for _, s := range stageShardBuilds(build, test.artifactTypes, test.targetOSes, test.targetArches) {
+				subs := s.Build.Substitutions
+				if subs["_SHARD"] != s.Name {
+					t.Errorf("expected _SHARD of shard %q to be its name but got %q", s.Name, subs["_SHARD"])
+				}
+				if subs["_CM_REF"] != "abc" {
+					t.Errorf("expected shard %q to keep the other substitutions but got %v", s.Name, subs)
+				}
+				if !reflect.DeepEqual(s.Build.Tags, []string{stageBuildTag, "shard-" + s.Name}) {
+					t.Errorf("unexpected tags of shard %q: %v", s.Name, s.Build.Tags)
+				}
+				got = append(got, shard{Name: s.Name, TargetOSes: subs["_TARGET_OSES"], TargetArches: subs["_TARGET_ARCHES"], ArtifactTypes: subs["_ARTIFACT_TYPES"], SBOMFormat: subs["_SBOM_FORMAT"]})
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected shards:\n%+v\nbut got:\n%+v", test.expected, got)
+			}
+			if build.Substitutions["_SHARD"] != "" || len(build.Tags) != 1 {
+				t.Errorf("expected the original build not to be modified")
+			}
+		})
+	}
+}
+
+func TestStageShardedBuild_ShardFails(t *testing.T) {
+	svc := &gcbfake.Service{Complete: func(attempt int, build *cloudbuild.Build) {
+		if build.Substitutions["_SHARD"] == "linux" {
+			build.Status = gcb.Failure
+		}
+	}}
+	o := &stageOptions{
+		Bucket:           "my-bucket",
+		Project:          "my-project",
+		GitRef:           "abc",
+		BuildTimeout:     time.Minute,
+		ShardConcurrency: 1,
+	}
+	build := &cloudbuild.Build{Substitutions: map[string]string{}}
+	shards := stageShardBuilds(build, sets.NewString("images", "tarballs"), sets.NewString("darwin", "linux", "windows"), sets.NewString("amd64"))
+
+	result, err := stageShardedBuild(context.Background(), func() {}, &rootOptions{Logger: logr.Discard()}, o, svc, shards, "stage/gcb/devel/abc", regexp.MustCompile(defaultStageRetryPattern), nil)
+	if !errors.Is(err, ErrBuildFailed) {
+		t.Fatalf("expected a build failure but got: %v", err)
+	}
+
+	if len(svc.Submitted()) != 3 {
+		t.Errorf("expected every shard to be submitted after one failed but got %d builds", len(svc.Submitted()))
+	}
+	if result.Status != gcb.Failure {
+		t.Errorf("expected status %q but got %q", gcb.Failure, result.Status)
+	}
+	// shards may be submitted in any order
+	if buildIDs := sets.NewString(strings.Split(result.BuildID, ",")...); !buildIDs.Equal(sets.NewString("build-1", "build-2", "build-3")) {
+		t.Errorf("expected the build IDs of every shard but got %q", result.BuildID)
+	}
+
+	statuses := map[string]string{}
+	for _, shard := range result.Shards {
+		statuses[shard.Shard] = shard.Status
+	}
+	expected := map[string]string{"darwin": gcb.Success, "linux": gcb.Failure, "windows": gcb.Success}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected shard statuses %v but got %v", expected, statuses)
+	}
+}
+
+func TestMarkStagedShards(t *testing.T) {
+	build := &cloudbuild.Build{Substitutions: map[string]string{"_COMPRESSION": "gzip", "_SBOM_FORMAT": "spdx"}}
+	newShards := func() []stageShard {
+		return stageShardBuilds(build, sets.NewString("images", "tarballs", "charts"), sets.NewString("darwin", "linux"), sets.NewString("amd64", "arm64"))
+	}
+
+	var staged []string
+	for _, shard := range newShards() {
+		expected, err := expectedShardFiles(shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		staged = append(staged, expected...)
+	}
+
+	tests := map[string]struct {
+		present  sets.String
+		expRetry []string
+	}{
+		"every shard staged": {
+			present: sets.NewString(staged...),
+		},
+		"nothing staged": {
+			present:  sets.NewString(),
+			expRetry: []string{"darwin", "linux"},
+		},
+		"missing artifact of one arch rebuilds its OS": {
+			present:  sets.NewString(staged...).Delete("cert-manager-server-linux-arm64.tar.gz"),
+			expRetry: []string{"linux"},
+		},
+		"missing shard file": {
+			present:  sets.NewString(staged...).Delete("metadata.darwin.json"),
+			expRetry: []string{"darwin"},
+		},
+		"missing SBOM rebuilds the first shard": {
+			present:  sets.NewString(staged...).Delete("cert-manager-sbom.spdx.json"),
+			expRetry: []string{"darwin"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			shards := newShards()
+			retry, err := markStagedShards(shards, test.present)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(retry, test.expRetry) {
+				t.Errorf("expected shards %v to be retried but got %v", test.expRetry, retry)
+			}
+			for _, shard := range shards {
+				if shard.Staged == sets.NewString(test.expRetry...).Has(shard.Name) {
+					t.Errorf("unexpected Staged=%t for shard %q", shard.Staged, shard.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestStageShardedBuild_SkipsStagedShards(t *testing.T) {
+	svc := &gcbfake.Service{Complete: func(attempt int, build *cloudbuild.Build) {
+		if build.Substitutions["_SHARD"] == "linux" {
+			build.Status = gcb.Failure
+		}
+	}}
+	o := &stageOptions{
+		Bucket:           "my-bucket",
+		Project:          "my-project",
+		GitRef:           "abc",
+		BuildTimeout:     time.Minute,
+		ShardConcurrency: 1,
+	}
+	build := &cloudbuild.Build{Substitutions: map[string]string{}}
+	shards := stageShardBuilds(build, sets.NewString("images", "tarballs"), sets.NewString("darwin", "linux", "windows"), sets.NewString("amd64"))
+	shards[0].Staged = true
+	shards[0].BuildID = "earlier-build"
+	svc.AddBuild(&cloudbuild.Build{
+		Id:      "earlier-build",
+		Status:  gcb.Success,
+		Results: &cloudbuild.Results{Images: []*cloudbuild.BuiltImage{{Name: "example.com/cert-manager-darwin", Digest: "sha256:abc"}}},
+	})
+
+	result, err := stageShardedBuild(context.Background(), func() {}, &rootOptions{Logger: logr.Discard()}, o, svc, shards, "stage/gcb/devel/abc", regexp.MustCompile(defaultStageRetryPattern), nil)
+	if !errors.Is(err, ErrBuildFailed) {
+		t.Fatalf("expected a build failure but got: %v", err)
+	}
+
+	var submitted []string
+	for _, b := range svc.Submitted() {
+		submitted = append(submitted, b.Substitutions["_SHARD"])
+	}
+	if !sets.NewString(submitted...).Equal(sets.NewString("linux", "windows")) {
+		t.Errorf("expected only the shards which aren't staged to be submitted but got %v", submitted)
+	}
+	if len(result.Shards) != 3 {
+		t.Errorf("expected the results of all 3 shards but got %d", len(result.Shards))
+	}
+	if !reflect.DeepEqual(result.Images, []stageImage{{Name: "example.com/cert-manager-darwin", Digest: "sha256:abc"}}) {
+		t.Errorf("expected the images of the staged shard to be reported but got %+v", result.Images)
+	}
+	if buildIDs := sets.NewString(strings.Split(result.BuildID, ",")...); !buildIDs.Has("earlier-build") {
+		t.Errorf("expected the build ID of the staged shard but got %q", result.BuildID)
+	}
+}
+
+func TestStageShardedBuild_StagedShardBuildNotFound(t *testing.T) {
+	svc := &gcbfake.Service{}
+	o := &stageOptions{Bucket: "my-bucket", Project: "my-project", GitRef: "abc", BuildTimeout: time.Minute, ShardConcurrency: 1}
+	build := &cloudbuild.Build{Substitutions: map[string]string{}}
+	shards := stageShardBuilds(build, sets.NewString("tarballs"), sets.NewString("darwin", "linux"), sets.NewString("amd64"))
+	shards[0].Staged = true
+	shards[0].BuildID = "missing-build"
+
+	if _, err := stageShardedBuild(context.Background(), func() {}, &rootOptions{Logger: logr.Discard()}, o, svc, shards, "stage/gcb/devel/abc", regexp.MustCompile(defaultStageRetryPattern), nil); err == nil {
+		t.Fatalf("expected an error when the build which staged a shard can't be found")
+	}
+	if len(svc.Submitted()) != 0 {
+		t.Errorf("expected no shards to be submitted but got %d", len(svc.Submitted()))
+	}
+}
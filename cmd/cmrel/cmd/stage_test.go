@@ -0,0 +1,576 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	flag "github.com/spf13/pflag"
+	"google.golang.org/api/cloudbuild/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/cert-manager/release/pkg/gcb"
+	"github.com/cert-manager/release/pkg/gcb/gcbfake"
+	"github.com/cert-manager/release/pkg/logging"
+	"github.com/cert-manager/release/pkg/version"
+)
+
+func TestStageOutputDirForBuild(t *testing.T) {
+	tests := map[string]struct {
+		build     *cloudbuild.Build
+		expected  string
+		expectErr bool
+	}{
+		"release build": {
+			build: &cloudbuild.Build{
+				Tags: []string{stageBuildTag, "ref-abc"},
+				Substitutions: map[string]string{
+					"_CM_REF":             "abc",
+					"_RELEASE_VERSION":    "v1.6.0",
+					"_BUCKET_PATH_PREFIX": "test-jake",
+				},
+			},
+			expected: "test-jake/release/v1.6.0-abc",
+		},
+		"release candidate build": {
+			build: &cloudbuild.Build{
+				Tags: []string{stageBuildTag, "ref-abc"},
+				Substitutions: map[string]string{
+					"_CM_REF":             "abc",
+					"_RELEASE_VERSION":    "v1.15.0-beta.0",
+					"_BUCKET_PATH_PREFIX": "stage/gcb",
+				},
+			},
+			expected: "stage/gcb/prerelease/v1.15.0-beta.0-abc",
+		},
+		"devel build": {
+			build: &cloudbuild.Build{
+				Tags: []string{stageBuildTag},
+				Substitutions: map[string]string{
+					"_CM_REF":             "abc",
+					"_BUCKET_PATH_PREFIX": "stage/gcb",
+				},
+			},
+			expected: "stage/gcb/devel/abc",
+		},
+		"missing prefix uses the default": {
+			build: &cloudbuild.Build{
+				Tags:          []string{stageBuildTag},
+				Substitutions: map[string]string{"_CM_REF": "abc"},
+			},
+			expected: "stage/gcb/devel/abc",
+		},
+		"build without the stage tag errors": {
+			build: &cloudbuild.Build{
+				Tags:          []string{"cert-manager-release-publish"},
+				Substitutions: map[string]string{"_CM_REF": "abc"},
+			},
+			expectErr: true,
+		},
+		"build without a git ref errors": {
+			build: &cloudbuild.Build{
+				Tags: []string{stageBuildTag},
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := stageOutputDirForBuild(test.build)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunStageHook(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env")
+	hook := filepath.Join(dir, "hook.sh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$CMREL_HOOK $CMREL_RELEASE_VERSION $CMREL_GIT_REF $CMREL_BUILD_ID\" > %q\nexit \"$HOOK_EXIT\"\n", out)
+	if err := os.WriteFile(hook, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &stageOptions{ReleaseVersion: "v1.6.0", Branch: "release-1.6"}
+	result := &stageResult{GitRef: "abc", BuildID: "build-1"}
+
+	env := append(stageHookEnv(postStageHookName, o, result), "HOOK_EXIT=0")
+	if err := runStageHook(context.Background(), hook, env); err != nil {
+		t.Fatalf("unexpected error running hook: %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "post-stage v1.6.0 abc build-1\n"; string(got) != exp {
+		t.Errorf("hook was run with unexpected environment: got=%q, exp=%q", got, exp)
+	}
+
+	env = append(stageHookEnv(preStageHookName, o, result), "HOOK_EXIT=3")
+	if err := runStageHook(context.Background(), hook, env); err == nil {
+		t.Errorf("expected an error when the hook exits with a non-zero status")
+	}
+}
+
+func TestUserSubstitutions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "substitutions.yaml")
+	if err := os.WriteFile(path, []byte("_FOO: from-file\n_BAR: from-file\n_CM_REF: abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := userSubstitutions(&stageOptions{SubstitutionFile: path}); err == nil {
+		t.Errorf("expected an error overriding _CM_REF without --allow-override")
+	}
+
+	substitutions, err := userSubstitutions(&stageOptions{
+		SubstitutionFile: path,
+		Substitutions:    []string{"_BAR=from-flag"},
+		AllowOverride:    true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if substitutions["_FOO"] != "from-file" || substitutions["_BAR"] != "from-flag" || substitutions["_CM_REF"] != "abc" {
+		t.Errorf("unexpected substitutions: %v", substitutions)
+	}
+}
+
+func TestValidateMirrorBuckets(t *testing.T) {
+	tests := map[string]struct {
+		mirrors   []string
+		expectErr bool
+	}{
+		"no mirrors": {},
+		"distinct mirrors": {
+			mirrors: []string{"mirror-a", "mirror-b"},
+		},
+		"mirror is the primary bucket": {
+			mirrors:   []string{"primary"},
+			expectErr: true,
+		},
+		"duplicate mirror": {
+			mirrors:   []string{"mirror-a", "mirror-a"},
+			expectErr: true,
+		},
+		"empty mirror": {
+			mirrors:   []string{""},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateMirrorBuckets("primary", test.mirrors)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got error: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateReleaseSigning(t *testing.T) {
+	tests := map[string]struct {
+		opts      stageOptions
+		expectErr bool
+	}{
+		"signed release": {
+			opts: stageOptions{ReleaseVersion: "v1.6.0"},
+		},
+		"unsigned devel build": {
+			opts: stageOptions{SkipSigning: true},
+		},
+		"unsigned release": {
+			opts:      stageOptions{ReleaseVersion: "v1.6.0", SkipSigning: true},
+			expectErr: true,
+		},
+		"unsigned release explicitly allowed": {
+			opts: stageOptions{ReleaseVersion: "v1.6.0", SkipSigning: true, AllowUnsignedRelease: true},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateReleaseSigning(&test.opts)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got error: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestApplySmokeFlags(t *testing.T) {
+	tests := map[string]struct {
+		args      []string
+		expected  stageOptions
+		expectErr bool
+	}{
+		"smoke not set": {
+			args:     []string{"--target-os=windows"},
+			expected: stageOptions{TargetOSes: "windows", TargetArches: "*", BuildTimeout: time.Hour},
+		},
+		"smoke sets implied flags": {
+			args:     []string{"--smoke"},
+			expected: stageOptions{Smoke: true, TargetOSes: smokeTargetOS, TargetArches: smokeTargetArch, SkipSigning: true, BuildTimeout: smokeBuildTimeout},
+		},
+		"explicit build timeout takes precedence": {
+			args:     []string{"--smoke", "--build-timeout=5m"},
+			expected: stageOptions{Smoke: true, TargetOSes: smokeTargetOS, TargetArches: smokeTargetArch, SkipSigning: true, BuildTimeout: 5 * time.Minute},
+		},
+		"explicit target arch is an error": {
+			args:      []string{"--smoke", "--target-arch=arm64"},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := &stageOptions{}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			o.AddFlags(fs, func(string) {})
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applySmokeFlags(fs)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := stageOptions{Smoke: o.Smoke, TargetOSes: o.TargetOSes, TargetArches: o.TargetArches, SkipSigning: o.SkipSigning, BuildTimeout: o.BuildTimeout}
+			if got.Smoke != test.expected.Smoke || got.TargetOSes != test.expected.TargetOSes || got.TargetArches != test.expected.TargetArches ||
+				got.SkipSigning != test.expected.SkipSigning || got.BuildTimeout != test.expected.BuildTimeout {
+				t.Errorf("unexpected options:\ngot: %+v\nexp: %+v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestStageBuildSubstitutions(t *testing.T) {
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = "v1.2.3"
+
+	o := &stageOptions{Org: "jetstack", Repo: "cert-manager", Branch: "release-1.6", GitRef: "abc", SkipSigning: true}
+	substitutions := stageBuildSubstitutions(o, "stage/gcb", nil, sets.NewString("images"), sets.NewString("linux"), sets.NewString("amd64"))
+
+	if got := substitutions["_CMREL_VERSION"]; got != "v1.2.3" {
+		t.Errorf("expected _CMREL_VERSION to be the version of cmrel but got %q", got)
+	}
+	if got := substitutions["_CM_REF"]; got != "abc" {
+		t.Errorf("expected _CM_REF to be the git ref but got %q", got)
+	}
+	if got := substitutions["_TAG_RELEASE_BRANCH"]; got != "release-1.6" {
+		t.Errorf("expected _TAG_RELEASE_BRANCH to default to the branch but got %q", got)
+	}
+
+	o.TagReleaseBranch = "release-1.6-fips"
+	if got := stageBuildSubstitutions(o, "stage/gcb", nil, sets.NewString(), sets.NewString(), sets.NewString())["_TAG_RELEASE_BRANCH"]; got != "release-1.6-fips" {
+		t.Errorf("expected _TAG_RELEASE_BRANCH to be overridden by --tag-release-branch but got %q", got)
+	}
+	// every substitution is set so that none are left at their defaults in
+	// the cloudbuild.yaml file
+	if missing := sets.NewString(stageSubstitutions...).Difference(sets.StringKeySet(substitutions)); missing.Len() > 0 {
+		t.Errorf("expected all stage substitutions to be set but missing: %v", missing.List())
+	}
+}
+
+func TestFormatSubstitutions(t *testing.T) {
+	defer func(s sets.String) { sensitiveSubstitutions = s }(sensitiveSubstitutions)
+	sensitiveSubstitutions = sets.NewString("_TOKEN")
+
+	got := formatSubstitutions(map[string]string{
+		"_RELEASE_VERSION": "v1.6.0",
+		"_CM_REF":          "abc",
+		"_TOKEN":           "secret",
+		"_EMPTY":           "",
+	})
+	exp := []string{"_CM_REF=abc", "_EMPTY=", "_RELEASE_VERSION=v1.6.0", "_TOKEN=<redacted>"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected substitutions:\ngot: %q\nexp: %q", got, exp)
+	}
+}
+
+func TestShouldRetryStageBuild(t *testing.T) {
+	retryPattern := regexp.MustCompile(defaultStageRetryPattern)
+	errFailed := withKind(ErrBuildFailed, fmt.Errorf("building release tarballs failed"))
+
+	tests := map[string]struct {
+		result   *stageResult
+		err      error
+		expected bool
+	}{
+		"succeeded": {
+			result: &stageResult{Status: "SUCCESS"},
+		},
+		"internal error is retried": {
+			result:   &stageResult{Status: "INTERNAL_ERROR", Failure: "INTERNAL_ERROR"},
+			err:      errFailed,
+			expected: true,
+		},
+		"failed build step is not retried": {
+			result: &stageResult{Status: "FAILURE", Failure: "FAILURE (USER_BUILD_STEP): Build step failure"},
+			err:    errFailed,
+		},
+		"error waiting for the build is not retried": {
+			err: withKind(ErrAPIUnavailable, fmt.Errorf("error waiting for cloud build to complete")),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := shouldRetryStageBuild(test.result, test.err, retryPattern); got != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestSubmitStageBuild(t *testing.T) {
+	failWith := func(status string, failedAttempts int) func(int, *cloudbuild.Build) {
+		return func(attempt int, build *cloudbuild.Build) {
+			if attempt <= failedAttempts {
+				build.Status = status
+			}
+		}
+	}
+
+	tests := map[string]struct {
+		svc            *gcbfake.Service
+		retryOnFailure int
+		expStatus      string
+		expSubmitted   int
+		expErr         error
+	}{
+		"successful build": {
+			svc:          &gcbfake.Service{},
+			expStatus:    gcb.Success,
+			expSubmitted: 1,
+		},
+		"failed build step is not retried": {
+			svc:            &gcbfake.Service{Complete: failWith(gcb.Failure, 1)},
+			retryOnFailure: 2,
+			expStatus:      gcb.Failure,
+			expSubmitted:   1,
+			expErr:         ErrBuildFailed,
+		},
+		"internal error is retried": {
+			svc:            &gcbfake.Service{Complete: failWith(gcb.InternalError, 1)},
+			retryOnFailure: 2,
+			expStatus:      gcb.Success,
+			expSubmitted:   2,
+		},
+		"retries are exhausted": {
+			svc:            &gcbfake.Service{Complete: failWith(gcb.InternalError, 3)},
+			retryOnFailure: 1,
+			expStatus:      gcb.InternalError,
+			expSubmitted:   2,
+			expErr:         ErrBuildFailed,
+		},
+		"error submitting build": {
+			svc:    &gcbfake.Service{SubmitErr: fmt.Errorf("unavailable")},
+			expErr: ErrAPIUnavailable,
+		},
+		"error waiting for build": {
+			svc:          &gcbfake.Service{WaitErr: fmt.Errorf("unavailable")},
+			expSubmitted: 1,
+			expErr:       ErrAPIUnavailable,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := &stageOptions{
+				Bucket:         "my-bucket",
+				Project:        "my-project",
+				GitRef:         "abc",
+				BuildTimeout:   time.Minute,
+				RetryOnFailure: test.retryOnFailure,
+			}
+			build := &cloudbuild.Build{Substitutions: map[string]string{"_CM_REF": "abc"}}
+
+			result, err := submitStageBuild(context.Background(), func() {}, &rootOptions{Logger: logr.Discard()}, o, test.svc, build, "stage/gcb/devel/abc", &stageTimings{}, regexp.MustCompile(defaultStageRetryPattern))
+			if test.expErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.expErr != nil && !errors.Is(err, test.expErr) {
+				t.Fatalf("expected error of kind %v but got: %v", test.expErr, err)
+			}
+
+			submitted := test.svc.Submitted()
+			if len(submitted) != test.expSubmitted {
+				t.Errorf("expected %d builds to be submitted but got %d", test.expSubmitted, len(submitted))
+			}
+			for _, b := range submitted {
+				if b.Substitutions["_CM_REF"] != "abc" {
+					t.Errorf("expected submitted build to have substitutions %v but got %v", build.Substitutions, b.Substitutions)
+				}
+			}
+
+			if test.expStatus == "" {
+				return
+			}
+			if result == nil {
+				t.Fatalf("expected a result with status %q but got nil", test.expStatus)
+			}
+			if result.Status != test.expStatus {
+				t.Errorf("expected status %q but got %q", test.expStatus, result.Status)
+			}
+			if exp := fmt.Sprintf("build-%d", test.expSubmitted); result.BuildID != exp {
+				t.Errorf("expected result for build %q but got %q", exp, result.BuildID)
+			}
+		})
+	}
+}
+
+func TestLegacyOrgWarning(t *testing.T) {
+	tests := map[string]struct {
+		args   []string
+		envOrg string
+		warns  bool
+	}{
+		"default org": {
+			warns: true,
+		},
+		"legacy org set explicitly": {
+			args: []string{"--org=jetstack"},
+		},
+		"canonical org set explicitly": {
+			args: []string{"--org=cert-manager"},
+		},
+		"org set by environment variable": {
+			envOrg: "jetstack",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.envOrg != "" {
+				os.Setenv(stageOrgEnvVar, test.envOrg)
+				defer os.Unsetenv(stageOrgEnvVar)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			(&stageOptions{}).AddFlags(fs, func(string) {})
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			if warning := legacyOrgWarning(fs); test.warns != (warning != "") {
+				t.Errorf("warns=%v but got warning: %q", test.warns, warning)
+			}
+		})
+	}
+}
+
+func TestSubmitStageBuild_QuietOutput(t *testing.T) {
+	tests := map[string]struct {
+		quiet    bool
+		expLines []string
+	}{
+		"progress is logged by default": {
+			expLines: []string{
+				"Submitting GCB build job...",
+				"---",
+				`Submitted build with name: "build-1"`,
+				"  View logs at: https://console.cloud.google.com/cloud-build/builds/build-1?project=my-project",
+				"  Log bucket: ",
+				"  Once complete, view artifacts at: gs://my-bucket/stage/gcb/devel/abc",
+				"---",
+				"Waiting for build to complete, this may take a while...",
+				`Build "build-1" finished with status "SUCCESS" in 0s`,
+				"---",
+				"PHASE          DURATION",
+				"Release build complete - artifacts available at: gs://my-bucket/stage/gcb/devel/abc",
+			},
+		},
+		"only the outcome is logged with --quiet": {
+			quiet: true,
+			expLines: []string{
+				`Submitted build with name: "build-1"`,
+				"  View logs at: https://console.cloud.google.com/cloud-build/builds/build-1?project=my-project",
+				`Build "build-1" finished with status "SUCCESS" in 0s`,
+				"Release build complete - artifacts available at: gs://my-bucket/stage/gcb/devel/abc",
+			},
+		},
+	}
+
+	defer func(w io.Writer) {
+		logWriter = w
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}(logWriter)
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logWriter = buf
+			rootOpts := &rootOptions{Quiet: test.quiet, Output: outputText, LogFormat: logging.FormatText}
+			if err := rootOpts.configure(); err != nil {
+				t.Fatal(err)
+			}
+
+			o := &stageOptions{
+				Bucket:       "my-bucket",
+				Project:      "my-project",
+				GitRef:       "abc",
+				BuildTimeout: time.Minute,
+			}
+			build := &cloudbuild.Build{Substitutions: map[string]string{"_CM_REF": "abc"}}
+			if _, err := submitStageBuild(context.Background(), func() {}, rootOpts, o, &gcbfake.Service{}, build, "stage/gcb/devel/abc", &stageTimings{}, regexp.MustCompile(defaultStageRetryPattern)); err != nil {
+				t.Fatal(err)
+			}
+
+			// the duration of each phase depends on how long the test took
+			// to run, so isn't compared
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+				line = line[len("2006/01/02 15:04:05 "):]
+				if strings.HasPrefix(line, "submit build ") || strings.HasPrefix(line, "wait for build ") {
+					continue
+				}
+				lines = append(lines, line)
+			}
+			if !reflect.DeepEqual(lines, test.expLines) {
+				t.Errorf("unexpected output:\ngot: %q\nexp: %q", lines, test.expLines)
+			}
+		})
+	}
+}
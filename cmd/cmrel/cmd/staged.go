@@ -17,13 +17,13 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"sort"
 	"text/tabwriter"
 
 	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 	"golang.org/x/mod/semver"
@@ -126,12 +126,13 @@ func (o *stagedOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
 	fs.StringVar(&o.ReleaseType, "release-type", "release", "The type of release to list, usually one of 'release' or 'devel'")
 }
 
-func (o *stagedOptions) print() {
-	log.Printf("Staged options:")
-	log.Printf("  Bucket: %q", o.Bucket)
-	log.Printf("  GitRef: %q", o.GitRef)
-	log.Printf("  ReleaseVersion: %q", o.ReleaseVersion)
-	log.Printf("  ReleaseType: %q", o.ReleaseType)
+func (o *stagedOptions) print(logger logr.Logger) {
+	logger.Info("Staged options",
+		"Bucket", o.Bucket,
+		"GitRef", o.GitRef,
+		"ReleaseVersion", o.ReleaseVersion,
+		"ReleaseType", o.ReleaseType,
+	)
 }
 
 func stagedCmd(rootOpts *rootOptions) *cobra.Command {
@@ -142,8 +143,7 @@ func stagedCmd(rootOpts *rootOptions) *cobra.Command {
 		Example:      stagedExample,
 		SilenceUsage: true,
 		PreRun: func(_ *cobra.Command, _ []string) {
-			o.print()
-			log.Printf("---")
+			rootOpts.printOptions(o.print)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runStaged(rootOpts, o)
@@ -153,11 +153,12 @@ func stagedCmd(rootOpts *rootOptions) *cobra.Command {
 	return cmd
 }
 
-func runStaged(_ *rootOptions, o *stagedOptions) error {
+func runStaged(rootOpts *rootOptions, o *stagedOptions) error {
 	if o.ReleaseVersion == "" && o.GitRef != "" {
-		return fmt.Errorf("cannot specify --git-ref without --release-version")
+		return validationErrorf("cannot specify --git-ref without --release-version")
 	}
-	ctx := context.Background()
+	ctx, cancel := rootOpts.context()
+	defer cancel()
 	gcs, err := storage.NewClient(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create GCS client: %w", err)
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// summaryFormatText logs the summary of a command's result as
+	// human-readable log lines, and prints nothing to stdout.
+	summaryFormatText = "text"
+
+	// summaryFormatJSON prints the summary of a command's result to stdout
+	// as a JSON document, as with --output=json, without suppressing logs.
+	summaryFormatJSON = "json"
+
+	// summaryFormatGitHubActions writes the summary of a command's result as
+	// GitHub Actions step outputs.
+	summaryFormatGitHubActions = "github-actions"
+)
+
+var summaryFormats = []string{summaryFormatText, summaryFormatJSON, summaryFormatGitHubActions}
+
+// validateSummaryFormat returns an error if format isn't a known summary
+// format.
+func validateSummaryFormat(format string) error {
+	for _, f := range summaryFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid summary format %q, must be one of: %s", format, strings.Join(summaryFormats, ", "))
+}
+
+// summaryOutput is a single named value in the summary of a command's result.
+type summaryOutput struct {
+	Name  string
+	Value string
+}
+
+// githubOutputEnv is the environment variable which GitHub Actions sets to the
+// path of the file that step outputs are appended to.
+const githubOutputEnv = "GITHUB_OUTPUT"
+
+// printGitHubActionsOutputs sets each of the outputs as a GitHub Actions step
+// output. They are appended to the file named by $GITHUB_OUTPUT if it is set,
+// and are otherwise printed to stdout using the older '::set-output' workflow
+// command.
+func printGitHubActionsOutputs(outputs []summaryOutput) error {
+	path := os.Getenv(githubOutputEnv)
+	if path == "" {
+		return writeGitHubActionsOutputs(os.Stdout, outputs, true)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open $%s: %w", githubOutputEnv, err)
+	}
+	if err := writeGitHubActionsOutputs(f, outputs, false); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeGitHubActionsOutputs writes each of the outputs to w, either as
+// 'name=value' lines in the format of the $GITHUB_OUTPUT file, or as
+// '::set-output' workflow commands if legacy is true.
+func writeGitHubActionsOutputs(w io.Writer, outputs []summaryOutput, legacy bool) error {
+	for _, output := range outputs {
+		if strings.ContainsAny(output.Value, "\r\n") {
+			return fmt.Errorf("value of output %q must not contain newlines", output.Name)
+		}
+
+		var err error
+		if legacy {
+			_, err = fmt.Fprintf(w, "::set-output name=%s::%s\n", output.Name, output.Value)
+		} else {
+			_, err = fmt.Fprintf(w, "%s=%s\n", output.Name, output.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write output %q: %w", output.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteGitHubActionsOutputs(t *testing.T) {
+	outputs := []summaryOutput{
+		{Name: "build_id", Value: "abc"},
+		{Name: "status", Value: "SUCCESS"},
+	}
+
+	tests := map[string]struct {
+		outputs   []summaryOutput
+		legacy    bool
+		exp       string
+		expectErr bool
+	}{
+		"output file format": {
+			outputs: outputs,
+			exp:     "build_id=abc\nstatus=SUCCESS\n",
+		},
+		"legacy workflow commands": {
+			outputs: outputs,
+			legacy:  true,
+			exp:     "::set-output name=build_id::abc\n::set-output name=status::SUCCESS\n",
+		},
+		"values containing newlines are rejected": {
+			outputs:   []summaryOutput{{Name: "status", Value: "SUCCESS\nevil=true"}},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := writeGitHubActionsOutputs(buf, test.outputs, test.legacy)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err == nil && buf.String() != test.exp {
+				t.Errorf("unexpected output:\ngot: %q\nexp: %q", buf.String(), test.exp)
+			}
+		})
+	}
+}
+
+func TestPrintGitHubActionsOutputs_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(path, []byte("existing=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(githubOutputEnv)
+	if err := os.Setenv(githubOutputEnv, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := printGitHubActionsOutputs([]summaryOutput{{Name: "status", Value: "SUCCESS"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "existing=1\nstatus=SUCCESS\n"; string(content) != exp {
+		t.Errorf("unexpected output file:\ngot: %q\nexp: %q", content, exp)
+	}
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/cert-manager/release/pkg/release"
+	"github.com/cert-manager/release/pkg/sign"
+)
+
+const (
+	validateCommand         = "validate"
+	validateDescription     = "Check that a staged release contains every expected artifact"
+	validateLongDescription = `The validate command will list the objects in a staged release and check them
+against the set of files that a stage build is expected to produce: the
+release tarballs for each targeted OS and architecture (which contain the
+release's container images), the manifests tarball, the metadata file, the
+release manifest and the SHA256SUMS file, as well as any signatures, SBOM and
+release notes.
+
+A report of any missing or unexpected files is printed, and the command exits
+with an error if any expected file is missing or if any release tarball is
+smaller than --min-artifact-bytes, which usually means it was truncated or
+packaged incorrectly.
+
+The --artifact-types, --target-os, --target-arch, --signing-backend,
+--signing-kms-key, --skip-signing, --sbom-format and --release-notes flags
+should match those used when the release was staged.
+`
+)
+
+var (
+	validateExample = fmt.Sprintf(`
+To validate the staged v1.6.0 release built at commit 6d3ce5e, run:
+
+	%s %s --release-version=v1.6.0 --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0`, rootCommand, validateCommand)
+)
+
+// validateResult is printed to stdout when the validate command is run with
+// --output=json.
+type validateResult struct {
+	Path       string                       `json:"path"`
+	Missing    []string                     `json:"missing"`
+	Extra      []string                     `json:"extra"`
+	Undersized []release.UndersizedArtifact `json:"undersized"`
+
+	// MissingPlatforms are the OS/arch combinations for which any release
+	// artifact is missing
+	MissingPlatforms []string `json:"missingPlatforms"`
+}
+
+type validateOptions struct {
+	// The name of the GCS bucket containing the staged release
+	Bucket string
+
+	// ReleaseVersion is the version of the staged release to validate
+	ReleaseVersion string
+
+	// GitRef is the commit ref that the staged release was built from
+	GitRef string
+
+	stagedFileOptions
+}
+
+// stagedFileOptions describe how a release was staged, and so which files it
+// is expected to contain. They are shared by commands which validate a staged
+// release.
+type stagedFileOptions struct {
+	// ArtifactTypes is a comma-separated list of the types of artifact which
+	// the release was built with
+	ArtifactTypes string
+
+	// TargetOSes is a comma-separated list of OSes which the release was built for
+	TargetOSes string
+
+	// TargetArches is a comma-separated list of architectures which the release was built for
+	TargetArches string
+
+	// SkipSigning, if true, indicates that the release was staged without
+	// signing, so no signatures are expected
+	SkipSigning bool
+
+	// SigningBackend is the backend that was used to sign the release
+	SigningBackend string
+
+	// SigningKMSKeys are the GCP KMS keys the release was signed with, if
+	// SigningBackend is 'kms'
+	SigningKMSKeys []string
+
+	// SBOMFormat, if set, is the format of the SBOM expected in the release
+	SBOMFormat string
+
+	// Compression is the format the release tarballs were staged in
+	Compression string
+
+	// ReleaseNotes, if true, expects release notes in the release
+	ReleaseNotes bool
+
+	// MinArtifactBytes is the minimum size of each release artifact, below
+	// which it's assumed to be broken
+	MinArtifactBytes int64
+}
+
+func (o *validateOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the staged release.")
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The version of the staged release to validate.")
+	fs.StringVar(&o.GitRef, "git-ref", "", "The git commit ref that the staged release was built from.")
+	o.stagedFileOptions.AddFlags(fs)
+	markRequired("release-version")
+	markRequired("git-ref")
+}
+
+func (o *stagedFileOptions) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ArtifactTypes, "artifact-types", "*", "Comma-separated list of the artifact types the release was built with, as passed to 'stage'.")
+	fs.StringVar(&o.TargetOSes, "target-os", "*", "Comma-separated list of OSes the release was built for, as passed to 'stage'.")
+	fs.StringVar(&o.TargetArches, "target-arch", "*", "Comma-separated list of arches the release was built for, as passed to 'stage'.")
+	fs.BoolVar(&o.SkipSigning, "skip-signing", false, "If true, the release was staged with --skip-signing and no signatures are expected.")
+	fs.StringVar(&o.SigningBackend, "signing-backend", sign.SigningBackendKMS, fmt.Sprintf("The backend the release was signed with. Options: %s", strings.Join(sign.SigningBackends, ", ")))
+	fs.StringSliceVar(&o.SigningKMSKeys, "signing-kms-key", []string{defaultKMSKey}, "The GCP KMS keys the release was signed with, as passed to 'stage'. A signature of the SHA256SUMS file is expected for each key when --signing-backend=kms.")
+	fs.StringVar(&o.SBOMFormat, "sbom-format", "", fmt.Sprintf("If set, the format of the SBOM expected in the release. Options: %s", strings.Join(release.SBOMFormats, ", ")))
+	fs.StringVar(&o.Compression, "compression", release.CompressionGzip, fmt.Sprintf("The format the release tarballs were staged in, as passed to 'stage'. Options: %s", strings.Join(release.Compressions, ", ")))
+	fs.BoolVar(&o.ReleaseNotes, "release-notes", false, fmt.Sprintf("If true, the release was staged with --release-notes-file and %q is expected.", release.ReleaseNotesFileName))
+	fs.Int64Var(&o.MinArtifactBytes, "min-artifact-bytes", release.DefaultMinArtifactBytes, "The minimum size in bytes of each release tarball, below which it's assumed to have been truncated or packaged incorrectly. Set to 0 to disable the check.")
+}
+
+// keysAndValues returns the options as a list of alternating keys and
+// values, to be included when logging the options of a command.
+func (o *stagedFileOptions) keysAndValues() []interface{} {
+	return []interface{}{
+		"ArtifactTypes", o.ArtifactTypes,
+		"TargetOSes", o.TargetOSes,
+		"TargetArches", o.TargetArches,
+		"SkipSigning", o.SkipSigning,
+		"SigningBackend", o.SigningBackend,
+		"SigningKMSKeys", o.SigningKMSKeys,
+		"SBOMFormat", o.SBOMFormat,
+		"Compression", o.Compression,
+		"ReleaseNotes", o.ReleaseNotes,
+		"MinArtifactBytes", o.MinArtifactBytes,
+	}
+}
+
+func (o *validateOptions) print(logger logr.Logger) {
+	logger.Info("Validate options", append([]interface{}{
+		"Bucket", o.Bucket,
+		"ReleaseVersion", o.ReleaseVersion,
+		"GitRef", o.GitRef,
+	}, o.stagedFileOptions.keysAndValues()...)...)
+}
+
+func validateCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &validateOptions{}
+	cmd := &cobra.Command{
+		Use:          validateCommand,
+		Short:        validateDescription,
+		Long:         validateLongDescription,
+		Example:      validateExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runValidate(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	mustRegisterFlagCompletionFunc(cmd, "target-os", completeTargetOSes)
+	mustRegisterFlagCompletionFunc(cmd, "target-arch", completeTargetArches(&o.TargetOSes))
+	return cmd
+}
+
+func runValidate(rootOpts *rootOptions, o *validateOptions) error {
+	if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+		return validationErrorf("invalid --release-version: %w", err)
+	}
+
+	expected, err := expectedStagedFiles(&o.stagedFileOptions)
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := expectedStagedArtifacts(&o.stagedFileOptions)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	stagedPath := release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeForVersion(o.ReleaseVersion), o.ReleaseVersion, o.GitRef)
+	log.Printf("Listing staged release at gs://%s/%s", o.Bucket, stagedPath)
+
+	missing, extra, sizes, err := diffStagedFiles(ctx, gcs.Bucket(o.Bucket), stagedPath, expected)
+	if err != nil {
+		return err
+	}
+	undersized := release.UndersizedArtifacts(artifacts, sizes, o.MinArtifactBytes)
+
+	missingPlatforms, err := missingStagedPlatforms(&o.stagedFileOptions, missing)
+	if err != nil {
+		return err
+	}
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(validateResult{
+			Path:             fmt.Sprintf("gs://%s/%s", o.Bucket, stagedPath),
+			Missing:          missing,
+			Extra:            extra,
+			Undersized:       undersized,
+			MissingPlatforms: missingPlatforms,
+		}); err != nil {
+			return err
+		}
+	}
+
+	logStagedFilesDiff(expected, missing, extra)
+	logStagedArtifacts(artifacts, missing, undersized, o.MinArtifactBytes)
+	if len(missingPlatforms) > 0 {
+		log.Printf("Release artifacts are missing for %d platforms: %s", len(missingPlatforms), strings.Join(missingPlatforms, ", "))
+		log.Printf("If the release was staged with --shard-by-os, run '%s %s' again with the same flags and --retry-missing to rebuild only the OSes of those platforms", rootCommand, stageCommand)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("staged release at gs://%s/%s is missing %d expected files", o.Bucket, stagedPath, len(missing))
+	}
+
+	if len(undersized) > 0 {
+		return fmt.Errorf("staged release at gs://%s/%s has %d release artifacts smaller than --min-artifact-bytes=%d", o.Bucket, stagedPath, len(undersized), o.MinArtifactBytes)
+	}
+
+	log.Printf("Staged release is complete")
+
+	return nil
+}
+
+// diffStagedFiles lists the objects of the staged release at stagedPath in
+// bucket, returning the sorted names of any expected files which are missing
+// and any extra files which were not expected, along with the size of every
+// file in the staged release keyed by name.
+func diffStagedFiles(ctx context.Context, bucket *storage.BucketHandle, stagedPath string, expected []string) (missing []string, extra []string, sizes map[string]int64, err error) {
+	objs, err := release.ListObjects(ctx, bucket, stagedPath+"/")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list staged release: %w", err)
+	}
+
+	actual := make([]string, len(objs))
+	sizes = make(map[string]int64, len(objs))
+	for i, obj := range objs {
+		actual[i] = strings.TrimPrefix(obj.Name, stagedPath+"/")
+		sizes[actual[i]] = obj.Size
+	}
+
+	missing, extra = release.DiffNames(expected, actual)
+	return missing, extra, sizes, nil
+}
+
+// logStagedFilesDiff logs a report of the result of diffStagedFiles.
+func logStagedFilesDiff(expected, missing, extra []string) {
+	log.Printf("Found %d of %d expected files", len(expected)-len(missing), len(expected))
+	for _, name := range missing {
+		log.Printf("  MISSING: %s", name)
+	}
+	for _, name := range extra {
+		log.Printf("  EXTRA: %s", name)
+	}
+}
+
+// logStagedArtifacts logs how many of the release artifacts expected for the
+// targeted platforms were staged, and any which are suspiciously small.
+func logStagedArtifacts(artifacts, missing []string, undersized []release.UndersizedArtifact, minBytes int64) {
+	missingArtifacts := sets.NewString(artifacts...).Intersection(sets.NewString(missing...))
+	log.Printf("Found %d of %d release artifacts expected for the targeted OSes and architectures", len(artifacts)-missingArtifacts.Len(), len(artifacts))
+	for _, artifact := range undersized {
+		log.Printf("  TOO SMALL: %s is %d bytes, expected at least %d", artifact.Name, artifact.Size, minBytes)
+	}
+}
+
+// expectedStagedArtifacts returns the names of the release artifacts that a
+// staged release built with the given options is expected to contain, i.e.
+// the tarballs built for each targeted OS and architecture and the manifests
+// tarball, but not the metadata, checksum and signature files describing them.
+func expectedStagedArtifacts(o *stagedFileOptions) ([]string, error) {
+	artifactTypes, targetOSes, targetArches, err := stagedArtifactTargets(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return release.CompressedArtifactNames(release.ExpectedArtifactNames(artifactTypes, targetOSes, targetArches), o.Compression), nil
+}
+
+// missingStagedPlatforms returns the sorted OS/arch combinations, of those
+// targeted by the given options, for which any of the release artifacts
+// named in missing would have been built.
+func missingStagedPlatforms(o *stagedFileOptions, missing []string) ([]string, error) {
+	artifactTypes, targetOSes, targetArches, err := stagedArtifactTargets(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []string
+	for _, platform := range release.MissingPlatforms(artifactTypes, targetOSes, targetArches, o.Compression, missing) {
+		platforms = append(platforms, platform.String())
+	}
+	return platforms, nil
+}
+
+// stagedArtifactTargets parses the artifact types, OSes and architectures
+// that a staged release built with the given options targets.
+func stagedArtifactTargets(o *stagedFileOptions) (artifactTypes, targetOSes, targetArches sets.String, err error) {
+	artifactTypes, err = release.ArtifactTypesFromString(o.ArtifactTypes)
+	if err != nil {
+		return nil, nil, nil, validationErrorf("invalid --artifact-types list: %w", err)
+	}
+
+	targetOSes, err = release.OSListFromString(o.TargetOSes)
+	if err != nil {
+		return nil, nil, nil, validationErrorf("invalid --target-os list: %w", err)
+	}
+
+	targetArches, err = release.ArchListFromString(o.TargetArches, targetOSes)
+	if err != nil {
+		return nil, nil, nil, validationErrorf("invalid --target-arch list: %w", err)
+	}
+
+	if o.Compression != "" {
+		if err := release.ValidateCompression(o.Compression); err != nil {
+			return nil, nil, nil, validationErrorf("invalid --compression: %w", err)
+		}
+	}
+
+	return artifactTypes, targetOSes, targetArches, nil
+}
+
+// expectedStagedFiles returns the names of all files that a staged release
+// built with the given options is expected to contain, relative to the
+// release's path in the bucket.
+func expectedStagedFiles(o *stagedFileOptions) ([]string, error) {
+	expected, err := expectedStagedArtifacts(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sign.ValidateSigningBackend(o.SigningBackend); err != nil {
+		return nil, err
+	}
+
+	expected = append(expected, release.MetadataFileName, release.ChecksumsFileName, release.ManifestFileName)
+
+	switch {
+	case o.SkipSigning:
+	case o.SigningBackend == sign.SigningBackendCosign:
+		expected = append(expected, release.ChecksumsFileName+".sig", release.ChecksumsFileName+".pem")
+	case o.SigningBackend == sign.SigningBackendKMS:
+		keys, err := sign.NewGCPKMSKeys(o.SigningKMSKeys)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys {
+			expected = append(expected, release.ChecksumsKMSSignatureFileName(i), release.ChecksumsKMSPublicKeyFileName(i))
+		}
+	}
+
+	if o.SBOMFormat != "" {
+		if err := release.ValidateSBOMFormat(o.SBOMFormat); err != nil {
+			return nil, err
+		}
+		expected = append(expected, release.SBOMFileName(o.SBOMFormat))
+	}
+
+	if o.ReleaseNotes {
+		expected = append(expected, release.ReleaseNotesFileName)
+	}
+
+	return expected, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExpectedStagedFiles(t *testing.T) {
+	linuxAMD64 := []string{
+		"cert-manager-cmctl-linux-amd64.tar.gz",
+		"cert-manager-kubectl-cert_manager-linux-amd64.tar.gz",
+		"cert-manager-manifests.tar.gz",
+		"cert-manager-server-linux-amd64.tar.gz",
+		"metadata.json",
+		"release-manifest.json",
+		"SHA256SUMS",
+	}
+
+	tests := map[string]struct {
+		opts      stagedFileOptions
+		base      []string
+		extra     []string
+		expectErr bool
+	}{
+		"kms signing expects a checksum signature and public key per key": {
+			opts:  stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "kms", SigningKMSKeys: []string{defaultKMSKey, "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/2"}},
+			extra: []string{"SHA256SUMS.kms.sig", "SHA256SUMS.kms.pem", "SHA256SUMS.kms.2.sig", "SHA256SUMS.kms.2.pem"},
+		},
+		"skipped kms signing expects no signatures": {
+			opts: stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "kms", SigningKMSKeys: []string{defaultKMSKey}, SkipSigning: true},
+		},
+		"cosign signing expects checksum signatures": {
+			opts:  stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "cosign"},
+			extra: []string{"SHA256SUMS.sig", "SHA256SUMS.pem"},
+		},
+		"skipped cosign signing expects no signatures": {
+			opts: stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "cosign", SkipSigning: true},
+		},
+		"sbom is expected if a format is set": {
+			opts:  stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "kms", SBOMFormat: "spdx"},
+			extra: []string{"cert-manager-sbom.spdx.json"},
+		},
+		"release notes are expected if staged with notes": {
+			opts:  stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "cosign", SkipSigning: true, ReleaseNotes: true},
+			extra: []string{"release-notes.md"},
+		},
+		"only images are expected if artifact types are restricted": {
+			opts: stagedFileOptions{ArtifactTypes: "images", TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "cosign", SkipSigning: true},
+			base: []string{"cert-manager-server-linux-amd64.tar.gz", "metadata.json", "release-manifest.json", "SHA256SUMS"},
+		},
+		"zstd compression expects zstd tarballs in place of gzip": {
+			opts: stagedFileOptions{ArtifactTypes: "images", TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "cosign", SkipSigning: true, Compression: "zstd"},
+			base: []string{"cert-manager-server-linux-amd64.tar.zst", "metadata.json", "release-manifest.json", "SHA256SUMS"},
+		},
+		"invalid compression errors": {
+			opts:      stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "kms", Compression: "bzip2"},
+			expectErr: true,
+		},
+		"invalid artifact types errors": {
+			opts:      stagedFileOptions{ArtifactTypes: "binaries", TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "kms"},
+			expectErr: true,
+		},
+		"invalid OS list errors": {
+			opts:      stagedFileOptions{TargetOSes: "templeos", TargetArches: "amd64", SigningBackend: "kms"},
+			expectErr: true,
+		},
+		"invalid signing backend errors": {
+			opts:      stagedFileOptions{TargetOSes: "linux", TargetArches: "amd64", SigningBackend: "gpg"},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := expectedStagedFiles(&test.opts)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			base := test.base
+			if base == nil {
+				base = linuxAMD64
+			}
+			expected := sortedSlice(append(append([]string{}, base...), test.extra...))
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("unexpected files:\ngot: %v\nexp: %v", got, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/cert-manager/release/pkg/release"
+	"github.com/cert-manager/release/pkg/sign"
+)
+
+const (
+	verifyCommand         = "verify"
+	verifyDescription     = "Verify the signatures and checksums of a staged release"
+	verifyLongDescription = `The verify command will check the integrity of a release which has already
+been staged using the KMS signing backend.
+
+The SHA256SUMS file of the staged release is downloaded and its signature
+verified against each of the given GCP KMS keys, which must be passed in the
+same order as they were passed to 'stage'. The checksum of every artifact listed
+in SHA256SUMS is then compared against the objects in the bucket.
+
+The command exits with an error if any signature or checksum fails to verify.
+`
+)
+
+var (
+	verifyExample = fmt.Sprintf(`
+To verify the staged v1.6.0 release built at commit 6d3ce5e, run:
+
+	%s %s --release-version=v1.6.0 --git-ref=6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0`, rootCommand, verifyCommand)
+)
+
+// verifyItem is the result of verifying a single signature or artifact.
+type verifyItem struct {
+	Name     string `json:"name"`
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// verifyResult is printed to stdout when the verify command is run with
+// --output=json.
+type verifyResult struct {
+	Path       string       `json:"path"`
+	Signatures []verifyItem `json:"signatures"`
+	Artifacts  []verifyItem `json:"artifacts"`
+}
+
+type verifyOptions struct {
+	// The name of the GCS bucket containing the staged release
+	Bucket string
+
+	// ReleaseVersion is the version of the staged release to verify
+	ReleaseVersion string
+
+	// GitRef is the commit ref that the staged release was built from
+	GitRef string
+
+	// SigningKMSKeys are the GCP KMS keys the release was signed with, in the
+	// order they were passed to 'stage'
+	SigningKMSKeys []string
+}
+
+func (o *verifyOptions) AddFlags(fs *flag.FlagSet, markRequired func(string)) {
+	fs.StringVar(&o.Bucket, "bucket", release.DefaultBucketName, "The name of the GCS bucket containing the staged release.")
+	fs.StringVar(&o.ReleaseVersion, "release-version", "", "The version of the staged release to verify.")
+	fs.StringVar(&o.GitRef, "git-ref", "", "The git commit ref that the staged release was built from.")
+	fs.StringSliceVar(&o.SigningKMSKeys, "signing-kms-key", []string{defaultKMSKey}, "Full name of a GCP KMS key the release was signed with. May be repeated, and must be given in the same order as was passed to 'stage'.")
+	markRequired("release-version")
+	markRequired("git-ref")
+}
+
+func (o *verifyOptions) print(logger logr.Logger) {
+	logger.Info("Verify options",
+		"Bucket", o.Bucket,
+		"ReleaseVersion", o.ReleaseVersion,
+		"GitRef", o.GitRef,
+		"SigningKMSKeys", o.SigningKMSKeys,
+	)
+}
+
+func verifyCmd(rootOpts *rootOptions) *cobra.Command {
+	o := &verifyOptions{}
+	cmd := &cobra.Command{
+		Use:          verifyCommand,
+		Short:        verifyDescription,
+		Long:         verifyLongDescription,
+		Example:      verifyExample,
+		SilenceUsage: true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			rootOpts.printOptions(o.print)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify(rootOpts, o)
+		},
+	}
+	o.AddFlags(cmd.Flags(), mustMarkRequired(cmd.MarkFlagRequired))
+	return cmd
+}
+
+func runVerify(rootOpts *rootOptions, o *verifyOptions) error {
+	if err := release.ValidateReleaseVersion(o.ReleaseVersion); err != nil {
+		return validationErrorf("invalid --release-version: %w", err)
+	}
+
+	keys, err := sign.NewGCPKMSKeys(o.SigningKMSKeys)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return validationErrorf("at least one --signing-kms-key must be specified")
+	}
+
+	ctx, cancel := rootOpts.context()
+	defer cancel()
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	stagedPath := release.BucketPathForRelease(release.DefaultBucketPathPrefix, release.BuildTypeForVersion(o.ReleaseVersion), o.ReleaseVersion, o.GitRef)
+	bucket := gcs.Bucket(o.Bucket)
+	log.Printf("Verifying staged release at gs://%s/%s", o.Bucket, stagedPath)
+
+	checksums, err := readObject(ctx, bucket.Object(stagedPath+"/"+release.ChecksumsFileName))
+	if err != nil {
+		return fmt.Errorf("failed to download %s file: %w", release.ChecksumsFileName, err)
+	}
+
+	result := verifyResult{Path: fmt.Sprintf("gs://%s/%s", o.Bucket, stagedPath)}
+	failed := 0
+
+	for i, key := range keys {
+		item := verifyItem{Name: release.ChecksumsKMSSignatureFileName(i)}
+		sig, err := readObject(ctx, bucket.Object(stagedPath+"/"+item.Name))
+		if err == nil {
+			err = sign.VerifyKMS(ctx, key, checksums, sig)
+		}
+		if err != nil {
+			item.Error = err.Error()
+			failed++
+		} else {
+			item.Verified = true
+		}
+		result.Signatures = append(result.Signatures, item)
+	}
+
+	sums, err := release.ReadChecksumsFile(bytes.NewReader(checksums))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s file: %w", release.ChecksumsFileName, err)
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := verifyItem{Name: name}
+		sum, err := sha256SumObject(ctx, bucket.Object(stagedPath+"/"+name))
+		switch {
+		case err != nil:
+			item.Error = err.Error()
+		case sum != sums[name]:
+			item.Error = fmt.Sprintf("checksum mismatch: expected %s but got %s", sums[name], sum)
+		default:
+			item.Verified = true
+		}
+		if !item.Verified {
+			failed++
+		}
+		result.Artifacts = append(result.Artifacts, item)
+	}
+
+	if rootOpts.Output == outputJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	}
+
+	var lines []string
+	for _, item := range append(append([]verifyItem{}, result.Signatures...), result.Artifacts...) {
+		if item.Verified {
+			lines = append(lines, fmt.Sprintf("  %s\tverified", item.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s\tFAILED: %s", item.Name, item.Error))
+		}
+	}
+	logTable(lines...)
+
+	if failed > 0 {
+		return fmt.Errorf("staged release at gs://%s/%s failed verification: %d of %d checks failed", o.Bucket, stagedPath, failed, len(result.Signatures)+len(result.Artifacts))
+	}
+
+	log.Printf("All %d signatures and %d artifact checksums verified", len(result.Signatures), len(result.Artifacts))
+
+	return nil
+}
+
+// readObject reads the entire contents of the given GCS object into memory.
+func readObject(ctx context.Context, obj *storage.ObjectHandle) ([]byte, error) {
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// sha256SumObject streams the given GCS object and returns its hex-encoded
+// SHA256 checksum.
+func sha256SumObject(ctx context.Context, obj *storage.ObjectHandle) (string, error) {
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
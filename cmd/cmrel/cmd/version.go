@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/release/pkg/version"
+)
+
+const (
+	versionCommand         = "version"
+	versionDescription     = "Print the version of cmrel"
+	versionLongDescription = `The version command will print the version, git commit and build date of
+this build of cmrel, so that the tool used to produce a release can be
+recorded.
+`
+)
+
+func versionCmd(rootOpts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          versionCommand,
+		Short:        versionDescription,
+		Long:         versionLongDescription,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVersion(rootOpts)
+		},
+	}
+	return cmd
+}
+
+func runVersion(rootOpts *rootOptions) error {
+	info := version.Get()
+
+	log.Printf("Version: %s", info.Version)
+	log.Printf("Git commit: %s", info.GitCommit)
+	log.Printf("Build date: %s", info.BuildDate)
+	log.Printf("Go version: %s", info.GoVersion)
+
+	if rootOpts.Output == outputJSON {
+		return printJSON(info)
+	}
+
+	return nil
+}
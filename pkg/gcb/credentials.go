@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+// credentialsHelp explains how to configure application default credentials,
+// and is included in errors returned by CheckCredentials.
+const credentialsHelp = `Google Cloud application default credentials are required. Configure them using one of:
+  - 'gcloud auth application-default login' to authenticate as your user
+  - setting GOOGLE_APPLICATION_CREDENTIALS to the path of a service account key file
+  - running on GCP (e.g. GCE, GKE with workload identity or Cloud Build) with a service account attached`
+
+// CheckCredentials verifies that Google application default credentials are
+// configured and can be used to obtain an access token, returning an error
+// which explains how to authenticate if not. It is intended to be called
+// before doing any other work, so that missing credentials are reported
+// before a user has waited for slower operations to complete.
+func CheckCredentials(ctx context.Context) error {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		if err := checkCredentialsFile(path); err != nil {
+			return fmt.Errorf("invalid GOOGLE_APPLICATION_CREDENTIALS: %w\n%s", err, credentialsHelp)
+		}
+	}
+
+	creds, err := google.FindDefaultCredentials(ctx, cloudbuild.CloudPlatformScope)
+	if err != nil {
+		return fmt.Errorf("could not find application default credentials: %w\n%s", err, credentialsHelp)
+	}
+
+	if _, err := creds.TokenSource.Token(); err != nil {
+		return fmt.Errorf("application default credentials could not be used to obtain an access token, they may have expired or been revoked: %w\n%s", err, credentialsHelp)
+	}
+
+	return nil
+}
+
+// checkCredentialsFile returns an error if the file at path is not a JSON
+// credentials file of a known type.
+func checkCredentialsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var f struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%q is not a JSON credentials file: %w", path, err)
+	}
+
+	switch f.Type {
+	case "service_account", "authorized_user", "external_account", "impersonated_service_account":
+		return nil
+	case "":
+		return fmt.Errorf("%q does not specify a credentials type", path)
+	default:
+		return fmt.Errorf("%q has unsupported credentials type %q", path, f.Type)
+	}
+}
@@ -18,43 +18,251 @@ package gcb
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"google.golang.org/api/cloudbuild/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	yamlv3 "gopkg.in/yaml.v3"
 	"sigs.k8s.io/yaml"
 )
 
+// MaxBuildFileSize is the largest cloudbuild.yaml file, in bytes, which
+// LoadBuild will read. Build definitions are far smaller than this, so a
+// larger file is almost certainly the wrong file.
+const MaxBuildFileSize = 1024 * 1024
+
+// requiredBuildFields are the top-level fields which every cloudbuild.yaml
+// file loaded by LoadBuild must define.
+var requiredBuildFields = []string{"steps", "substitutions"}
+
+// unknownFieldRegex matches the error returned when decoding a build which
+// contains a field that isn't part of the Build schema.
+var unknownFieldRegex = regexp.MustCompile(`unknown field "([^"]+)"`)
+
 const (
-	Success = "SUCCESS"
-	Failure = "FAILURE"
+	Success       = "SUCCESS"
+	Failure       = "FAILURE"
+	InternalError = "INTERNAL_ERROR"
+	Timeout       = "TIMEOUT"
+	Cancelled     = "CANCELLED"
+	Expired       = "EXPIRED"
 )
 
+// IsTerminal returns true if the given build status indicates that the build
+// has finished running, whether successfully or not.
+func IsTerminal(status string) bool {
+	switch status {
+	case Success, Failure, InternalError, Timeout, Cancelled, Expired:
+		return true
+	}
+	return false
+}
+
 // LoadBuild will decode a cloudbuild.yaml file into a cloudbuild.Build
-// structure and return it.
+// structure and return it. The file must be no larger than MaxBuildFileSize
+// and define the top-level 'steps' and 'substitutions' fields. Where
+// possible, errors decoding the file give the line and column at fault.
 func LoadBuild(filename string) (*cloudbuild.Build, error) {
-	f, err := os.ReadFile(filename)
+	return LoadBuildWithChecksum(filename, "")
+}
+
+// LoadBuildWithChecksum is like LoadBuild, but if expectedSHA256 is not
+// empty the file's content must have the given hex-encoded SHA256 checksum,
+// allowing the exact build definition being submitted to be pinned.
+// The checksum is computed from the same content that is decoded.
+func LoadBuildWithChecksum(filename, expectedSHA256 string) (*cloudbuild.Build, error) {
+	f, err := readBuildFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
+	if expectedSHA256 != "" {
+		if err := VerifySHA256(f, expectedSHA256); err != nil {
+			return nil, fmt.Errorf("content of %q is not as expected: %w", filename, err)
+		}
+	}
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(f, &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML in %q: %w", filename, err)
+	}
+	if err := validateBuildFields(&doc); err != nil {
+		return nil, fmt.Errorf("invalid build in %q: %w", filename, err)
+	}
+
 	cb := cloudbuild.Build{}
 	if err := yaml.UnmarshalStrict(f, &cb); err != nil {
-		return nil, err
+		// the JSON decoder used by UnmarshalStrict doesn't know where in the
+		// YAML an unknown field is, so look it up
+		if m := unknownFieldRegex.FindStringSubmatch(err.Error()); m != nil {
+			if key := findKey(&doc, m[1]); key != nil {
+				return nil, fmt.Errorf("invalid build in %q: line %d, column %d: unknown field %q", filename, key.Line, key.Column, m[1])
+			}
+		}
+		return nil, fmt.Errorf("invalid build in %q: %w", filename, err)
 	}
 
 	return &cb, nil
 }
 
+// readBuildFile reads the content of the named file, returning an error
+// without reading it all if it's larger than MaxBuildFileSize.
+func readBuildFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxBuildFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBuildFileSize {
+		return nil, fmt.Errorf("%q is larger than the maximum build file size of %d bytes", filename, MaxBuildFileSize)
+	}
+	return data, nil
+}
+
+// validateBuildFields checks that doc, a decoded YAML document, is a mapping
+// which defines each of requiredBuildFields.
+func validateBuildFields(doc *yamlv3.Node) error {
+	if doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return fmt.Errorf("line %d, column %d: expected a mapping of build fields", root.Line, root.Column)
+	}
+
+	defined := map[string]bool{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		defined[root.Content[i].Value] = true
+	}
+	for _, field := range requiredBuildFields {
+		if !defined[field] {
+			return fmt.Errorf("missing required top-level field %q", field)
+		}
+	}
+	return nil
+}
+
+// findKey returns the first mapping key within node with the given name, or
+// nil if there is none.
+func findKey(node *yamlv3.Node, name string) *yamlv3.Node {
+	for i, child := range node.Content {
+		if node.Kind == yamlv3.MappingNode && i%2 == 0 && child.Value == name {
+			return child
+		}
+		if key := findKey(child, name); key != nil {
+			return key
+		}
+	}
+	return nil
+}
+
+// sha256Regex matches a hex-encoded SHA256 checksum.
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidateSHA256 checks that checksum is a hex-encoded SHA256 checksum.
+// Upper case hex digits are accepted.
+func ValidateSHA256(checksum string) error {
+	if !sha256Regex.MatchString(strings.ToLower(checksum)) {
+		return fmt.Errorf("%q is not a hex-encoded SHA256 checksum of 64 characters", checksum)
+	}
+	return nil
+}
+
+// VerifySHA256 checks that data has the given hex-encoded SHA256 checksum.
+func VerifySHA256(data []byte, expected string) error {
+	if err := ValidateSHA256(expected); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != strings.ToLower(expected) {
+		return fmt.Errorf("SHA256 checksum %q does not match expected checksum %q", actual, strings.ToLower(expected))
+	}
+	return nil
+}
+
+// EncodeBuild will encode the given Build as YAML, in the same format as is
+// accepted by LoadBuild.
+func EncodeBuild(build *cloudbuild.Build) ([]byte, error) {
+	return yaml.Marshal(build)
+}
+
+// ValidateSubstitutions checks that each of the required substitution keys is
+// either declared in the 'substitutions' block of the given build or referenced
+// somewhere within the build definition.
+// Cloud Build rejects builds which are given substitutions that they do not
+// use, so this allows such errors to be discovered before a build is submitted.
+// Builds which set the ALLOW_LOOSE substitution option are always valid.
+func ValidateSubstitutions(build *cloudbuild.Build, required []string) error {
+	if build.Options != nil && build.Options.SubstitutionOption == "ALLOW_LOOSE" {
+		return nil
+	}
+
+	raw, err := json.Marshal(build)
+	if err != nil {
+		return fmt.Errorf("failed to encode build: %w", err)
+	}
+
+	for _, key := range required {
+		if _, ok := build.Substitutions[key]; ok {
+			continue
+		}
+
+		ref := regexp.MustCompile(`\$(\{` + regexp.QuoteMeta(key) + `\}|` + regexp.QuoteMeta(key) + `([^A-Z0-9_]|$))`)
+		if ref.Match(raw) {
+			continue
+		}
+
+		return fmt.Errorf("substitution %q is neither declared nor referenced in the build", key)
+	}
+
+	return nil
+}
+
 // SubmitBuild will submit a Build to the cloud build API.
 // It will wait for the Create operation to complete, and then return an
 // up-to-date copy of the Build from the server.
-func SubmitBuild(svc *cloudbuild.Service, projectID string, build *cloudbuild.Build) (*cloudbuild.Build, error) {
-	op, err := svc.Projects.Builds.Create(projectID, build).Do()
+// If region is set, or the build is configured to run in a private worker
+// pool, it is submitted in that region and must be referred to by the name
+// returned by BuildRef in subsequent calls. svc should use the region's
+// endpoint, as returned by NewService. An error is returned if the build's
+// worker pool is not in region.
+func SubmitBuild(ctx context.Context, svc *cloudbuild.Service, projectID, region string, build *cloudbuild.Build) (*cloudbuild.Build, error) {
+	location := region
+	if build.Options != nil && build.Options.Pool != nil && build.Options.Pool.Name != "" {
+		pool, err := ParseWorkerPoolName(build.Options.Pool.Name)
+		if err != nil {
+			return nil, err
+		}
+		if region != "" && pool.Location != region {
+			return nil, fmt.Errorf("worker pool %q is in region %q but the build is being submitted in region %q", pool, pool.Location, region)
+		}
+		location = pool.Location
+	}
+
+	var op *cloudbuild.Operation
+	var err error
+	parent := ""
+	if location != "" {
+		parent = fmt.Sprintf("projects/%s/locations/%s", projectID, location)
+		op, err = svc.Projects.Locations.Builds.Create(parent, build).Context(ctx).Do()
+	} else {
+		op, err = svc.Projects.Builds.Create(projectID, build).Context(ctx).Do()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -65,32 +273,77 @@ func SubmitBuild(svc *cloudbuild.Service, projectID string, build *cloudbuild.Bu
 		return nil, err
 	}
 
+	if location != "" && metadata.Build != nil && metadata.Build.Name == "" {
+		metadata.Build.Name = BuildName(projectID, location, metadata.Build.Id)
+	}
+
 	return metadata.Build, nil
 }
 
+// GetBuild will fetch the current copy of the GCB Build with the given ID.
+// The ID may also be a full resource name as returned by BuildRef, in which
+// case the build is fetched from the region it was submitted to.
+func GetBuild(ctx context.Context, svc *cloudbuild.Service, projectID string, id string) (*cloudbuild.Build, error) {
+	if isResourceName(id) {
+		return svc.Projects.Locations.Builds.Get(id).Context(ctx).Do()
+	}
+	return svc.Projects.Builds.Get(projectID, id).Context(ctx).Do()
+}
+
 // WaitForBuild will wait for the GCB Build with the given ID to complete
-// before returning a final copy of the Build resource.
-func WaitForBuild(svc *cloudbuild.Service, projectID string, id string) (*cloudbuild.Build, error) {
-	var build *cloudbuild.Build
-	var err error
-	err = wait.PollInfinite(time.Second*5, func() (done bool, err error) {
-		build, err = svc.Projects.Builds.Get(projectID, id).Do()
+// before returning a final copy of the Build resource, polling according to
+// DefaultPollOptions.
+// If ctx is cancelled or its deadline is exceeded before the build completes,
+// the context's error is returned.
+func WaitForBuild(ctx context.Context, svc *cloudbuild.Service, projectID string, id string) (*cloudbuild.Build, error) {
+	return WaitForBuildWithProgress(ctx, svc, projectID, id, DefaultPollOptions, nil)
+}
+
+// WaitForBuildWithProgress will wait for the GCB Build with the given ID to
+// complete, as with WaitForBuild, polling with exponential backoff according
+// to opts. If progress is non-nil, it is updated with each copy of the Build
+// fetched whilst waiting so that step transitions are logged, and is used to
+// log each poll of a build which is still in progress.
+func WaitForBuildWithProgress(ctx context.Context, svc *cloudbuild.Service, projectID string, id string, opts PollOptions, progress *StepProgress) (*cloudbuild.Build, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	backoff := newPollBackoff(opts)
+	for {
+		timer := time.NewTimer(backoff.Step())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		build, err := GetBuild(ctx, svc, projectID, id)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 
-		// TODO: invert this to check for Pending instead
-		if build.Status == Success || build.Status == Failure {
-			return true, nil
+		if progress != nil {
+			progress.Update(build)
 		}
 
-		log.Printf("DEBUG: build %q still in progress...", build.Id)
-		return false, nil
-	})
-	if err != nil {
-		return nil, err
+		if IsTerminal(build.Status) {
+			return build, nil
+		}
+
+		progress.waiting(build)
+	}
+}
+
+// CancelBuild will request that the GCB Build with the given ID is cancelled
+// and return the updated copy of the Build from the server.
+// As with GetBuild, the ID may also be a full resource name.
+func CancelBuild(ctx context.Context, svc *cloudbuild.Service, projectID string, id string) (*cloudbuild.Build, error) {
+	if isResourceName(id) {
+		return svc.Projects.Locations.Builds.Cancel(id, &cloudbuild.CancelBuildRequest{}).Context(ctx).Do()
 	}
-	return build, err
+	return svc.Projects.Builds.Cancel(projectID, id, &cloudbuild.CancelBuildRequest{}).Context(ctx).Do()
 }
 
 // ListBuildsWithTag will list all Builds that have the given tag value set,
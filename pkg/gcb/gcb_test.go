@@ -0,0 +1,293 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/option"
+)
+
+func TestValidateSubstitutions(t *testing.T) {
+	tests := map[string]struct {
+		build     *cloudbuild.Build
+		required  []string
+		expectErr bool
+	}{
+		"declared substitutions are valid": {
+			build: &cloudbuild.Build{
+				Substitutions: map[string]string{"_CM_REF": "", "_CM_REPO": ""},
+			},
+			required:  []string{"_CM_REF", "_CM_REPO"},
+			expectErr: false,
+		},
+		"referenced substitutions are valid": {
+			build: &cloudbuild.Build{
+				Steps: []*cloudbuild.BuildStep{
+					{Args: []string{"--ref=${_CM_REF}", "--repo=$_CM_REPO"}},
+				},
+			},
+			required:  []string{"_CM_REF", "_CM_REPO"},
+			expectErr: false,
+		},
+		"missing substitution is invalid": {
+			build: &cloudbuild.Build{
+				Substitutions: map[string]string{"_CM_REF": ""},
+			},
+			required:  []string{"_CM_REF", "_CM_REPO"},
+			expectErr: true,
+		},
+		"substitution with a common prefix is not a reference": {
+			build: &cloudbuild.Build{
+				Steps: []*cloudbuild.BuildStep{
+					{Args: []string{"--ref=$_CM_REF_OTHER"}},
+				},
+			},
+			required:  []string{"_CM_REF"},
+			expectErr: true,
+		},
+		"loose substitution option is always valid": {
+			build: &cloudbuild.Build{
+				Options: &cloudbuild.BuildOptions{SubstitutionOption: "ALLOW_LOOSE"},
+			},
+			required:  []string{"_CM_REF"},
+			expectErr: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSubstitutions(test.build, test.required)
+			if (err != nil) != test.expectErr {
+				t.Errorf("expectErr=%v, err=%v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSubmitBuild(t *testing.T) {
+	const pool = "projects/my-project/locations/europe-west1/workerPools/my-pool"
+	tests := map[string]struct {
+		region  string
+		options *cloudbuild.BuildOptions
+		expPath string
+		expPool string
+		expRef  string
+		expErr  bool
+	}{
+		"shared pool builds are submitted globally": {
+			options: &cloudbuild.BuildOptions{MachineType: "N1_HIGHCPU_32"},
+			expPath: "/v1/projects/my-project/builds",
+			expRef:  "abc-123",
+		},
+		"worker pool builds are submitted in the pool's region": {
+			options: &cloudbuild.BuildOptions{Pool: &cloudbuild.PoolOption{Name: pool}},
+			expPath: "/v1/projects/my-project/locations/europe-west1/builds",
+			expPool: pool,
+			expRef:  "projects/my-project/locations/europe-west1/builds/abc-123",
+		},
+		"regional builds are submitted in the region": {
+			region:  "us-central1",
+			options: &cloudbuild.BuildOptions{MachineType: "N1_HIGHCPU_32"},
+			expPath: "/v1/projects/my-project/locations/us-central1/builds",
+			expRef:  "projects/my-project/locations/us-central1/builds/abc-123",
+		},
+		"worker pool in the build's region": {
+			region:  "europe-west1",
+			options: &cloudbuild.BuildOptions{Pool: &cloudbuild.PoolOption{Name: pool}},
+			expPath: "/v1/projects/my-project/locations/europe-west1/builds",
+			expPool: pool,
+			expRef:  "projects/my-project/locations/europe-west1/builds/abc-123",
+		},
+		"worker pool in a different region errors": {
+			region:  "us-central1",
+			options: &cloudbuild.BuildOptions{Pool: &cloudbuild.PoolOption{Name: pool}},
+			expErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != test.expPath {
+					t.Errorf("unexpected request path: got=%q, exp=%q", r.URL.Path, test.expPath)
+				}
+
+				submitted := &cloudbuild.Build{}
+				if err := json.NewDecoder(r.Body).Decode(submitted); err != nil {
+					t.Fatal(err)
+				}
+				gotPool := ""
+				if submitted.Options != nil && submitted.Options.Pool != nil {
+					gotPool = submitted.Options.Pool.Name
+				}
+				if gotPool != test.expPool {
+					t.Errorf("unexpected worker pool in submitted build: got=%q, exp=%q", gotPool, test.expPool)
+				}
+
+				submitted.Id = "abc-123"
+				metadata, err := json.Marshal(cloudbuild.BuildOperationMetadata{Build: submitted})
+				if err != nil {
+					t.Fatal(err)
+				}
+				json.NewEncoder(w).Encode(cloudbuild.Operation{Metadata: metadata})
+			}))
+			defer srv.Close()
+
+			ctx := context.Background()
+			svc, err := cloudbuild.NewService(ctx, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			build, err := SubmitBuild(ctx, svc, "my-project", test.region, &cloudbuild.Build{Options: test.options})
+			if test.expErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ref := BuildRef(build); ref != test.expRef {
+				t.Errorf("unexpected build ref: got=%q, exp=%q", ref, test.expRef)
+			}
+		})
+	}
+}
+
+const testBuildFile = "timeout: 60s\nsteps:\n- name: busybox\nsubstitutions:\n  _FOO: bar\n"
+
+func TestLoadBuild(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		expErr  string
+	}{
+		"valid build": {
+			content: testBuildFile,
+		},
+		"empty file": {
+			content: "",
+			expErr:  "file is empty",
+		},
+		"malformed YAML gives the line": {
+			content: "timeout: 60s\nsteps:\n- name: busybox\n  args: [\"a\"\nsubstitutions: {}\n",
+			expErr:  "line 3",
+		},
+		"top level is not a mapping": {
+			content: "- name: busybox\n",
+			expErr:  "line 1, column 1: expected a mapping",
+		},
+		"missing steps": {
+			content: "substitutions:\n  _FOO: bar\n",
+			expErr:  `missing required top-level field "steps"`,
+		},
+		"missing substitutions": {
+			content: "steps:\n- name: busybox\n",
+			expErr:  `missing required top-level field "substitutions"`,
+		},
+		"unknown field gives the line and column": {
+			content: "steps:\n- name: busybox\n  entrypont: sh\nsubstitutions: {}\n",
+			expErr:  `line 3, column 3: unknown field "entrypont"`,
+		},
+		"file larger than the maximum size": {
+			content: testBuildFile + "# " + strings.Repeat("a", MaxBuildFileSize) + "\n",
+			expErr:  "larger than the maximum build file size",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cloudbuild.yaml")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			build, err := LoadBuild(path)
+			if test.expErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(build.Steps) != 1 || build.Substitutions["_FOO"] != "bar" {
+					t.Errorf("unexpected build: %+v", build)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadBuildWithChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudbuild.yaml")
+	if err := os.WriteFile(path, []byte(testBuildFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// sha256sum of testBuildFile
+	const sum = "fe664854f57b22d90e810344bb656d1e50d0f7885ee3461331463e4ffa64bd72"
+
+	tests := map[string]struct {
+		checksum string
+		expErr   string
+	}{
+		"no checksum": {},
+		"matching checksum": {
+			checksum: sum,
+		},
+		"matching checksum in upper case": {
+			checksum: strings.ToUpper(sum),
+		},
+		"mismatched checksum": {
+			checksum: strings.Repeat("0", 64),
+			expErr:   "does not match expected checksum",
+		},
+		"malformed checksum": {
+			checksum: "abc",
+			expErr:   "is not a hex-encoded SHA256 checksum",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			build, err := LoadBuildWithChecksum(path, test.checksum)
+			if test.expErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if build.Timeout != "60s" {
+					t.Errorf("unexpected build: %+v", build)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gcbfake provides an in-memory implementation of gcb.Service for
+// testing commands which submit and wait for Cloud Build builds.
+package gcbfake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/api/cloudbuild/v1"
+
+	"github.com/cert-manager/release/pkg/gcb"
+)
+
+// Service is a fake gcb.Service which stores builds in memory. Submitted
+// builds are given sequential IDs and complete as soon as they're waited for.
+type Service struct {
+	// Complete is called with the number of builds submitted so far, starting
+	// at 1, and a copy of each build when it is first waited for. It should
+	// update the build to its final state. If nil, builds succeed.
+	Complete func(attempt int, build *cloudbuild.Build)
+
+	// SubmitErr, if set, is returned by SubmitBuild.
+	SubmitErr error
+
+	// WaitErr, if set, is returned by WaitForBuild.
+	WaitErr error
+
+	mu        sync.Mutex
+	builds    map[string]*cloudbuild.Build
+	submitted []*cloudbuild.Build
+	cancelled []string
+}
+
+var _ gcb.Service = &Service{}
+
+// AddBuild stores build so that it can be fetched by its ID. It is intended
+// for setting up builds which were submitted before a test started.
+func (s *Service) AddBuild(build *cloudbuild.Build) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.builds == nil {
+		s.builds = map[string]*cloudbuild.Build{}
+	}
+	s.builds[build.Id] = build
+}
+
+// Submitted returns every build submitted to the fake, in order.
+func (s *Service) Submitted() []*cloudbuild.Build {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*cloudbuild.Build{}, s.submitted...)
+}
+
+// Cancelled returns the ID of every build which was cancelled, in order.
+func (s *Service) Cancelled() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.cancelled...)
+}
+
+func (s *Service) SubmitBuild(ctx context.Context, projectID, region string, build *cloudbuild.Build) (*cloudbuild.Build, error) {
+	if s.SubmitErr != nil {
+		return nil, s.SubmitErr
+	}
+
+	s.mu.Lock()
+	submitted := *build
+	s.submitted = append(s.submitted, &submitted)
+	id := fmt.Sprintf("build-%d", len(s.submitted))
+	s.mu.Unlock()
+
+	created := submitted
+	created.Id = id
+	created.ProjectId = projectID
+	created.Status = "QUEUED"
+	created.LogUrl = fmt.Sprintf("https://console.cloud.google.com/cloud-build/builds/%s?project=%s", id, projectID)
+	if region != "" {
+		created.Name = gcb.BuildName(projectID, region, id)
+	}
+	s.AddBuild(&created)
+
+	copied := created
+	return &copied, nil
+}
+
+func (s *Service) GetBuild(ctx context.Context, projectID string, id string) (*cloudbuild.Build, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	build, err := s.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *build
+	return &copied, nil
+}
+
+func (s *Service) WaitForBuild(ctx context.Context, projectID string, id string, progress *gcb.StepProgress) (*cloudbuild.Build, error) {
+	if s.WaitErr != nil {
+		return nil, s.WaitErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	build, err := s.lookup(id)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if !gcb.IsTerminal(build.Status) {
+		build.Status = gcb.Success
+		if s.Complete != nil {
+			s.Complete(len(s.submitted), build)
+		}
+	}
+	copied := *build
+	s.mu.Unlock()
+
+	if progress != nil {
+		progress.Update(&copied)
+	}
+	return &copied, nil
+}
+
+func (s *Service) CancelBuild(ctx context.Context, projectID string, id string) (*cloudbuild.Build, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	build, err := s.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if !gcb.IsTerminal(build.Status) {
+		build.Status = gcb.Cancelled
+	}
+	s.cancelled = append(s.cancelled, id)
+	copied := *build
+	return &copied, nil
+}
+
+// lookup returns the stored build with the given ID, which may also be a
+// full resource name. s.mu must be held.
+func (s *Service) lookup(id string) (*cloudbuild.Build, error) {
+	for _, build := range s.builds {
+		if build.Id == id || (build.Name != "" && build.Name == id) {
+			return build, nil
+		}
+	}
+	return nil, fmt.Errorf("build %q not found", id)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/cloudbuild/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// StreamBuildLogs will tail the log object of the GCB Build with the given ID
+// from the build's logs bucket, writing output to w as it becomes available.
+// It returns once the build has completed and all of its log output has been
+// written, or with an error if the log object cannot be read.
+func StreamBuildLogs(ctx context.Context, svc Service, gcs *storage.Client, projectID string, id string, w io.Writer) error {
+	var offset int64
+	err := wait.PollImmediateUntilWithContext(ctx, time.Second*5, func(ctx context.Context) (done bool, err error) {
+		// The build status must be fetched before reading the log object so
+		// that no output is missed once the build is seen to be complete.
+		build, err := svc.GetBuild(ctx, projectID, id)
+		if err != nil {
+			return false, err
+		}
+
+		bucket, object, err := LogObjectForBuild(build)
+		if err != nil {
+			return false, err
+		}
+
+		n, err := copyObjectFromOffset(ctx, gcs.Bucket(bucket).Object(object), offset, w)
+		offset += n
+		// The log object is not created until the build starts running.
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return false, err
+		}
+
+		return IsTerminal(build.Status), nil
+	})
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// DownloadBuildLog downloads the log object of the given build into dir,
+// which is created if it doesn't exist, and returns the path of the file
+// written. The file has the same name as the log object, which includes the
+// build's ID. An error is returned if the log object is empty.
+func DownloadBuildLog(ctx context.Context, gcs *storage.Client, build *cloudbuild.Build, dir string) (string, error) {
+	bucket, object, err := LogObjectForBuild(build)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := gcs.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read log object gs://%s/%s: %w", bucket, object, err)
+	}
+	defer r.Close()
+
+	return saveBuildLog(r, dir, path.Base(object))
+}
+
+// saveBuildLog writes the log read from r to the file with the given name in
+// dir, removing it again if the log is empty.
+func saveBuildLog(r io.Reader, dir, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	logPath := filepath.Join(dir, name)
+	f, err := os.Create(logPath)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("build log %q is empty", name)
+	}
+	if err != nil {
+		os.Remove(logPath)
+		return "", err
+	}
+
+	return logPath, nil
+}
+
+// LogObjectForBuild returns the name of the GCS bucket and object which
+// contain the log output for the given build.
+func LogObjectForBuild(build *cloudbuild.Build) (string, string, error) {
+	if build.LogsBucket == "" {
+		return "", "", fmt.Errorf("build %q does not have a logs bucket set", build.Id)
+	}
+
+	path := strings.TrimPrefix(build.LogsBucket, "gs://")
+	bucket, prefix := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, prefix = path[:i], strings.Trim(path[i+1:], "/")
+	}
+
+	object := fmt.Sprintf("log-%s.txt", build.Id)
+	if prefix != "" {
+		object = prefix + "/" + object
+	}
+
+	return bucket, object, nil
+}
+
+// copyObjectFromOffset copies any content of obj beyond the given offset into
+// w, returning the number of bytes copied.
+func copyObjectFromOffset(ctx context.Context, obj *storage.ObjectHandle, offset int64, w io.Writer) (int64, error) {
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if attrs.Size <= offset {
+		return 0, nil
+	}
+
+	r, err := obj.NewRangeReader(ctx, offset, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return io.Copy(w, r)
+}
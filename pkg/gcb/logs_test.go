@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+func TestLogObjectForBuild(t *testing.T) {
+	tests := map[string]struct {
+		logsBucket     string
+		expectedBucket string
+		expectedObject string
+		expectErr      bool
+	}{
+		"default logs bucket": {
+			logsBucket:     "gs://1234.cloudbuild-logs.googleusercontent.com",
+			expectedBucket: "1234.cloudbuild-logs.googleusercontent.com",
+			expectedObject: "log-abc.txt",
+		},
+		"logs bucket with prefix": {
+			logsBucket:     "gs://my-logs/some/prefix/",
+			expectedBucket: "my-logs",
+			expectedObject: "some/prefix/log-abc.txt",
+		},
+		"no logs bucket should error": {
+			logsBucket: "",
+			expectErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bucket, object, err := LogObjectForBuild(&cloudbuild.Build{Id: "abc", LogsBucket: test.logsBucket})
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expectErr=%v, err=%v", test.expectErr, err)
+			}
+
+			if bucket != test.expectedBucket {
+				t.Errorf("wanted bucket %q but got %q", test.expectedBucket, bucket)
+			}
+
+			if object != test.expectedObject {
+				t.Errorf("wanted object %q but got %q", test.expectedObject, object)
+			}
+		})
+	}
+}
+
+func TestSaveBuildLog(t *testing.T) {
+	tests := map[string]struct {
+		log       string
+		expectErr bool
+	}{
+		"log is saved": {
+			log: "Step #0: building...\nDONE\n",
+		},
+		"empty log should error": {
+			log:       "",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// the directory is created if it doesn't exist
+			dir := filepath.Join(t.TempDir(), "logs")
+			logPath, err := saveBuildLog(strings.NewReader(test.log), dir, "log-abc.txt")
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expectErr=%v, err=%v", test.expectErr, err)
+			}
+
+			if test.expectErr {
+				if _, err := os.Stat(filepath.Join(dir, "log-abc.txt")); !os.IsNotExist(err) {
+					t.Errorf("expected empty log file to be removed but got: %v", err)
+				}
+				return
+			}
+
+			data, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.log {
+				t.Errorf("wanted log %q but got %q", test.log, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/cloudbuild/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// MaxDiskSizeGB is the largest disk size that can be requested for a build.
+const MaxDiskSizeGB = 1000
+
+// MachineTypes is the list of machine types that builds can be run on, in
+// the format used by the Cloud Build API.
+var MachineTypes = []string{
+	"N1_HIGHCPU_8",
+	"N1_HIGHCPU_32",
+	"E2_HIGHCPU_8",
+	"E2_HIGHCPU_32",
+}
+
+// NormalizeMachineType accepts a machine type either in the format used by
+// the Cloud Build API (e.g. N1_HIGHCPU_32) or by gcloud (e.g. n1-highcpu-32)
+// and returns it in the format used by the API. An error is returned if the
+// machine type is not known.
+func NormalizeMachineType(machineType string) (string, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(machineType, "-", "_"))
+	for _, m := range MachineTypes {
+		if normalized == m {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown machine type %q, must be one of: %s", machineType, strings.Join(MachineTypes, ", "))
+}
+
+// ValidateDiskSizeGB returns an error if sizeGB cannot be requested as the
+// disk size of a build.
+func ValidateDiskSizeGB(sizeGB int64) error {
+	if sizeGB <= 0 || sizeGB > MaxDiskSizeGB {
+		return fmt.Errorf("invalid disk size %dGB, must be between 1 and %d", sizeGB, MaxDiskSizeGB)
+	}
+	return nil
+}
+
+var regionRegex = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+$`)
+
+// ValidateRegion returns an error if region is not the name of a Cloud Build
+// region, e.g. us-central1. An empty region, meaning the global endpoint
+// should be used, is valid.
+func ValidateRegion(region string) error {
+	if region != "" && !regionRegex.MatchString(region) {
+		return fmt.Errorf("invalid region %q, must be the name of a region such as us-central1", region)
+	}
+	return nil
+}
+
+// RegionalEndpoint returns the base URL of the Cloud Build API endpoint for
+// the given region, or an empty string to use the global endpoint if region
+// is empty.
+func RegionalEndpoint(region string) string {
+	if region == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://%s-cloudbuild.googleapis.com/", region)
+}
+
+var substitutionKeyRegex = regexp.MustCompile(`^_[A-Z0-9_]+$`)
+
+// ParseSubstitutions parses a list of user-defined substitutions of the form
+// KEY=VALUE, as accepted by Cloud Build, returning them as a map of key to
+// value. Each key is validated with ValidateSubstitutionKey.
+func ParseSubstitutions(values []string, reserved []string) (map[string]string, error) {
+	subs := make(map[string]string, len(values))
+	for _, value := range values {
+		i := strings.Index(value, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid substitution %q, must be of the form KEY=VALUE", value)
+		}
+
+		key := value[:i]
+		if err := ValidateSubstitutionKey(key, reserved); err != nil {
+			return nil, err
+		}
+		if _, ok := subs[key]; ok {
+			return nil, fmt.Errorf("substitution %q is set more than once", key)
+		}
+
+		subs[key] = value[i+1:]
+	}
+	return subs, nil
+}
+
+// LoadSubstitutionsFile reads a file mapping user-defined substitution keys
+// to values, returning them as a map of key to value. Files with a '.json'
+// extension are decoded as JSON, and '.yaml' or '.yml' files as YAML. Values
+// must be strings, since numbers such as Go versions can't be decoded from
+// YAML without losing precision, and each key is validated with
+// ValidateSubstitutionKey.
+func LoadSubstitutionsFile(path string, reserved []string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read substitutions file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported substitutions file extension %q, must be one of .json, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse substitutions file %q: %w", path, err)
+	}
+
+	subs := make(map[string]string, len(values))
+	for key, value := range values {
+		if err := ValidateSubstitutionKey(key, reserved); err != nil {
+			return nil, fmt.Errorf("invalid substitutions file %q: %w", path, err)
+		}
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid substitutions file %q: value of %q must be a string, numbers and booleans must be quoted", path, key)
+		}
+		subs[key] = v
+	}
+	return subs, nil
+}
+
+// ValidateSubstitutionKey returns an error if key is not a valid
+// user-defined substitution key, which must begin with an underscore
+// followed only by uppercase letters, numbers and underscores, or if it is
+// any of the reserved keys, which are set by cmrel itself.
+func ValidateSubstitutionKey(key string, reserved []string) error {
+	if !substitutionKeyRegex.MatchString(key) {
+		return fmt.Errorf("invalid substitution key %q, must match %s", key, substitutionKeyRegex)
+	}
+	for _, r := range reserved {
+		if key == r {
+			return fmt.Errorf("substitution %q is set by cmrel and can't be overridden", key)
+		}
+	}
+	return nil
+}
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SubstitutionsEnv returns the environment of a build's steps, given as env
+// in the form KEY=VALUE, with each of the given substitutions added as an
+// environment variable of the same name. The variables are sorted by name
+// and appended to env. An error is returned if a substitution's name isn't a
+// valid environment variable name, or if a variable of the same name is
+// already set in env.
+func SubstitutionsEnv(substitutions map[string]string, env []string) ([]string, error) {
+	existing := make(map[string]bool, len(env))
+	for _, e := range env {
+		existing[strings.SplitN(e, "=", 2)[0]] = true
+	}
+
+	keys := make([]string, 0, len(substitutions))
+	for key := range substitutions {
+		if !envNameRegex.MatchString(key) {
+			return nil, fmt.Errorf("substitution %q can't be set as an environment variable, names must match %s", key, envNameRegex)
+		}
+		if existing[key] {
+			return nil, fmt.Errorf("substitution %q can't be set as an environment variable as it is already set in the build's env", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := append([]string{}, env...)
+	for _, key := range keys {
+		out = append(out, key+"="+substitutions[key])
+	}
+	return out, nil
+}
+
+var (
+	labelKeyRegex   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValueRegex = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// labelTagSeparator separates the key and value of a label in the build tag
+// it is stored as. Cloud Build builds have tags rather than labels, and '.'
+// is allowed in tags but not in label keys or values.
+const labelTagSeparator = "."
+
+// ParseLabels parses a list of labels of the form KEY=VALUE, returning them as
+// a map of key to value. Keys and values must use the character set allowed
+// in GCP resource labels: keys must start with a lowercase letter and contain
+// at most 63 lowercase letters, digits, underscores or dashes, and values may
+// be empty or contain at most 63 of the same characters.
+func ParseLabels(values []string) (map[string]string, error) {
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		i := strings.Index(value, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid label %q, must be of the form KEY=VALUE", value)
+		}
+
+		key, val := value[:i], value[i+1:]
+		if !labelKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("invalid label key %q, must start with a lowercase letter and contain at most 63 lowercase letters, digits, '_' or '-'", key)
+		}
+		if !labelValueRegex.MatchString(val) {
+			return nil, fmt.Errorf("invalid value %q for label %q, must contain at most 63 lowercase letters, digits, '_' or '-'", val, key)
+		}
+		if _, ok := labels[key]; ok {
+			return nil, fmt.Errorf("label %q is set more than once", key)
+		}
+
+		labels[key] = val
+	}
+	return labels, nil
+}
+
+// LabelTags returns the build tags which record the given labels, sorted by
+// label key, so that builds can be filtered by label with a filter such as
+// 'tags="key.value"'.
+func LabelTags(labels map[string]string) []string {
+	tags := make([]string, 0, len(labels))
+	for key, value := range labels {
+		tags = append(tags, key+labelTagSeparator+value)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// LabelsFromTags returns the labels recorded in a build's tags by LabelTags,
+// ignoring any other tags. It returns nil if no labels are found.
+func LabelsFromTags(tags []string) map[string]string {
+	var labels map[string]string
+	for _, tag := range tags {
+		i := strings.Index(tag, labelTagSeparator)
+		if i < 0 || !labelKeyRegex.MatchString(tag[:i]) || !labelValueRegex.MatchString(tag[i+1:]) {
+			continue
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[tag[:i]] = tag[i+1:]
+	}
+	return labels
+}
+
+var workerPoolNameRegex = regexp.MustCompile(`^projects/([^/]+)/locations/([^/]+)/workerPools/([^/]+)$`)
+
+// WorkerPool identifies a Cloud Build private worker pool.
+type WorkerPool struct {
+	Project  string
+	Location string
+	Name     string
+}
+
+// String returns the full resource name of the worker pool.
+func (w WorkerPool) String() string {
+	return fmt.Sprintf("projects/%s/locations/%s/workerPools/%s", w.Project, w.Location, w.Name)
+}
+
+// ParseWorkerPoolName parses the full resource name of a private worker pool,
+// of the form projects/{project}/locations/{location}/workerPools/{name}.
+func ParseWorkerPoolName(name string) (WorkerPool, error) {
+	v := workerPoolNameRegex.FindStringSubmatch(name)
+	if len(v) != 4 {
+		return WorkerPool{}, fmt.Errorf("invalid worker pool name %q, must be of the form projects/{project}/locations/{location}/workerPools/{name}", name)
+	}
+	if v[2] == "global" {
+		return WorkerPool{}, fmt.Errorf("invalid worker pool name %q, worker pools must use a regional location", name)
+	}
+	return WorkerPool{Project: v[1], Location: v[2], Name: v[3]}, nil
+}
+
+// bucketNameRegex matches the names of GCS buckets which don't contain dots,
+// which are the only names usable by a logs bucket since dotted names must
+// be verified domains.
+var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,61}[a-z0-9]$`)
+
+// NormalizeLogsBucket accepts the GCS bucket which build logs should be
+// written to, either as a bucket name or as a gs:// URL, optionally followed
+// by a path within the bucket, and returns it as a gs:// URL in the format
+// used by the logsBucket field of a build.
+func NormalizeLogsBucket(logsBucket string) (string, error) {
+	path := strings.Trim(strings.TrimPrefix(logsBucket, "gs://"), "/")
+	bucket, prefix := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, prefix = path[:i], path[i+1:]
+	}
+
+	if !bucketNameRegex.MatchString(bucket) || strings.HasPrefix(bucket, "goog") {
+		return "", fmt.Errorf("invalid logs bucket %q, must be a bucket name of 3 to 63 lowercase letters, digits, '-' and '_', optionally prefixed with gs:// and followed by a path", logsBucket)
+	}
+	if strings.Contains(prefix, "//") {
+		return "", fmt.Errorf("invalid logs bucket %q, path must not contain empty segments", logsBucket)
+	}
+
+	if prefix == "" {
+		return "gs://" + bucket, nil
+	}
+	return "gs://" + bucket + "/" + prefix, nil
+}
+
+// BuildRef returns the identifier that should be passed to functions such as
+// GetBuild and WaitForBuild to refer to the given build. For builds submitted
+// in a specific region this is the build's full resource name, otherwise it is
+// the build's ID.
+func BuildRef(build *cloudbuild.Build) string {
+	if strings.Contains(build.Name, "/locations/") && !strings.Contains(build.Name, "/locations/global/") {
+		return build.Name
+	}
+	return build.Id
+}
+
+// BuildName returns the identifier to pass to functions such as GetBuild to
+// refer to the build with the given ID, which was submitted in region, or the
+// ID itself if region is empty.
+func BuildName(projectID, region, id string) string {
+	if region == "" || isResourceName(id) {
+		return id
+	}
+	return fmt.Sprintf("projects/%s/locations/%s/builds/%s", projectID, region, id)
+}
+
+func isResourceName(id string) bool {
+	return strings.HasPrefix(id, "projects/")
+}
@@ -0,0 +1,436 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMachineType(t *testing.T) {
+	tests := map[string]struct {
+		machineType string
+		expected    string
+		expectErr   bool
+	}{
+		"API format": {
+			machineType: "N1_HIGHCPU_32",
+			expected:    "N1_HIGHCPU_32",
+		},
+		"gcloud format": {
+			machineType: "e2-highcpu-8",
+			expected:    "E2_HIGHCPU_8",
+		},
+		"empty": {
+			machineType: "",
+			expectErr:   true,
+		},
+		"unknown": {
+			machineType: "n1-highcpu-64",
+			expectErr:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormalizeMachineType(test.machineType)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if got != test.expected {
+				t.Errorf("unexpected machine type: got=%q, exp=%q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestValidateDiskSizeGB(t *testing.T) {
+	tests := map[string]struct {
+		sizeGB    int64
+		expectErr bool
+	}{
+		"valid":    {sizeGB: 200},
+		"maximum":  {sizeGB: MaxDiskSizeGB},
+		"zero":     {sizeGB: 0, expectErr: true},
+		"negative": {sizeGB: -1, expectErr: true},
+		"too big":  {sizeGB: MaxDiskSizeGB + 1, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateDiskSizeGB(test.sizeGB)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	tests := map[string]struct {
+		region    string
+		expectErr bool
+	}{
+		"empty uses the global endpoint": {region: ""},
+		"us region":                      {region: "us-central1"},
+		"multi-part region":              {region: "northamerica-northeast1"},
+		"global":                         {region: "global", expectErr: true},
+		"uppercase":                      {region: "US-CENTRAL1", expectErr: true},
+		"endpoint host":                  {region: "us-central1-cloudbuild.googleapis.com", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateRegion(test.region)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestParseSubstitutions(t *testing.T) {
+	tests := map[string]struct {
+		values    []string
+		expected  map[string]string
+		expectErr bool
+	}{
+		"no substitutions": {
+			expected: map[string]string{},
+		},
+		"values may contain '=' and ','": {
+			values:   []string{"_GO_VERSION=1.17", "_EXTRA=a=b,c", "_EMPTY="},
+			expected: map[string]string{"_GO_VERSION": "1.17", "_EXTRA": "a=b,c", "_EMPTY": ""},
+		},
+		"missing '='":           {values: []string{"_GO_VERSION"}, expectErr: true},
+		"no leading underscore": {values: []string{"GO_VERSION=1.17"}, expectErr: true},
+		"lowercase key":         {values: []string{"_go_version=1.17"}, expectErr: true},
+		"underscore only":       {values: []string{"_=1.17"}, expectErr: true},
+		"reserved key":          {values: []string{"_CM_REF=abc"}, expectErr: true},
+		"duplicate key":         {values: []string{"_A=1", "_A=2"}, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			subs, err := ParseSubstitutions(test.values, []string{"_CM_REF"})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if !test.expectErr && !reflect.DeepEqual(subs, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, subs)
+			}
+		})
+	}
+}
+
+func TestSubstitutionsEnv(t *testing.T) {
+	tests := map[string]struct {
+		substitutions map[string]string
+		env           []string
+		expected      []string
+		expectErr     bool
+	}{
+		"no substitutions": {
+			env:      []string{"GOFLAGS=-mod=vendor"},
+			expected: []string{"GOFLAGS=-mod=vendor"},
+		},
+		"substitutions are appended sorted by name": {
+			substitutions: map[string]string{"_CM_REF": "abc", "_BRANCH": "master", "_EXTRA": "a=b"},
+			env:           []string{"GOFLAGS=-mod=vendor"},
+			expected:      []string{"GOFLAGS=-mod=vendor", "_BRANCH=master", "_CM_REF=abc", "_EXTRA=a=b"},
+		},
+		"invalid name": {
+			substitutions: map[string]string{"_CM-REF": "abc"},
+			expectErr:     true,
+		},
+		"already set in env": {
+			substitutions: map[string]string{"_CM_REF": "abc"},
+			env:           []string{"_CM_REF=def"},
+			expectErr:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			env, err := SubstitutionsEnv(test.substitutions, test.env)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if !test.expectErr && !reflect.DeepEqual(env, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, env)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := map[string]struct {
+		values    []string
+		expected  map[string]string
+		expectErr bool
+	}{
+		"no labels": {
+			expected: map[string]string{},
+		},
+		"valid labels": {
+			values:   []string{"release-version=v1-8-0", "initiator=jake_e", "empty="},
+			expected: map[string]string{"release-version": "v1-8-0", "initiator": "jake_e", "empty": ""},
+		},
+		"missing '='":           {values: []string{"initiator"}, expectErr: true},
+		"uppercase key":         {values: []string{"Initiator=jake"}, expectErr: true},
+		"key starts with digit": {values: []string{"1st=jake"}, expectErr: true},
+		"value contains '.'":    {values: []string{"release-version=v1.8.0"}, expectErr: true},
+		"value is too long":     {values: []string{"initiator=" + strings.Repeat("a", 64)}, expectErr: true},
+		"duplicate key":         {values: []string{"a=1", "a=2"}, expectErr: true},
+		"empty key":             {values: []string{"=jake"}, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			labels, err := ParseLabels(test.values)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if test.expectErr {
+				return
+			}
+			if !reflect.DeepEqual(labels, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, labels)
+			}
+
+			// labels must survive being stored as build tags
+			tags := append([]string{"cert-manager-release-stage", "v1.8.0"}, LabelTags(labels)...)
+			roundTripped := LabelsFromTags(tags)
+			if len(labels) == 0 && roundTripped == nil {
+				return
+			}
+			if !reflect.DeepEqual(roundTripped, test.expected) {
+				t.Errorf("expected labels %v to be read from tags %v but got %v", test.expected, tags, roundTripped)
+			}
+		})
+	}
+}
+
+func TestLoadSubstitutionsFile(t *testing.T) {
+	tests := map[string]struct {
+		filename  string
+		content   string
+		reserved  []string
+		expected  map[string]string
+		expectErr bool
+	}{
+		"yaml file": {
+			filename: "subs.yaml",
+			content:  "_GO_VERSION: '1.10'\n_FIPS: 'true'\n_ALT_REPO: https://example.com/a,b\n",
+			expected: map[string]string{"_GO_VERSION": "1.10", "_FIPS": "true", "_ALT_REPO": "https://example.com/a,b"},
+		},
+		"json file": {
+			filename: "subs.json",
+			content:  `{"_GO_VERSION": "1.17", "_RETRIES": "3"}`,
+			expected: map[string]string{"_GO_VERSION": "1.17", "_RETRIES": "3"},
+		},
+		"yml extension": {
+			filename: "subs.yml",
+			content:  "_A: b\n",
+			expected: map[string]string{"_A": "b"},
+		},
+		"unknown extension": {
+			filename:  "subs.txt",
+			content:   "_A=b\n",
+			expectErr: true,
+		},
+		"invalid key": {
+			filename:  "subs.yaml",
+			content:   "GO_VERSION: 1.17\n",
+			expectErr: true,
+		},
+		"reserved key": {
+			filename:  "subs.yaml",
+			content:   "_CM_REF: abc\n",
+			reserved:  []string{"_CM_REF"},
+			expectErr: true,
+		},
+		"reserved key is allowed if not reserved": {
+			filename: "subs.yaml",
+			content:  "_CM_REF: abc\n",
+			expected: map[string]string{"_CM_REF": "abc"},
+		},
+		"unquoted number": {
+			filename:  "subs.yaml",
+			content:   "_GO_VERSION: 1.10\n",
+			expectErr: true,
+		},
+		"non-scalar value": {
+			filename:  "subs.yaml",
+			content:   "_A: [b, c]\n",
+			expectErr: true,
+		},
+		"malformed json": {
+			filename:  "subs.json",
+			content:   `{"_A": `,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.filename)
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			subs, err := LoadSubstitutionsFile(path, test.reserved)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if !test.expectErr && !reflect.DeepEqual(subs, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, subs)
+			}
+		})
+	}
+}
+
+func TestBuildName(t *testing.T) {
+	tests := map[string]struct {
+		region   string
+		id       string
+		expected string
+	}{
+		"global build": {
+			id:       "abc-123",
+			expected: "abc-123",
+		},
+		"regional build": {
+			region:   "us-central1",
+			id:       "abc-123",
+			expected: "projects/my-project/locations/us-central1/builds/abc-123",
+		},
+		"resource name is unchanged": {
+			region:   "us-central1",
+			id:       "projects/my-project/locations/europe-west1/builds/abc-123",
+			expected: "projects/my-project/locations/europe-west1/builds/abc-123",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := BuildName("my-project", test.region, test.id); got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeLogsBucket(t *testing.T) {
+	tests := map[string]struct {
+		logsBucket string
+		expected   string
+		expectErr  bool
+	}{
+		"bucket name": {
+			logsBucket: "my-logs",
+			expected:   "gs://my-logs",
+		},
+		"gs URL with path": {
+			logsBucket: "gs://my_logs/cert-manager/stage/",
+			expected:   "gs://my_logs/cert-manager/stage",
+		},
+		"empty": {
+			logsBucket: "",
+			expectErr:  true,
+		},
+		"uppercase": {
+			logsBucket: "gs://My-Logs",
+			expectErr:  true,
+		},
+		"too short": {
+			logsBucket: "ab",
+			expectErr:  true,
+		},
+		"dotted name": {
+			logsBucket: "logs.example.com",
+			expectErr:  true,
+		},
+		"reserved prefix": {
+			logsBucket: "google-logs",
+			expectErr:  true,
+		},
+		"other scheme": {
+			logsBucket: "s3://my-logs",
+			expectErr:  true,
+		},
+		"empty path segment": {
+			logsBucket: "gs://my-logs/a//b",
+			expectErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormalizeLogsBucket(test.logsBucket)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if got != test.expected {
+				t.Errorf("unexpected logs bucket: got=%q, exp=%q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseWorkerPoolName(t *testing.T) {
+	tests := map[string]struct {
+		name      string
+		expected  WorkerPool
+		expectErr bool
+	}{
+		"valid": {
+			name:     "projects/my-project/locations/europe-west1/workerPools/my-pool",
+			expected: WorkerPool{Project: "my-project", Location: "europe-west1", Name: "my-pool"},
+		},
+		"global location": {
+			name:      "projects/my-project/locations/global/workerPools/my-pool",
+			expectErr: true,
+		},
+		"missing location": {
+			name:      "projects/my-project/workerPools/my-pool",
+			expectErr: true,
+		},
+		"pool name only": {
+			name:      "my-pool",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseWorkerPoolName(test.name)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if got != test.expected {
+				t.Errorf("unexpected worker pool: got=%+v, exp=%+v", got, test.expected)
+			}
+			if err == nil && got.String() != test.name {
+				t.Errorf("worker pool name did not round trip: got=%q, exp=%q", got.String(), test.name)
+			}
+		})
+	}
+}
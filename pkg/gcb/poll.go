@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// pollJitter is the fraction by which each polling interval is randomly
+// shortened, so that many builds waited on at once don't poll in lockstep.
+const pollJitter = 0.2
+
+// PollOptions configures how often the status of a build is polled whilst
+// waiting for it to complete.
+type PollOptions struct {
+	// Interval is the delay before the build is first polled. The delay is
+	// doubled after each subsequent poll, up to MaxInterval.
+	Interval time.Duration
+
+	// MaxInterval is the longest delay between polls.
+	MaxInterval time.Duration
+}
+
+// DefaultPollOptions are the PollOptions used when none are configured.
+var DefaultPollOptions = PollOptions{
+	Interval:    2 * time.Second,
+	MaxInterval: 30 * time.Second,
+}
+
+// Validate returns an error if the options can't be used to poll a build.
+func (o PollOptions) Validate() error {
+	if o.Interval <= 0 {
+		return fmt.Errorf("poll interval %s must be positive", o.Interval)
+	}
+	if o.MaxInterval < o.Interval {
+		return fmt.Errorf("max poll interval %s must not be less than the poll interval %s", o.MaxInterval, o.Interval)
+	}
+	return nil
+}
+
+// pollBackoff returns the delay before each successive poll of a build.
+type pollBackoff struct {
+	next time.Duration
+	max  time.Duration
+
+	// jitter returns the delay to wait for a given interval
+	jitter func(time.Duration) time.Duration
+}
+
+func newPollBackoff(opts PollOptions) *pollBackoff {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &pollBackoff{
+		next: opts.Interval,
+		max:  opts.MaxInterval,
+		jitter: func(d time.Duration) time.Duration {
+			return d - time.Duration(rnd.Float64()*pollJitter*float64(d))
+		},
+	}
+}
+
+// Step returns the delay before the next poll, and backs off the delay used
+// for the poll after it.
+func (b *pollBackoff) Step() time.Duration {
+	d := b.next
+	b.next *= 2
+	if b.next > b.max {
+		b.next = b.max
+	}
+	return b.jitter(d)
+}
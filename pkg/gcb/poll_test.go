@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/option"
+)
+
+func TestPollBackoff(t *testing.T) {
+	tests := map[string]struct {
+		opts PollOptions
+		exp  []time.Duration
+	}{
+		"default options back off to the cap": {
+			opts: DefaultPollOptions,
+			exp:  []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second},
+		},
+		"interval equal to the cap never backs off": {
+			opts: PollOptions{Interval: 5 * time.Second, MaxInterval: 5 * time.Second},
+			exp:  []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		"cap between doublings": {
+			opts: PollOptions{Interval: time.Second, MaxInterval: 3 * time.Second},
+			exp:  []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := newPollBackoff(test.opts)
+			b.jitter = func(d time.Duration) time.Duration { return d }
+			for i, exp := range test.exp {
+				if got := b.Step(); got != exp {
+					t.Errorf("unexpected interval for poll %d: got=%s, exp=%s", i, got, exp)
+				}
+			}
+		})
+	}
+}
+
+func TestPollBackoff_Jitter(t *testing.T) {
+	b := newPollBackoff(DefaultPollOptions)
+	interval := DefaultPollOptions.Interval
+	for i := 0; i < 20; i++ {
+		got := b.Step()
+		min := time.Duration(float64(interval) * (1 - pollJitter))
+		if got < min || got > interval {
+			t.Errorf("interval for poll %d not within jitter of %s: got=%s", i, interval, got)
+		}
+		if interval *= 2; interval > DefaultPollOptions.MaxInterval {
+			interval = DefaultPollOptions.MaxInterval
+		}
+	}
+}
+
+func TestPollOptionsValidate(t *testing.T) {
+	tests := map[string]struct {
+		opts   PollOptions
+		expErr bool
+	}{
+		"default options": {
+			opts: DefaultPollOptions,
+		},
+		"zero interval": {
+			opts:   PollOptions{MaxInterval: time.Second},
+			expErr: true,
+		},
+		"max interval less than interval": {
+			opts:   PollOptions{Interval: 10 * time.Second, MaxInterval: time.Second},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.opts.Validate()
+			if test.expErr != (err != nil) {
+				t.Errorf("unexpected error: exp error=%t, got=%v", test.expErr, err)
+			}
+		})
+	}
+}
+
+func TestWaitForBuildWithProgress(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "WORKING"
+		if polls == 3 {
+			status = Success
+		}
+		json.NewEncoder(w).Encode(cloudbuild.Build{Id: "abc-123", Status: status})
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc, err := cloudbuild.NewService(ctx, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := PollOptions{Interval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+	build, err := WaitForBuildWithProgress(ctx, svc, "my-project", "abc-123", opts, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if build.Status != Success || polls != 3 {
+		t.Errorf("expected build to succeed after 3 polls but got status %q after %d polls", build.Status, polls)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"log"
+	"time"
+
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+// Working is the status of a build or build step which is currently running.
+const Working = "WORKING"
+
+// StepProgress tracks the status of each step of a GCB Build across
+// successive snapshots of the build, logging a line each time a step starts
+// or finishes.
+type StepProgress struct {
+	// Logf is called to log each step transition. Step transitions aren't
+	// logged if it is nil.
+	Logf func(format string, args ...interface{})
+
+	// Waitingf, if set, is called to log each time the build is polled and
+	// found to still be in progress. Otherwise a debug message is logged
+	// using the log package.
+	Waitingf func(format string, args ...interface{})
+
+	// statuses is the last seen status of each step, by index.
+	statuses []string
+}
+
+// NewStepProgress returns a StepProgress which logs step transitions using
+// the given function, e.g. log.Printf.
+func NewStepProgress(logf func(format string, args ...interface{})) *StepProgress {
+	return &StepProgress{Logf: logf}
+}
+
+// Update compares the status of each step in the given build with the status
+// seen in the previous call to Update, and logs any steps which have since
+// started or finished.
+// A step which both started and finished between two snapshots is only
+// logged as having finished.
+func (p *StepProgress) Update(build *cloudbuild.Build) {
+	if p.Logf == nil {
+		return
+	}
+
+	for len(p.statuses) < len(build.Steps) {
+		p.statuses = append(p.statuses, "")
+	}
+
+	for i, step := range build.Steps {
+		if step.Status == p.statuses[i] {
+			continue
+		}
+		p.statuses[i] = step.Status
+
+		name := stepName(step)
+		switch {
+		case step.Status == Working:
+			p.Logf("Step %d/%d %q started", i+1, len(build.Steps), name)
+		case IsTerminal(step.Status):
+			outcome := "finished"
+			if step.Status != Success {
+				outcome = "finished with status " + step.Status
+			}
+
+			// an invalid timing isn't worth failing the wait over, so is
+			// treated in the same way as a step which has no timing
+			duration, err := timeSpanDuration(step.Timing)
+			if err != nil || duration == 0 {
+				p.Logf("Step %d/%d %q %s", i+1, len(build.Steps), name, outcome)
+				continue
+			}
+			p.Logf("Step %d/%d %q %s (%s)", i+1, len(build.Steps), name, outcome, duration.Round(time.Second))
+		}
+	}
+}
+
+// waiting logs that build was polled and is still in progress. It may be
+// called on a nil StepProgress.
+func (p *StepProgress) waiting(build *cloudbuild.Build) {
+	if p == nil || p.Waitingf == nil {
+		log.Printf("DEBUG: build %q still in progress...", build.Id)
+		return
+	}
+	p.Waitingf("build %q still in progress...", build.Id)
+}
+
+// stepName identifies a build step, using the step's ID if set or else the
+// name of the image the step runs.
+func stepName(step *cloudbuild.BuildStep) string {
+	if step.Id != "" {
+		return step.Id
+	}
+	return step.Name
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+func TestStepProgress(t *testing.T) {
+	step := func(id, status, start, end string) *cloudbuild.BuildStep {
+		s := &cloudbuild.BuildStep{Id: id, Name: "gcr.io/cloud-builders/" + id, Status: status}
+		if start != "" {
+			s.Timing = &cloudbuild.TimeSpan{StartTime: start, EndTime: end}
+		}
+		return s
+	}
+
+	tests := map[string]struct {
+		// snapshots are successive copies of the build's steps, as returned
+		// by each poll of the API
+		snapshots [][]*cloudbuild.BuildStep
+		expected  [][]string
+	}{
+		"steps starting and finishing across polls": {
+			snapshots: [][]*cloudbuild.BuildStep{
+				{
+					step("clone", Working, "2021-10-01T10:00:00Z", ""),
+					step("build", "QUEUED", "", ""),
+				},
+				{
+					step("clone", Success, "2021-10-01T10:00:00Z", "2021-10-01T10:03:12Z"),
+					step("build", Working, "2021-10-01T10:03:12Z", ""),
+				},
+				{
+					step("clone", Success, "2021-10-01T10:00:00Z", "2021-10-01T10:03:12Z"),
+					step("build", Working, "2021-10-01T10:03:12Z", ""),
+				},
+				{
+					step("clone", Success, "2021-10-01T10:00:00Z", "2021-10-01T10:03:12Z"),
+					step("build", Success, "2021-10-01T10:03:12Z", "2021-10-01T10:40:00.4Z"),
+				},
+			},
+			expected: [][]string{
+				{`Step 1/2 "clone" started`},
+				{`Step 1/2 "clone" finished (3m12s)`, `Step 2/2 "build" started`},
+				nil,
+				{`Step 2/2 "build" finished (36m48s)`},
+			},
+		},
+		"step which starts and finishes between polls is logged once": {
+			snapshots: [][]*cloudbuild.BuildStep{
+				{
+					step("clone", "QUEUED", "", ""),
+				},
+				{
+					step("clone", Success, "2021-10-01T10:00:00Z", "2021-10-01T10:00:04Z"),
+				},
+			},
+			expected: [][]string{
+				nil,
+				{`Step 1/1 "clone" finished (4s)`},
+			},
+		},
+		"failed and cancelled steps include their status": {
+			snapshots: [][]*cloudbuild.BuildStep{
+				{
+					step("clone", Working, "2021-10-01T10:00:00Z", ""),
+					step("build", "QUEUED", "", ""),
+				},
+				{
+					step("clone", Failure, "2021-10-01T10:00:00Z", "2021-10-01T10:00:30Z"),
+					step("build", Cancelled, "", ""),
+				},
+			},
+			expected: [][]string{
+				{`Step 1/2 "clone" started`},
+				{`Step 1/2 "clone" finished with status FAILURE (30s)`, `Step 2/2 "build" finished with status CANCELLED`},
+			},
+		},
+		"step without an ID uses its image name": {
+			snapshots: [][]*cloudbuild.BuildStep{
+				{
+					{Name: "gcr.io/cloud-builders/git", Status: Working},
+				},
+			},
+			expected: [][]string{
+				{`Step 1/1 "gcr.io/cloud-builders/git" started`},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var logged []string
+			p := NewStepProgress(func(format string, args ...interface{}) {
+				logged = append(logged, fmt.Sprintf(format, args...))
+			})
+
+			for i, steps := range test.snapshots {
+				logged = nil
+				p.Update(&cloudbuild.Build{Steps: steps})
+				if !reflect.DeepEqual(logged, test.expected[i]) {
+					t.Errorf("unexpected output after poll %d:\ngot: %q\nexp: %q", i+1, logged, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStepProgressWaiting(t *testing.T) {
+	var logged []string
+	p := &StepProgress{Waitingf: func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+
+	build := &cloudbuild.Build{Id: "abc-123", Steps: []*cloudbuild.BuildStep{{Name: "gcr.io/cloud-builders/git", Status: Working}}}
+	p.Update(build)
+	p.waiting(build)
+
+	exp := []string{`build "abc-123" still in progress...`}
+	if !reflect.DeepEqual(logged, exp) {
+		t.Errorf("unexpected output:\ngot: %q\nexp: %q", logged, exp)
+	}
+}
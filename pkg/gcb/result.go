@@ -0,0 +1,233 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+// BuildResult is a summary of a completed GCB Build.
+type BuildResult struct {
+	// Build is the final copy of the Build resource.
+	Build *cloudbuild.Build
+
+	// Status is the final status of the build, e.g. SUCCESS or FAILURE.
+	Status string
+
+	// StartTime is the time at which the build started executing.
+	StartTime time.Time
+
+	// FinishTime is the time at which the build finished executing.
+	FinishTime time.Time
+
+	// Duration is the amount of time the build spent executing.
+	Duration time.Duration
+
+	// Steps contains a summary of each step in the build, in the order they
+	// are defined in the build.
+	Steps []StepResult
+
+	// Artifacts is a list of the GCS paths of artifact objects uploaded by
+	// the build.
+	Artifacts []string
+
+	// Images contains the name and digest of each container image pushed
+	// by the build, as reported by Cloud Build.
+	Images []ImageResult
+}
+
+// ImageResult is a container image pushed by a GCB Build.
+type ImageResult struct {
+	// Name is the name of the image, as given in the build's 'images' list.
+	Name string
+
+	// Digest is the digest of the pushed image, e.g. sha256:abc123...
+	Digest string
+}
+
+// StepResult is a summary of a single step within a GCB Build.
+type StepResult struct {
+	// Name identifies the step, using the step's ID if set or else the name
+	// of the image the step runs.
+	Name string
+
+	// Status is the final status of the step.
+	Status string
+
+	// Duration is the amount of time the step spent executing. It is zero
+	// if the step did not run.
+	Duration time.Duration
+}
+
+// Succeeded returns true if the build completed successfully.
+func (r *BuildResult) Succeeded() bool {
+	return r.Status == Success
+}
+
+// Failure describes why the build did not succeed, made up of its status
+// and, if known, the type and detail of its failure, e.g.
+// "FAILURE (USER_BUILD_STEP): Build step failure: ...". It returns an empty
+// string if the build succeeded.
+func (r *BuildResult) Failure() string {
+	if r.Succeeded() {
+		return ""
+	}
+
+	desc := r.Status
+	var details []string
+	if info := r.Build.FailureInfo; info != nil {
+		if info.Type != "" {
+			desc += fmt.Sprintf(" (%s)", info.Type)
+		}
+		if info.Detail != "" {
+			details = append(details, info.Detail)
+		}
+	}
+	if r.Build.StatusDetail != "" {
+		details = append(details, r.Build.StatusDetail)
+	}
+	if len(details) > 0 {
+		desc += ": " + strings.Join(details, "; ")
+	}
+	return desc
+}
+
+// SlowestStep returns the step which took the longest to execute, or nil if
+// the build has no steps.
+func (r *BuildResult) SlowestStep() *StepResult {
+	var slowest *StepResult
+	for i := range r.Steps {
+		if slowest == nil || r.Steps[i].Duration > slowest.Duration {
+			slowest = &r.Steps[i]
+		}
+	}
+	return slowest
+}
+
+// SlowestSteps returns up to n of the build's steps which took the longest to
+// execute, slowest first.
+func (r *BuildResult) SlowestSteps(n int) []StepResult {
+	steps := make([]StepResult, len(r.Steps))
+	copy(steps, r.Steps)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Duration > steps[j].Duration
+	})
+	if len(steps) > n {
+		steps = steps[:n]
+	}
+	return steps
+}
+
+// NewBuildResult will construct a BuildResult summarising the given Build.
+func NewBuildResult(build *cloudbuild.Build) (*BuildResult, error) {
+	result := &BuildResult{
+		Build:  build,
+		Status: build.Status,
+	}
+
+	var err error
+	if result.StartTime, err = parseTimestamp(build.StartTime); err != nil {
+		return nil, fmt.Errorf("invalid build start time: %w", err)
+	}
+	if result.FinishTime, err = parseTimestamp(build.FinishTime); err != nil {
+		return nil, fmt.Errorf("invalid build finish time: %w", err)
+	}
+	if !result.StartTime.IsZero() && !result.FinishTime.IsZero() {
+		result.Duration = result.FinishTime.Sub(result.StartTime)
+	}
+
+	for _, step := range build.Steps {
+		name := stepName(step)
+
+		duration, err := timeSpanDuration(step.Timing)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timing for step %q: %w", name, err)
+		}
+
+		result.Steps = append(result.Steps, StepResult{
+			Name:     name,
+			Status:   step.Status,
+			Duration: duration,
+		})
+	}
+
+	if build.Artifacts != nil && build.Artifacts.Objects != nil {
+		for _, p := range build.Artifacts.Objects.Paths {
+			result.Artifacts = append(result.Artifacts, strings.TrimSuffix(build.Artifacts.Objects.Location, "/")+"/"+path.Base(p))
+		}
+	}
+
+	if build.Results != nil {
+		for _, image := range build.Results.Images {
+			result.Images = append(result.Images, ImageResult{
+				Name:   image.Name,
+				Digest: image.Digest,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// WaitForBuildResult will wait for the GCB Build with the given ID to
+// complete using svc, as with WaitForBuildWithProgress, and return a summary
+// of the final Build.
+func WaitForBuildResult(ctx context.Context, svc Service, projectID string, id string, progress *StepProgress) (*BuildResult, error) {
+	build, err := svc.WaitForBuild(ctx, projectID, id, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBuildResult(build)
+}
+
+func timeSpanDuration(span *cloudbuild.TimeSpan) (time.Duration, error) {
+	if span == nil {
+		return 0, nil
+	}
+
+	start, err := parseTimestamp(span.StartTime)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := parseTimestamp(span.EndTime)
+	if err != nil {
+		return 0, err
+	}
+
+	if start.IsZero() || end.IsZero() {
+		return 0, nil
+	}
+
+	return end.Sub(start), nil
+}
+
+func parseTimestamp(ts string) (time.Time, error) {
+	if ts == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, ts)
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+func TestNewBuildResult(t *testing.T) {
+	tests := map[string]struct {
+		build             *cloudbuild.Build
+		expectedStatus    string
+		expectedDuration  time.Duration
+		expectedSteps     []StepResult
+		expectedSlowest   string
+		expectedArtifacts []string
+		expectedImages    []ImageResult
+		expectErr         bool
+	}{
+		"build with step timings": {
+			build: &cloudbuild.Build{
+				Status:     Success,
+				StartTime:  "2021-10-01T10:00:00.000Z",
+				FinishTime: "2021-10-01T10:40:00.000Z",
+				Steps: []*cloudbuild.BuildStep{
+					{
+						Id:     "clone",
+						Name:   "gcr.io/cloud-builders/git",
+						Status: Success,
+						Timing: &cloudbuild.TimeSpan{StartTime: "2021-10-01T10:00:00Z", EndTime: "2021-10-01T10:01:30Z"},
+					},
+					{
+						Name:   "gcr.io/cloud-builders/bazel",
+						Status: Success,
+						Timing: &cloudbuild.TimeSpan{StartTime: "2021-10-01T10:01:30Z", EndTime: "2021-10-01T10:39:00.5Z"},
+					},
+				},
+				Artifacts: &cloudbuild.Artifacts{
+					Objects: &cloudbuild.ArtifactObjects{
+						Location: "gs://my-bucket/stage/",
+						Paths:    []string{"out/cert-manager.tar.gz"},
+					},
+				},
+			},
+			expectedStatus:   Success,
+			expectedDuration: time.Minute * 40,
+			expectedSteps: []StepResult{
+				{Name: "clone", Status: Success, Duration: time.Second * 90},
+				{Name: "gcr.io/cloud-builders/bazel", Status: Success, Duration: time.Minute*37 + time.Second*30 + time.Millisecond*500},
+			},
+			expectedSlowest:   "gcr.io/cloud-builders/bazel",
+			expectedArtifacts: []string{"gs://my-bucket/stage/cert-manager.tar.gz"},
+		},
+		"build which pushed images": {
+			build: &cloudbuild.Build{
+				Status:     Success,
+				StartTime:  "2021-10-01T10:00:00Z",
+				FinishTime: "2021-10-01T10:30:00Z",
+				Steps: []*cloudbuild.BuildStep{
+					{
+						Id:     "build",
+						Status: Success,
+						Timing: &cloudbuild.TimeSpan{StartTime: "2021-10-01T10:00:00Z", EndTime: "2021-10-01T10:30:00Z"},
+					},
+				},
+				Results: &cloudbuild.Results{
+					Images: []*cloudbuild.BuiltImage{
+						{Name: "quay.io/jetstack/cert-manager-controller:v1.6.0", Digest: "sha256:1111"},
+						{Name: "quay.io/jetstack/cert-manager-webhook:v1.6.0", Digest: "sha256:2222"},
+					},
+				},
+			},
+			expectedStatus:   Success,
+			expectedDuration: time.Minute * 30,
+			expectedSteps: []StepResult{
+				{Name: "build", Status: Success, Duration: time.Minute * 30},
+			},
+			expectedSlowest: "build",
+			expectedImages: []ImageResult{
+				{Name: "quay.io/jetstack/cert-manager-controller:v1.6.0", Digest: "sha256:1111"},
+				{Name: "quay.io/jetstack/cert-manager-webhook:v1.6.0", Digest: "sha256:2222"},
+			},
+		},
+		"step which did not run has no duration": {
+			build: &cloudbuild.Build{
+				Status:     Failure,
+				StartTime:  "2021-10-01T10:00:00Z",
+				FinishTime: "2021-10-01T10:00:10Z",
+				Steps: []*cloudbuild.BuildStep{
+					{
+						Id:     "clone",
+						Status: Failure,
+						Timing: &cloudbuild.TimeSpan{StartTime: "2021-10-01T10:00:00Z", EndTime: "2021-10-01T10:00:10Z"},
+					},
+					{Id: "build", Status: "QUEUED"},
+				},
+			},
+			expectedStatus:   Failure,
+			expectedDuration: time.Second * 10,
+			expectedSteps: []StepResult{
+				{Name: "clone", Status: Failure, Duration: time.Second * 10},
+				{Name: "build", Status: "QUEUED"},
+			},
+			expectedSlowest: "clone",
+		},
+		"invalid timestamp should error": {
+			build: &cloudbuild.Build{
+				StartTime: "not-a-time",
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewBuildResult(test.build)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expectErr=%v, err=%v", test.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if result.Status != test.expectedStatus {
+				t.Errorf("wanted status %q but got %q", test.expectedStatus, result.Status)
+			}
+
+			if result.Duration != test.expectedDuration {
+				t.Errorf("wanted duration %s but got %s", test.expectedDuration, result.Duration)
+			}
+
+			if !reflect.DeepEqual(result.Steps, test.expectedSteps) {
+				t.Errorf("wanted steps %#v but got %#v", test.expectedSteps, result.Steps)
+			}
+
+			if slowest := result.SlowestStep(); slowest == nil || slowest.Name != test.expectedSlowest {
+				t.Errorf("wanted slowest step %q but got %#v", test.expectedSlowest, slowest)
+			}
+
+			if !reflect.DeepEqual(result.Artifacts, test.expectedArtifacts) {
+				t.Errorf("wanted artifacts %#v but got %#v", test.expectedArtifacts, result.Artifacts)
+			}
+
+			if !reflect.DeepEqual(result.Images, test.expectedImages) {
+				t.Errorf("wanted images %#v but got %#v", test.expectedImages, result.Images)
+			}
+		})
+	}
+}
+
+func TestSlowestSteps(t *testing.T) {
+	result := &BuildResult{
+		Steps: []StepResult{
+			{Name: "clone", Duration: time.Minute},
+			{Name: "build", Duration: time.Hour},
+			{Name: "skipped"},
+			{Name: "upload", Duration: 5 * time.Minute},
+		},
+	}
+
+	tests := map[string]struct {
+		n        int
+		expected []string
+	}{
+		"fewer than all steps": {n: 2, expected: []string{"build", "upload"}},
+		"more than all steps":  {n: 10, expected: []string{"build", "upload", "clone", "skipped"}},
+		"no steps":             {n: 0, expected: []string{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			steps := result.SlowestSteps(test.n)
+			names := make([]string, len(steps))
+			for i, step := range steps {
+				names[i] = step.Name
+			}
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("wanted steps %v but got %v", test.expected, names)
+			}
+		})
+	}
+
+	if result.Steps[0].Name != "clone" {
+		t.Errorf("SlowestSteps must not reorder the build's steps")
+	}
+}
+
+func TestBuildResultFailure(t *testing.T) {
+	tests := map[string]struct {
+		build    *cloudbuild.Build
+		expected string
+	}{
+		"succeeded": {
+			build:    &cloudbuild.Build{Status: Success, StatusDetail: "ignored"},
+			expected: "",
+		},
+		"status only": {
+			build:    &cloudbuild.Build{Status: Timeout},
+			expected: "TIMEOUT",
+		},
+		"failure info and status detail": {
+			build: &cloudbuild.Build{
+				Status:       Failure,
+				StatusDetail: "step exited with non-zero status: 1",
+				FailureInfo:  &cloudbuild.FailureInfo{Type: "USER_BUILD_STEP", Detail: "Build step failure"},
+			},
+			expected: "FAILURE (USER_BUILD_STEP): Build step failure; step exited with non-zero status: 1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := &BuildResult{Build: test.build, Status: test.build.Status}
+			if got := result.Failure(); got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}
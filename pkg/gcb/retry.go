@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/option"
+)
+
+// RetryOptions configures how requests to the Cloud Build API are retried
+// when they fail with a transient error.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of times a request will be retried.
+	// If zero, requests are never retried.
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry. The delay is doubled
+	// after each subsequent attempt.
+	BaseDelay time.Duration
+}
+
+// DefaultRetryOptions are the RetryOptions used when none are configured.
+var DefaultRetryOptions = RetryOptions{
+	MaxRetries: 5,
+	BaseDelay:  time.Second,
+}
+
+// ServiceInitTimeout is the maximum time NewService waits for application
+// default credentials to be resolved, which may otherwise hang indefinitely
+// if the environment's network is broken, e.g. while probing for the GCE
+// metadata server.
+const ServiceInitTimeout = 30 * time.Second
+
+// findDefaultCredentials is overridden in tests to simulate credential
+// resolution hanging.
+var findDefaultCredentials = google.FindDefaultCredentials
+
+// NewService builds a Cloud Build API client using default credentials,
+// which retries requests that fail with a transient error according to opts.
+// If region is set, the client uses the region's endpoint rather than the
+// global endpoint. An error is returned if ctx is done, or if the credentials
+// can't be resolved within ServiceInitTimeout.
+func NewService(ctx context.Context, region string, opts RetryOptions) (*cloudbuild.Service, error) {
+	creds, err := resolveDefaultCredentials(ctx, ServiceInitTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not create GCP OAuth2 client: %w", err)
+	}
+
+	client := oauth2.NewClient(ctx, creds.TokenSource)
+	client.Transport = NewRetryTransport(client.Transport, opts)
+
+	return newServiceWithClient(ctx, client, region)
+}
+
+// resolveDefaultCredentials finds application default credentials, giving up
+// after timeout or once ctx is done. The credentials are resolved using ctx
+// itself rather than a context bounded by timeout, as the returned token
+// source keeps using it to refresh tokens for the lifetime of the client.
+func resolveDefaultCredentials(ctx context.Context, timeout time.Duration) (*google.Credentials, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		creds *google.Credentials
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		creds, err := findDefaultCredentials(ctx, cloudbuild.CloudPlatformScope)
+		done <- result{creds: creds, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.creds, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out after %s resolving application default credentials", timeout)
+	}
+}
+
+func newServiceWithClient(ctx context.Context, client *http.Client, region string) (*cloudbuild.Service, error) {
+	clientOpts := []option.ClientOption{option.WithHTTPClient(client)}
+	if endpoint := RegionalEndpoint(region); endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoint))
+	}
+	return cloudbuild.NewService(ctx, clientOpts...)
+}
+
+// NewRetryTransport wraps base so that requests which fail with a retryable
+// status code are retried with exponential backoff. Requests are retried on
+// 429, which means the request wasn't processed, and idempotent requests are
+// also retried on 5xx. Other requests, such as the POST submitting a build,
+// aren't retried on 5xx since the server may have acted on them before
+// failing, e.g. starting a second build. Any other response, including errors
+// such as 400 or 403, is returned immediately.
+func NewRetryTransport(base http.RoundTripper, opts RetryOptions) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, opts: opts}
+}
+
+type retryTransport struct {
+	base http.RoundTripper
+	opts RetryOptions
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay := t.opts.BaseDelay
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("cannot retry %s %s: request body cannot be replayed", req.Method, req.URL)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || !isRetryableStatus(req.Method, resp.StatusCode) || attempt >= t.opts.MaxRetries {
+			return resp, err
+		}
+
+		log.Printf("DEBUG: %s %s returned %s, retrying in %s (attempt %d of %d)", req.Method, req.URL.Path, resp.Status, delay, attempt+1, t.opts.MaxRetries)
+
+		// drain the body so that the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func isRetryableStatus(method string, code int) bool {
+	if code == http.StatusTooManyRequests {
+		return true
+	}
+	if !isIdempotentMethod(method) {
+		return false
+	}
+	switch code {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return true
+	}
+	return false
+}
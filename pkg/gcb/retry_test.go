@@ -0,0 +1,260 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// sequenceRoundTripper returns a response with each of the given status
+// codes in turn, recording the body of each request it receives.
+type sequenceRoundTripper struct {
+	statusCodes []int
+	bodies      []string
+}
+
+func (s *sequenceRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(s.bodies) >= len(s.statusCodes) {
+		return nil, errors.New("unexpected request")
+	}
+	body := ""
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(b)
+	}
+	code := s.statusCodes[len(s.bodies)]
+	s.bodies = append(s.bodies, body)
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := map[string]struct {
+		method      string
+		statusCodes []int
+		maxRetries  int
+		expStatus   int
+		expAttempts int
+	}{
+		"succeeds first time": {
+			method:      http.MethodPost,
+			statusCodes: []int{200},
+			maxRetries:  3,
+			expStatus:   200,
+			expAttempts: 1,
+		},
+		"retries 503 then succeeds": {
+			method:      http.MethodGet,
+			statusCodes: []int{503, 503, 200},
+			maxRetries:  3,
+			expStatus:   200,
+			expAttempts: 3,
+		},
+		"retries 429 then succeeds": {
+			method:      http.MethodPost,
+			statusCodes: []int{429, 200},
+			maxRetries:  3,
+			expStatus:   200,
+			expAttempts: 2,
+		},
+		"does not replay a POST which returned 503": {
+			method:      http.MethodPost,
+			statusCodes: []int{503, 200},
+			maxRetries:  3,
+			expStatus:   503,
+			expAttempts: 1,
+		},
+		"retries DELETE on 502": {
+			method:      http.MethodDelete,
+			statusCodes: []int{502, 200},
+			maxRetries:  3,
+			expStatus:   200,
+			expAttempts: 2,
+		},
+		"gives up after max retries": {
+			method:      http.MethodGet,
+			statusCodes: []int{503, 503, 503},
+			maxRetries:  2,
+			expStatus:   503,
+			expAttempts: 3,
+		},
+		"does not retry 400": {
+			method:      http.MethodGet,
+			statusCodes: []int{400, 200},
+			maxRetries:  3,
+			expStatus:   400,
+			expAttempts: 1,
+		},
+		"does not retry 403": {
+			method:      http.MethodGet,
+			statusCodes: []int{403, 200},
+			maxRetries:  3,
+			expStatus:   403,
+			expAttempts: 1,
+		},
+		"zero retries disables retrying": {
+			method:      http.MethodGet,
+			statusCodes: []int{503, 200},
+			maxRetries:  0,
+			expStatus:   503,
+			expAttempts: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := &sequenceRoundTripper{statusCodes: test.statusCodes}
+			client := &http.Client{Transport: NewRetryTransport(fake, RetryOptions{MaxRetries: test.maxRetries, BaseDelay: time.Millisecond})}
+
+			req, err := http.NewRequest(test.method, "https://cloudbuild.example.com/v1/builds", strings.NewReader("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != test.expStatus {
+				t.Errorf("unexpected status code: got=%d, exp=%d", resp.StatusCode, test.expStatus)
+			}
+			if len(fake.bodies) != test.expAttempts {
+				t.Errorf("unexpected number of attempts: got=%d, exp=%d", len(fake.bodies), test.expAttempts)
+			}
+			for i, body := range fake.bodies {
+				if body != "body" {
+					t.Errorf("request %d had unexpected body %q", i, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransport_ContextCancelled(t *testing.T) {
+	fake := &sequenceRoundTripper{statusCodes: []int{503, 200}}
+	client := &http.Client{Transport: NewRetryTransport(fake, RetryOptions{MaxRetries: 3, BaseDelay: time.Hour})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://cloudbuild.example.com/v1/builds/abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline exceeded error but got: %v", err)
+	}
+	if len(fake.bodies) != 1 {
+		t.Errorf("expected a single attempt but got %d", len(fake.bodies))
+	}
+}
+
+// hostRecordingRoundTripper records the URL of each request it receives and
+// responds with an empty JSON object.
+type hostRecordingRoundTripper struct {
+	urls []string
+}
+
+func (h *hostRecordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.urls = append(h.urls, req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+	}, nil
+}
+
+func TestNewServiceWithClient(t *testing.T) {
+	tests := map[string]struct {
+		region  string
+		buildID string
+		expURL  string
+	}{
+		"global endpoint is used by default": {
+			buildID: "abc-123",
+			expURL:  "https://cloudbuild.googleapis.com/v1/projects/my-project/builds/abc-123?alt=json&prettyPrint=false",
+		},
+		"regional endpoint is used when a region is set": {
+			region:  "us-central1",
+			buildID: "projects/my-project/locations/us-central1/builds/abc-123",
+			expURL:  "https://us-central1-cloudbuild.googleapis.com/v1/projects/my-project/locations/us-central1/builds/abc-123?alt=json&prettyPrint=false",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := &hostRecordingRoundTripper{}
+			svc, err := newServiceWithClient(ctx, &http.Client{Transport: fake}, test.region)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := GetBuild(ctx, svc, "my-project", test.buildID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(fake.urls) != 1 || fake.urls[0] != test.expURL {
+				t.Errorf("unexpected requests: got=%q, exp=%q", fake.urls, test.expURL)
+			}
+		})
+	}
+}
+
+func TestNewService_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if _, err := NewService(ctx, "", DefaultRetryOptions); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context cancelled error but got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected NewService to return promptly but took %s", elapsed)
+	}
+}
+
+func TestResolveDefaultCredentials_Timeout(t *testing.T) {
+	defer func(f func(context.Context, ...string) (*google.Credentials, error)) { findDefaultCredentials = f }(findDefaultCredentials)
+	findDefaultCredentials = func(ctx context.Context, _ ...string) (*google.Credentials, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := resolveDefaultCredentials(ctx, time.Millisecond*10); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error but got: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+
+	"google.golang.org/api/cloudbuild/v1"
+)
+
+// Service is the subset of the Cloud Build API used to submit and monitor
+// builds. It allows commands to be tested against a fake implementation,
+// such as the one in the gcbfake package.
+type Service interface {
+	// SubmitBuild submits build, as with the SubmitBuild function.
+	SubmitBuild(ctx context.Context, projectID, region string, build *cloudbuild.Build) (*cloudbuild.Build, error)
+
+	// GetBuild fetches the current copy of a build, as with the GetBuild
+	// function.
+	GetBuild(ctx context.Context, projectID string, id string) (*cloudbuild.Build, error)
+
+	// WaitForBuild waits for a build to complete, as with the
+	// WaitForBuildWithProgress function.
+	WaitForBuild(ctx context.Context, projectID string, id string, progress *StepProgress) (*cloudbuild.Build, error)
+
+	// CancelBuild requests that a build is cancelled, as with the
+	// CancelBuild function.
+	CancelBuild(ctx context.Context, projectID string, id string) (*cloudbuild.Build, error)
+}
+
+// NewAPIService returns a Service which calls the Cloud Build API using svc,
+// as returned by NewService, and polls for builds to complete according to
+// poll.
+func NewAPIService(svc *cloudbuild.Service, poll PollOptions) Service {
+	return &apiService{svc: svc, poll: poll}
+}
+
+type apiService struct {
+	svc  *cloudbuild.Service
+	poll PollOptions
+}
+
+var _ Service = &apiService{}
+
+func (s *apiService) SubmitBuild(ctx context.Context, projectID, region string, build *cloudbuild.Build) (*cloudbuild.Build, error) {
+	return SubmitBuild(ctx, s.svc, projectID, region, build)
+}
+
+func (s *apiService) GetBuild(ctx context.Context, projectID string, id string) (*cloudbuild.Build, error) {
+	return GetBuild(ctx, s.svc, projectID, id)
+}
+
+func (s *apiService) WaitForBuild(ctx context.Context, projectID string, id string, progress *StepProgress) (*cloudbuild.Build, error) {
+	return WaitForBuildWithProgress(ctx, s.svc, projectID, id, s.poll, progress)
+}
+
+func (s *apiService) CancelBuild(ctx context.Context, projectID string, id string) (*cloudbuild.Build, error) {
+	return CancelBuild(ctx, s.svc, projectID, id)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package httpclient configures the HTTP transport used for all outbound
+// requests, so that cmrel can be run behind an egress proxy which uses a
+// custom certificate authority.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// NewTransport returns a copy of the default HTTP transport which uses a
+// proxy given by the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment
+// variables. If caCertFile is set, certificates in the PEM bundle it names
+// are trusted in addition to the system's root certificates.
+func NewTransport(caCertFile string) (*http.Transport, error) {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("default HTTP transport has unexpected type %T", http.DefaultTransport)
+	}
+
+	transport := base.Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if caCertFile != "" {
+		pool, err := loadCertPool(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return transport, nil
+}
+
+// NewClient returns an HTTP client which uses a transport built by
+// NewTransport.
+func NewClient(caCertFile string) (*http.Client, error) {
+	transport, err := NewTransport(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// SetDefault replaces http.DefaultTransport with a transport built by
+// NewTransport. The Google API clients and http.DefaultClient are all built
+// on http.DefaultTransport, so this configures every outbound request
+// without each client needing to be given the transport explicitly. It must
+// be called before any clients are created.
+func SetDefault(caCertFile string) error {
+	transport, err := NewTransport(caCertFile)
+	if err != nil {
+		return err
+	}
+	http.DefaultTransport = transport
+	return nil
+}
+
+// loadCertPool returns the system's root certificates, along with all of the
+// certificates in the PEM bundle at path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM encoded certificates found in CA certificate bundle %q", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,313 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging provides a logr.Logger which writes leveled log messages
+// in either a human-readable text format or as JSON.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// FormatText writes each message on a single line prefixed with a
+	// timestamp, in the same style as the standard library's log package.
+	FormatText = "text"
+
+	// FormatJSON writes each message as a single-line JSON object.
+	FormatJSON = "json"
+)
+
+// Formats is the list of all supported log formats.
+var Formats = []string{FormatText, FormatJSON}
+
+const (
+	// LevelError only logs errors.
+	LevelError = "error"
+
+	// LevelInfo logs errors and informational messages.
+	LevelInfo = "info"
+
+	// LevelDebug logs all messages, including those logged at DebugLevel.
+	LevelDebug = "debug"
+)
+
+// Levels is the list of all supported log levels.
+var Levels = []string{LevelError, LevelInfo, LevelDebug}
+
+// DebugLevel is the verbosity at which debug messages should be logged, i.e.
+// using logger.V(DebugLevel).Info(...).
+const DebugLevel = 1
+
+// textTimeFormat matches the timestamp written by the standard library's log
+// package with its default flags.
+const textTimeFormat = "2006/01/02 15:04:05"
+
+// New returns a logger which writes messages to w in the given format,
+// discarding any messages which are less severe than level.
+func New(w io.Writer, format, level string) (logr.Logger, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("invalid log format %q, must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+
+	var maxVerbosity int
+	switch level {
+	case LevelError:
+		maxVerbosity = -1
+	case LevelInfo:
+		maxVerbosity = 0
+	case LevelDebug:
+		maxVerbosity = DebugLevel
+	default:
+		return nil, fmt.Errorf("invalid log level %q, must be one of: %s", level, strings.Join(Levels, ", "))
+	}
+
+	return &logger{
+		out: &output{
+			w:            w,
+			format:       format,
+			maxVerbosity: maxVerbosity,
+			now:          time.Now,
+		},
+	}, nil
+}
+
+// output is shared between a logger and all loggers derived from it.
+type output struct {
+	mu           sync.Mutex
+	w            io.Writer
+	format       string
+	maxVerbosity int
+	now          func() time.Time
+}
+
+type logger struct {
+	out       *output
+	verbosity int
+	name      string
+	values    []interface{}
+}
+
+var _ logr.Logger = &logger{}
+
+func (l *logger) Enabled() bool {
+	return l.verbosity <= l.out.maxVerbosity
+}
+
+func (l *logger) Info(msg string, keysAndValues ...interface{}) {
+	if !l.Enabled() {
+		return
+	}
+
+	level := LevelInfo
+	if l.verbosity >= DebugLevel {
+		level = LevelDebug
+	}
+	l.write(level, msg, nil, keysAndValues)
+}
+
+func (l *logger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.write(LevelError, msg, err, keysAndValues)
+}
+
+func (l *logger) V(level int) logr.Logger {
+	c := *l
+	c.verbosity += level
+	return &c
+}
+
+func (l *logger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	c := *l
+	c.values = append(append([]interface{}{}, l.values...), keysAndValues...)
+	return &c
+}
+
+func (l *logger) WithName(name string) logr.Logger {
+	c := *l
+	if c.name == "" {
+		c.name = name
+	} else {
+		c.name = c.name + "/" + name
+	}
+	return &c
+}
+
+func (l *logger) write(level, msg string, err error, keysAndValues []interface{}) {
+	kvs := append(append([]interface{}{}, l.values...), keysAndValues...)
+	if err != nil {
+		kvs = append([]interface{}{"error", err.Error()}, kvs...)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	now := l.out.now()
+	if l.out.format == FormatJSON {
+		writeJSON(buf, now, level, l.name, msg, kvs)
+	} else {
+		writeText(buf, now, level, l.name, msg, kvs)
+	}
+	buf.WriteByte('\n')
+
+	// errors writing log output can't usefully be reported anywhere
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func writeText(buf *bytes.Buffer, now time.Time, level, name, msg string, kvs []interface{}) {
+	buf.WriteString(now.Format(textTimeFormat))
+	buf.WriteByte(' ')
+	switch level {
+	case LevelDebug:
+		buf.WriteString("DEBUG: ")
+	case LevelError:
+		buf.WriteString("ERROR: ")
+	}
+	if name != "" {
+		buf.WriteString(name)
+		buf.WriteString(": ")
+	}
+	buf.WriteString(msg)
+
+	for i := 0; i < len(kvs); i += 2 {
+		key, value := keyValue(kvs, i)
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		switch v := value.(type) {
+		case string:
+			fmt.Fprintf(buf, "%q", v)
+		case []string:
+			fmt.Fprintf(buf, "%q", v)
+		case fmt.Stringer:
+			fmt.Fprintf(buf, "%q", v.String())
+		default:
+			fmt.Fprintf(buf, "%v", v)
+		}
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level, name, msg string, kvs []interface{}) {
+	fields := []interface{}{"ts", now.UTC().Format(time.RFC3339Nano), "level", level}
+	if name != "" {
+		fields = append(fields, "logger", name)
+	}
+	fields = append(append(fields, "msg", msg), kvs...)
+
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		key, value := keyValue(fields, i)
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		encodedKey, _ := json.Marshal(key)
+		encodedValue, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			encodedValue, _ = json.Marshal(fmt.Sprintf("%+v", value))
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+}
+
+// jsonValue returns the value which should be encoded to represent v in JSON
+// output. Errors, and types such as time.Duration which implement
+// fmt.Stringer but not json.Marshaler, are encoded as strings.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case json.Marshaler:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+// keyValue returns the key and value at index i of a list of alternating
+// keys and values, tolerating keys which aren't strings and a missing final
+// value.
+func keyValue(kvs []interface{}, i int) (string, interface{}) {
+	key, ok := kvs[i].(string)
+	if !ok {
+		key = fmt.Sprintf("%v", kvs[i])
+	}
+	if i+1 >= len(kvs) {
+		return key, "(MISSING)"
+	}
+	return key, kvs[i+1]
+}
+
+// NewStdWriter returns a writer which logs each line written to it as an
+// informational message of logger at the given verbosity. It is intended to
+// be set as the output of the standard library's log package, with all flags
+// disabled, so that code which hasn't been migrated to use a logr.Logger has
+// its output written in the same format and filtered at the same level.
+// Lines prefixed with "DEBUG: " are logged at DebugLevel with the prefix
+// removed, and lines prefixed with "WARNING: " are always logged at
+// verbosity 0.
+func NewStdWriter(logger logr.Logger, verbosity int) io.Writer {
+	return &stdWriter{logger: logger, verbosity: verbosity}
+}
+
+type stdWriter struct {
+	mu        sync.Mutex
+	logger    logr.Logger
+	verbosity int
+	partial   []byte
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Writes may contain several lines or only part of a line, e.g. when
+	// written using a tabwriter, so only complete lines are logged.
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.logLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *stdWriter) logLine(line string) {
+	switch {
+	case strings.HasPrefix(line, "DEBUG: "):
+		w.logger.V(DebugLevel).Info(strings.TrimPrefix(line, "DEBUG: "))
+	case strings.HasPrefix(line, "WARNING: "):
+		w.logger.Info(line)
+	default:
+		w.logger.V(w.verbosity).Info(line)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+var fixedTime = time.Date(2021, 10, 14, 12, 30, 0, 0, time.UTC)
+
+func newTestLogger(t *testing.T, format, level string) (logr.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l, err := New(buf, format, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*logger).out.now = func() time.Time { return fixedTime }
+	return l, buf
+}
+
+func TestLogger(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		level  string
+		log    func(l logr.Logger)
+		exp    string
+	}{
+		"text info with key/values": {
+			format: FormatText,
+			level:  LevelInfo,
+			log: func(l logr.Logger) {
+				l.Info("Stage options", "Bucket", "my-bucket", "Keys", []string{"a", "b"}, "DryRun", true)
+			},
+			exp: `2021/10/14 12:30:00 Stage options Bucket="my-bucket" Keys=["a" "b"] DryRun=true` + "\n",
+		},
+		"text debug is discarded at info level": {
+			format: FormatText,
+			level:  LevelInfo,
+			log: func(l logr.Logger) {
+				l.V(DebugLevel).Info("building client")
+			},
+			exp: "",
+		},
+		"text debug is written at debug level": {
+			format: FormatText,
+			level:  LevelDebug,
+			log: func(l logr.Logger) {
+				l.V(DebugLevel).Info("building client")
+			},
+			exp: "2021/10/14 12:30:00 DEBUG: building client\n",
+		},
+		"text error with name and values": {
+			format: FormatText,
+			level:  LevelError,
+			log: func(l logr.Logger) {
+				l.WithName("stage").WithValues("id", 42).Info("discarded")
+				l.WithName("stage").WithValues("id", 42).Error(errors.New("boom"), "build failed")
+			},
+			exp: `2021/10/14 12:30:00 ERROR: stage: build failed error="boom" id=42` + "\n",
+		},
+		"json info": {
+			format: FormatJSON,
+			level:  LevelInfo,
+			log: func(l logr.Logger) {
+				l.WithName("gcb").Info("Submitted build", "id", "abc", "steps", 3, "timeout", 2*time.Hour)
+			},
+			exp: `{"ts":"2021-10-14T12:30:00Z","level":"info","logger":"gcb","msg":"Submitted build","id":"abc","steps":3,"timeout":"2h0m0s"}` + "\n",
+		},
+		"json error with missing value": {
+			format: FormatJSON,
+			level:  LevelInfo,
+			log: func(l logr.Logger) {
+				l.Error(fmt.Errorf("wrapped: %w", errors.New("boom")), "failed", "dangling")
+			},
+			exp: `{"ts":"2021-10-14T12:30:00Z","level":"error","msg":"failed","error":"wrapped: boom","dangling":"(MISSING)"}` + "\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			l, buf := newTestLogger(t, test.format, test.level)
+			test.log(l)
+			if buf.String() != test.exp {
+				t.Errorf("unexpected output:\ngot: %q\nexp: %q", buf.String(), test.exp)
+			}
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "yaml", LevelInfo); err == nil {
+		t.Errorf("expected an error for an invalid format")
+	}
+	if _, err := New(&bytes.Buffer{}, FormatText, "trace"); err == nil {
+		t.Errorf("expected an error for an invalid level")
+	}
+}
+
+func TestStdWriter(t *testing.T) {
+	l, buf := newTestLogger(t, FormatJSON, LevelDebug)
+	w := NewStdWriter(l, 0)
+
+	fmt.Fprint(w, "first line\nDEBUG: second")
+	fmt.Fprint(w, " line\n")
+	fmt.Fprint(w, "incomplete")
+
+	exp := `{"ts":"2021-10-14T12:30:00Z","level":"info","msg":"first line"}` + "\n" +
+		`{"ts":"2021-10-14T12:30:00Z","level":"debug","msg":"second line"}` + "\n"
+	if buf.String() != exp {
+		t.Errorf("unexpected output:\ngot: %q\nexp: %q", buf.String(), exp)
+	}
+}
+
+func TestStdWriter_Verbosity(t *testing.T) {
+	l, buf := newTestLogger(t, FormatText, LevelInfo)
+	w := NewStdWriter(l, DebugLevel)
+
+	fmt.Fprint(w, "progress\nDEBUG: detail\nWARNING: something odd\n")
+
+	exp := "2021/10/14 12:30:00 WARNING: something odd\n"
+	if buf.String() != exp {
+		t.Errorf("unexpected output:\ngot: %q\nexp: %q", buf.String(), exp)
+	}
+}
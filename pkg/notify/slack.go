@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications about the outcome of release builds.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cert-manager/release/pkg/gcb"
+)
+
+// SlackMessage is the payload posted to a Slack incoming webhook.
+type SlackMessage struct {
+	Text string `json:"text"`
+}
+
+// StageBuildInfo describes the release a stage build was building, which
+// isn't recorded in the gcb.BuildResult itself.
+type StageBuildInfo struct {
+	// ReleaseVersion is the version being staged, or empty for a devel build.
+	ReleaseVersion string
+
+	// Branch is the branch the release was built from.
+	Branch string
+}
+
+// NewStageBuildMessage returns the Slack message announcing that the stage
+// build summarised by result has completed, whether or not it succeeded.
+func NewStageBuildMessage(info StageBuildInfo, result *gcb.BuildResult) SlackMessage {
+	version := info.ReleaseVersion
+	if version == "" {
+		version = "devel"
+	}
+
+	icon := ":x:"
+	if result.Succeeded() {
+		icon = ":white_check_mark:"
+	}
+
+	logURL := ""
+	if result.Build != nil {
+		logURL = result.Build.LogUrl
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s cert-manager %s stage build finished with status *%s*", icon, version, result.Status),
+		fmt.Sprintf("Branch: `%s`", info.Branch),
+		fmt.Sprintf("Duration: %s", result.Duration.Round(time.Second)),
+	}
+	if logURL != "" {
+		lines = append(lines, fmt.Sprintf("Logs: <%s|view build logs>", logURL))
+	}
+
+	return SlackMessage{Text: strings.Join(lines, "\n")}
+}
+
+// ValidateSlackWebhookURL returns an error if webhookURL isn't an absolute
+// https URL, as given for Slack incoming webhooks.
+func ValidateSlackWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute https URL", webhookURL)
+	}
+	return nil
+}
+
+// PostSlackMessage posts msg to the Slack incoming webhook at webhookURL,
+// returning an error if the webhook doesn't accept it.
+// The request is cancelled if ctx is done before it completes.
+func PostSlackMessage(ctx context.Context, webhookURL string, msg SlackMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Slack describes why a message was rejected in the response body
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("slack webhook returned %s: %s", resp.Status, strings.TrimSpace(string(reason)))
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudbuild/v1"
+
+	"github.com/cert-manager/release/pkg/gcb"
+)
+
+func TestNewStageBuildMessage(t *testing.T) {
+	tests := map[string]struct {
+		info   StageBuildInfo
+		result *gcb.BuildResult
+		exp    string
+	}{
+		"successful release build": {
+			info: StageBuildInfo{ReleaseVersion: "v1.6.0", Branch: "release-1.6"},
+			result: &gcb.BuildResult{
+				Build:    &cloudbuild.Build{LogUrl: "https://console.cloud.google.com/build/abc"},
+				Status:   gcb.Success,
+				Duration: 42*time.Minute + 10*time.Second + 300*time.Millisecond,
+			},
+			exp: ":white_check_mark: cert-manager v1.6.0 stage build finished with status *SUCCESS*\n" +
+				"Branch: `release-1.6`\n" +
+				"Duration: 42m10s\n" +
+				"Logs: <https://console.cloud.google.com/build/abc|view build logs>",
+		},
+		"failed devel build without a log URL": {
+			info: StageBuildInfo{Branch: "master"},
+			result: &gcb.BuildResult{
+				Status:   "FAILURE",
+				Duration: time.Minute,
+			},
+			exp: ":x: cert-manager devel stage build finished with status *FAILURE*\n" +
+				"Branch: `master`\n" +
+				"Duration: 1m0s",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			msg := NewStageBuildMessage(test.info, test.result)
+			if msg.Text != test.exp {
+				t.Errorf("unexpected message:\ngot: %q\nexp: %q", msg.Text, test.exp)
+			}
+		})
+	}
+}
+
+func TestValidateSlackWebhookURL(t *testing.T) {
+	tests := map[string]struct {
+		url       string
+		expectErr bool
+	}{
+		"valid webhook":   {url: "https://hooks.slack.com/services/T000/B000/XXXX"},
+		"http is invalid": {url: "http://hooks.slack.com/services/T000/B000/XXXX", expectErr: true},
+		"relative url":    {url: "hooks.slack.com/services/T000", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSlackWebhookURL(test.url)
+			if (err != nil) != test.expectErr {
+				t.Errorf("expectErr=%v, err=%v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestPostSlackMessage(t *testing.T) {
+	var received SlackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode message: %v", err)
+		}
+		if received.Text == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid_payload\n"))
+		}
+	}))
+	defer server.Close()
+
+	if err := PostSlackMessage(context.Background(), server.URL, SlackMessage{Text: "hello"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.Text != "hello" {
+		t.Errorf("expected message to be posted but got %+v", received)
+	}
+
+	err := PostSlackMessage(context.Background(), server.URL, SlackMessage{Text: "bad"})
+	if err == nil || !strings.Contains(err.Error(), "invalid_payload") {
+		t.Errorf("expected an error containing the rejection reason but got: %v", err)
+	}
+}
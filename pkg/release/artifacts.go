@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ManifestsArtifactName is the name of the release artifact containing the
+// Helm chart and static Kubernetes manifests.
+const ManifestsArtifactName = "cert-manager-manifests.tar.gz"
+
+const (
+	// ArtifactTypeImages selects the per-architecture server tarballs, which
+	// contain the release's container images.
+	ArtifactTypeImages = "images"
+
+	// ArtifactTypeTarballs selects the per-OS and architecture client CLI
+	// tarballs.
+	ArtifactTypeTarballs = "tarballs"
+
+	// ArtifactTypeCharts selects the manifests tarball containing the Helm
+	// chart and static Kubernetes manifests.
+	ArtifactTypeCharts = "charts"
+)
+
+// ArtifactTypes is the list of all types of artifact which can be selected
+// when staging a release.
+var ArtifactTypes = []string{ArtifactTypeImages, ArtifactTypeTarballs, ArtifactTypeCharts}
+
+// ArtifactTypesFromString parses and validates a comma-separated list of
+// artifact types. As with OSListFromString, '*' includes all types and types
+// prefixed with '!' are removed from the list. An empty string selects all
+// artifact types.
+func ArtifactTypesFromString(artifactTypes string) (sets.String, error) {
+	if strings.TrimSpace(artifactTypes) == "" {
+		return sets.NewString(ArtifactTypes...), nil
+	}
+
+	typesOut, err := parseTargetList(artifactTypes, sets.NewString(ArtifactTypes...), func(rawType string) error {
+		return fmt.Errorf("unknown artifact type %q, must be one of: %s", rawType, strings.Join(ArtifactTypes, ", "))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(typesOut) == 0 {
+		return nil, fmt.Errorf("invalid artifact type list; no artifact types specified")
+	}
+
+	return typesOut, nil
+}
+
+// ClientArtifactKinds is the list of client CLI tools built for each client
+// OS and architecture.
+var ClientArtifactKinds = []string{"kubectl-cert_manager", "cmctl"}
+
+// ServerArtifactName returns the name of the release artifact containing the
+// server binaries and images for the given architecture.
+func ServerArtifactName(arch string) string {
+	return fmt.Sprintf("cert-manager-server-linux-%s.tar.gz", arch)
+}
+
+// ClientArtifactName returns the name of the release artifact containing the
+// given kind of client CLI tool for the given OS and architecture.
+func ClientArtifactName(kind, os, arch string) string {
+	return fmt.Sprintf("cert-manager-%s-%s-%s.tar.gz", kind, os, arch)
+}
+
+// ExpectedArtifactNames returns the sorted names of all release artifacts
+// that are built when staging a release of the given artifact types for the
+// given OSes and architectures.
+func ExpectedArtifactNames(artifactTypes, targetOSes, targetArches sets.String) []string {
+	names := sets.NewString()
+	if artifactTypes.Has(ArtifactTypeCharts) {
+		names.Insert(ManifestsArtifactName)
+	}
+	for _, platform := range TargetPlatforms(targetOSes, targetArches) {
+		if IsServerOS(platform.OS) && artifactTypes.Has(ArtifactTypeImages) {
+			names.Insert(ServerArtifactName(platform.Arch))
+		}
+		if IsClientOS(platform.OS) && artifactTypes.Has(ArtifactTypeTarballs) {
+			for _, kind := range ClientArtifactKinds {
+				names.Insert(ClientArtifactName(kind, platform.OS, platform.Arch))
+			}
+		}
+	}
+	return names.List()
+}
+
+// MissingPlatforms returns each of the platforms targeted by a release of
+// the given artifact types, OSes and architectures for which any of its
+// artifacts, staged with the given compression option, are named in missing.
+// OS and architecture independent artifacts, i.e. the manifests tarball, are
+// ignored.
+func MissingPlatforms(artifactTypes, targetOSes, targetArches sets.String, compression string, missing []string) []Platform {
+	missingNames := sets.NewString(missing...)
+	platformTypes := artifactTypes.Difference(sets.NewString(ArtifactTypeCharts))
+
+	var platforms []Platform
+	for _, platform := range TargetPlatforms(targetOSes, targetArches) {
+		names := ExpectedArtifactNames(platformTypes, sets.NewString(platform.OS), sets.NewString(platform.Arch))
+		if missingNames.HasAny(CompressedArtifactNames(names, compression)...) {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// DefaultMinArtifactBytes is the default minimum size of a release artifact,
+// below which it's assumed to have been truncated or packaged incorrectly.
+// Every real artifact is several orders of magnitude larger.
+const DefaultMinArtifactBytes = 10 * 1024
+
+// UndersizedArtifact is a release artifact which is smaller than expected.
+type UndersizedArtifact struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// UndersizedArtifacts returns each of the named artifacts whose size, as
+// given by sizes, is less than minBytes, sorted by name. Artifacts which are
+// not in sizes are ignored, since they will be reported as missing.
+func UndersizedArtifacts(names []string, sizes map[string]int64, minBytes int64) []UndersizedArtifact {
+	var undersized []UndersizedArtifact
+	for _, name := range sets.NewString(names...).List() {
+		size, ok := sizes[name]
+		if ok && size < minBytes {
+			undersized = append(undersized, UndersizedArtifact{Name: name, Size: size})
+		}
+	}
+	return undersized
+}
+
+// DiffNames compares a list of expected names against a list of actual
+// names, returning the sorted names which are missing from actual and those
+// which are present in actual but not expected.
+func DiffNames(expected, actual []string) (missing []string, extra []string) {
+	expectedSet, actualSet := sets.NewString(expected...), sets.NewString(actual...)
+	missing = expectedSet.Difference(actualSet).List()
+	extra = actualSet.Difference(expectedSet).List()
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
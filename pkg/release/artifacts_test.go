@@ -0,0 +1,260 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestExpectedArtifactNames(t *testing.T) {
+	tests := map[string]struct {
+		types    []string
+		oses     []string
+		arches   []string
+		expected []string
+	}{
+		"linux amd64": {
+			oses:   []string{"linux"},
+			arches: []string{"amd64"},
+			expected: []string{
+				"cert-manager-cmctl-linux-amd64.tar.gz",
+				"cert-manager-kubectl-cert_manager-linux-amd64.tar.gz",
+				"cert-manager-manifests.tar.gz",
+				"cert-manager-server-linux-amd64.tar.gz",
+			},
+		},
+		"client only OS does not include server artifacts": {
+			oses:   []string{"darwin"},
+			arches: []string{"arm64"},
+			expected: []string{
+				"cert-manager-cmctl-darwin-arm64.tar.gz",
+				"cert-manager-kubectl-cert_manager-darwin-arm64.tar.gz",
+				"cert-manager-manifests.tar.gz",
+			},
+		},
+		"freebsd builds client artifacts": {
+			oses:   []string{"freebsd"},
+			arches: []string{"amd64", "arm64"},
+			expected: []string{
+				"cert-manager-cmctl-freebsd-amd64.tar.gz",
+				"cert-manager-cmctl-freebsd-arm64.tar.gz",
+				"cert-manager-kubectl-cert_manager-freebsd-amd64.tar.gz",
+				"cert-manager-kubectl-cert_manager-freebsd-arm64.tar.gz",
+				"cert-manager-manifests.tar.gz",
+			},
+		},
+		"only images": {
+			types:  []string{ArtifactTypeImages},
+			oses:   []string{"linux", "darwin"},
+			arches: []string{"amd64"},
+			expected: []string{
+				"cert-manager-server-linux-amd64.tar.gz",
+			},
+		},
+		"tarballs and charts": {
+			types:  []string{ArtifactTypeTarballs, ArtifactTypeCharts},
+			oses:   []string{"linux"},
+			arches: []string{"arm64"},
+			expected: []string{
+				"cert-manager-cmctl-linux-arm64.tar.gz",
+				"cert-manager-kubectl-cert_manager-linux-arm64.tar.gz",
+				"cert-manager-manifests.tar.gz",
+			},
+		},
+		"arches not supported by an OS are skipped": {
+			oses:   []string{"windows"},
+			arches: []string{"amd64", "s390x"},
+			expected: []string{
+				"cert-manager-cmctl-windows-amd64.tar.gz",
+				"cert-manager-kubectl-cert_manager-windows-amd64.tar.gz",
+				"cert-manager-manifests.tar.gz",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			types := test.types
+			if types == nil {
+				types = ArtifactTypes
+			}
+			got := ExpectedArtifactNames(sets.NewString(types...), sets.NewString(test.oses...), sets.NewString(test.arches...))
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("unexpected artifact names:\ngot: %v\nexp: %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestArtifactTypesFromString(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		expected  []string
+		expectErr bool
+	}{
+		"empty selects all types": {
+			input:    "",
+			expected: []string{"charts", "images", "tarballs"},
+		},
+		"asterisk selects all types": {
+			input:    "*",
+			expected: []string{"charts", "images", "tarballs"},
+		},
+		"single type": {
+			input:    "images",
+			expected: []string{"images"},
+		},
+		"multiple types with whitespace and case": {
+			input:    " Tarballs, charts ",
+			expected: []string{"charts", "tarballs"},
+		},
+		"negated type": {
+			input:    "*,!images",
+			expected: []string{"charts", "tarballs"},
+		},
+		"unknown type errors": {
+			input:     "images,binaries",
+			expectErr: true,
+		},
+		"all types negated errors": {
+			input:     "*,!images,!tarballs,!charts",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ArtifactTypesFromString(test.input)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.List(), test.expected) {
+				t.Errorf("unexpected artifact types:\ngot: %v\nexp: %v", got.List(), test.expected)
+			}
+		})
+	}
+}
+
+func TestUndersizedArtifacts(t *testing.T) {
+	sizes := map[string]int64{
+		"cert-manager-server-linux-amd64.tar.gz": 200 * 1024 * 1024,
+		"cert-manager-server-linux-arm64.tar.gz": 512,
+		"cert-manager-manifests.tar.gz":          0,
+		"metadata.json":                          100,
+	}
+
+	tests := map[string]struct {
+		names    []string
+		minBytes int64
+		exp      []UndersizedArtifact
+	}{
+		"small and empty artifacts are reported": {
+			names:    []string{"cert-manager-server-linux-amd64.tar.gz", "cert-manager-server-linux-arm64.tar.gz", "cert-manager-manifests.tar.gz"},
+			minBytes: DefaultMinArtifactBytes,
+			exp: []UndersizedArtifact{
+				{Name: "cert-manager-manifests.tar.gz", Size: 0},
+				{Name: "cert-manager-server-linux-arm64.tar.gz", Size: 512},
+			},
+		},
+		"files which aren't named are ignored": {
+			names:    []string{"cert-manager-server-linux-amd64.tar.gz"},
+			minBytes: DefaultMinArtifactBytes,
+		},
+		"missing artifacts are ignored": {
+			names:    []string{"cert-manager-server-linux-s390x.tar.gz"},
+			minBytes: DefaultMinArtifactBytes,
+		},
+		"zero minimum disables the check": {
+			names:    []string{"cert-manager-manifests.tar.gz"},
+			minBytes: 0,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := UndersizedArtifacts(test.names, sizes, test.minBytes)
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected %+v but got %+v", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestMissingPlatforms(t *testing.T) {
+	tests := map[string]struct {
+		artifactTypes sets.String
+		compression   string
+		missing       []string
+		exp           []Platform
+	}{
+		"nothing missing": {
+			artifactTypes: sets.NewString(ArtifactTypes...),
+			compression:   CompressionGzip,
+			missing:       []string{"metadata.json"},
+		},
+		"missing artifacts are grouped by platform": {
+			artifactTypes: sets.NewString(ArtifactTypes...),
+			compression:   CompressionGzip,
+			missing: []string{
+				"cert-manager-server-linux-arm64.tar.gz",
+				"cert-manager-cmctl-darwin-amd64.tar.gz",
+			},
+			exp: []Platform{{OS: "darwin", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}},
+		},
+		"missing manifests tarball isn't specific to a platform": {
+			artifactTypes: sets.NewString(ArtifactTypes...),
+			compression:   CompressionGzip,
+			missing:       []string{ManifestsArtifactName},
+		},
+		"zstd artifacts are matched": {
+			artifactTypes: sets.NewString(ArtifactTypeImages),
+			compression:   CompressionBoth,
+			missing:       []string{"cert-manager-server-linux-amd64.tar.zst"},
+			exp:           []Platform{{OS: "linux", Arch: "amd64"}},
+		},
+		"artifacts of types which weren't built are ignored": {
+			artifactTypes: sets.NewString(ArtifactTypeTarballs),
+			compression:   CompressionGzip,
+			missing:       []string{"cert-manager-server-linux-amd64.tar.gz"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := MissingPlatforms(test.artifactTypes, sets.NewString("darwin", "linux"), sets.NewString("amd64", "arm64"), test.compression, test.missing)
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected %v but got %v", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestDiffNames(t *testing.T) {
+	missing, extra := DiffNames([]string{"a", "b", "c"}, []string{"c", "d", "a"})
+	if !reflect.DeepEqual(missing, []string{"b"}) {
+		t.Errorf("unexpected missing names: %v", missing)
+	}
+	if !reflect.DeepEqual(extra, []string{"d"}) {
+		t.Errorf("unexpected extra names: %v", extra)
+	}
+}
@@ -19,7 +19,9 @@ package release
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/google/martian/log"
@@ -27,12 +29,92 @@ import (
 )
 
 type Bucket struct {
-	bucket *storage.BucketHandle
-	prefix string
+	bucket      *storage.BucketHandle
+	prefix      string
+	releaseType string
 }
 
 func NewBucket(bucket *storage.BucketHandle, prefix, releaseType string) *Bucket {
-	return &Bucket{bucket: bucket, prefix: fmt.Sprintf("%s/%s/", prefix, releaseType)}
+	return &Bucket{bucket: bucket, prefix: fmt.Sprintf("%s/%s/", prefix, releaseType), releaseType: releaseType}
+}
+
+// Summary describes the objects that make up a single staged release. Unlike
+// Staged, constructing a Summary does not require the release's metadata file
+// to be downloaded.
+type Summary struct {
+	// Name is the name of the release, as accepted by GetRelease.
+	Name string
+
+	// BuildType is the type of the release, e.g. 'release', 'prerelease' or
+	// 'devel'.
+	BuildType string
+
+	// ReleaseVersion is the version of the release as encoded in its name.
+	// It is empty for devel builds.
+	ReleaseVersion string
+
+	// GitRef is the git commit ref the release was built from, as encoded in
+	// its name.
+	GitRef string
+
+	// Objects is the number of objects in the release.
+	Objects int
+
+	// Size is the total size in bytes of all objects in the release.
+	Size int64
+
+	// Updated is the time at which the most recently modified object in the
+	// release was last modified.
+	Updated time.Time
+}
+
+// ListSummaries will return a Summary of every release in the bucket.
+func (b *Bucket) ListSummaries(ctx context.Context) ([]Summary, error) {
+	summaries := map[string]*Summary{}
+	var names []string
+	objs := b.bucket.Objects(ctx, &storage.Query{Prefix: b.prefix})
+	for {
+		objAttr, err := objs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := NameForObjectPath(objAttr.Name, b.prefix)
+		summary, ok := summaries[name]
+		if !ok {
+			version, gitRef := ParseReleaseName(b.releaseType, name)
+			summary = &Summary{Name: name, BuildType: b.releaseType, ReleaseVersion: version, GitRef: gitRef}
+			summaries[name] = summary
+			names = append(names, name)
+		}
+		summary.Objects++
+		summary.Size += objAttr.Size
+		if objAttr.Updated.After(summary.Updated) {
+			summary.Updated = objAttr.Updated
+		}
+	}
+
+	out := make([]Summary, len(names))
+	for i, name := range names {
+		out[i] = *summaries[name]
+	}
+	return out, nil
+}
+
+// ParseReleaseName will split the name of a release of the given build type
+// into its release version and git commit ref, inverting the naming used by
+// BucketPathForRelease. Devel releases do not encode a version.
+func ParseReleaseName(buildType, name string) (string, string) {
+	if buildType == BuildTypeDevel {
+		return "", name
+	}
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
 }
 
 // GetRelease will fetch a single release from the bucket with the given name.
@@ -115,3 +197,44 @@ func pathSuffixForVersion(version, gitRef string) string {
 	}
 	return version + "-" + gitRef
 }
+
+// SelectExpired returns the releases in summaries which should be removed
+// when retaining only releases last updated within maxAge of now and only
+// the keepLast most recently updated releases. A release is selected if it
+// falls outside either limit, and a zero maxAge or keepLast disables that
+// limit. The returned releases are ordered with the most recently updated
+// first.
+func SelectExpired(summaries []Summary, now time.Time, maxAge time.Duration, keepLast int) []Summary {
+	sorted := make([]Summary, len(summaries))
+	copy(sorted, summaries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Updated.After(sorted[j].Updated)
+	})
+
+	var expired []Summary
+	for i, s := range sorted {
+		tooOld := maxAge > 0 && now.Sub(s.Updated) > maxAge
+		tooMany := keepLast > 0 && i >= keepLast
+		if tooOld || tooMany {
+			expired = append(expired, s)
+		}
+	}
+	return expired
+}
+
+// DeleteRelease will delete every object belonging to the release with the
+// given name, returning the number of objects deleted.
+func (b *Bucket) DeleteRelease(ctx context.Context, name string) (int, error) {
+	objs, err := ListObjects(ctx, b.bucket, b.prefix+name+"/")
+	if err != nil {
+		return 0, err
+	}
+
+	for i, obj := range objs {
+		if err := b.bucket.Object(obj.Name).Delete(ctx); err != nil {
+			return i, fmt.Errorf("failed to delete %q: %w", obj.Name, err)
+		}
+	}
+
+	return len(objs), nil
+}
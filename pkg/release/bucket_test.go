@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseReleaseName(t *testing.T) {
+	const ref = "614438aed00e1060870b273f2238794ef69b60ab"
+	tests := map[string]struct {
+		buildType  string
+		name       string
+		expVersion string
+		expGitRef  string
+	}{
+		"release": {
+			buildType:  BuildTypeRelease,
+			name:       "v1.3.1-" + ref,
+			expVersion: "v1.3.1",
+			expGitRef:  ref,
+		},
+		"prerelease": {
+			buildType:  BuildTypeRelease,
+			name:       "v1.3.0-alpha.1-" + ref,
+			expVersion: "v1.3.0-alpha.1",
+			expGitRef:  ref,
+		},
+		"prerelease build type": {
+			buildType:  BuildTypePrerelease,
+			name:       "v1.3.0-beta.0-" + ref,
+			expVersion: "v1.3.0-beta.0",
+			expGitRef:  ref,
+		},
+		"devel": {
+			buildType: BuildTypeDevel,
+			name:      ref,
+			expGitRef: ref,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, gitRef := ParseReleaseName(test.buildType, test.name)
+			if version != test.expVersion || gitRef != test.expGitRef {
+				t.Errorf("unexpected result: got=(%q, %q), exp=(%q, %q)", version, gitRef, test.expVersion, test.expGitRef)
+			}
+
+			// the name must round trip through BucketPathForRelease
+			if p := BucketPathForRelease(DefaultBucketPathPrefix, test.buildType, version, gitRef); path.Base(p) != test.name {
+				t.Errorf("name did not round trip: got=%q, exp=%q", path.Base(p), test.name)
+			}
+		})
+	}
+}
+
+func TestSelectExpired(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	summaries := []Summary{
+		{Name: "two-days", Updated: now.Add(-time.Hour * 48)},
+		{Name: "one-hour", Updated: now.Add(-time.Hour)},
+		{Name: "one-week", Updated: now.Add(-time.Hour * 24 * 7)},
+		{Name: "one-day", Updated: now.Add(-time.Hour * 24)},
+	}
+
+	tests := map[string]struct {
+		maxAge   time.Duration
+		keepLast int
+		expNames []string
+	}{
+		"no limits selects nothing": {},
+		"max age selects older builds": {
+			maxAge:   time.Hour * 36,
+			expNames: []string{"two-days", "one-week"},
+		},
+		"keep last selects all but the newest builds": {
+			keepLast: 1,
+			expNames: []string{"one-day", "two-days", "one-week"},
+		},
+		"either limit selects a build": {
+			maxAge:   time.Hour * 72,
+			keepLast: 2,
+			expNames: []string{"two-days", "one-week"},
+		},
+		"keep last larger than the number of builds selects nothing": {
+			keepLast: 10,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var names []string
+			for _, s := range SelectExpired(summaries, now, test.maxAge, test.keepLast) {
+				names = append(names, s.Name)
+			}
+			if !reflect.DeepEqual(names, test.expNames) {
+				t.Errorf("unexpected builds selected: got=%v, exp=%v", names, test.expNames)
+			}
+		})
+	}
+}
+
+func TestNormalizeBucketPathPrefix(t *testing.T) {
+	tests := map[string]struct {
+		prefix    string
+		expected  string
+		expectErr bool
+	}{
+		"default prefix is unchanged": {
+			prefix:   DefaultBucketPathPrefix,
+			expected: DefaultBucketPathPrefix,
+		},
+		"trailing slash is trimmed": {
+			prefix:   "test-jake/",
+			expected: "test-jake",
+		},
+		"leading slash is trimmed": {
+			prefix:   "/scratch/stage",
+			expected: "scratch/stage",
+		},
+		"empty prefix errors": {
+			prefix:    "",
+			expectErr: true,
+		},
+		"only slashes errors": {
+			prefix:    "//",
+			expectErr: true,
+		},
+		"empty segment errors": {
+			prefix:    "scratch//stage",
+			expectErr: true,
+		},
+		"parent directory segment errors": {
+			prefix:    "scratch/../stage",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormalizeBucketPathPrefix(test.prefix)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}
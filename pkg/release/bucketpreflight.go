@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// requiredStagingPermissions are the IAM permissions needed on a bucket in
+// order to stage release artifacts to it.
+var requiredStagingPermissions = []string{
+	"storage.objects.create",
+	"storage.objects.delete",
+}
+
+// CheckBucketWriteAccess confirms that the named bucket exists and that the caller's
+// credentials have the permissions required to write objects to it,
+// including overwriting existing objects. It returns an error describing any
+// missing permissions if not.
+// No objects are written, so the check is safe to run against any bucket.
+func CheckBucketWriteAccess(ctx context.Context, gcs *storage.Client, name string) error {
+	bucket := gcs.Bucket(name)
+	if _, err := bucket.Attrs(ctx); err != nil {
+		if errors.Is(err, storage.ErrBucketNotExist) {
+			return fmt.Errorf("bucket %q does not exist", name)
+		}
+		return fmt.Errorf("failed to look up bucket %q: %w", name, err)
+	}
+
+	granted, err := bucket.IAM().TestPermissions(ctx, requiredStagingPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to check permissions on bucket %q: %w", name, err)
+	}
+
+	if missing := sets.NewString(requiredStagingPermissions...).Difference(sets.NewString(granted...)).List(); len(missing) > 0 {
+		return fmt.Errorf("caller is missing permissions on bucket %q: %s", name, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+func TestCheckBucketWriteAccess(t *testing.T) {
+	tests := map[string]struct {
+		bucketExists bool
+		granted      []string
+		expErr       string
+	}{
+		"all permissions granted": {
+			bucketExists: true,
+			granted:      requiredStagingPermissions,
+		},
+		"bucket does not exist": {
+			expErr: `bucket "staging" does not exist`,
+		},
+		"delete permission missing": {
+			bucketExists: true,
+			granted:      []string{"storage.objects.create"},
+			expErr:       "caller is missing permissions on bucket \"staging\": storage.objects.delete",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case !test.bucketExists:
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"error":{"code":404,"message":"Not Found"}}`))
+				case r.URL.Path == "/b/staging":
+					w.Write([]byte(`{"name":"staging"}`))
+				case r.URL.Path == "/b/staging/iam/testPermissions":
+					json.NewEncoder(w).Encode(map[string]interface{}{"permissions": test.granted})
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer srv.Close()
+
+			gcs, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer gcs.Close()
+
+			err = CheckBucketWriteAccess(context.Background(), gcs, "staging")
+			if test.expErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// buildTagRegex matches a single Go build tag.
+var buildTagRegex = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+// goVersionRegex matches a Go toolchain version without the 'go' prefix,
+// e.g. '1.16', '1.22.3' or '1.23rc1'.
+var goVersionRegex = regexp.MustCompile(`^1\.(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))?((rc|beta)[1-9][0-9]*)?$`)
+
+// ValidateBuildTags returns an error if tags is not a comma-separated list of
+// Go build tags, e.g. 'fips,netgo'. An empty string is valid.
+func ValidateBuildTags(tags string) error {
+	if tags == "" {
+		return nil
+	}
+
+	for _, tag := range strings.Split(tags, ",") {
+		if !buildTagRegex.MatchString(tag) {
+			return fmt.Errorf("invalid build tag %q: tags must only contain letters, digits, '_' and '.', and be separated by commas", tag)
+		}
+	}
+
+	return nil
+}
+
+// ValidateGoVersion returns an error if version is not a Go toolchain version
+// such as '1.22.3'. An empty string is valid.
+func ValidateGoVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+
+	if !goVersionRegex.MatchString(version) {
+		return fmt.Errorf("invalid Go version %q: must be a Go release such as '1.22.3', without a 'go' prefix", version)
+	}
+
+	return nil
+}
+
+// ValidateLDFlags returns an error if ldflags is not a space-separated list of
+// Go linker flags which can safely be passed through a Cloud Build
+// substitution and on to the build, e.g. '-s -w -X main.variant=fips'.
+// Quoting isn't supported, so no flag may contain spaces, and characters
+// which Cloud Build or the build tooling would interpret are rejected. An
+// empty string is valid.
+func ValidateLDFlags(ldflags string) error {
+	for _, r := range ldflags {
+		switch {
+		case r == ' ':
+		case r < ' ' || r == 0x7f:
+			return fmt.Errorf("invalid ldflags %q: must not contain control characters", ldflags)
+		case strings.ContainsRune("$,'\"`\\", r):
+			return fmt.Errorf("invalid ldflags %q: must not contain %q", ldflags, r)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import "testing"
+
+func TestValidateBuildTags(t *testing.T) {
+	tests := map[string]struct {
+		tags      string
+		expectErr bool
+	}{
+		"empty":             {tags: ""},
+		"single tag":        {tags: "fips"},
+		"multiple tags":     {tags: "fips,netgo,go1.16"},
+		"space separated":   {tags: "fips netgo", expectErr: true},
+		"empty tag":         {tags: "fips,", expectErr: true},
+		"substitution char": {tags: "$fips", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateBuildTags(test.tags)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateGoVersion(t *testing.T) {
+	tests := map[string]struct {
+		version   string
+		expectErr bool
+	}{
+		"empty":          {version: ""},
+		"minor version":  {version: "1.16"},
+		"patch version":  {version: "1.22.3"},
+		"release cand":   {version: "1.23rc1"},
+		"go prefix":      {version: "go1.22.3", expectErr: true},
+		"wildcard patch": {version: "1.22.x", expectErr: true},
+		"leading zero":   {version: "1.022", expectErr: true},
+		"major only":     {version: "1", expectErr: true},
+		"substitution":   {version: "1.22;rm", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateGoVersion(test.version)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateLDFlags(t *testing.T) {
+	tests := map[string]struct {
+		ldflags   string
+		expectErr bool
+	}{
+		"empty":           {ldflags: ""},
+		"strip flags":     {ldflags: "-s -w"},
+		"variable":        {ldflags: "-s -w -X github.com/jetstack/cert-manager/pkg/util.AppVariant=fips"},
+		"substitution":    {ldflags: "-X main.version=${_RELEASE_VERSION}", expectErr: true},
+		"quoted value":    {ldflags: `-X "main.name=cert manager"`, expectErr: true},
+		"comma":           {ldflags: "-extldflags=-static,-lpthread", expectErr: true},
+		"newline":         {ldflags: "-s\n-w", expectErr: true},
+		"backslash":       {ldflags: `-X main.path=C:\build`, expectErr: true},
+		"single quote":    {ldflags: "-X 'main.name=a'", expectErr: true},
+		"backtick":        {ldflags: "-X main.name=`id`", expectErr: true},
+		"control char":    {ldflags: "-s\t-w", expectErr: true},
+		"unicode allowed": {ldflags: "-X main.name=café"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateLDFlags(test.ldflags)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChecksumsFileName is the name of the file containing the SHA256 checksums
+// of all artifacts in a staged release, in the format used by sha256sum.
+const ChecksumsFileName = "SHA256SUMS"
+
+// ChecksumsKMSSignatureFileName returns the name of the file containing the
+// signature of the checksums file made with the i'th GCP KMS signing key of a
+// release. The first key's signature is named "SHA256SUMS.kms.sig", and
+// subsequent signatures are numbered from 2, e.g. "SHA256SUMS.kms.2.sig".
+func ChecksumsKMSSignatureFileName(i int) string {
+	return checksumsKMSFileName(i, "sig")
+}
+
+// ChecksumsKMSPublicKeyFileName returns the name of the file containing the
+// PEM encoded public key of the i'th GCP KMS signing key of a release, which
+// verifies the signature named by ChecksumsKMSSignatureFileName(i), e.g.
+// "SHA256SUMS.kms.pem" or "SHA256SUMS.kms.2.pem".
+func ChecksumsKMSPublicKeyFileName(i int) string {
+	return checksumsKMSFileName(i, "pem")
+}
+
+func checksumsKMSFileName(i int, ext string) string {
+	if i == 0 {
+		return fmt.Sprintf("%s.kms.%s", ChecksumsFileName, ext)
+	}
+	return fmt.Sprintf("%s.kms.%d.%s", ChecksumsFileName, i+1, ext)
+}
+
+// ComputeChecksums computes the SHA256 checksum of each of the given artifact
+// files, returning a map of the base name of each file to its hex-encoded
+// checksum. Files are streamed rather than read into memory.
+// An error is returned if two artifacts share the same base name.
+func ComputeChecksums(artifacts []string) (map[string]string, error) {
+	sums := make(map[string]string, len(artifacts))
+	for _, artifact := range artifacts {
+		name := filepath.Base(artifact)
+		if _, ok := sums[name]; ok {
+			return nil, fmt.Errorf("duplicate artifact name %q", name)
+		}
+
+		sum, err := sha256SumFile(artifact)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute checksum of %q: %w", artifact, err)
+		}
+
+		sums[name] = sum
+	}
+	return sums, nil
+}
+
+// WriteChecksumsFile writes the given checksums to w in the standard
+// '<hash>  <filename>' format produced by sha256sum, sorted by filename.
+func WriteChecksumsFile(w io.Writer, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", sums[name], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadChecksumsFile parses a checksums file in the format written by
+// WriteChecksumsFile, returning a map of filename to checksum.
+func ReadChecksumsFile(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		fields := strings.SplitN(text, "  ", 2)
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("invalid checksums file: malformed line %d: %q", line, text)
+		}
+
+		// sha256sum prefixes filenames with '*' when operating in binary mode
+		name := strings.TrimPrefix(fields[1], "*")
+		if _, ok := sums[name]; ok {
+			return nil, fmt.Errorf("invalid checksums file: duplicate entry for %q on line %d", name, line)
+		}
+		sums[name] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// VerifyChecksumsFile validates that every file listed in the checksums file
+// read from r exists in dir and has a matching SHA256 checksum.
+func VerifyChecksumsFile(r io.Reader, dir string) error {
+	sums, err := ReadChecksumsFile(r)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mismatched []string
+	for _, name := range names {
+		sum, err := sha256SumFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to compute checksum of %q: %w", name, err)
+		}
+		if sum != sums[name] {
+			mismatched = append(mismatched, name)
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return fmt.Errorf("checksum mismatch for files: %s", strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+// CompareChecksums compares the checksums of two builds which are expected to
+// be identical, as returned by ReadChecksumsFile, returning the sorted names
+// of files present in both whose checksums differ, and of files which are
+// only present in one of them.
+func CompareChecksums(first, second map[string]string) (differing []string, missing []string) {
+	for name, sum := range first {
+		otherSum, ok := second[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case otherSum != sum:
+			differing = append(differing, name)
+		}
+	}
+	for name := range second {
+		if _, ok := first[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(differing)
+	sort.Strings(missing)
+	return differing, missing
+}
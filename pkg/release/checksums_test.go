@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	// sha256 of "hello"
+	helloSum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	// sha256 of "world"
+	worldSum = "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"
+)
+
+func TestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"b.tar.gz": "hello", "a.tar.gz": "world"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sums, err := ComputeChecksums([]string{filepath.Join(dir, "b.tar.gz"), filepath.Join(dir, "a.tar.gz")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteChecksumsFile(buf, sums); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := worldSum + "  a.tar.gz\n" + helloSum + "  b.tar.gz\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected checksums file:\ngot:\n%s\nexp:\n%s", buf.String(), expected)
+	}
+
+	tests := map[string]struct {
+		file   string
+		expErr string
+	}{
+		"matching checksums": {
+			file: expected,
+		},
+		"binary mode filenames": {
+			file: helloSum + "  *b.tar.gz\n",
+		},
+		"mismatched checksum": {
+			file:   worldSum + "  b.tar.gz\n",
+			expErr: "checksum mismatch for files: b.tar.gz",
+		},
+		"missing file": {
+			file:   helloSum + "  c.tar.gz\n",
+			expErr: "c.tar.gz",
+		},
+		"malformed line": {
+			file:   helloSum + " b.tar.gz\n",
+			expErr: "malformed line 1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := VerifyChecksumsFile(strings.NewReader(test.file), dir)
+			if test.expErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
+
+func TestComputeChecksums_DuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"x", "y"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sub, "a.tar.gz"), []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ComputeChecksums([]string{filepath.Join(dir, "x", "a.tar.gz"), filepath.Join(dir, "y", "a.tar.gz")}); err == nil {
+		t.Errorf("expected an error for duplicate artifact names")
+	}
+}
+
+func TestChecksumsKMSSignatureFileName(t *testing.T) {
+	tests := map[int]string{
+		0: "SHA256SUMS.kms.sig",
+		1: "SHA256SUMS.kms.2.sig",
+		2: "SHA256SUMS.kms.3.sig",
+	}
+
+	for i, expected := range tests {
+		if got := ChecksumsKMSSignatureFileName(i); got != expected {
+			t.Errorf("expected name for key %d to be %q but got %q", i, expected, got)
+		}
+	}
+}
+
+func TestChecksumsKMSPublicKeyFileName(t *testing.T) {
+	tests := map[int]string{
+		0: "SHA256SUMS.kms.pem",
+		1: "SHA256SUMS.kms.2.pem",
+	}
+
+	for i, expected := range tests {
+		if got := ChecksumsKMSPublicKeyFileName(i); got != expected {
+			t.Errorf("expected name for key %d to be %q but got %q", i, expected, got)
+		}
+	}
+}
+
+func TestCompareChecksums(t *testing.T) {
+	tests := map[string]struct {
+		first, second map[string]string
+		differing     []string
+		missing       []string
+	}{
+		"identical": {
+			first:  map[string]string{"a.tar.gz": helloSum, "b.tar.gz": worldSum},
+			second: map[string]string{"a.tar.gz": helloSum, "b.tar.gz": worldSum},
+		},
+		"differing checksums": {
+			first:     map[string]string{"a.tar.gz": helloSum, "b.tar.gz": worldSum, "c.tar.gz": helloSum},
+			second:    map[string]string{"a.tar.gz": helloSum, "b.tar.gz": helloSum, "c.tar.gz": worldSum},
+			differing: []string{"b.tar.gz", "c.tar.gz"},
+		},
+		"files only in one build": {
+			first:   map[string]string{"a.tar.gz": helloSum, "b.tar.gz": worldSum},
+			second:  map[string]string{"a.tar.gz": helloSum, "c.tar.gz": worldSum},
+			missing: []string{"b.tar.gz", "c.tar.gz"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			differing, missing := CompareChecksums(test.first, test.second)
+			if !reflect.DeepEqual(differing, test.differing) {
+				t.Errorf("expected differing files %v but got %v", test.differing, differing)
+			}
+			if !reflect.DeepEqual(missing, test.missing) {
+				t.Errorf("expected missing files %v but got %v", test.missing, missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionGzip stages only the gzip compressed artifacts produced by
+	// the cert-manager build, which is the default.
+	CompressionGzip = "gzip"
+
+	// CompressionZstd stages only zstd compressed artifacts, recompressed
+	// from those produced by the cert-manager build.
+	CompressionZstd = "zstd"
+
+	// CompressionBoth stages both the gzip and zstd compressed artifacts.
+	CompressionBoth = "both"
+)
+
+// Compressions is the list of all supported artifact compression options.
+var Compressions = []string{CompressionGzip, CompressionZstd, CompressionBoth}
+
+const (
+	gzipTarExt = ".tar.gz"
+	zstdTarExt = ".tar.zst"
+)
+
+// ValidateCompression returns an error if compression is not one of
+// Compressions.
+func ValidateCompression(compression string) error {
+	for _, c := range Compressions {
+		if compression == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid compression %q, must be one of: %s", compression, strings.Join(Compressions, ", "))
+}
+
+// CompressionFormats returns the formats, CompressionGzip and/or
+// CompressionZstd, which artifacts are staged in with the given compression
+// option.
+func CompressionFormats(compression string) []string {
+	switch compression {
+	case CompressionZstd:
+		return []string{CompressionZstd}
+	case CompressionBoth:
+		return []string{CompressionGzip, CompressionZstd}
+	}
+	return []string{CompressionGzip}
+}
+
+// ArtifactCompression returns the format the named artifact is compressed
+// with, or an empty string if it isn't a compressed tarball.
+func ArtifactCompression(name string) string {
+	switch {
+	case strings.HasSuffix(name, gzipTarExt):
+		return CompressionGzip
+	case strings.HasSuffix(name, zstdTarExt):
+		return CompressionZstd
+	}
+	return ""
+}
+
+// ZstdArtifactName returns the name of the zstd compressed variant of the
+// named gzip compressed artifact, e.g. "cert-manager-manifests.tar.zst".
+// Names of artifacts which aren't gzip compressed tarballs are returned
+// unchanged.
+func ZstdArtifactName(name string) string {
+	if !strings.HasSuffix(name, gzipTarExt) {
+		return name
+	}
+	return strings.TrimSuffix(name, gzipTarExt) + zstdTarExt
+}
+
+// CompressedArtifactNames returns the names of the given gzip compressed
+// artifacts as they're staged with the given compression option.
+func CompressedArtifactNames(names []string, compression string) []string {
+	var out []string
+	for _, format := range CompressionFormats(compression) {
+		for _, name := range names {
+			if format == CompressionZstd {
+				name = ZstdArtifactName(name)
+			}
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// RecompressZstd writes the gzip compressed file at src to dst, compressed
+// with zstd instead. The uncompressed content is streamed rather than read
+// into memory.
+func RecompressZstd(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", src, err)
+	}
+	defer gz.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw, err := zstd.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, gz); err != nil {
+		zw.Close()
+		return fmt.Errorf("failed to recompress %q: %w", src, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to recompress %q: %w", src, err)
+	}
+
+	return out.Close()
+}
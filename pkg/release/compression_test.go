@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressedArtifactNames(t *testing.T) {
+	names := []string{ManifestsArtifactName, ServerArtifactName("amd64")}
+
+	tests := map[string]struct {
+		compression string
+		exp         []string
+	}{
+		"gzip": {
+			compression: CompressionGzip,
+			exp:         []string{"cert-manager-manifests.tar.gz", "cert-manager-server-linux-amd64.tar.gz"},
+		},
+		"zstd": {
+			compression: CompressionZstd,
+			exp:         []string{"cert-manager-manifests.tar.zst", "cert-manager-server-linux-amd64.tar.zst"},
+		},
+		"both": {
+			compression: CompressionBoth,
+			exp:         []string{"cert-manager-manifests.tar.gz", "cert-manager-server-linux-amd64.tar.gz", "cert-manager-manifests.tar.zst", "cert-manager-server-linux-amd64.tar.zst"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateCompression(test.compression); err != nil {
+				t.Fatalf("unexpected error validating compression: %v", err)
+			}
+			if got := CompressedArtifactNames(names, test.compression); !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("unexpected names:\ngot: %v\nexp: %v", got, test.exp)
+			}
+			for _, name := range test.exp {
+				if ArtifactCompression(name) == "" {
+					t.Errorf("expected compression of %q to be known", name)
+				}
+			}
+		})
+	}
+
+	if err := ValidateCompression("xz"); err == nil {
+		t.Errorf("expected an error for an unknown compression")
+	}
+	if got := ArtifactCompression(MetadataFileName); got != "" {
+		t.Errorf("expected no compression for %q but got %q", MetadataFileName, got)
+	}
+}
+
+func TestRecompressZstd(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("cert-manager "), 1000)
+
+	src := filepath.Join(dir, "cert-manager-manifests.tar.gz")
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write(content)
+	gz.Close()
+	if err := os.WriteFile(src, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, ZstdArtifactName(filepath.Base(src)))
+	if err := RecompressZstd(src, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("recompressed content does not match the original")
+	}
+
+	if err := RecompressZstd(dst, filepath.Join(dir, "invalid.tar.zst")); err == nil {
+		t.Errorf("expected an error recompressing a file which isn't gzip compressed")
+	}
+}
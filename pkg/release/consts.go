@@ -18,6 +18,7 @@ package release
 
 import (
 	"fmt"
+	"strings"
 )
 
 const (
@@ -42,6 +43,11 @@ const (
 	// to Google Cloud Storage.
 	DefaultBucketPathPrefix = "stage/gcb"
 
+	// DefaultPublishedBucketPathPrefix is the default prefix prepended to
+	// paths written to Google Cloud Storage when promoting a staged release
+	// into a public release bucket.
+	DefaultPublishedBucketPathPrefix = "releases"
+
 	// DefaultImageRepository is the default image repository used for artifact
 	// images.
 	DefaultImageRepository = "quay.io/jetstack"
@@ -50,6 +56,11 @@ const (
 	// repository.
 	DefaultGitHubOrg = "jetstack"
 
+	// CanonicalGitHubOrg is the organisation the cert-manager repository has
+	// moved to. DefaultGitHubOrg is still the default so that existing
+	// invocations are unchanged, but will eventually be replaced by it.
+	CanonicalGitHubOrg = "cert-manager"
+
 	// DefaultGitHubRepo is the default repository containing the cert-manager
 	// code.
 	DefaultGitHubRepo = "cert-manager"
@@ -71,17 +82,57 @@ const (
 	// the release tool.
 	BuildTypeRelease = "release"
 
+	// BuildTypePrerelease denotes that a build is targeting a named release
+	// whose version has a prerelease component, e.g. v1.6.0-beta.0, so that
+	// release candidates are staged apart from final releases.
+	BuildTypePrerelease = "prerelease"
+
 	// BuildTypeDevel denotes that a build did not explicitly set a
 	// --release-version and so it is not suitable for being used as part of a
 	// published release.
 	BuildTypeDevel = "devel"
 )
 
+// BuildTypeForVersion returns the type of build which is staged for the given
+// release version: BuildTypeDevel if no version is set, BuildTypePrerelease if
+// the version has a prerelease component and BuildTypeRelease otherwise.
+func BuildTypeForVersion(releaseVersion string) string {
+	switch {
+	case releaseVersion == "":
+		return BuildTypeDevel
+	case IsPrerelease(releaseVersion):
+		return BuildTypePrerelease
+	default:
+		return BuildTypeRelease
+	}
+}
+
 // BucketPathForRelease will assemble an output directory path for the given
 // release parameters.
 func BucketPathForRelease(bucketPrefix, buildType, releaseVersion, gitRef string) string {
-	if buildType == BuildTypeRelease {
+	if buildType != BuildTypeDevel {
 		return fmt.Sprintf("%s/%s/%s-%s", bucketPrefix, buildType, releaseVersion, gitRef)
 	}
 	return fmt.Sprintf("%s/%s/%s", bucketPrefix, buildType, gitRef)
 }
+
+// NormalizeBucketPathPrefix validates a prefix to be passed to
+// BucketPathForRelease, trimming any leading or trailing slashes.
+func NormalizeBucketPathPrefix(prefix string) (string, error) {
+	trimmed := strings.Trim(prefix, "/")
+	if trimmed == "" {
+		return "", fmt.Errorf("bucket path prefix %q must not be empty", prefix)
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("bucket path prefix %q contains an invalid path segment %q", prefix, segment)
+		}
+	}
+	return trimmed, nil
+}
+
+// PublishedBucketPathForRelease will assemble the output directory path used
+// for a promoted release with the given version.
+func PublishedBucketPathForRelease(bucketPrefix, releaseVersion string) string {
+	return fmt.Sprintf("%s/%s", bucketPrefix, releaseVersion)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"sort"
+)
+
+// StagedObject describes a single file in a staged build.
+type StagedObject struct {
+	// Name is the name of the file, relative to the build's path in the bucket.
+	Name string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// Checksum is a checksum of the file's content, such as its CRC32C as
+	// reported by GCS. Only checksums of the same kind can be compared.
+	Checksum string
+}
+
+// ChangedObject is a file present in both of two compared builds whose size
+// or checksum differs between them.
+type ChangedObject struct {
+	Name         string `json:"name"`
+	FromSize     int64  `json:"fromSize"`
+	ToSize       int64  `json:"toSize"`
+	FromChecksum string `json:"fromChecksum"`
+	ToChecksum   string `json:"toChecksum"`
+}
+
+// StagedDiff is the difference between the files of two staged builds.
+type StagedDiff struct {
+	// Added are the sorted names of files only present in the second build.
+	Added []string `json:"added"`
+
+	// Removed are the sorted names of files only present in the first build.
+	Removed []string `json:"removed"`
+
+	// Changed are the files present in both builds whose content differs,
+	// sorted by name.
+	Changed []ChangedObject `json:"changed"`
+
+	// Unchanged is the number of files which are identical in both builds.
+	Unchanged int `json:"unchanged"`
+}
+
+// DiffStagedObjects compares the files of two staged builds, from and to.
+func DiffStagedObjects(from, to []StagedObject) StagedDiff {
+	fromNames, toNames := make([]string, len(from)), make([]string, len(to))
+	toObjects := make(map[string]StagedObject, len(to))
+	for i, obj := range from {
+		fromNames[i] = obj.Name
+	}
+	for i, obj := range to {
+		toNames[i] = obj.Name
+		toObjects[obj.Name] = obj
+	}
+
+	var diff StagedDiff
+	diff.Removed, diff.Added = DiffNames(fromNames, toNames)
+
+	for _, f := range from {
+		t, ok := toObjects[f.Name]
+		if !ok {
+			continue
+		}
+		if f.Size == t.Size && f.Checksum == t.Checksum {
+			diff.Unchanged++
+			continue
+		}
+		diff.Changed = append(diff.Changed, ChangedObject{
+			Name:         f.Name,
+			FromSize:     f.Size,
+			ToSize:       t.Size,
+			FromChecksum: f.Checksum,
+			ToChecksum:   t.Checksum,
+		})
+	}
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Name < diff.Changed[j].Name
+	})
+
+	return diff
+}
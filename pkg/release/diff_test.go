@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffStagedObjects(t *testing.T) {
+	tests := map[string]struct {
+		from []StagedObject
+		to   []StagedObject
+		exp  StagedDiff
+	}{
+		"identical builds": {
+			from: []StagedObject{{Name: "a", Size: 1, Checksum: "x"}, {Name: "b", Size: 2, Checksum: "y"}},
+			to:   []StagedObject{{Name: "b", Size: 2, Checksum: "y"}, {Name: "a", Size: 1, Checksum: "x"}},
+			exp:  StagedDiff{Added: []string{}, Removed: []string{}, Unchanged: 2},
+		},
+		"added and removed files": {
+			from: []StagedObject{{Name: "a", Size: 1, Checksum: "x"}, {Name: "c", Size: 3}},
+			to:   []StagedObject{{Name: "a", Size: 1, Checksum: "x"}, {Name: "b", Size: 2}},
+			exp:  StagedDiff{Added: []string{"b"}, Removed: []string{"c"}, Unchanged: 1},
+		},
+		"changed size and checksum": {
+			from: []StagedObject{{Name: "b", Size: 2, Checksum: "y"}, {Name: "a", Size: 1, Checksum: "x"}},
+			to:   []StagedObject{{Name: "a", Size: 1, Checksum: "z"}, {Name: "b", Size: 5, Checksum: "y"}},
+			exp: StagedDiff{
+				Added:   []string{},
+				Removed: []string{},
+				Changed: []ChangedObject{
+					{Name: "a", FromSize: 1, ToSize: 1, FromChecksum: "x", ToChecksum: "z"},
+					{Name: "b", FromSize: 2, ToSize: 5, FromChecksum: "y", ToChecksum: "y"},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			diff := DiffStagedObjects(test.from, test.to)
+			if !reflect.DeepEqual(diff, test.exp) {
+				t.Errorf("unexpected diff:\ngot: %+v\nexp: %+v", diff, test.exp)
+			}
+		})
+	}
+}
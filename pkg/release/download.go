@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// LocalPathForObject returns the path within dir that the object with the
+// given name, relative to a staged release's path in its bucket, should be
+// downloaded to. An error is returned if the name would resolve to a path
+// outside of dir.
+func LocalPathForObject(dir, name string) (string, error) {
+	cleaned := path.Clean("/" + name)
+	if name == "" || strings.HasSuffix(name, "/") || cleaned != "/"+name {
+		return "", fmt.Errorf("refusing to download object with unsafe name %q", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+// DownloadObject downloads the content of obj to the file at dst, creating
+// any parent directories. The content is written to a temporary file which
+// is renamed once the download completes, so dst is never left partially
+// written.
+func DownloadObject(ctx context.Context, obj *storage.ObjectHandle, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), dst)
+}
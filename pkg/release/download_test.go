@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPathForObject(t *testing.T) {
+	tests := map[string]struct {
+		name      string
+		expected  string
+		expectErr bool
+	}{
+		"top level file":        {name: "SHA256SUMS", expected: filepath.Join("out", "SHA256SUMS")},
+		"nested file":           {name: "sbom/cert-manager.spdx.json", expected: filepath.Join("out", "sbom", "cert-manager.spdx.json")},
+		"empty name":            {name: "", expectErr: true},
+		"directory placeholder": {name: "sbom/", expectErr: true},
+		"parent directory":      {name: "../SHA256SUMS", expectErr: true},
+		"nested traversal":      {name: "a/../../SHA256SUMS", expectErr: true},
+		"absolute path":         {name: "/etc/passwd", expectErr: true},
+		"repeated slashes":      {name: "a//b", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := LocalPathForObject("out", test.name)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}
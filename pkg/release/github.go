@@ -17,18 +17,77 @@ limitations under the License.
 package release
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
+// DefaultGitHubAPIURL is the base URL of the public GitHub v3 API.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// NormalizeGitHubBaseURL validates the given GitHub API base URL and returns
+// it in a canonical form with no trailing slash. An empty URL, or the URL of
+// github.com itself, is normalized to DefaultGitHubAPIURL.
+// GitHub Enterprise instances serve the v3 API under /api/v3, so a URL for
+// any other host which has no path, e.g. https://github.example.com, has
+// /api/v3 appended to it.
+func NormalizeGitHubBaseURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		return DefaultGitHubAPIURL, nil
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid GitHub base URL %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid GitHub base URL %q: scheme must be http or https", baseURL)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid GitHub base URL %q: no host specified", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid GitHub base URL %q: must not contain a query or fragment", baseURL)
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	switch {
+	case strings.EqualFold(u.Host, "github.com") || strings.EqualFold(u.Host, "api.github.com"):
+		if u.Path != "" {
+			return "", fmt.Errorf("invalid GitHub base URL %q: the public GitHub API does not have a path prefix", baseURL)
+		}
+		return DefaultGitHubAPIURL, nil
+	case u.Path == "":
+		u.Path = "/api/v3"
+	}
+
+	return u.String(), nil
+}
+
 // LookupBranchRef will lookup the git commit ref of the HEAD of the branch
 // in the given repository.
 // It does this by querying the GitHub v3 API at:
-// https://api.github.com/repos/{org}/{repo}/git/ref/heads/{branch}
-func LookupBranchRef(org, repo, branch string) (string, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/ref/heads/%s", org, repo, branch)
-	resp, err := http.DefaultClient.Get(url)
+// {baseURL}/repos/{org}/{repo}/git/ref/heads/{branch}
+// The baseURL is normalized with NormalizeGitHubBaseURL, so an empty baseURL
+// will query the public GitHub API at https://api.github.com.
+// If token is non-empty, it is sent as a bearer token to authenticate the
+// request. Unauthenticated requests are subject to much lower rate limits.
+// The request is cancelled if ctx is done before it completes.
+func LookupBranchRef(ctx context.Context, baseURL, org, repo, branch, token string) (string, error) {
+	baseURL, err := NormalizeGitHubBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/git/ref/heads/%s", baseURL, org, repo, branch)
+	resp, err := githubGet(ctx, url, token)
 	if err != nil {
 		return "", err
 	}
@@ -43,6 +102,322 @@ func LookupBranchRef(org, repo, branch string) (string, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
 		return "", err
 	}
+	if p.Object.SHA == "" {
+		return "", fmt.Errorf("GitHub API response for %s did not contain a commit ref", url)
+	}
 
 	return p.Object.SHA, nil
 }
+
+// LookupCommit will look up the commit with the given ref in the given
+// repository, which may be a full or abbreviated commit SHA, a branch or a
+// tag, returning the full SHA of the commit. An error is returned if the ref
+// does not exist in the repository.
+// It does this by querying the GitHub v3 API at:
+// {baseURL}/repos/{org}/{repo}/commits/{ref}
+// The baseURL and token are used as with LookupBranchRef.
+func LookupCommit(ctx context.Context, baseURL, org, repo, ref, token string) (string, error) {
+	baseURL, err := NormalizeGitHubBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/commits/%s", baseURL, org, repo, ref)
+	resp, err := githubGet(ctx, url, token)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	type payload struct {
+		SHA string
+	}
+	p := payload{}
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return "", err
+	}
+	if p.SHA == "" {
+		return "", fmt.Errorf("GitHub API response for %s did not contain a commit SHA", url)
+	}
+
+	return p.SHA, nil
+}
+
+// IsAncestor reports whether the commit with the given ref is the HEAD of
+// branch, or one of its ancestors, in the given repository.
+// It does this by comparing the two with the GitHub v3 API at:
+// {baseURL}/repos/{org}/{repo}/compare/{ref}...{branch}
+// The baseURL and token are used as with LookupBranchRef.
+func IsAncestor(ctx context.Context, baseURL, org, repo, ref, branch, token string) (bool, error) {
+	baseURL, err := NormalizeGitHubBaseURL(baseURL)
+	if err != nil {
+		return false, err
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", baseURL, org, repo, ref, branch)
+	resp, err := githubGet(ctx, url, token)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	type payload struct {
+		Status string
+	}
+	p := payload{}
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return false, err
+	}
+
+	// the status describes the branch relative to the ref
+	switch p.Status {
+	case "ahead", "identical":
+		return true, nil
+	case "behind", "diverged":
+		return false, nil
+	}
+	return false, fmt.Errorf("GitHub API response for %s contained unknown comparison status %q", url, p.Status)
+}
+
+// minExpectedGitRefLength is the length of the shortest abbreviated commit
+// SHA accepted by ValidateExpectedGitRef, matching git's default.
+const minExpectedGitRefLength = 7
+
+// ValidateExpectedGitRef returns an error if expected is not a full or
+// abbreviated hex commit SHA which can be compared to a looked up commit ref
+// with GitRefMatches.
+func ValidateExpectedGitRef(expected string) error {
+	if len(expected) < minExpectedGitRefLength || len(expected) > 40 {
+		return fmt.Errorf("invalid commit SHA %q: must be between %d and 40 characters", expected, minExpectedGitRefLength)
+	}
+	for _, r := range strings.ToLower(expected) {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return fmt.Errorf("invalid commit SHA %q: must only contain hex characters", expected)
+		}
+	}
+	return nil
+}
+
+// GitRefMatches reports whether the commit SHA ref is the commit given by
+// expected, which may be abbreviated. The comparison is case-insensitive.
+func GitRefMatches(ref, expected string) bool {
+	return expected != "" && strings.HasPrefix(strings.ToLower(ref), strings.ToLower(expected))
+}
+
+// maxBranchPages is the maximum number of pages of branches ListBranches will
+// request, bounding the number of requests made for very large repositories.
+const maxBranchPages = 10
+
+// ListBranches will list the names of the branches in the given repository,
+// querying the GitHub v3 API at:
+// {baseURL}/repos/{org}/{repo}/branches
+// The baseURL and token are used as with LookupBranchRef. At most 1000
+// branches are returned.
+func ListBranches(ctx context.Context, baseURL, org, repo, token string) ([]string, error) {
+	baseURL, err := NormalizeGitHubBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	const perPage = 100
+	var branches []string
+	for page := 1; page <= maxBranchPages; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/branches?per_page=%d&page=%d", baseURL, org, repo, perPage, page)
+		names, err := func() ([]string, error) {
+			resp, err := githubGet(ctx, url, token)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+
+			var payload []struct {
+				Name string
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+				return nil, err
+			}
+
+			names := make([]string, len(payload))
+			for i, b := range payload {
+				names[i] = b.Name
+			}
+			return names, nil
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		branches = append(branches, names...)
+		if len(names) < perPage {
+			break
+		}
+	}
+
+	return branches, nil
+}
+
+// TagExists returns true if a tag with the given name exists in the given
+// repository, querying the GitHub v3 API at:
+// {baseURL}/repos/{org}/{repo}/git/ref/tags/{tag}
+// The baseURL and token are used as with LookupBranchRef.
+func TagExists(ctx context.Context, baseURL, org, repo, tag, token string) (bool, error) {
+	baseURL, err := NormalizeGitHubBaseURL(baseURL)
+	if err != nil {
+		return false, err
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/git/ref/tags/%s", baseURL, org, repo, tag)
+	resp, err := githubGet(ctx, url, token)
+	var statusErr *githubStatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// CreateTag creates an annotated tag with the given name and message in the
+// given repository, pointing at the commit with the given full SHA, and
+// returns the SHA of the created tag object. If force is true, an existing
+// tag with the same name is moved to point at the new tag object, otherwise
+// creating the tag fails if it already exists.
+// It does this by creating a tag object and then a reference to it using the
+// GitHub v3 API at:
+// {baseURL}/repos/{org}/{repo}/git/tags
+// {baseURL}/repos/{org}/{repo}/git/refs
+// The baseURL is used as with LookupBranchRef, and token must be set to a
+// token which is permitted to push to the repository.
+func CreateTag(ctx context.Context, baseURL, org, repo, tag, commitSHA, message, token string, force bool) (string, error) {
+	baseURL, err := NormalizeGitHubBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", fmt.Errorf("a GitHub token is required to create a tag")
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/git/tags", baseURL, org, repo)
+	resp, err := githubRequest(ctx, http.MethodPost, url, token, map[string]string{
+		"tag":     tag,
+		"message": message,
+		"object":  commitSHA,
+		"type":    "commit",
+	}, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		SHA string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", err
+	}
+	if payload.SHA == "" {
+		return "", fmt.Errorf("GitHub API response for %s did not contain a tag SHA", url)
+	}
+
+	exists := false
+	if force {
+		if exists, err = TagExists(ctx, baseURL, org, repo, tag, token); err != nil {
+			return "", err
+		}
+	}
+
+	if exists {
+		url = fmt.Sprintf("%s/repos/%s/%s/git/refs/tags/%s", baseURL, org, repo, tag)
+		resp, err = githubRequest(ctx, http.MethodPatch, url, token, map[string]interface{}{
+			"sha":   payload.SHA,
+			"force": true,
+		}, http.StatusOK)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return payload.SHA, nil
+	}
+
+	url = fmt.Sprintf("%s/repos/%s/%s/git/refs", baseURL, org, repo)
+	resp, err = githubRequest(ctx, http.MethodPost, url, token, map[string]string{
+		"ref": "refs/tags/" + tag,
+		"sha": payload.SHA,
+	}, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	return payload.SHA, nil
+}
+
+// githubStatusError is returned when a request to the GitHub API returns an
+// unexpected status code.
+type githubStatusError struct {
+	URL        string
+	Method     string
+	Status     string
+	StatusCode int
+	RateLimit  string
+}
+
+func (e *githubStatusError) Error() string {
+	if e.StatusCode == http.StatusForbidden {
+		return fmt.Sprintf("GitHub API returned %s for %s %s (X-RateLimit-Remaining: %q) - if rate limited, set a GitHub token to authenticate the request", e.Status, e.Method, e.URL, e.RateLimit)
+	}
+	return fmt.Sprintf("GitHub API returned %s for %s %s", e.Status, e.Method, e.URL)
+}
+
+// githubGet performs a GET request of the given GitHub v3 API URL, returning
+// an error if the response does not have a 200 status code. The caller must
+// close the body of the returned response.
+func githubGet(ctx context.Context, url, token string) (*http.Response, error) {
+	return githubRequest(ctx, http.MethodGet, url, token, nil, http.StatusOK)
+}
+
+// githubRequest performs a request of the given GitHub v3 API URL, sending
+// body encoded as JSON if it is not nil, and returns an error if the response
+// does not have the expected status code. The caller must close the body of
+// the returned response.
+func githubRequest(ctx context.Context, method, url, token string, body interface{}, expectedStatus int) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != expectedStatus {
+		resp.Body.Close()
+		return nil, &githubStatusError{
+			URL:        url,
+			Method:     method,
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			RateLimit:  resp.Header.Get("X-RateLimit-Remaining"),
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,592 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupBranchRef(t *testing.T) {
+	tests := map[string]struct {
+		token      string
+		statusCode int
+		headers    map[string]string
+		body       string
+		expAuth    string
+		expRef     string
+		expErr     string
+	}{
+		"unauthenticated lookup succeeds": {
+			statusCode: http.StatusOK,
+			body:       `{"object": {"sha": "abc123"}}`,
+			expRef:     "abc123",
+		},
+		"token is sent as a bearer token": {
+			token:      "secret",
+			statusCode: http.StatusOK,
+			body:       `{"object": {"sha": "abc123"}}`,
+			expAuth:    "Bearer secret",
+			expRef:     "abc123",
+		},
+		"forbidden includes remaining rate limit": {
+			statusCode: http.StatusForbidden,
+			headers:    map[string]string{"X-RateLimit-Remaining": "0"},
+			body:       `{"message": "API rate limit exceeded"}`,
+			expErr:     `X-RateLimit-Remaining: "0"`,
+		},
+		"not found returns an error": {
+			statusCode: http.StatusNotFound,
+			body:       `{"message": "Not Found"}`,
+			expErr:     "404",
+		},
+		"missing sha returns an error": {
+			statusCode: http.StatusOK,
+			body:       `{}`,
+			expErr:     "did not contain a commit ref",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/repos/jetstack/cert-manager/git/ref/heads/master" {
+					t.Errorf("unexpected request path %q", r.URL.Path)
+				}
+				if got := r.Header.Get("Authorization"); got != test.expAuth {
+					t.Errorf("unexpected Authorization header: got=%q, exp=%q", got, test.expAuth)
+				}
+				for k, v := range test.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(test.statusCode)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			// The test server's URL has no path, so /api/v3 will be appended
+			// as for a GitHub Enterprise host.
+			ref, err := LookupBranchRef(context.Background(), srv.URL+"/", "jetstack", "cert-manager", "master", test.token)
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ref != test.expRef {
+				t.Errorf("unexpected ref: got=%q, exp=%q", ref, test.expRef)
+			}
+		})
+	}
+}
+
+func TestLookupCommit(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		body       string
+		expSHA     string
+		expErr     string
+	}{
+		"existing commit returns the full sha": {
+			statusCode: http.StatusOK,
+			body:       `{"sha": "abc123def456"}`,
+			expSHA:     "abc123def456",
+		},
+		"unknown commit returns an error": {
+			statusCode: http.StatusUnprocessableEntity,
+			body:       `{"message": "No commit found for SHA: abc123"}`,
+			expErr:     "422",
+		},
+		"missing sha returns an error": {
+			statusCode: http.StatusOK,
+			body:       `{}`,
+			expErr:     "did not contain a commit SHA",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/repos/jetstack/cert-manager/commits/abc123" {
+					t.Errorf("unexpected request path %q", r.URL.Path)
+				}
+				w.WriteHeader(test.statusCode)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			sha, err := LookupCommit(context.Background(), srv.URL, "jetstack", "cert-manager", "abc123", "")
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sha != test.expSHA {
+				t.Errorf("unexpected sha: got=%q, exp=%q", sha, test.expSHA)
+			}
+		})
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	tests := map[string]struct {
+		statusCode  int
+		body        string
+		expAncestor bool
+		expErr      string
+	}{
+		"branch is ahead of ref": {
+			statusCode:  http.StatusOK,
+			body:        `{"status": "ahead"}`,
+			expAncestor: true,
+		},
+		"ref is the branch HEAD": {
+			statusCode:  http.StatusOK,
+			body:        `{"status": "identical"}`,
+			expAncestor: true,
+		},
+		"ref is ahead of branch": {
+			statusCode: http.StatusOK,
+			body:       `{"status": "behind"}`,
+		},
+		"ref is on a different branch": {
+			statusCode: http.StatusOK,
+			body:       `{"status": "diverged"}`,
+		},
+		"unknown status returns an error": {
+			statusCode: http.StatusOK,
+			body:       `{}`,
+			expErr:     "unknown comparison status",
+		},
+		"unknown ref returns an error": {
+			statusCode: http.StatusNotFound,
+			body:       `{"message": "Not Found"}`,
+			expErr:     "404",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/repos/jetstack/cert-manager/compare/abc123...release-1.6" {
+					t.Errorf("unexpected request path %q", r.URL.Path)
+				}
+				w.WriteHeader(test.statusCode)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			ancestor, err := IsAncestor(context.Background(), srv.URL, "jetstack", "cert-manager", "abc123", "release-1.6", "")
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ancestor != test.expAncestor {
+				t.Errorf("unexpected result: got=%v, exp=%v", ancestor, test.expAncestor)
+			}
+		})
+	}
+}
+
+func TestGitRefMatches(t *testing.T) {
+	const ref = "0123456789abcdef0123456789abcdef01234567"
+	tests := map[string]struct {
+		expected  string
+		expMatch  bool
+		expectErr bool
+	}{
+		"full sha":           {expected: ref, expMatch: true},
+		"short sha":          {expected: "0123456", expMatch: true},
+		"upper case":         {expected: "0123456789ABCDEF", expMatch: true},
+		"different sha":      {expected: "0123457"},
+		"trailing mismatch":  {expected: ref[:39] + "8"},
+		"too short":          {expected: "012345", expectErr: true},
+		"too long":           {expected: ref + "8", expectErr: true},
+		"not hex":            {expected: "release-1.6", expectErr: true},
+		"branch name prefix": {expected: "refs/heads/master", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateExpectedGitRef(test.expected)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := GitRefMatches(ref, test.expected); got != test.expMatch {
+				t.Errorf("expected match=%v but got %v", test.expMatch, got)
+			}
+		})
+	}
+}
+
+func TestTagExists(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		expExists  bool
+		expErr     bool
+	}{
+		"existing tag": {statusCode: http.StatusOK, expExists: true},
+		"missing tag":  {statusCode: http.StatusNotFound},
+		"server error": {statusCode: http.StatusInternalServerError, expErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/repos/jetstack/cert-manager/git/ref/tags/v1.6.0" {
+					t.Errorf("unexpected request path %q", r.URL.Path)
+				}
+				w.WriteHeader(test.statusCode)
+				w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			exists, err := TagExists(context.Background(), srv.URL, "jetstack", "cert-manager", "v1.6.0", "")
+			if test.expErr != (err != nil) {
+				t.Fatalf("expErr=%v but got err: %v", test.expErr, err)
+			}
+			if exists != test.expExists {
+				t.Errorf("unexpected result: got=%v, exp=%v", exists, test.expExists)
+			}
+		})
+	}
+}
+
+func TestCreateTag(t *testing.T) {
+	tests := map[string]struct {
+		force       bool
+		tagExists   bool
+		expRequests []string
+		expErr      bool
+	}{
+		"new tag is created": {
+			expRequests: []string{"POST /git/tags", "POST /git/refs"},
+		},
+		"existing tag is not overwritten without force": {
+			tagExists:   true,
+			expRequests: []string{"POST /git/tags", "POST /git/refs"},
+			expErr:      true,
+		},
+		"existing tag is moved with force": {
+			force:       true,
+			tagExists:   true,
+			expRequests: []string{"POST /git/tags", "GET /git/ref/tags/v1.6.0", "PATCH /git/refs/tags/v1.6.0"},
+		},
+		"new tag is created with force": {
+			force:       true,
+			expRequests: []string{"POST /git/tags", "GET /git/ref/tags/v1.6.0", "POST /git/refs"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path := strings.TrimPrefix(r.URL.Path, "/api/v3/repos/jetstack/cert-manager")
+				requests = append(requests, r.Method+" "+path)
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("unexpected Authorization header %q", got)
+				}
+
+				switch {
+				case r.Method == http.MethodPost && path == "/git/tags":
+					var body map[string]string
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Errorf("failed to decode request: %v", err)
+					}
+					if body["tag"] != "v1.6.0" || body["object"] != "abc123" || body["type"] != "commit" {
+						t.Errorf("unexpected tag object request: %v", body)
+					}
+					w.WriteHeader(http.StatusCreated)
+					w.Write([]byte(`{"sha": "tag456"}`))
+				case r.Method == http.MethodGet && test.tagExists:
+					w.Write([]byte(`{}`))
+				case r.Method == http.MethodPost && path == "/git/refs" && test.tagExists:
+					w.WriteHeader(http.StatusUnprocessableEntity)
+				case r.Method == http.MethodPost && path == "/git/refs":
+					w.WriteHeader(http.StatusCreated)
+				case r.Method == http.MethodPatch:
+					w.Write([]byte(`{}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			sha, err := CreateTag(context.Background(), srv.URL, "jetstack", "cert-manager", "v1.6.0", "abc123", "cert-manager v1.6.0", "secret", test.force)
+			if test.expErr != (err != nil) {
+				t.Fatalf("expErr=%v but got err: %v", test.expErr, err)
+			}
+			if !test.expErr && sha != "tag456" {
+				t.Errorf("unexpected tag sha %q", sha)
+			}
+			if !reflect.DeepEqual(requests, test.expRequests) {
+				t.Errorf("unexpected requests:\ngot: %v\nexp: %v", requests, test.expRequests)
+			}
+		})
+	}
+}
+
+func TestCreateTag_NoToken(t *testing.T) {
+	if _, err := CreateTag(context.Background(), "", "jetstack", "cert-manager", "v1.6.0", "abc123", "", "", false); err == nil {
+		t.Errorf("expected an error creating a tag without a token")
+	}
+}
+
+func TestNormalizeGitHubBaseURL(t *testing.T) {
+	tests := map[string]struct {
+		baseURL string
+		exp     string
+		expErr  bool
+	}{
+		"empty defaults to the public API": {
+			baseURL: "",
+			exp:     DefaultGitHubAPIURL,
+		},
+		"public API is unchanged": {
+			baseURL: "https://api.github.com",
+			exp:     DefaultGitHubAPIURL,
+		},
+		"public API trailing slash is removed": {
+			baseURL: "https://api.github.com/",
+			exp:     DefaultGitHubAPIURL,
+		},
+		"github.com is mapped to the public API": {
+			baseURL: "https://github.com",
+			exp:     DefaultGitHubAPIURL,
+		},
+		"enterprise host has the API path appended": {
+			baseURL: "https://github.example.com",
+			exp:     "https://github.example.com/api/v3",
+		},
+		"enterprise host with trailing slash has the API path appended": {
+			baseURL: "https://github.example.com/",
+			exp:     "https://github.example.com/api/v3",
+		},
+		"enterprise API path is unchanged": {
+			baseURL: "https://github.example.com/api/v3",
+			exp:     "https://github.example.com/api/v3",
+		},
+		"enterprise API path trailing slash is removed": {
+			baseURL: "https://github.example.com/api/v3/",
+			exp:     "https://github.example.com/api/v3",
+		},
+		"port is preserved": {
+			baseURL: "http://localhost:8080",
+			exp:     "http://localhost:8080/api/v3",
+		},
+		"missing scheme errors": {
+			baseURL: "github.example.com",
+			expErr:  true,
+		},
+		"unsupported scheme errors": {
+			baseURL: "ftp://github.example.com",
+			expErr:  true,
+		},
+		"query errors": {
+			baseURL: "https://github.example.com?foo=bar",
+			expErr:  true,
+		},
+		"public API with path errors": {
+			baseURL: "https://api.github.com/api/v3",
+			expErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormalizeGitHubBaseURL(test.baseURL)
+			if test.expErr != (err != nil) {
+				t.Fatalf("expErr=%v but got err: %v", test.expErr, err)
+			}
+			if got != test.exp {
+				t.Errorf("unexpected URL: got=%q, exp=%q", got, test.exp)
+			}
+		})
+	}
+}
+
+func TestLookupBranchRef_Cancel(t *testing.T) {
+	received := make(chan struct{})
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		// simulate a stalled connection, which never sends a response
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := LookupBranchRef(ctx, srv.URL, "jetstack", "cert-manager", "master", "")
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a context cancelled error but got: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("LookupBranchRef did not return after its context was cancelled")
+	}
+}
+
+func TestLookupBranchRef_BaseURL(t *testing.T) {
+	tests := map[string]struct {
+		path    string
+		expPath string
+	}{
+		"host only uses the enterprise API path": {
+			path:    "",
+			expPath: "/api/v3/repos/jetstack/cert-manager/git/ref/heads/master",
+		},
+		"explicit path prefix is used as-is": {
+			path:    "/github/api/v3/",
+			expPath: "/github/api/v3/repos/jetstack/cert-manager/git/ref/heads/master",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.Write([]byte(`{"object": {"sha": "abc123"}}`))
+			}))
+			defer srv.Close()
+
+			if _, err := LookupBranchRef(context.Background(), srv.URL+test.path, "jetstack", "cert-manager", "master", ""); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotPath != test.expPath {
+				t.Errorf("request sent to unexpected path: got=%q, exp=%q", gotPath, test.expPath)
+			}
+		})
+	}
+}
+
+func TestListBranches(t *testing.T) {
+	tests := map[string]struct {
+		branchCount int
+		statusCode  int
+		expPages    int
+		expErr      bool
+	}{
+		"single page": {
+			branchCount: 3,
+			statusCode:  http.StatusOK,
+			expPages:    1,
+		},
+		"multiple pages": {
+			branchCount: 250,
+			statusCode:  http.StatusOK,
+			expPages:    3,
+		},
+		"number of pages is bounded": {
+			branchCount: 2000,
+			statusCode:  http.StatusOK,
+			expPages:    maxBranchPages,
+		},
+		"error response": {
+			statusCode: http.StatusNotFound,
+			expPages:   1,
+			expErr:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pages := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				pages++
+				if r.URL.Path != "/api/v3/repos/jetstack/cert-manager/branches" {
+					t.Errorf("unexpected request path %q", r.URL.Path)
+				}
+				if test.statusCode != http.StatusOK {
+					w.WriteHeader(test.statusCode)
+					return
+				}
+
+				page, err := strconv.Atoi(r.URL.Query().Get("page"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var names []string
+				for i := (page - 1) * 100; i < page*100 && i < test.branchCount; i++ {
+					names = append(names, fmt.Sprintf(`{"name": "branch-%d"}`, i))
+				}
+				w.Write([]byte("[" + strings.Join(names, ",") + "]"))
+			}))
+			defer srv.Close()
+
+			branches, err := ListBranches(context.Background(), srv.URL, "jetstack", "cert-manager", "")
+			if test.expErr != (err != nil) {
+				t.Fatalf("expErr=%v but got err: %v", test.expErr, err)
+			}
+			if pages != test.expPages {
+				t.Errorf("expected %d pages to be requested but got %d", test.expPages, pages)
+			}
+
+			expCount := test.branchCount
+			if expCount > maxBranchPages*100 {
+				expCount = maxBranchPages * 100
+			}
+			if len(branches) != expCount {
+				t.Errorf("expected %d branches but got %d", expCount, len(branches))
+			}
+			if len(branches) > 0 && branches[0] != "branch-0" {
+				t.Errorf("unexpected first branch %q", branches[0])
+			}
+		})
+	}
+}
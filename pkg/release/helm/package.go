@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// PackageChart loads the Helm chart source directory at chartDir, stamps it
+// with the given release version as both its version and appVersion, and
+// writes the packaged chart into destDir, as 'helm package' would.
+// The path to the packaged chart and the chart's metadata are returned.
+func PackageChart(chartDir, releaseVersion, destDir string) (string, *chart.Metadata, error) {
+	c, err := loader.LoadDir(chartDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load chart from %q: %w", chartDir, err)
+	}
+
+	c.Metadata.Version = releaseVersion
+	c.Metadata.AppVersion = releaseVersion
+	if err := c.Validate(); err != nil {
+		return "", nil, fmt.Errorf("invalid chart %q: %w", chartDir, err)
+	}
+
+	path, err := chartutil.Save(c, destDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to package chart %q: %w", chartDir, err)
+	}
+
+	return path, c.Metadata, nil
+}
+
+// AddChartToIndex adds an entry for the packaged chart at chartPath, with the
+// given metadata, to a Helm repository index. The entry's URL is the chart's
+// file name resolved against baseURL.
+// An error is returned if the index already contains the chart's version, as
+// a published chart version must never change.
+func AddChartToIndex(index *repo.IndexFile, md *chart.Metadata, chartPath, baseURL string) error {
+	if index.Has(md.Name, md.Version) {
+		return fmt.Errorf("chart %q version %q is already present in the repository index", md.Name, md.Version)
+	}
+
+	digest, err := provenance.DigestFile(chartPath)
+	if err != nil {
+		return fmt.Errorf("failed to compute digest of %q: %w", chartPath, err)
+	}
+
+	if err := index.MustAdd(md, filepath.Base(chartPath), baseURL, digest); err != nil {
+		return fmt.Errorf("failed to add chart %q to repository index: %w", chartPath, err)
+	}
+
+	index.SortEntries()
+
+	return nil
+}
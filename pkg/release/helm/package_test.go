@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestPackageChart(t *testing.T) {
+	dir := t.TempDir()
+
+	path, md, err := PackageChart("testdata/cert-manager", "v1.6.0", dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "cert-manager-v1.6.0.tgz"), path)
+	require.Equal(t, "v1.6.0", md.Version)
+	require.Equal(t, "v1.6.0", md.AppVersion)
+
+	// the version must be stamped into the packaged chart itself
+	c, err := loader.LoadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "v1.6.0", c.Metadata.Version)
+	require.Equal(t, "v1.6.0", c.Metadata.AppVersion)
+}
+
+func TestAddChartToIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	path, md, err := PackageChart("testdata/cert-manager", "v1.6.0", dir)
+	require.NoError(t, err)
+
+	index := repo.NewIndexFile()
+	require.NoError(t, AddChartToIndex(index, md, path, "https://charts.example.com/stable"))
+
+	entry, err := index.Get("cert-manager", "v1.6.0")
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://charts.example.com/stable/cert-manager-v1.6.0.tgz"}, entry.URLs)
+	require.NotEmpty(t, entry.Digest)
+
+	// a chart version which has already been published must not be replaced
+	require.Error(t, AddChartToIndex(index, md, path, "https://charts.example.com/stable"))
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// stageLocksDir is the directory under a bucket path prefix which contains
+// the lock objects of builds currently being staged. It is kept apart from
+// staged builds so that locks are never mistaken for staged artifacts.
+const stageLocksDir = "locks"
+
+// StageLockObjectName returns the name of the lock object for the build
+// which is staged to BucketPathForRelease with the same arguments.
+func StageLockObjectName(bucketPrefix, buildType, releaseVersion, gitRef string) string {
+	name := path.Base(BucketPathForRelease(bucketPrefix, buildType, releaseVersion, gitRef))
+	return path.Join(bucketPrefix, stageLocksDir, buildType, name+".json")
+}
+
+// StageLock is the content of a lock object, recording who is staging a
+// build so that the same build isn't staged by anyone else at the same time.
+type StageLock struct {
+	// Holder identifies who acquired the lock.
+	Holder string `json:"holder"`
+
+	// ReleaseVersion is the version of the build being staged, which is
+	// empty for devel builds.
+	ReleaseVersion string `json:"releaseVersion,omitempty"`
+
+	// GitRef is the git commit ref of the build being staged.
+	GitRef string `json:"gitRef"`
+
+	// AcquiredAt is the time at which the lock was acquired.
+	AcquiredAt time.Time `json:"acquiredAt"`
+
+	// ExpiresAt is the time after which the lock is considered stale, as the
+	// build it was acquired for can no longer be running.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// StageLockedError is returned by AcquireStageLock if the lock is already
+// held.
+type StageLockedError struct {
+	// Object is the name of the existing lock object.
+	Object string
+
+	// Lock is the content of the existing lock object.
+	Lock StageLock
+
+	// Stale is true if the existing lock has expired.
+	Stale bool
+}
+
+func (e *StageLockedError) Error() string {
+	if e.Stale {
+		return fmt.Sprintf("stale lock %q held by %s since %s expired at %s", e.Object, e.Lock.Holder, e.Lock.AcquiredAt.Format(time.RFC3339), e.Lock.ExpiresAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("lock %q is held by %s since %s until %s", e.Object, e.Lock.Holder, e.Lock.AcquiredAt.Format(time.RFC3339), e.Lock.ExpiresAt.Format(time.RFC3339))
+}
+
+// HeldStageLock is a lock acquired by AcquireStageLock.
+type HeldStageLock struct {
+	obj        *storage.ObjectHandle
+	generation int64
+}
+
+// AcquireStageLock writes lock to obj, returning a *StageLockedError if obj
+// already holds a lock which hasn't expired, or which has expired unless
+// force is set. The lock is written using a precondition on the generation
+// of obj, so that only one of any concurrent attempts to acquire it succeeds.
+func AcquireStageLock(ctx context.Context, obj *storage.ObjectHandle, lock StageLock, force bool) (*HeldStageLock, error) {
+	conds := storage.Conditions{DoesNotExist: true}
+
+	r, err := obj.NewReader(ctx)
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read lock %q: %w", obj.ObjectName(), err)
+	default:
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lock %q: %w", obj.ObjectName(), err)
+		}
+		var existing StageLock
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return nil, fmt.Errorf("failed to parse lock %q: %w", obj.ObjectName(), err)
+		}
+		if err := checkStageLock(obj.ObjectName(), existing, lock.AcquiredAt, force); err != nil {
+			return nil, err
+		}
+		log.Printf("WARNING: overriding stale lock %q held by %s which expired at %s", obj.ObjectName(), existing.Holder, existing.ExpiresAt.Format(time.RFC3339))
+		conds = storage.Conditions{GenerationMatch: r.Attrs.Generation}
+	}
+
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	w := obj.If(conds).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to write lock %q: %w", obj.ObjectName(), err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write lock %q, it may have been acquired concurrently: %w", obj.ObjectName(), err)
+	}
+
+	return &HeldStageLock{obj: obj, generation: w.Attrs().Generation}, nil
+}
+
+// checkStageLock returns a *StageLockedError if the existing lock written to
+// the named object can't be overridden at the given time.
+func checkStageLock(object string, existing StageLock, now time.Time, force bool) error {
+	stale := !now.Before(existing.ExpiresAt)
+	if stale && force {
+		return nil
+	}
+	return &StageLockedError{Object: object, Lock: existing, Stale: stale}
+}
+
+// Release deletes the lock object, provided that it hasn't since been
+// overwritten by someone else overriding the lock.
+func (l *HeldStageLock) Release(ctx context.Context) error {
+	if err := l.obj.If(storage.Conditions{GenerationMatch: l.generation}).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to release lock %q: %w", l.obj.ObjectName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStageLockObjectName(t *testing.T) {
+	tests := map[string]struct {
+		buildType, releaseVersion, gitRef string
+		exp                               string
+	}{
+		"release build": {
+			buildType:      BuildTypeRelease,
+			releaseVersion: "v1.6.0",
+			gitRef:         "abc",
+			exp:            "stage/gcb/locks/release/v1.6.0-abc.json",
+		},
+		"devel build": {
+			buildType: BuildTypeDevel,
+			gitRef:    "abc",
+			exp:       "stage/gcb/locks/devel/abc.json",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := StageLockObjectName("stage/gcb", test.buildType, test.releaseVersion, test.gitRef); got != test.exp {
+				t.Errorf("unexpected lock object name: got=%q, exp=%q", got, test.exp)
+			}
+		})
+	}
+}
+
+func TestCheckStageLock(t *testing.T) {
+	now := time.Date(2021, 10, 14, 12, 0, 0, 0, time.UTC)
+	fresh := StageLock{Holder: "jake", AcquiredAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	stale := StageLock{Holder: "jake", AcquiredAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+
+	tests := map[string]struct {
+		existing  StageLock
+		force     bool
+		expLocked bool
+		expStale  bool
+	}{
+		"fresh lock is refused": {
+			existing:  fresh,
+			expLocked: true,
+		},
+		"fresh lock can't be forced": {
+			existing:  fresh,
+			force:     true,
+			expLocked: true,
+		},
+		"stale lock is refused without force": {
+			existing:  stale,
+			expLocked: true,
+			expStale:  true,
+		},
+		"stale lock is overridden with force": {
+			existing: stale,
+			force:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkStageLock("locks/release/v1.6.0-abc.json", test.existing, now, test.force)
+			if !test.expLocked {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var locked *StageLockedError
+			if !errors.As(err, &locked) {
+				t.Fatalf("expected a StageLockedError but got: %v", err)
+			}
+			if locked.Stale != test.expStale {
+				t.Errorf("unexpected stale: got=%t, exp=%t", locked.Stale, test.expStale)
+			}
+		})
+	}
+}
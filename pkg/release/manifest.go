@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// ManifestFileName is the name of the release manifest file in the root
+	// of a staged release.
+	ManifestFileName = "release-manifest.json"
+
+	// ManifestSchemaVersion is the version of the Manifest schema written by
+	// this version of the release tooling. It is incremented whenever a
+	// change is made to the schema which older consumers could not safely
+	// ignore.
+	ManifestSchemaVersion = 1
+)
+
+// Manifest is a machine-readable index describing every file that makes up
+// a staged release. Unlike Metadata, it is intended for consumption by tools
+// outside of this repository and so its schema is versioned.
+type Manifest struct {
+	// SchemaVersion is the version of the schema the manifest was written
+	// with.
+	SchemaVersion int `json:"schemaVersion"`
+
+	// ReleaseVersion is the version of the release. It is empty for devel
+	// builds.
+	ReleaseVersion string `json:"releaseVersion"`
+
+	// GitCommitRef is the git commit ref that the release was built from.
+	GitCommitRef string `json:"gitCommitRef"`
+
+	// BuildID, if known, is the ID of the GCB build which staged the release.
+	BuildID string `json:"buildID,omitempty"`
+
+	// CmrelVersion, if known, is the version of cmrel which submitted the
+	// GCB build which staged the release.
+	CmrelVersion string `json:"cmrelVersion,omitempty"`
+
+	// Created is the time at which the manifest was written.
+	Created time.Time `json:"created"`
+
+	// Artifacts is the list of every file in the release, other than the
+	// manifest itself and any signature files.
+	Artifacts []ManifestArtifact `json:"artifacts"`
+}
+
+// ManifestArtifact describes a single file within a release.
+type ManifestArtifact struct {
+	// Name of the artifact within the release directory.
+	Name string `json:"name"`
+
+	// Path is the full GCS URI of the artifact.
+	Path string `json:"path"`
+
+	// Size of the artifact in bytes.
+	Size int64 `json:"size"`
+
+	// SHA256 is the hex-encoded SHA256 checksum of the artifact.
+	SHA256 string `json:"sha256"`
+
+	// OS, if specified, is the OS that this artifact was built for.
+	OS string `json:"os,omitempty"`
+
+	// Architecture, if specified, is the architecture that this artifact was
+	// built for.
+	Architecture string `json:"architecture,omitempty"`
+
+	// Compression, if the artifact is a compressed tarball, is the format it
+	// is compressed with, either 'gzip' or 'zstd'.
+	Compression string `json:"compression,omitempty"`
+
+	// Signature, if set, is the name of the file within the release
+	// directory containing a detached signature which covers the artifact,
+	// e.g. a signature of the SHA256SUMS file which includes its checksum.
+	Signature string `json:"signature,omitempty"`
+}
+
+// Marshal encodes the manifest as indented JSON. If SchemaVersion is not
+// set, the manifest is written with the current ManifestSchemaVersion.
+func (m *Manifest) Marshal() ([]byte, error) {
+	out := *m
+	if out.SchemaVersion == 0 {
+		out.SchemaVersion = ManifestSchemaVersion
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// Unmarshal decodes a JSON encoded manifest into m. Fields which are not
+// known to this version of the schema are ignored, but an error is returned
+// if the manifest was written with a newer schema version than is supported.
+func (m *Manifest) Unmarshal(data []byte) error {
+	var decoded Manifest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("failed to decode release manifest: %w", err)
+	}
+
+	switch {
+	case decoded.SchemaVersion == 0:
+		return fmt.Errorf("release manifest does not specify a schemaVersion")
+	case decoded.SchemaVersion > ManifestSchemaVersion:
+		return fmt.Errorf("release manifest has schemaVersion %d but the newest supported version is %d", decoded.SchemaVersion, ManifestSchemaVersion)
+	}
+
+	*m = decoded
+	return nil
+}
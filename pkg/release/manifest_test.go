@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	m := Manifest{
+		ReleaseVersion: "v1.6.0",
+		GitCommitRef:   "6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0",
+		BuildID:        "abc-123",
+		Created:        time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC),
+		Artifacts: []ManifestArtifact{
+			{
+				Name:         "cert-manager-server-linux-amd64.tar.gz",
+				Path:         "gs://cert-manager-release/stage/gcb/release/v1.6.0-6d3ce5e2c8a1f7e4b1d2f0e5c3b4a5d6e7f8a9b0/cert-manager-server-linux-amd64.tar.gz",
+				Size:         1024,
+				SHA256:       "deadbeef",
+				OS:           "linux",
+				Architecture: "amd64",
+				Signature:    "SHA256SUMS.sig",
+			},
+		},
+	}
+
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error marshalling manifest: %v", err)
+	}
+
+	var got Manifest
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatalf("unexpected error unmarshalling manifest: %v", err)
+	}
+
+	expected := m
+	expected.SchemaVersion = ManifestSchemaVersion
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("manifest did not round trip:\ngot: %+v\nexp: %+v", got, expected)
+	}
+}
+
+func TestManifestUnmarshal(t *testing.T) {
+	tests := map[string]struct {
+		data       string
+		expVersion string
+		expErr     bool
+	}{
+		"current schema version": {
+			data:       `{"schemaVersion": 1, "releaseVersion": "v1.6.0"}`,
+			expVersion: "v1.6.0",
+		},
+		"unknown fields are ignored": {
+			data:       `{"schemaVersion": 1, "releaseVersion": "v1.6.0", "somethingNew": true}`,
+			expVersion: "v1.6.0",
+		},
+		"missing schema version errors": {
+			data:   `{"releaseVersion": "v1.6.0"}`,
+			expErr: true,
+		},
+		"newer schema version errors": {
+			data:   `{"schemaVersion": 2, "releaseVersion": "v1.6.0"}`,
+			expErr: true,
+		},
+		"invalid JSON errors": {
+			data:   `{`,
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var m Manifest
+			err := m.Unmarshal([]byte(test.data))
+			if test.expErr != (err != nil) {
+				t.Fatalf("expErr=%v but got err: %v", test.expErr, err)
+			}
+			if m.ReleaseVersion != test.expVersion {
+				t.Errorf("unexpected release version: got=%q, exp=%q", m.ReleaseVersion, test.expVersion)
+			}
+		})
+	}
+}
@@ -39,7 +39,7 @@ type ArtifactMetadata struct {
 	SHA256 string `json:"sha256"`
 
 	// OS, if specified, is the OS parameter that this artifact was built for.
-	// This could be 'linux', 'darwin', 'windows' etc.
+	// This could be 'linux', 'darwin', 'freebsd', 'windows' etc.
 	OS string `json:"os,omitempty"`
 
 	// Architecture, if specified, is the architecture that this artifact was
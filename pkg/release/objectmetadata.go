@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// ObjectMetadataReleaseVersionKey is the GCS object metadata key holding
+	// the version of the release an object belongs to.
+	ObjectMetadataReleaseVersionKey = "cmrel-version"
+
+	// ObjectMetadataGitRefKey is the GCS object metadata key holding the git
+	// commit ref the release an object belongs to was built from.
+	ObjectMetadataGitRefKey = "cmrel-git-ref"
+
+	// ObjectMetadataBuildIDKey is the GCS object metadata key holding the ID
+	// of the GCB build which staged the object.
+	ObjectMetadataBuildIDKey = "cmrel-build-id"
+)
+
+// ObjectMetadata is the custom metadata set on GCS objects which are part of
+// a staged or promoted release, allowing objects to be identified without
+// parsing their paths.
+type ObjectMetadata struct {
+	ReleaseVersion string
+	GitRef         string
+	BuildID        string
+}
+
+// Map returns the metadata as a map of GCS object metadata keys to values.
+// Empty values are omitted.
+func (m ObjectMetadata) Map() map[string]string {
+	md := make(map[string]string)
+	for key, value := range map[string]string{
+		ObjectMetadataReleaseVersionKey: m.ReleaseVersion,
+		ObjectMetadataGitRefKey:         m.GitRef,
+		ObjectMetadataBuildIDKey:        m.BuildID,
+	} {
+		if value != "" {
+			md[key] = value
+		}
+	}
+	return md
+}
+
+// ObjectMetadataFromMap returns the ObjectMetadata stored in the given GCS
+// object metadata, ignoring any unrelated keys.
+func ObjectMetadataFromMap(md map[string]string) ObjectMetadata {
+	return ObjectMetadata{
+		ReleaseVersion: md[ObjectMetadataReleaseVersionKey],
+		GitRef:         md[ObjectMetadataGitRefKey],
+		BuildID:        md[ObjectMetadataBuildIDKey],
+	}
+}
+
+// CopyObject copies src to dst server-side. The metadata of src is preserved,
+// with any non-empty fields of meta taking precedence.
+func CopyObject(ctx context.Context, dst, src *storage.ObjectHandle, meta ObjectMetadata) error {
+	attrs, err := src.Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read attributes of %q: %w", src.ObjectName(), err)
+	}
+
+	md := make(map[string]string)
+	for key, value := range attrs.Metadata {
+		md[key] = value
+	}
+	for key, value := range meta.Map() {
+		md[key] = value
+	}
+
+	copier := dst.CopierFrom(src)
+	copier.ContentType = attrs.ContentType
+	copier.Metadata = md
+	_, err = copier.Run(ctx)
+	return err
+}
+
+// ReadObjectMetadata returns the ObjectMetadata set on obj.
+func ReadObjectMetadata(ctx context.Context, obj *storage.ObjectHandle) (ObjectMetadata, error) {
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return ObjectMetadata{}, fmt.Errorf("failed to read attributes of %q: %w", obj.ObjectName(), err)
+	}
+	return ObjectMetadataFromMap(attrs.Metadata), nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObjectMetadata(t *testing.T) {
+	tests := map[string]struct {
+		meta ObjectMetadata
+		exp  map[string]string
+	}{
+		"all fields set": {
+			meta: ObjectMetadata{ReleaseVersion: "v1.6.0", GitRef: "abc", BuildID: "1234"},
+			exp: map[string]string{
+				"cmrel-version":  "v1.6.0",
+				"cmrel-git-ref":  "abc",
+				"cmrel-build-id": "1234",
+			},
+		},
+		"empty fields are omitted": {
+			meta: ObjectMetadata{GitRef: "abc"},
+			exp:  map[string]string{"cmrel-git-ref": "abc"},
+		},
+		"no fields set": {
+			meta: ObjectMetadata{},
+			exp:  map[string]string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			md := test.meta.Map()
+			if !reflect.DeepEqual(md, test.exp) {
+				t.Errorf("expected metadata %v but got %v", test.exp, md)
+			}
+
+			// unrelated keys, e.g. set by other tools, are ignored
+			md["other-key"] = "value"
+			if got := ObjectMetadataFromMap(md); got != test.meta {
+				t.Errorf("expected %+v to be read back but got %+v", test.meta, got)
+			}
+		})
+	}
+}
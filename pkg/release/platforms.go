@@ -38,6 +38,7 @@ var (
 	ClientPlatforms = map[string][]string{
 		"linux":   []string{"amd64", "arm", "arm64", "ppc64le", "s390x"},
 		"darwin":  []string{"amd64", "arm64"},
+		"freebsd": []string{"amd64", "arm64"},
 		"windows": []string{"amd64"},
 	}
 
@@ -46,6 +47,7 @@ var (
 	ArchitecturesPerOS = map[string][]string{
 		"linux":   []string{"amd64", "arm", "arm64", "ppc64le", "s390x"},
 		"darwin":  []string{"amd64", "arm64"},
+		"freebsd": []string{"amd64", "arm64"},
 		"windows": []string{"amd64"},
 	}
 )
@@ -79,9 +81,6 @@ func AllArchesForOSes(osList sets.String) sets.String {
 	return knownArches
 }
 
-// AllOSes returns a slice of all known architectures which cert-manager targets
-// including both server and client targets.
-
 func mapKeys(in map[string][]string) []string {
 	keys := make([]string, 0, len(in))
 	for k := range in {
@@ -93,29 +92,14 @@ func mapKeys(in map[string][]string) []string {
 
 // OSListFromString parses and validates a comma-separated list of OSes, returning an error if any are invalid or a slice
 // of valid OSes if all are OK.
+// The list may contain '*' to include all known OSes, and OSes prefixed with '!' are removed from the list, e.g.
+// "*,!windows" means all known OSes except windows.
 func OSListFromString(targetOSes string) (sets.String, error) {
-	allOSes := AllOSes()
-
-	splitList := strings.Split(strings.TrimSpace(targetOSes), ",")
-
-	if len(splitList) == 1 && splitList[0] == "*" {
-		return allOSes, nil
-	}
-
-	osListOut := sets.String{}
-
-	for _, rawOS := range splitList {
-		os := strings.ToLower(strings.TrimSpace(rawOS))
-
-		if len(os) == 0 {
-			continue
-		}
-
-		if !allOSes.Has(os) {
-			return nil, fmt.Errorf("unknown os %q", rawOS)
-		}
-
-		osListOut = osListOut.Insert(os)
+	osListOut, err := parseTargetList(targetOSes, AllOSes(), func(rawOS string) error {
+		return fmt.Errorf("unknown os %q", rawOS)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	if len(osListOut) == 0 {
@@ -128,37 +112,94 @@ func OSListFromString(targetOSes string) (sets.String, error) {
 // ArchListFromString parses and validates a comma-separated list of arches, returning a slice of valid arches if all are OK.
 // Returns an error on an unknown architecture or an architecture which isn't a valid target for the given
 // OSes for this invocation (e.g. will error if osList == []string{"windows"} and targetArches == "s390x")
+// As with OSListFromString, '*' and '!'-prefixed arches can be used to include all arches or remove individual arches.
+// Arches which are named explicitly must be supported on every one of the given OSes, and every OS must be left
+// with at least one supported arch, so that no requested OS/arch combination is silently skipped. Arches added
+// by '*' are only built for the OSes which support them.
 // Panics if given an unknown OS
 func ArchListFromString(targetArches string, osList sets.String) (sets.String, error) {
-	allArches := AllArchesForOSes(osList)
+	archListOut, err := parseTargetList(targetArches, AllArchesForOSes(osList), func(rawArch string) error {
+		return fmt.Errorf("unknown arch %q; if it's a valid arch, it might not be supported on any of the given OSes", rawArch)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	splitList := strings.Split(targetArches, ",")
+	if len(archListOut) == 0 {
+		return nil, fmt.Errorf("invalid architecture list; no arches specified")
+	}
 
-	if len(splitList) == 1 && splitList[0] == "*" {
-		return allArches, nil
+	for _, arch := range explicitTargets(targetArches) {
+		if !archListOut.Has(arch) {
+			// the arch was also excluded using '!'
+			continue
+		}
+
+		for _, os := range osList.List() {
+			if !IsSupportedPlatform(os, arch) {
+				return nil, fmt.Errorf("unsupported platform %q; arch %q is not built for os %q", Platform{OS: os, Arch: arch}, arch, os)
+			}
+		}
 	}
 
-	archListOut := sets.String{}
+	for _, os := range osList.List() {
+		if !archListOut.HasAny(ArchitecturesPerOS[os]...) {
+			return nil, fmt.Errorf("no supported arches specified for os %q; options: %s", os, strings.Join(ArchitecturesPerOS[os], ", "))
+		}
+	}
 
-	for _, rawArch := range splitList {
-		arch := strings.ToLower(strings.TrimSpace(rawArch))
+	return archListOut, nil
+}
 
-		if len(arch) == 0 {
+// explicitTargets returns the entries of a comma-separated target list which name a single target to include,
+// i.e. ignoring '*' and any entries prefixed with '!'.
+func explicitTargets(rawList string) []string {
+	var explicit []string
+	for _, rawEntry := range strings.Split(rawList, ",") {
+		entry := strings.ToLower(strings.TrimSpace(rawEntry))
+		if len(entry) == 0 || entry == "*" || strings.HasPrefix(entry, "!") {
 			continue
 		}
+		explicit = append(explicit, entry)
+	}
+	return explicit
+}
 
-		if !allArches.Has(arch) {
-			return nil, fmt.Errorf("unknown arch %q; if it's a valid arch, it might not be supported on any of the given OSes", rawArch)
+// parseTargetList parses a comma-separated list of targets, each of which must be in the known set.
+// An entry of '*' adds all known targets to the list, and any entries prefixed with '!' are removed from the
+// list once all other entries have been added. unknownErr is called to construct the error returned for an
+// entry which isn't in the known set.
+func parseTargetList(rawList string, known sets.String, unknownErr func(string) error) (sets.String, error) {
+	listOut := sets.String{}
+	var negated []string
+
+	for _, rawEntry := range strings.Split(rawList, ",") {
+		entry := strings.ToLower(strings.TrimSpace(rawEntry))
+
+		if len(entry) == 0 {
+			continue
 		}
 
-		archListOut = archListOut.Insert(arch)
-	}
+		if entry == "*" {
+			listOut = listOut.Union(known)
+			continue
+		}
 
-	if len(archListOut) == 0 {
-		return nil, fmt.Errorf("invalid architecture list; no arches specified")
+		negate := strings.HasPrefix(entry, "!")
+		entry = strings.TrimSpace(strings.TrimPrefix(entry, "!"))
+
+		if !known.Has(entry) {
+			return nil, unknownErr(strings.TrimSpace(rawEntry))
+		}
+
+		if negate {
+			negated = append(negated, entry)
+		} else {
+			listOut = listOut.Insert(entry)
+		}
 	}
 
-	return archListOut, nil
+	return listOut.Delete(negated...), nil
 }
 
 // IsServerOS returns true if cert-manager can be deployed to the given OS on the server side
@@ -172,3 +213,38 @@ func IsClientOS(os string) bool {
 	_, isClient := ClientPlatforms[os]
 	return isClient
 }
+
+// Platform is a single OS and architecture combination which cert-manager is built for.
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// String returns the platform in the form "os/arch".
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// IsSupportedPlatform returns true if cert-manager is built for the given OS and architecture combination
+func IsSupportedPlatform(os, arch string) bool {
+	for _, supported := range ArchitecturesPerOS[os] {
+		if supported == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetPlatforms returns every supported combination of the given OSes and architectures, sorted by OS and then
+// in the order the architectures are listed in ArchitecturesPerOS. Unsupported combinations are skipped.
+func TargetPlatforms(osList, archList sets.String) []Platform {
+	var platforms []Platform
+	for _, os := range osList.List() {
+		for _, arch := range ArchitecturesPerOS[os] {
+			if archList.Has(arch) {
+				platforms = append(platforms, Platform{OS: os, Arch: arch})
+			}
+		}
+	}
+	return platforms
+}
@@ -19,6 +19,7 @@ package release
 import (
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -38,7 +39,7 @@ func TestOSListFromString(t *testing.T) {
 		"valid asterisk": {
 			input: "*",
 			// this test will break if we add more OSes but that'll be rare
-			expectedOSes: []string{"linux", "windows", "darwin"},
+			expectedOSes: []string{"linux", "windows", "darwin", "freebsd"},
 			expectErr:    false,
 		},
 		"valid with deduping": {
@@ -46,6 +47,11 @@ func TestOSListFromString(t *testing.T) {
 			expectedOSes: []string{"linux", "windows"},
 			expectErr:    false,
 		},
+		"freebsd is a valid OS": {
+			input:        "FreeBSD",
+			expectedOSes: []string{"freebsd"},
+			expectErr:    false,
+		},
 		"no OSes should error": {
 			input:        "",
 			expectedOSes: nil,
@@ -61,6 +67,36 @@ func TestOSListFromString(t *testing.T) {
 			expectedOSes: nil,
 			expectErr:    true,
 		},
+		"asterisk with negation": {
+			input:        "*,!windows",
+			expectedOSes: []string{"linux", "darwin", "freebsd"},
+			expectErr:    false,
+		},
+		"negation is applied regardless of order": {
+			input:        "!Windows, *",
+			expectedOSes: []string{"linux", "darwin", "freebsd"},
+			expectErr:    false,
+		},
+		"negation of an explicitly listed OS": {
+			input:        "linux,darwin,!darwin",
+			expectedOSes: []string{"linux"},
+			expectErr:    false,
+		},
+		"negation of unknown OS should error": {
+			input:        "*,!templeos",
+			expectedOSes: nil,
+			expectErr:    true,
+		},
+		"negation without any OSes should error": {
+			input:        "!windows",
+			expectedOSes: nil,
+			expectErr:    true,
+		},
+		"negating all OSes should error": {
+			input:        "*,!linux,!darwin,!freebsd,!windows",
+			expectedOSes: nil,
+			expectErr:    true,
+		},
 	}
 
 	for name, test := range tests {
@@ -132,6 +168,36 @@ func TestArchListFromString(t *testing.T) {
 			expectedArches: nil,
 			expectErr:      true,
 		},
+		"asterisk with negation": {
+			input:          "*,!s390x,!ppc64le",
+			inputOSes:      []string{"linux"},
+			expectedArches: []string{"amd64", "arm", "arm64"},
+			expectErr:      false,
+		},
+		"negation of arch not valid for OS should error": {
+			input:          "*,!s390x",
+			inputOSes:      []string{"darwin"},
+			expectedArches: nil,
+			expectErr:      true,
+		},
+		"negating all arches should error": {
+			input:          "*,!amd64",
+			inputOSes:      []string{"windows"},
+			expectedArches: nil,
+			expectErr:      true,
+		},
+		"valid asterisk for freebsd": {
+			input:          "*",
+			inputOSes:      []string{"freebsd"},
+			expectedArches: []string{"amd64", "arm64"},
+			expectErr:      false,
+		},
+		"invalid arch for freebsd should error": {
+			input:          "ppc64le",
+			inputOSes:      []string{"freebsd"},
+			expectedArches: nil,
+			expectErr:      true,
+		},
 		"invalid arch for OS should error": {
 			// will break if we add support for s390x on windows, but that's not likely!
 			input:          "s390x",
@@ -139,6 +205,43 @@ func TestArchListFromString(t *testing.T) {
 			expectedArches: nil,
 			expectErr:      true,
 		},
+		"asterisk across OSes only builds supported arches": {
+			input:          "*",
+			inputOSes:      []string{"linux", "windows"},
+			expectedArches: []string{"amd64", "arm", "arm64", "ppc64le", "s390x"},
+			expectErr:      false,
+		},
+		"arch supported on every OS": {
+			input:          "amd64",
+			inputOSes:      []string{"linux", "darwin", "freebsd", "windows"},
+			expectedArches: []string{"amd64"},
+			expectErr:      false,
+		},
+		"arch unsupported on one of the OSes should error": {
+			// windows/arm isn't built
+			input:          "amd64,arm",
+			inputOSes:      []string{"linux", "windows"},
+			expectedArches: nil,
+			expectErr:      true,
+		},
+		"arch unsupported on one of several OSes should error": {
+			input:          "arm64",
+			inputOSes:      []string{"linux", "darwin", "windows"},
+			expectedArches: nil,
+			expectErr:      true,
+		},
+		"explicit arch which is also negated is ignored": {
+			input:          "amd64,arm,!arm",
+			inputOSes:      []string{"linux", "windows"},
+			expectedArches: []string{"amd64"},
+			expectErr:      false,
+		},
+		"OS left without any arches should error": {
+			input:          "*,!amd64",
+			inputOSes:      []string{"linux", "windows"},
+			expectedArches: nil,
+			expectErr:      true,
+		},
 	}
 
 	for name, test := range tests {
@@ -165,3 +268,42 @@ func TestArchListFromString(t *testing.T) {
 		})
 	}
 }
+
+func TestArchListFromString_UnsupportedPlatform(t *testing.T) {
+	_, err := ArchListFromString("arm", sets.NewString("linux", "windows"))
+	if err == nil || !strings.Contains(err.Error(), `"windows/arm"`) {
+		t.Errorf("expected an error naming the unsupported platform but got: %v", err)
+	}
+}
+
+func TestTargetPlatforms(t *testing.T) {
+	tests := map[string]struct {
+		oses   []string
+		arches []string
+		exp    []Platform
+	}{
+		"unsupported combinations are skipped": {
+			oses:   []string{"windows", "linux"},
+			arches: []string{"arm", "amd64"},
+			exp: []Platform{
+				{OS: "linux", Arch: "amd64"},
+				{OS: "linux", Arch: "arm"},
+				{OS: "windows", Arch: "amd64"},
+			},
+		},
+		"no supported combinations": {
+			oses:   []string{"windows"},
+			arches: []string{"s390x"},
+			exp:    nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := TargetPlatforms(sets.NewString(test.oses...), sets.NewString(test.arches...))
+			if !reflect.DeepEqual(test.exp, got) {
+				t.Errorf("expected %v but got %v", test.exp, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ListObjects will list the attributes of all objects in the bucket with the
+// given prefix, paginating through the results.
+func ListObjects(ctx context.Context, bucket *storage.BucketHandle, prefix string) ([]*storage.ObjectAttrs, error) {
+	var attrs []*storage.ObjectAttrs
+	objs := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		objAttr, err := objs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, objAttr)
+	}
+	return attrs, nil
+}
+
+// PromotionCopy is a single object copy made when promoting a release.
+type PromotionCopy struct {
+	// Source is the name of the staged object in the staging bucket.
+	Source string `json:"source"`
+
+	// Destination is the name the object is copied to in the release bucket.
+	Destination string `json:"destination"`
+
+	// Size is the size of the staged object in bytes.
+	Size int64 `json:"size"`
+
+	// Exists is true if an object already exists at Destination, which will
+	// be overwritten.
+	Exists bool `json:"exists"`
+}
+
+// PlanPromotion returns the copies which PromoteRelease will make to promote
+// the given staged release and files to destPath, in the order they're made.
+// sizes maps the base name of each staged object to its size, and existing
+// lists the objects already present in the destination bucket.
+func PlanPromotion(s *Staged, files []string, destPath string, sizes map[string]int64, existing []*storage.ObjectAttrs) ([]PromotionCopy, error) {
+	objs, err := promotedObjects(s, files)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(existing))
+	for _, attrs := range existing {
+		exists[attrs.Name] = true
+	}
+
+	var plan []PromotionCopy
+	for _, src := range objs {
+		name := path.Base(src.ObjectName())
+		dstName := path.Join(destPath, name)
+		plan = append(plan, PromotionCopy{
+			Source:      src.ObjectName(),
+			Destination: dstName,
+			Size:        sizes[name],
+			Exists:      exists[dstName],
+		})
+	}
+	return plan, nil
+}
+
+// PromoteRelease will copy all artifacts of the given staged release, as well
+// as its metadata file and the other named files such as its checksums and
+// signatures, into the dst bucket under destPath.
+// Objects are copied server-side, so artifacts are never downloaded locally.
+// The metadata of each object is preserved, and the release's version and git
+// ref are set on objects staged before object metadata was recorded.
+func PromoteRelease(ctx context.Context, s *Staged, files []string, dst *storage.BucketHandle, destPath string) error {
+	meta := ObjectMetadata{
+		ReleaseVersion: s.Metadata().ReleaseVersion,
+		GitRef:         s.Metadata().GitCommitRef,
+	}
+
+	objs, err := promotedObjects(s, files)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range objs {
+		dstName := path.Join(destPath, path.Base(src.ObjectName()))
+		log.Printf("Copying %q to %q", src.ObjectName(), dstName)
+		if err := CopyObject(ctx, dst.Object(dstName), src, meta); err != nil {
+			return fmt.Errorf("failed to copy %q to %q: %w", src.ObjectName(), dstName, err)
+		}
+	}
+
+	return nil
+}
+
+// promotedObjects returns the objects of a staged release which are copied
+// when it is promoted: its metadata file and artifacts, followed by each of
+// the named files which isn't one of those. files are named relative to the
+// staged release's path, and an error is returned if any wasn't staged.
+func promotedObjects(s *Staged, files []string) ([]*storage.ObjectHandle, error) {
+	objs := []*storage.ObjectHandle{s.MetadataObject()}
+	for _, a := range s.Artifacts() {
+		objs = append(objs, a.ObjectHandle)
+	}
+
+	promoted := sets.NewString()
+	for _, obj := range objs {
+		promoted.Insert(path.Base(obj.ObjectName()))
+	}
+
+	for _, name := range files {
+		if promoted.Has(name) {
+			continue
+		}
+		obj := s.File(name)
+		if obj == nil {
+			return nil, fmt.Errorf("staged release %q has no file %q to promote", s.Name(), name)
+		}
+		promoted.Insert(name)
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// MirrorObjects copies every object under prefix in the src bucket to the
+// same name in the dst bucket, returning the number of objects copied.
+// Objects are copied server-side and their metadata is preserved.
+func MirrorObjects(ctx context.Context, src, dst *storage.BucketHandle, prefix string) (int, error) {
+	objs, err := ListObjects(ctx, src, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list objects to mirror: %w", err)
+	}
+
+	for i, attrs := range objs {
+		if err := CopyObject(ctx, dst.Object(attrs.Name), src.Object(attrs.Name), ObjectMetadata{}); err != nil {
+			return i, fmt.Errorf("failed to mirror %q: %w", attrs.Name, err)
+		}
+	}
+
+	return len(objs), nil
+}
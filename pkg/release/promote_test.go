@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+func TestPlanPromotion(t *testing.T) {
+	gcs, err := storage.NewClient(context.Background(), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gcs.Close()
+
+	src := gcs.Bucket("staging")
+	staged := &Staged{
+		name:    "v1.6.0-abc",
+		metaObj: src.Object("stage/gcb/release/v1.6.0-abc/metadata.json"),
+		artifacts: []StagedArtifact{
+			{ObjectHandle: src.Object("stage/gcb/release/v1.6.0-abc/cert-manager-manifests.tar.gz")},
+			{ObjectHandle: src.Object("stage/gcb/release/v1.6.0-abc/cert-manager-server-linux-amd64.tar.gz")},
+		},
+		objects: []*storage.ObjectHandle{
+			src.Object("stage/gcb/release/v1.6.0-abc/metadata.json"),
+			src.Object("stage/gcb/release/v1.6.0-abc/cert-manager-manifests.tar.gz"),
+			src.Object("stage/gcb/release/v1.6.0-abc/cert-manager-server-linux-amd64.tar.gz"),
+			src.Object("stage/gcb/release/v1.6.0-abc/SHA256SUMS"),
+			src.Object("stage/gcb/release/v1.6.0-abc/SHA256SUMS.sig"),
+			src.Object("stage/gcb/release/v1.6.0-abc/SHA256SUMS.pem"),
+			src.Object("stage/gcb/release/v1.6.0-abc/release-manifest.json"),
+		},
+	}
+	files := []string{
+		"cert-manager-manifests.tar.gz",
+		"cert-manager-server-linux-amd64.tar.gz",
+		"metadata.json",
+		"SHA256SUMS",
+		"release-manifest.json",
+		"SHA256SUMS.sig",
+		"SHA256SUMS.pem",
+	}
+	sizes := map[string]int64{
+		"metadata.json":                          100,
+		"cert-manager-manifests.tar.gz":          2000,
+		"cert-manager-server-linux-amd64.tar.gz": 30000,
+		"SHA256SUMS":                             300,
+		"SHA256SUMS.sig":                         96,
+		"SHA256SUMS.pem":                         1200,
+		"release-manifest.json":                  500,
+	}
+	existing := []*storage.ObjectAttrs{
+		{Name: "releases/v1.6.0/cert-manager-manifests.tar.gz"},
+		{Name: "releases/v1.6.0/unrelated.txt"},
+	}
+
+	plan, err := PlanPromotion(staged, files, "releases/v1.6.0", sizes, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []PromotionCopy{
+		{Source: "stage/gcb/release/v1.6.0-abc/metadata.json", Destination: "releases/v1.6.0/metadata.json", Size: 100},
+		{Source: "stage/gcb/release/v1.6.0-abc/cert-manager-manifests.tar.gz", Destination: "releases/v1.6.0/cert-manager-manifests.tar.gz", Size: 2000, Exists: true},
+		{Source: "stage/gcb/release/v1.6.0-abc/cert-manager-server-linux-amd64.tar.gz", Destination: "releases/v1.6.0/cert-manager-server-linux-amd64.tar.gz", Size: 30000},
+		{Source: "stage/gcb/release/v1.6.0-abc/SHA256SUMS", Destination: "releases/v1.6.0/SHA256SUMS", Size: 300},
+		{Source: "stage/gcb/release/v1.6.0-abc/release-manifest.json", Destination: "releases/v1.6.0/release-manifest.json", Size: 500},
+		{Source: "stage/gcb/release/v1.6.0-abc/SHA256SUMS.sig", Destination: "releases/v1.6.0/SHA256SUMS.sig", Size: 96},
+		{Source: "stage/gcb/release/v1.6.0-abc/SHA256SUMS.pem", Destination: "releases/v1.6.0/SHA256SUMS.pem", Size: 1200},
+	}
+	if !reflect.DeepEqual(plan, exp) {
+		t.Errorf("unexpected plan:\ngot: %+v\nexp: %+v", plan, exp)
+	}
+
+	if _, err := PlanPromotion(staged, append(files, "cert-manager.spdx.json"), "releases/v1.6.0", sizes, existing); err == nil {
+		t.Errorf("expected an error planning the promotion of a file which wasn't staged")
+	}
+}
+
+func TestPromoteRelease(t *testing.T) {
+	var copied []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srcPath, dstPath := r.URL.Path, ""
+		if i := strings.Index(r.URL.Path, "/rewriteTo"); i >= 0 {
+			srcPath, dstPath = r.URL.Path[:i], r.URL.Path[i+len("/rewriteTo"):]
+		}
+		if !strings.HasPrefix(srcPath, "/b/staging/o/stage/gcb/release/v1.6.0-abc/") {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && dstPath == "":
+			w.Write([]byte(`{"bucket":"staging","contentType":"application/octet-stream"}`))
+		case r.Method == http.MethodPost && strings.HasPrefix(dstPath, "/b/releases/o/"):
+			var body struct {
+				Metadata map[string]string `json:"metadata"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("failed to decode copy request: %v", err)
+			}
+			if got := ObjectMetadataFromMap(body.Metadata); got.ReleaseVersion != "v1.6.0" || got.GitRef != "abc" {
+				t.Errorf("unexpected metadata set on %q: %+v", dstPath, got)
+			}
+			copied = append(copied, strings.TrimPrefix(dstPath, "/b/releases/o/"))
+			w.Write([]byte(`{"done":true,"resource":{"bucket":"releases"}}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	gcs, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gcs.Close()
+
+	src := gcs.Bucket("staging")
+	staged := &Staged{
+		name:    "v1.6.0-abc",
+		meta:    Metadata{ReleaseVersion: "v1.6.0", GitCommitRef: "abc"},
+		metaObj: src.Object("stage/gcb/release/v1.6.0-abc/metadata.json"),
+		artifacts: []StagedArtifact{
+			{ObjectHandle: src.Object("stage/gcb/release/v1.6.0-abc/cert-manager-manifests.tar.gz")},
+		},
+		objects: []*storage.ObjectHandle{
+			src.Object("stage/gcb/release/v1.6.0-abc/metadata.json"),
+			src.Object("stage/gcb/release/v1.6.0-abc/cert-manager-manifests.tar.gz"),
+			src.Object("stage/gcb/release/v1.6.0-abc/SHA256SUMS"),
+		},
+	}
+
+	if err := PromoteRelease(context.Background(), staged, []string{"SHA256SUMS"}, gcs.Bucket("releases"), "releases/v1.6.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		"releases/v1.6.0/metadata.json",
+		"releases/v1.6.0/cert-manager-manifests.tar.gz",
+		"releases/v1.6.0/SHA256SUMS",
+	}
+	if !reflect.DeepEqual(copied, exp) {
+		t.Errorf("unexpected objects copied:\ngot: %v\nexp: %v", copied, exp)
+	}
+}
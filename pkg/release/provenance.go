@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// PromotionLogFileName is the name of the object in a public release bucket,
+// under DefaultPublishedBucketPathPrefix, which records every promotion made
+// into the bucket, and every rollback of a promoted release, as a JSON-lines
+// file.
+const PromotionLogFileName = "promotions.jsonl"
+
+// PromotionActionRollback is the Action of a PromotionRecord describing a
+// promoted release which was rolled back.
+const PromotionActionRollback = "rollback"
+
+// PromotionRecord is a single entry in the promotion log, describing a staged
+// release which was promoted into a public release bucket, or a promoted
+// release which was rolled back.
+type PromotionRecord struct {
+	// Action is empty for a promotion, or PromotionActionRollback if the
+	// release was rolled back.
+	Action string `json:"action,omitempty"`
+
+	// ReleaseVersion is the version of the promoted release.
+	ReleaseVersion string `json:"releaseVersion"`
+
+	// GitCommitRef is the commit the promoted release was built from.
+	GitCommitRef string `json:"gitCommitRef"`
+
+	// BuildID is the ID of the GCB build which staged the release, if known.
+	BuildID string `json:"buildID,omitempty"`
+
+	// Source is the GCS path of the staged release which was promoted, or of
+	// the published release which was rolled back.
+	Source string `json:"source"`
+
+	// Destination is the GCS path the release was promoted to, or moved to
+	// when it was rolled back. It is empty if a rolled back release was
+	// deleted.
+	Destination string `json:"destination"`
+
+	// PromotedBy identifies who promoted or rolled back the release.
+	PromotedBy string `json:"promotedBy"`
+
+	// PromotedAt is the time at which the release was promoted or rolled
+	// back.
+	PromotedAt time.Time `json:"promotedAt"`
+
+	// Reason, if set, describes why the release was rolled back.
+	Reason string `json:"reason,omitempty"`
+
+	// Forced is true if an existing promoted release was overwritten.
+	Forced bool `json:"forced,omitempty"`
+
+	// TagSHA is the SHA of the annotated git tag created for the release
+	// when it was promoted, if any.
+	TagSHA string `json:"tagSHA,omitempty"`
+
+	// PreviousSHA256 is the hex-encoded SHA256 checksum of the entire
+	// promotion log before this record was appended, chaining each record to
+	// all of those before it so that any later modification of the log can
+	// be detected.
+	PreviousSHA256 string `json:"previousSHA256"`
+}
+
+// AppendPromotionRecord returns the content of the promotion log after
+// appending rec to the existing log content, setting the record's
+// PreviousSHA256 to the checksum of existing.
+func AppendPromotionRecord(existing []byte, rec PromotionRecord) ([]byte, error) {
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		return nil, fmt.Errorf("invalid promotion log: does not end with a newline")
+	}
+
+	sum := sha256.Sum256(existing)
+	rec.PreviousSHA256 = hex.EncodeToString(sum[:])
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append(append([]byte{}, existing...), line...)
+	return append(out, '\n'), nil
+}
+
+// ReadPromotionLog parses every record in the promotion log read from r,
+// returning an error if the log has been modified such that the chain of
+// checksums between records is broken.
+func ReadPromotionLog(r io.Reader) ([]PromotionRecord, error) {
+	var records []PromotionRecord
+	hasher := sha256.New()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec PromotionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("invalid promotion log: malformed record on line %d: %w", line, err)
+		}
+		if expected := hex.EncodeToString(hasher.Sum(nil)); rec.PreviousSHA256 != expected {
+			return nil, fmt.Errorf("invalid promotion log: record on line %d has previous checksum %q but expected %q", line, rec.PreviousSHA256, expected)
+		}
+
+		hasher.Write(scanner.Bytes())
+		hasher.Write([]byte{'\n'})
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// AppendPromotionLog appends rec to the promotion log stored in obj, creating
+// it if it does not exist. The log is validated before appending, and is
+// only written if it has not been modified since being read.
+func AppendPromotionLog(ctx context.Context, obj *storage.ObjectHandle, rec PromotionRecord) error {
+	existing := []byte{}
+	conds := storage.Conditions{DoesNotExist: true}
+
+	r, err := obj.NewReader(ctx)
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read promotion log: %w", err)
+	default:
+		defer r.Close()
+		if existing, err = io.ReadAll(r); err != nil {
+			return fmt.Errorf("failed to read promotion log: %w", err)
+		}
+		conds = storage.Conditions{GenerationMatch: r.Attrs.Generation}
+	}
+
+	if _, err := ReadPromotionLog(bytes.NewReader(existing)); err != nil {
+		return err
+	}
+
+	updated, err := AppendPromotionRecord(existing, rec)
+	if err != nil {
+		return err
+	}
+
+	w := obj.If(conds).NewWriter(ctx)
+	w.ContentType = "application/x-ndjson"
+	if _, err := w.Write(updated); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write promotion log: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write promotion log, it may have been modified concurrently: %w", err)
+	}
+
+	return nil
+}
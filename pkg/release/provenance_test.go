@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromotionLog(t *testing.T) {
+	promotedAt := time.Date(2021, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	var log []byte
+	for _, version := range []string{"v1.6.0", "v1.6.1", "v1.7.0"} {
+		var err error
+		log, err = AppendPromotionRecord(log, PromotionRecord{
+			ReleaseVersion: version,
+			GitCommitRef:   "abc",
+			PromotedBy:     "jake",
+			PromotedAt:     promotedAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := ReadPromotionLog(bytes.NewReader(log))
+	if err != nil {
+		t.Fatalf("unexpected error reading log: %v", err)
+	}
+	if len(records) != 3 || records[0].ReleaseVersion != "v1.6.0" || records[2].ReleaseVersion != "v1.7.0" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if !records[1].PromotedAt.Equal(promotedAt) {
+		t.Errorf("expected promotion time to be preserved but got %s", records[1].PromotedAt)
+	}
+
+	tests := map[string]struct {
+		log    string
+		expErr string
+	}{
+		"empty log is valid": {
+			log: "",
+		},
+		"modified record breaks the chain": {
+			log:    strings.Replace(string(log), `"releaseVersion":"v1.6.1"`, `"releaseVersion":"v1.6.2"`, 1),
+			expErr: "record on line 3",
+		},
+		"removed record breaks the chain": {
+			log:    strings.SplitAfterN(string(log), "\n", 2)[1],
+			expErr: "record on line 1",
+		},
+		"malformed record": {
+			log:    "not json\n",
+			expErr: "malformed record on line 1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadPromotionLog(strings.NewReader(test.log))
+			if test.expErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
+
+func TestAppendPromotionRecord_NoTrailingNewline(t *testing.T) {
+	if _, err := AppendPromotionRecord([]byte(`{"releaseVersion":"v1.6.0"}`), PromotionRecord{}); err == nil {
+		t.Errorf("expected an error appending to a log without a trailing newline")
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReleaseNotesFileName is the name of the release notes file in the root of
+// a staged release, if it was staged with release notes.
+const ReleaseNotesFileName = "release-notes.md"
+
+// ReleaseNotes describes a release notes file which is staged alongside the
+// release artifacts.
+type ReleaseNotes struct {
+	// SHA256 is the hex-encoded SHA256 checksum of the file.
+	SHA256 string
+
+	// Size of the file in bytes.
+	Size int64
+}
+
+// InspectReleaseNotes validates that the file at path exists, is a regular
+// file and is not empty, and returns a description of it.
+func InspectReleaseNotes(path string) (*ReleaseNotes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%q is not a regular file", path)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("%q is empty", path)
+	}
+
+	return &ReleaseNotes{
+		SHA256: hex.EncodeToString(hasher.Sum(nil)),
+		Size:   size,
+	}, nil
+}
+
+// ReleaseNotesObjectName returns the name of the object within a release
+// bucket that a release notes file with the given checksum is uploaded to
+// for use by a stage build, under the given prefix as passed to
+// BucketPathForRelease. As with SourceTarballObjectName, objects are named by
+// their checksum so that re-staging with the same notes reuses the same
+// object.
+func ReleaseNotesObjectName(bucketPrefix, sha256 string) string {
+	return fmt.Sprintf("%s/release-notes/%s.md", bucketPrefix, sha256)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectReleaseNotes(t *testing.T) {
+	dir := t.TempDir()
+	notes := "## Changes\n\n- Fixed a bug\n"
+	sum := sha256.Sum256([]byte(notes))
+
+	tests := map[string]struct {
+		content   *string
+		dir       bool
+		expSHA256 string
+		expectErr bool
+	}{
+		"notes are inspected": {
+			content:   &notes,
+			expSHA256: hex.EncodeToString(sum[:]),
+		},
+		"empty file errors": {
+			content:   new(string),
+			expectErr: true,
+		},
+		"missing file errors": {
+			expectErr: true,
+		},
+		"directory errors": {
+			dir:       true,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			switch {
+			case test.dir:
+				if err := os.Mkdir(path, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			case test.content != nil:
+				if err := os.WriteFile(path, []byte(*test.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := InspectReleaseNotes(path)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got.SHA256 != test.expSHA256 || got.Size != int64(len(*test.content)) {
+				t.Errorf("unexpected release notes: %+v", got)
+			}
+		})
+	}
+}
+
+func TestReleaseNotesObjectName(t *testing.T) {
+	if got := ReleaseNotesObjectName("stage/gcb", "abc"); got != "stage/gcb/release-notes/abc.md" {
+		t.Errorf("unexpected object name %q", got)
+	}
+}
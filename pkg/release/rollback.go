@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// RolledBackBucketPathPrefix is the prefix in a public release bucket which
+// the objects of a rolled back release are moved under.
+const RolledBackBucketPathPrefix = "rolled-back"
+
+// RolledBackBucketPath returns the path in a public release bucket that the
+// release published at publishedPath is moved to when it is rolled back at
+// the given time, e.g. "rolled-back/20211014T120000Z/releases/v1.6.0". The
+// time is included so that a release which is published and rolled back
+// more than once never overwrites an earlier rollback.
+func RolledBackBucketPath(publishedPath string, at time.Time) string {
+	return path.Join(RolledBackBucketPathPrefix, at.UTC().Format("20060102T150405Z"), publishedPath)
+}
+
+// RollbackAction is a single object moved or deleted when rolling back a
+// published release.
+type RollbackAction struct {
+	// Source is the name of the published object.
+	Source string `json:"source"`
+
+	// Destination is the name the object is moved to, or empty if the
+	// object is deleted.
+	Destination string `json:"destination,omitempty"`
+
+	// Size is the size of the published object in bytes.
+	Size int64 `json:"size"`
+}
+
+// PlanRollback returns the actions RollbackRelease will take to roll back
+// the release published at publishedPath, given the objects published under
+// it. Each object is moved to the same relative name under rolledBackPath,
+// or deleted if rolledBackPath is empty. An error is returned if
+// publishedPath is a development build or any object is not under it, so
+// that nothing but a published release is ever rolled back.
+func PlanRollback(objs []*storage.ObjectAttrs, publishedPath, rolledBackPath string) ([]RollbackAction, error) {
+	for _, segment := range strings.Split(publishedPath, "/") {
+		if segment == BuildTypeDevel {
+			return nil, fmt.Errorf("refusing to roll back %q as it is a %s build", publishedPath, BuildTypeDevel)
+		}
+	}
+
+	prefix := strings.TrimSuffix(publishedPath, "/") + "/"
+	plan := make([]RollbackAction, len(objs))
+	for i, attrs := range objs {
+		if !strings.HasPrefix(attrs.Name, prefix) {
+			return nil, fmt.Errorf("refusing to roll back %q as it is not part of the release published at %q", attrs.Name, publishedPath)
+		}
+		plan[i] = RollbackAction{Source: attrs.Name, Size: attrs.Size}
+		if rolledBackPath != "" {
+			plan[i].Destination = path.Join(rolledBackPath, strings.TrimPrefix(attrs.Name, prefix))
+		}
+	}
+	return plan, nil
+}
+
+// RollbackRelease takes each of the actions planned by PlanRollback in the
+// given bucket, returning the number of objects which were removed from the
+// published release. Moved objects are copied server-side, preserving their
+// metadata, before the published object is deleted.
+func RollbackRelease(ctx context.Context, bucket *storage.BucketHandle, plan []RollbackAction) (int, error) {
+	for i, action := range plan {
+		src := bucket.Object(action.Source)
+		if action.Destination != "" {
+			log.Printf("Moving %q to %q", action.Source, action.Destination)
+			if err := CopyObject(ctx, bucket.Object(action.Destination), src, ObjectMetadata{}); err != nil {
+				return i, fmt.Errorf("failed to move %q to %q: %w", action.Source, action.Destination, err)
+			}
+		} else {
+			log.Printf("Deleting %q", action.Source)
+		}
+		if err := src.Delete(ctx); err != nil {
+			return i, fmt.Errorf("failed to delete %q: %w", action.Source, err)
+		}
+	}
+	return len(plan), nil
+}
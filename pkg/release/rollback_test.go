@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestRolledBackBucketPath(t *testing.T) {
+	at := time.Date(2021, 10, 14, 13, 0, 0, 0, time.FixedZone("BST", 3600))
+	if got := RolledBackBucketPath("releases/v1.6.0", at); got != "rolled-back/20211014T120000Z/releases/v1.6.0" {
+		t.Errorf("unexpected rolled back path %q", got)
+	}
+}
+
+func TestPlanRollback(t *testing.T) {
+	objs := []*storage.ObjectAttrs{
+		{Name: "releases/v1.6.0/metadata.json", Size: 100},
+		{Name: "releases/v1.6.0/cert-manager-manifests.tar.gz", Size: 2000},
+	}
+
+	tests := map[string]struct {
+		objs           []*storage.ObjectAttrs
+		publishedPath  string
+		rolledBackPath string
+		exp            []RollbackAction
+		expErr         string
+	}{
+		"objects are moved": {
+			objs:           objs,
+			publishedPath:  "releases/v1.6.0",
+			rolledBackPath: "rolled-back/20211014T120000Z/releases/v1.6.0",
+			exp: []RollbackAction{
+				{Source: "releases/v1.6.0/metadata.json", Destination: "rolled-back/20211014T120000Z/releases/v1.6.0/metadata.json", Size: 100},
+				{Source: "releases/v1.6.0/cert-manager-manifests.tar.gz", Destination: "rolled-back/20211014T120000Z/releases/v1.6.0/cert-manager-manifests.tar.gz", Size: 2000},
+			},
+		},
+		"objects are deleted": {
+			objs:          objs,
+			publishedPath: "releases/v1.6.0",
+			exp: []RollbackAction{
+				{Source: "releases/v1.6.0/metadata.json", Size: 100},
+				{Source: "releases/v1.6.0/cert-manager-manifests.tar.gz", Size: 2000},
+			},
+		},
+		"object outside the published release": {
+			objs:          []*storage.ObjectAttrs{{Name: "releases/v1.6.0-beta.0/metadata.json"}},
+			publishedPath: "releases/v1.6.0",
+			expErr:        "not part of the release",
+		},
+		"devel builds are refused": {
+			objs:          []*storage.ObjectAttrs{{Name: "stage/gcb/devel/abc/metadata.json"}},
+			publishedPath: "stage/gcb/devel/abc",
+			expErr:        "is a devel build",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan, err := PlanRollback(test.objs, test.publishedPath, test.rolledBackPath)
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(plan, test.exp) {
+				t.Errorf("unexpected plan:\ngot: %+v\nexp: %+v", plan, test.exp)
+			}
+		})
+	}
+}
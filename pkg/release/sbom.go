@@ -0,0 +1,314 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	// SBOMFormatCycloneDX produces a CycloneDX 1.4 SBOM in JSON format.
+	SBOMFormatCycloneDX = "cyclonedx"
+
+	// SBOMFormatSPDX produces an SPDX 2.2 SBOM in JSON format.
+	SBOMFormatSPDX = "spdx"
+)
+
+// SBOMFormats is the list of all supported SBOM formats.
+var SBOMFormats = []string{SBOMFormatCycloneDX, SBOMFormatSPDX}
+
+// SBOMOptions configures the SBOM produced by GenerateSBOM.
+type SBOMOptions struct {
+	// RepoPath is the path to the root of the Go module the SBOM describes.
+	RepoPath string
+
+	// Packages are the patterns of the packages built into the binaries the
+	// SBOM describes, relative to RepoPath, e.g. ./cmd/...
+	Packages []string
+
+	// GoCommand is the path to the go command used to list the modules
+	// linked into Packages. Defaults to "go".
+	GoCommand string
+
+	// Format is the format of the SBOM, one of SBOMFormats.
+	Format string
+
+	// Name is the name of the software the SBOM describes, e.g. cert-manager.
+	Name string
+
+	// Version is the version of the software the SBOM describes.
+	Version string
+
+	// Created is the time recorded as the creation time of the SBOM, where
+	// the format requires one.
+	Created time.Time
+}
+
+// SBOMFileName returns the name of the file an SBOM in the given format
+// should be uploaded as.
+func SBOMFileName(format string) string {
+	switch format {
+	case SBOMFormatCycloneDX:
+		return "cert-manager-sbom.cdx.json"
+	case SBOMFormatSPDX:
+		return "cert-manager-sbom.spdx.json"
+	}
+	return ""
+}
+
+// ValidateSBOMFormat returns an error if format is not a supported SBOM format.
+func ValidateSBOMFormat(format string) error {
+	if SBOMFileName(format) == "" {
+		return fmt.Errorf("invalid SBOM format %q, must be one of: %s", format, strings.Join(SBOMFormats, ", "))
+	}
+	return nil
+}
+
+// SBOMPackages are the packages of the cert-manager repository which are
+// built into the binaries of a release.
+var SBOMPackages = []string{"./cmd/..."}
+
+// GenerateSBOM produces an SBOM listing the Go modules which provide the
+// packages linked into the binaries built from opts.Packages of the module
+// at opts.RepoPath, so that modules only required by tests or by packages
+// which aren't built are omitted. Replace directives are honoured, and
+// modules replaced with a local path are omitted as they have no upstream
+// version.
+func GenerateSBOM(opts SBOMOptions) ([]byte, error) {
+	if err := ValidateSBOMFormat(opts.Format); err != nil {
+		return nil, err
+	}
+	if len(opts.Packages) == 0 {
+		return nil, fmt.Errorf("no packages given to generate SBOM for")
+	}
+
+	goModPath := filepath.Join(opts.RepoPath, "go.mod")
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.mod: %w", err)
+	}
+
+	mod, err := modfile.Parse(goModPath, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go.mod: %w", err)
+	}
+
+	listing, err := listPackageModules(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list modules linked into %s: %w", strings.Join(opts.Packages, " "), err)
+	}
+	deps := linkedModules(listing, mod.Module.Mod.Path)
+
+	var out interface{}
+	switch opts.Format {
+	case SBOMFormatCycloneDX:
+		out = cycloneDXDocument(opts, mod.Module.Mod.Path, deps)
+	case SBOMFormatSPDX:
+		out = spdxDocument(opts, mod.Module.Mod.Path, deps)
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
+
+type goModule struct {
+	path    string
+	version string
+}
+
+func (m goModule) purl() string {
+	return fmt.Sprintf("pkg:golang/%s@%s", m.path, m.version)
+}
+
+// goListModuleFormat is the template given to 'go list -f' to print the
+// module providing each package, followed by its replacement if any.
+const goListModuleFormat = `{{with .Module}}{{.Path}} {{.Version}}{{with .Replace}} {{.Path}} {{.Version}}{{end}}{{end}}`
+
+// listPackageModules is overridden in tests
+var listPackageModules = goListPackageModules
+
+// goListPackageModules runs 'go list -deps' for the packages given by opts,
+// returning a line for every package linked into them in the format given by
+// goListModuleFormat. Packages in the standard library produce empty lines.
+func goListPackageModules(opts SBOMOptions) ([]byte, error) {
+	goCommand := opts.GoCommand
+	if goCommand == "" {
+		goCommand = "go"
+	}
+
+	args := append([]string{"list", "-deps", "-f", goListModuleFormat}, opts.Packages...)
+	cmd := exec.Command(goCommand, args...)
+	cmd.Dir = opts.RepoPath
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// linkedModules parses the output of goListPackageModules, returning every
+// module other than mainModule after applying any replacements, sorted by
+// path.
+func linkedModules(listing []byte, mainModule string) []goModule {
+	seen := make(map[goModule]bool)
+	var deps []goModule
+	for _, line := range strings.Split(string(listing), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == mainModule {
+			continue
+		}
+		if len(fields) == 3 {
+			// replaced with a local directory
+			continue
+		}
+
+		dep := goModule{path: fields[0]}
+		if len(fields) > 1 {
+			dep.version = fields[1]
+		}
+		if len(fields) == 4 {
+			dep = goModule{path: fields[2], version: fields[3]}
+		}
+		if dep.version == "" || seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		deps = append(deps, dep)
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].path < deps[j].path
+	})
+	return deps
+}
+
+type cycloneDXComponent struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	PURL    string `json:"purl"`
+}
+
+func cycloneDXDocument(opts SBOMOptions, modulePath string, deps []goModule) interface{} {
+	components := make([]cycloneDXComponent, len(deps))
+	for i, dep := range deps {
+		components[i] = cycloneDXComponent{
+			Type:    "library",
+			Name:    dep.path,
+			Version: dep.version,
+			PURL:    dep.purl(),
+		}
+	}
+
+	return map[string]interface{}{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.4",
+		"version":     1,
+		"metadata": map[string]interface{}{
+			"timestamp": opts.Created.UTC().Format(time.RFC3339),
+			"component": cycloneDXComponent{
+				Type:    "application",
+				Name:    opts.Name,
+				Version: opts.Version,
+				PURL:    goModule{path: modulePath, version: opts.Version}.purl(),
+			},
+		},
+		"components": components,
+	}
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func newSPDXPackage(id string, m goModule) spdxPackage {
+	return spdxPackage{
+		SPDXID:           id,
+		Name:             m.path,
+		VersionInfo:      m.version,
+		DownloadLocation: "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  m.purl(),
+		}},
+	}
+}
+
+func spdxDocument(opts SBOMOptions, modulePath string, deps []goModule) interface{} {
+	const rootID = "SPDXRef-Package-root"
+
+	packages := []spdxPackage{newSPDXPackage(rootID, goModule{path: modulePath, version: opts.Version})}
+	packages[0].Name = opts.Name
+	relationships := []spdxRelationship{{
+		SPDXElementID:      "SPDXRef-DOCUMENT",
+		RelationshipType:   "DESCRIBES",
+		RelatedSPDXElement: rootID,
+	}}
+
+	for i, dep := range deps {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		packages = append(packages, newSPDXPackage(id, dep))
+		relationships = append(relationships, spdxRelationship{
+			SPDXElementID:      rootID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.2",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              fmt.Sprintf("%s-%s", opts.Name, opts.Version),
+		"documentNamespace": fmt.Sprintf("https://%s/spdx/%s", modulePath, opts.Version),
+		"creationInfo": map[string]interface{}{
+			"created":  opts.Created.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: cmrel"},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useGoListFixture replaces the output of 'go list' with that recorded in
+// testdata/sbom/go-list.txt for the duration of the test, which lists each
+// package linked into ./cmd/... of the testdata/sbom module.
+func useGoListFixture(t *testing.T) {
+	orig := listPackageModules
+	t.Cleanup(func() { listPackageModules = orig })
+	listPackageModules = func(opts SBOMOptions) ([]byte, error) {
+		if !reflect.DeepEqual(opts.Packages, []string{"./cmd/..."}) {
+			t.Errorf("unexpected packages listed: %v", opts.Packages)
+		}
+		return os.ReadFile("testdata/sbom/go-list.txt")
+	}
+}
+
+func TestGenerateSBOM(t *testing.T) {
+	useGoListFixture(t)
+	created := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	expectedPURLs := []string{
+		"pkg:golang/github.com/spf13/cobra@v1.2.1",
+		"pkg:golang/k8s.io/api@v0.22.1",
+		"pkg:golang/k8s.io/client-go@v0.22.0",
+	}
+
+	tests := map[string]struct {
+		format    string
+		purls     func(t *testing.T, data []byte) []string
+		expectErr bool
+	}{
+		"cyclonedx": {
+			format: SBOMFormatCycloneDX,
+			purls: func(t *testing.T, data []byte) []string {
+				var doc struct {
+					BOMFormat  string `json:"bomFormat"`
+					Components []struct {
+						PURL string `json:"purl"`
+					} `json:"components"`
+				}
+				if err := json.Unmarshal(data, &doc); err != nil {
+					t.Fatal(err)
+				}
+				if doc.BOMFormat != "CycloneDX" {
+					t.Errorf("unexpected bomFormat %q", doc.BOMFormat)
+				}
+				var purls []string
+				for _, c := range doc.Components {
+					purls = append(purls, c.PURL)
+				}
+				return purls
+			},
+		},
+		"spdx": {
+			format: SBOMFormatSPDX,
+			purls: func(t *testing.T, data []byte) []string {
+				var doc struct {
+					SPDXVersion string `json:"spdxVersion"`
+					Packages    []struct {
+						ExternalRefs []struct {
+							ReferenceLocator string `json:"referenceLocator"`
+						} `json:"externalRefs"`
+					} `json:"packages"`
+				}
+				if err := json.Unmarshal(data, &doc); err != nil {
+					t.Fatal(err)
+				}
+				if doc.SPDXVersion != "SPDX-2.2" {
+					t.Errorf("unexpected spdxVersion %q", doc.SPDXVersion)
+				}
+				var purls []string
+				// the first package describes the module itself
+				for _, p := range doc.Packages[1:] {
+					purls = append(purls, p.ExternalRefs[0].ReferenceLocator)
+				}
+				return purls
+			},
+		},
+		"unknown format": {
+			format:    "csv",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := GenerateSBOM(SBOMOptions{
+				RepoPath: "testdata/sbom",
+				Packages: SBOMPackages,
+				Format:   test.format,
+				Name:     "cert-manager",
+				Version:  "v1.6.0",
+				Created:  created,
+			})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if purls := test.purls(t, data); !reflect.DeepEqual(purls, expectedPURLs) {
+				t.Errorf("unexpected components:\ngot: %v\nexp: %v", purls, expectedPURLs)
+			}
+
+			again, err := GenerateSBOM(SBOMOptions{RepoPath: "testdata/sbom", Packages: SBOMPackages, Format: test.format, Name: "cert-manager", Version: "v1.6.0", Created: created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != string(data) {
+				t.Errorf("expected output to be deterministic")
+			}
+		})
+	}
+}
+
+func TestGenerateSBOM_UnlinkedRequirements(t *testing.T) {
+	useGoListFixture(t)
+
+	// github.com/onsi/ginkgo is required by the fixture's go.mod, but only
+	// imported by tests, so isn't linked into any of the binaries
+	data, err := GenerateSBOM(SBOMOptions{RepoPath: "testdata/sbom", Packages: SBOMPackages, Format: SBOMFormatCycloneDX, Name: "cert-manager", Version: "v1.6.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "github.com/spf13/cobra") {
+		t.Errorf("expected linked module to be included:\n%s", data)
+	}
+	if strings.Contains(string(data), "github.com/onsi/ginkgo") {
+		t.Errorf("expected module which isn't linked into a binary to be excluded:\n%s", data)
+	}
+
+	if _, err := GenerateSBOM(SBOMOptions{RepoPath: "testdata/sbom", Format: SBOMFormatCycloneDX}); err == nil {
+		t.Errorf("expected an error when no packages are given")
+	}
+}
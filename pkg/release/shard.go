@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var shardNameRegex = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// ValidateShardName returns an error if shard can't be used as the name of a
+// shard of a stage build, as passed to ShardFileName.
+func ValidateShardName(shard string) error {
+	if !shardNameRegex.MatchString(shard) {
+		return fmt.Errorf("invalid shard name %q, must contain only lowercase letters and digits", shard)
+	}
+	return nil
+}
+
+// ShardFileName returns the name under which one shard of a stage build
+// writes the release file with the given name, so that the files written by
+// each shard into the same release directory don't overwrite each other
+// before they're merged, e.g. "metadata.linux.json" or "SHA256SUMS.linux".
+// Shard files are never found by the names consumers of a release look for.
+func ShardFileName(name, shard string) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), shard, ext)
+}
+
+// MergeMetadata returns the metadata of a release staged in several shards
+// given the metadata written by each shard, which must all have been built
+// from the same version and git commit ref. An error is returned if more
+// than one shard staged an artifact with the same name.
+func MergeMetadata(shards ...Metadata) (*Metadata, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shards to merge")
+	}
+
+	merged := &Metadata{
+		ReleaseVersion: shards[0].ReleaseVersion,
+		GitCommitRef:   shards[0].GitCommitRef,
+	}
+	seen := map[string]bool{}
+	for _, shard := range shards {
+		if shard.ReleaseVersion != merged.ReleaseVersion || shard.GitCommitRef != merged.GitCommitRef {
+			return nil, fmt.Errorf("shards were built from different releases: %s@%s and %s@%s", merged.ReleaseVersion, merged.GitCommitRef, shard.ReleaseVersion, shard.GitCommitRef)
+		}
+		for _, artifact := range shard.Artifacts {
+			if seen[artifact.Name] {
+				return nil, fmt.Errorf("artifact %q was staged by more than one shard", artifact.Name)
+			}
+			seen[artifact.Name] = true
+			merged.Artifacts = append(merged.Artifacts, artifact)
+		}
+	}
+	return merged, nil
+}
+
+// MergeChecksums returns the union of the checksums written by each shard of
+// a stage build. An error is returned if more than one shard wrote a
+// checksum for the same file.
+func MergeChecksums(shards ...map[string]string) (map[string]string, error) {
+	merged := map[string]string{}
+	for _, shard := range shards {
+		for name, sum := range shard {
+			if _, ok := merged[name]; ok {
+				return nil, fmt.Errorf("checksum of %q was written by more than one shard", name)
+			}
+			merged[name] = sum
+		}
+	}
+	return merged, nil
+}
+
+// MergeManifests returns the release manifest of a release staged in
+// several shards given the manifest written by each shard. The checksums
+// file written by each shard is left out, since the caller is expected to
+// write and append an entry for the merged checksums file. The merged
+// manifest's BuildID lists the build ID of every shard.
+func MergeManifests(shards ...*Manifest) (*Manifest, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shards to merge")
+	}
+
+	merged := &Manifest{
+		ReleaseVersion: shards[0].ReleaseVersion,
+		GitCommitRef:   shards[0].GitCommitRef,
+		CmrelVersion:   shards[0].CmrelVersion,
+	}
+	var buildIDs []string
+	seen := map[string]bool{}
+	for _, shard := range shards {
+		if shard.ReleaseVersion != merged.ReleaseVersion || shard.GitCommitRef != merged.GitCommitRef {
+			return nil, fmt.Errorf("shards were built from different releases: %s@%s and %s@%s", merged.ReleaseVersion, merged.GitCommitRef, shard.ReleaseVersion, shard.GitCommitRef)
+		}
+		if shard.BuildID != "" {
+			buildIDs = append(buildIDs, shard.BuildID)
+		}
+		if shard.Created.After(merged.Created) {
+			merged.Created = shard.Created
+		}
+		for _, artifact := range shard.Artifacts {
+			if artifact.Name == ChecksumsFileName {
+				continue
+			}
+			if seen[artifact.Name] {
+				return nil, fmt.Errorf("artifact %q was staged by more than one shard", artifact.Name)
+			}
+			seen[artifact.Name] = true
+			merged.Artifacts = append(merged.Artifacts, artifact)
+		}
+	}
+	merged.BuildID = strings.Join(buildIDs, ",")
+	return merged, nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShardFileName(t *testing.T) {
+	tests := map[string]string{
+		MetadataFileName:  "metadata.linux.json",
+		ChecksumsFileName: "SHA256SUMS.linux",
+		ManifestFileName:  "release-manifest.linux.json",
+	}
+
+	for name, expected := range tests {
+		if got := ShardFileName(name, "linux"); got != expected {
+			t.Errorf("expected shard file name of %q to be %q but got %q", name, expected, got)
+		}
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	linux := Metadata{ReleaseVersion: "v1.8.0", GitCommitRef: "abc", Artifacts: []ArtifactMetadata{
+		{Name: "cert-manager-server-linux-amd64.tar.gz", OS: "linux", Architecture: "amd64"},
+		{Name: "cert-manager-manifests.tar.gz"},
+	}}
+	darwin := Metadata{ReleaseVersion: "v1.8.0", GitCommitRef: "abc", Artifacts: []ArtifactMetadata{
+		{Name: "cert-manager-cmctl-darwin-arm64.tar.gz", OS: "darwin", Architecture: "arm64"},
+	}}
+
+	tests := map[string]struct {
+		shards    []Metadata
+		expected  *Metadata
+		expectErr bool
+	}{
+		"artifacts of every shard are merged": {
+			shards: []Metadata{linux, darwin},
+			expected: &Metadata{ReleaseVersion: "v1.8.0", GitCommitRef: "abc", Artifacts: []ArtifactMetadata{
+				linux.Artifacts[0], linux.Artifacts[1], darwin.Artifacts[0],
+			}},
+		},
+		"duplicate artifact": {
+			shards:    []Metadata{linux, linux},
+			expectErr: true,
+		},
+		"different git refs": {
+			shards:    []Metadata{linux, {ReleaseVersion: "v1.8.0", GitCommitRef: "def"}},
+			expectErr: true,
+		},
+		"no shards": {
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			merged, err := MergeMetadata(test.shards...)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if !test.expectErr && !reflect.DeepEqual(merged, test.expected) {
+				t.Errorf("expected %+v but got %+v", test.expected, merged)
+			}
+		})
+	}
+}
+
+func TestMergeChecksums(t *testing.T) {
+	merged, err := MergeChecksums(map[string]string{"a.tar.gz": "1"}, map[string]string{"b.tar.gz": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"a.tar.gz": "1", "b.tar.gz": "2"}; !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v but got %v", expected, merged)
+	}
+
+	if _, err := MergeChecksums(map[string]string{"a.tar.gz": "1"}, map[string]string{"a.tar.gz": "1"}); err == nil {
+		t.Errorf("expected an error merging checksums of the same file from two shards")
+	}
+}
+
+func TestMergeManifests(t *testing.T) {
+	created := time.Date(2021, 10, 14, 12, 0, 0, 0, time.UTC)
+	linux := &Manifest{ReleaseVersion: "v1.8.0", GitCommitRef: "abc", BuildID: "build-1", Created: created, Artifacts: []ManifestArtifact{
+		{Name: "cert-manager-server-linux-amd64.tar.gz"},
+		{Name: ChecksumsFileName},
+	}}
+	darwin := &Manifest{ReleaseVersion: "v1.8.0", GitCommitRef: "abc", BuildID: "build-2", Created: created.Add(time.Minute), Artifacts: []ManifestArtifact{
+		{Name: "cert-manager-cmctl-darwin-arm64.tar.gz"},
+		{Name: ChecksumsFileName},
+	}}
+
+	merged, err := MergeManifests(linux, darwin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Manifest{ReleaseVersion: "v1.8.0", GitCommitRef: "abc", BuildID: "build-1,build-2", Created: created.Add(time.Minute), Artifacts: []ManifestArtifact{
+		{Name: "cert-manager-server-linux-amd64.tar.gz"},
+		{Name: "cert-manager-cmctl-darwin-arm64.tar.gz"},
+	}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %+v but got %+v", expected, merged)
+	}
+
+	if _, err := MergeManifests(linux, linux); err == nil {
+		t.Errorf("expected an error merging manifests which stage the same artifact")
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ProvenanceFileName is the name of the file in the root of a staged
+	// release containing its signed SLSA provenance statement, as a single
+	// line DSSE envelope.
+	ProvenanceFileName = "cert-manager.intoto.jsonl"
+
+	// ProvenancePayloadType is the DSSE payload type of a provenance
+	// statement.
+	ProvenancePayloadType = "application/vnd.in-toto+json"
+
+	// InTotoStatementType is the type of the in-toto statement produced by
+	// GenerateProvenance.
+	InTotoStatementType = "https://in-toto.io/Statement/v0.1"
+
+	// SLSAProvenancePredicateType is the predicate type of the in-toto
+	// statement produced by GenerateProvenance.
+	SLSAProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+
+	// CloudBuildBuilderID identifies Cloud Build as the builder of a release
+	// in its provenance.
+	CloudBuildBuilderID = "https://cloudbuild.googleapis.com/GoogleHostedWorker"
+
+	// StageBuildType identifies the process by which a release was built in
+	// its provenance, which is the stage cloudbuild.yaml in this repository.
+	StageBuildType = "https://github.com/cert-manager/release/stage@v1"
+)
+
+// ProvenanceOptions describes how a release was built, to be recorded in its
+// provenance by GenerateProvenance.
+type ProvenanceOptions struct {
+	// BuilderID identifies the builder which built the release, usually
+	// CloudBuildBuilderID.
+	BuilderID string
+
+	// SourceRepo is the URL of the git repository the release was built
+	// from, e.g. https://github.com/jetstack/cert-manager.
+	SourceRepo string
+
+	// GitRef is the git commit the release was built from.
+	GitRef string
+
+	// ConfigFile is the name of the cloudbuild.yaml file which defined the
+	// build.
+	ConfigFile string
+
+	// Builds is each of the builds which staged the release. There is more
+	// than one if the release was staged in shards.
+	Builds []ProvenanceBuild
+
+	// Images maps the name of each container image built for the release to
+	// its digest, e.g. "sha256:abc...".
+	Images map[string]string
+}
+
+// ProvenanceBuild describes one of the builds which staged a release.
+type ProvenanceBuild struct {
+	// ID is the ID of the build.
+	ID string
+
+	// Substitutions are the substitutions the build was run with.
+	Substitutions map[string]string
+
+	// StartedOn and FinishedOn are the times at which the build started and
+	// finished running, if known.
+	StartedOn, FinishedOn time.Time
+}
+
+type inTotoStatement struct {
+	Type          string            `json:"_type"`
+	PredicateType string            `json:"predicateType"`
+	Subject       []inTotoSubject   `json:"subject"`
+	Predicate     slsaProvenanceV02 `json:"predicate"`
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenanceV02 struct {
+	Builder    slsaBuilder    `json:"builder"`
+	BuildType  string         `json:"buildType"`
+	Invocation slsaInvocation `json:"invocation"`
+	Metadata   slsaMetadata   `json:"metadata"`
+	Materials  []slsaMaterial `json:"materials"`
+}
+
+type slsaBuilder struct {
+	ID string `json:"id"`
+}
+
+type slsaInvocation struct {
+	ConfigSource slsaMaterial                 `json:"configSource"`
+	Parameters   map[string]map[string]string `json:"parameters"`
+}
+
+type slsaMetadata struct {
+	BuildInvocationID string           `json:"buildInvocationId"`
+	BuildStartedOn    *time.Time       `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn   *time.Time       `json:"buildFinishedOn,omitempty"`
+	Completeness      slsaCompleteness `json:"completeness"`
+	Reproducible      bool             `json:"reproducible"`
+}
+
+type slsaCompleteness struct {
+	Parameters  bool `json:"parameters"`
+	Environment bool `json:"environment"`
+	Materials   bool `json:"materials"`
+}
+
+type slsaMaterial struct {
+	URI        string            `json:"uri,omitempty"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+// GenerateProvenance produces an in-toto statement with a SLSA v0.2
+// provenance predicate describing how the release with the given manifest
+// was built. Every artifact in the manifest and every image in opts.Images
+// is a subject of the statement.
+func GenerateProvenance(opts ProvenanceOptions, manifest *Manifest) ([]byte, error) {
+	if len(opts.Builds) == 0 {
+		return nil, fmt.Errorf("no builds to describe in provenance")
+	}
+	if opts.GitRef == "" {
+		return nil, fmt.Errorf("no git ref to describe in provenance")
+	}
+
+	var subjects []inTotoSubject
+	for _, artifact := range manifest.Artifacts {
+		if artifact.SHA256 == "" {
+			return nil, fmt.Errorf("artifact %q in release manifest has no checksum", artifact.Name)
+		}
+		subjects = append(subjects, inTotoSubject{Name: artifact.Name, Digest: map[string]string{"sha256": artifact.SHA256}})
+	}
+	for name, digest := range opts.Images {
+		sum := strings.TrimPrefix(digest, "sha256:")
+		if sum == digest || sum == "" {
+			return nil, fmt.Errorf("image %q has unsupported digest %q, must be a sha256 digest", name, digest)
+		}
+		subjects = append(subjects, inTotoSubject{Name: name, Digest: map[string]string{"sha256": sum}})
+	}
+	if len(subjects) == 0 {
+		return nil, fmt.Errorf("release has no artifacts to describe in provenance")
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].Name < subjects[j].Name
+	})
+
+	source := slsaMaterial{
+		URI:    "git+" + opts.SourceRepo,
+		Digest: map[string]string{"sha1": opts.GitRef},
+	}
+
+	var ids []string
+	var started, finished time.Time
+	parameters := make(map[string]map[string]string, len(opts.Builds))
+	for _, build := range opts.Builds {
+		ids = append(ids, build.ID)
+		parameters[build.ID] = build.Substitutions
+		if !build.StartedOn.IsZero() && (started.IsZero() || build.StartedOn.Before(started)) {
+			started = build.StartedOn
+		}
+		if build.FinishedOn.After(finished) {
+			finished = build.FinishedOn
+		}
+	}
+
+	metadata := slsaMetadata{
+		BuildInvocationID: strings.Join(ids, ","),
+		Completeness:      slsaCompleteness{Parameters: true},
+	}
+	if !started.IsZero() {
+		t := started.UTC()
+		metadata.BuildStartedOn = &t
+	}
+	if !finished.IsZero() {
+		t := finished.UTC()
+		metadata.BuildFinishedOn = &t
+	}
+
+	statement := inTotoStatement{
+		Type:          InTotoStatementType,
+		PredicateType: SLSAProvenancePredicateType,
+		Subject:       subjects,
+		Predicate: slsaProvenanceV02{
+			Builder:   slsaBuilder{ID: opts.BuilderID},
+			BuildType: StageBuildType,
+			Invocation: slsaInvocation{
+				// the cloudbuild.yaml file is read locally by cmrel rather
+				// than from the source repository
+				ConfigSource: slsaMaterial{EntryPoint: opts.ConfigFile},
+				Parameters:   parameters,
+			},
+			Metadata:  metadata,
+			Materials: []slsaMaterial{source},
+		},
+	}
+
+	return json.Marshal(statement)
+}
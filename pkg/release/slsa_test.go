@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateProvenance(t *testing.T) {
+	started := time.Date(2021, 10, 14, 12, 0, 0, 0, time.UTC)
+	manifest := &Manifest{
+		ReleaseVersion: "v1.6.0",
+		GitCommitRef:   "abc",
+		Artifacts: []ManifestArtifact{
+			{Name: "cert-manager.yaml", SHA256: "1111"},
+			{Name: ChecksumsFileName, SHA256: "2222"},
+		},
+	}
+	opts := ProvenanceOptions{
+		BuilderID:  CloudBuildBuilderID,
+		SourceRepo: "https://github.com/jetstack/cert-manager",
+		GitRef:     "abc",
+		ConfigFile: "gcb/stage/cloudbuild.yaml",
+		Builds: []ProvenanceBuild{
+			{ID: "build-linux", Substitutions: map[string]string{"_TARGET_OSES": "linux"}, StartedOn: started.Add(time.Minute), FinishedOn: started.Add(time.Hour)},
+			{ID: "build-darwin", Substitutions: map[string]string{"_TARGET_OSES": "darwin"}, StartedOn: started, FinishedOn: started.Add(30 * time.Minute)},
+		},
+		Images: map[string]string{"quay.io/jetstack/cert-manager-controller-amd64:v1.6.0": "sha256:3333"},
+	}
+
+	data, err := GenerateProvenance(opts, manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var statement inTotoStatement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		t.Fatal(err)
+	}
+	if statement.Type != InTotoStatementType || statement.PredicateType != SLSAProvenancePredicateType {
+		t.Errorf("unexpected statement type %q with predicate %q", statement.Type, statement.PredicateType)
+	}
+
+	var subjects []string
+	for _, s := range statement.Subject {
+		subjects = append(subjects, s.Name+"@"+s.Digest["sha256"])
+	}
+	exp := "SHA256SUMS@2222,cert-manager.yaml@1111,quay.io/jetstack/cert-manager-controller-amd64:v1.6.0@3333"
+	if got := strings.Join(subjects, ","); got != exp {
+		t.Errorf("unexpected subjects:\ngot: %s\nexp: %s", got, exp)
+	}
+
+	predicate := statement.Predicate
+	if predicate.Builder.ID != CloudBuildBuilderID {
+		t.Errorf("unexpected builder %q", predicate.Builder.ID)
+	}
+	if len(predicate.Materials) != 1 || predicate.Materials[0].URI != "git+https://github.com/jetstack/cert-manager" || predicate.Materials[0].Digest["sha1"] != "abc" {
+		t.Errorf("unexpected materials: %+v", predicate.Materials)
+	}
+	if got := predicate.Metadata.BuildInvocationID; got != "build-linux,build-darwin" {
+		t.Errorf("unexpected build invocation ID %q", got)
+	}
+	if got := predicate.Metadata.BuildStartedOn; got == nil || !got.Equal(started) {
+		t.Errorf("expected the build to start when the first build started but got %v", got)
+	}
+	if got := predicate.Metadata.BuildFinishedOn; got == nil || !got.Equal(started.Add(time.Hour)) {
+		t.Errorf("expected the build to finish when the last build finished but got %v", got)
+	}
+	if got := predicate.Invocation.Parameters["build-darwin"]["_TARGET_OSES"]; got != "darwin" {
+		t.Errorf("expected the substitutions of each build to be recorded but got %q", got)
+	}
+}
+
+func TestGenerateProvenance_Invalid(t *testing.T) {
+	valid := ProvenanceOptions{GitRef: "abc", Builds: []ProvenanceBuild{{ID: "build"}}}
+	validManifest := &Manifest{Artifacts: []ManifestArtifact{{Name: "cert-manager.yaml", SHA256: "1111"}}}
+
+	tests := map[string]struct {
+		opts     func(o *ProvenanceOptions)
+		manifest *Manifest
+		expErr   string
+	}{
+		"no builds": {
+			opts:   func(o *ProvenanceOptions) { o.Builds = nil },
+			expErr: "no builds",
+		},
+		"no git ref": {
+			opts:   func(o *ProvenanceOptions) { o.GitRef = "" },
+			expErr: "no git ref",
+		},
+		"artifact without checksum": {
+			manifest: &Manifest{Artifacts: []ManifestArtifact{{Name: "cert-manager.yaml"}}},
+			expErr:   `artifact "cert-manager.yaml" in release manifest has no checksum`,
+		},
+		"image without sha256 digest": {
+			opts:   func(o *ProvenanceOptions) { o.Images = map[string]string{"controller": "sha512:abc"} },
+			expErr: `image "controller" has unsupported digest`,
+		},
+		"no artifacts": {
+			manifest: &Manifest{},
+			expErr:   "no artifacts",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := valid
+			if test.opts != nil {
+				test.opts(&opts)
+			}
+			manifest := validManifest
+			if test.manifest != nil {
+				manifest = test.manifest
+			}
+			_, err := GenerateProvenance(opts, manifest)
+			if err == nil || !strings.Contains(err.Error(), test.expErr) {
+				t.Errorf("expected error containing %q but got: %v", test.expErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SourceTarball describes a gzipped tar archive of a cert-manager checkout,
+// which can be used as the source of a stage build instead of cloning the
+// repository from GitHub.
+type SourceTarball struct {
+	// GitRef is the commit checked out in the archived repository.
+	GitRef string
+
+	// SHA256 is the hex-encoded SHA256 checksum of the archive.
+	SHA256 string
+}
+
+// SourceTarballObjectName returns the name of the object within a release
+// bucket that a source tarball with the given checksum is uploaded to for use
+// by a stage build, under the given prefix as passed to BucketPathForRelease.
+// Objects are named by their checksum so that re-staging the same archive
+// reuses the same object.
+func SourceTarballObjectName(bucketPrefix, sha256 string) string {
+	return fmt.Sprintf("%s/sources/%s.tar.gz", bucketPrefix, sha256)
+}
+
+// maxGitMetadataSize bounds how much of any file in the archive's .git
+// directory is read when resolving the checked out commit.
+const maxGitMetadataSize = 1024 * 1024
+
+var commitSHARegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// InspectSourceTarball validates that the file at path is a gzipped tar
+// archive of a git checkout and returns a description of it. Entries must be
+// relative to the root of the checkout, as created by e.g.
+// 'tar -czf source.tar.gz -C cert-manager .', and the archive must include
+// the .git directory since the build uses it to determine the release version.
+func InspectSourceTarball(filename string) (*SourceTarball, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	r := bufio.NewReader(io.TeeReader(f, hasher))
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a gzip archive: %w", filename, err)
+	}
+
+	var head string
+	var packedRefs string
+	refs := map[string]string{}
+	hasGitDir := false
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid tar archive: %w", filename, err)
+		}
+
+		name := path.Clean(hdr.Name)
+		if name != ".git" && !strings.HasPrefix(name, ".git/") {
+			continue
+		}
+		hasGitDir = true
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch {
+		case name == ".git/HEAD", name == ".git/packed-refs", strings.HasPrefix(name, ".git/refs/"):
+			content, err := io.ReadAll(io.LimitReader(tr, maxGitMetadataSize))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %q from %q: %w", name, filename, err)
+			}
+
+			switch name {
+			case ".git/HEAD":
+				head = strings.TrimSpace(string(content))
+			case ".git/packed-refs":
+				packedRefs = string(content)
+			default:
+				refs[strings.TrimPrefix(name, ".git/")] = strings.TrimSpace(string(content))
+			}
+		}
+	}
+
+	// read any trailing data so that the checksum covers the whole file
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+
+	if !hasGitDir {
+		return nil, fmt.Errorf("%q does not contain a .git directory at its root", filename)
+	}
+
+	ref, err := resolveGitHead(head, refs, packedRefs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the commit checked out in %q: %w", filename, err)
+	}
+
+	return &SourceTarball{
+		GitRef: ref,
+		SHA256: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// resolveGitHead returns the commit SHA referred to by the content of a git
+// repository's HEAD file, looking up symbolic refs in the given loose refs,
+// keyed by name (e.g. refs/heads/master), or else in the packed-refs file.
+func resolveGitHead(head string, refs map[string]string, packedRefs string) (string, error) {
+	if head == "" {
+		return "", fmt.Errorf(".git/HEAD not found")
+	}
+
+	if !strings.HasPrefix(head, "ref: ") {
+		if !commitSHARegex.MatchString(head) {
+			return "", fmt.Errorf("invalid .git/HEAD %q", head)
+		}
+		return head, nil
+	}
+
+	refName := strings.TrimSpace(strings.TrimPrefix(head, "ref: "))
+	sha, ok := refs[refName]
+	if !ok {
+		for _, line := range strings.Split(packedRefs, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[1] == refName {
+				sha, ok = fields[0], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("ref %q checked out in .git/HEAD not found", refName)
+	}
+	if !commitSHARegex.MatchString(sha) {
+		return "", fmt.Errorf("invalid commit %q for ref %q", sha, refName)
+	}
+
+	return sha, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+func writeTestTarball(t *testing.T, files map[string]string) string {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "source.tar.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInspectSourceTarball(t *testing.T) {
+	tests := map[string]struct {
+		files  map[string]string
+		raw    string
+		expRef string
+		expErr string
+	}{
+		"detached HEAD": {
+			files:  map[string]string{"./.git/HEAD": testCommit + "\n", "./go.mod": "module x"},
+			expRef: testCommit,
+		},
+		"HEAD referring to a loose ref": {
+			files:  map[string]string{".git/HEAD": "ref: refs/heads/master\n", ".git/refs/heads/master": testCommit + "\n"},
+			expRef: testCommit,
+		},
+		"HEAD referring to a packed ref": {
+			files: map[string]string{
+				".git/HEAD":        "ref: refs/heads/release-1.6\n",
+				".git/packed-refs": "# pack-refs with: peeled fully-peeled sorted\nfedcba9876543210fedcba9876543210fedcba98 refs/heads/master\n" + testCommit + " refs/heads/release-1.6\n",
+			},
+			expRef: testCommit,
+		},
+		"missing ref": {
+			files:  map[string]string{".git/HEAD": "ref: refs/heads/master\n"},
+			expErr: `ref "refs/heads/master" checked out in .git/HEAD not found`,
+		},
+		"no .git directory": {
+			files:  map[string]string{"go.mod": "module x"},
+			expErr: "does not contain a .git directory",
+		},
+		".git directory is not at the root": {
+			files:  map[string]string{"cert-manager/.git/HEAD": testCommit},
+			expErr: "does not contain a .git directory",
+		},
+		"not a gzip archive": {
+			raw:    "hello world",
+			expErr: "is not a gzip archive",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := ""
+			if test.raw != "" {
+				path = filepath.Join(t.TempDir(), "source.tar.gz")
+				if err := os.WriteFile(path, []byte(test.raw), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				path = writeTestTarball(t, test.files)
+			}
+
+			source, err := InspectSourceTarball(path)
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if source.GitRef != test.expRef {
+				t.Errorf("unexpected git ref: got=%q, exp=%q", source.GitRef, test.expRef)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256(content)
+			if source.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("unexpected checksum %q", source.SHA256)
+			}
+		})
+	}
+}
+
+func TestSourceTarballObjectName(t *testing.T) {
+	if got := SourceTarballObjectName("stage/gcb", "abc"); got != "stage/gcb/sources/abc.tar.gz" {
+		t.Errorf("unexpected object name %q", got)
+	}
+}
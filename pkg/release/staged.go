@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -33,7 +34,9 @@ type Staged struct {
 	name      string
 	prefix    string
 	meta      Metadata
+	metaObj   *storage.ObjectHandle
 	artifacts []StagedArtifact
+	objects   []*storage.ObjectHandle
 }
 
 // StagedArtifact represents a single artifact within a release, with some
@@ -45,7 +48,12 @@ type StagedArtifact struct {
 
 func NewStagedRelease(name, prefix string, objects ...*storage.ObjectHandle) (*Staged, error) {
 	ctx := context.TODO()
-	meta, err := loadReleaseMetadataFile(ctx, objects...)
+	metaObj := findReleaseMetadataObject(objects...)
+	if metaObj == nil {
+		return nil, fmt.Errorf("release metadata not found")
+	}
+
+	meta, err := loadReleaseMetadataFile(ctx, metaObj)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +67,9 @@ func NewStagedRelease(name, prefix string, objects ...*storage.ObjectHandle) (*S
 		name:      name,
 		prefix:    prefix,
 		meta:      *meta,
+		metaObj:   metaObj,
 		artifacts: artifacts,
+		objects:   objects,
 	}, nil
 }
 
@@ -73,6 +83,29 @@ func (s Staged) Metadata() Metadata {
 	return s.meta
 }
 
+// Artifacts returns all artifacts that are a part of the release.
+func (s Staged) Artifacts() []StagedArtifact {
+	return s.artifacts
+}
+
+// MetadataObject returns the ObjectHandle of the release metadata.json file.
+func (s Staged) MetadataObject() *storage.ObjectHandle {
+	return s.metaObj
+}
+
+// File returns the ObjectHandle of the named file of the release, relative to
+// the directory containing its metadata.json file, or nil if the release has
+// no such file.
+func (s Staged) File(name string) *storage.ObjectHandle {
+	objectName := path.Join(path.Dir(s.metaObj.ObjectName()), name)
+	for _, obj := range s.objects {
+		if obj.ObjectName() == objectName {
+			return obj
+		}
+	}
+	return nil
+}
+
 // ArtifactsOfKind returns a list of ObjectHandles of .tar.gz artifacts of type
 // kind. A kind may be 'server', 'manifests', 'test' etc. and refers to a
 // platform as defined in `build/release-tars/BUILD.bazel`.
@@ -87,17 +120,16 @@ func (s Staged) ArtifactsOfKind(kind string) []StagedArtifact {
 	return objs
 }
 
-func loadReleaseMetadataFile(ctx context.Context, objs ...*storage.ObjectHandle) (*Metadata, error) {
-	var metadataObj *storage.ObjectHandle
+func findReleaseMetadataObject(objs ...*storage.ObjectHandle) *storage.ObjectHandle {
 	for _, f := range objs {
 		if filepath.Base(f.ObjectName()) == MetadataFileName {
-			metadataObj = f
-			break
+			return f
 		}
 	}
-	if metadataObj == nil {
-		return nil, fmt.Errorf("release metadata not found")
-	}
+	return nil
+}
+
+func loadReleaseMetadataFile(ctx context.Context, metadataObj *storage.ObjectHandle) (*Metadata, error) {
 	r, err := metadataObj.NewReader(ctx)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,15 @@
+module github.com/jetstack/cert-manager
+
+go 1.16
+
+require (
+	github.com/onsi/ginkgo v1.16.4
+	github.com/spf13/cobra v1.2.1
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5 // indirect
+	k8s.io/api v0.22.1
+	k8s.io/client-go v0.22.1
+)
+
+replace k8s.io/client-go => k8s.io/client-go v0.22.0
+
+replace golang.org/x/crypto => ./third_party/crypto
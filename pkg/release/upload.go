@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// UploadOptions configures how objects are uploaded by UploadObject.
+type UploadOptions struct {
+	// ChunkSize is the number of bytes uploaded in each request of a
+	// resumable upload, so that a failed request only requires its chunk to
+	// be resent. If zero, objects are uploaded in a single request.
+	ChunkSize int
+
+	// MaxRetries is the maximum number of times an upload will be restarted
+	// if it fails with a transient error. If zero, uploads are never retried.
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry. The delay is doubled
+	// after each subsequent attempt.
+	BaseDelay time.Duration
+}
+
+// DefaultUploadOptions are the UploadOptions used when none are configured.
+var DefaultUploadOptions = UploadOptions{
+	ChunkSize:  googleapi.DefaultUploadChunkSize,
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// UploadObject writes the content read from r to obj, setting meta as the
+// object's metadata. The upload is resumable if opts.ChunkSize is set, and is
+// restarted from the beginning of r if it fails with a transient error.
+// The CRC32C checksum of the content is sent with the upload so that GCS
+// rejects corrupted data, and the size and checksum of the stored object are
+// verified once the upload completes.
+func UploadObject(ctx context.Context, obj *storage.ObjectHandle, r io.ReadSeeker, meta ObjectMetadata, opts UploadOptions) error {
+	size, crc, err := sizeAndCRC32C(r)
+	if err != nil {
+		return fmt.Errorf("failed to read content to upload: %w", err)
+	}
+
+	return withUploadRetries(ctx, opts, obj.ObjectName(), func() error {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		w := obj.NewWriter(ctx)
+		w.ChunkSize = opts.ChunkSize
+		w.Metadata = meta.Map()
+		w.CRC32C = crc
+		w.SendCRC32C = true
+		if _, err := io.Copy(w, r); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		return verifyUploadedObject(w.Attrs(), size, crc)
+	})
+}
+
+// sizeAndCRC32C returns the size and CRC32C checksum of the content of r.
+func sizeAndCRC32C(r io.ReadSeeker) (int64, uint32, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	h := crc32.New(castagnoliTable)
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, h.Sum32(), nil
+}
+
+// verifyUploadedObject returns an error if the attributes of an uploaded
+// object don't match the size and CRC32C checksum of the uploaded content.
+func verifyUploadedObject(attrs *storage.ObjectAttrs, size int64, crc uint32) error {
+	if attrs == nil {
+		return fmt.Errorf("no attributes were returned for the uploaded object")
+	}
+	if attrs.Size != size {
+		return fmt.Errorf("uploaded object %q has size %d but expected %d", attrs.Name, attrs.Size, size)
+	}
+	if attrs.CRC32C != crc {
+		return fmt.Errorf("uploaded object %q has CRC32C checksum %08x but expected %08x", attrs.Name, attrs.CRC32C, crc)
+	}
+	return nil
+}
+
+// withUploadRetries calls upload until it succeeds, returns an error which
+// isn't transient, or opts.MaxRetries retries have been made.
+func withUploadRetries(ctx context.Context, opts UploadOptions, name string, upload func() error) error {
+	delay := opts.BaseDelay
+	for attempt := 0; ; attempt++ {
+		err := upload()
+		if err == nil || !isRetryableUploadError(err) || attempt >= opts.MaxRetries {
+			return err
+		}
+
+		log.Printf("Upload of %q failed, retrying in %s (attempt %d of %d): %v", name, delay, attempt+1, opts.MaxRetries, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryableUploadError returns true if err is likely to be caused by a
+// transient problem, such as a dropped connection or a 429 or 5xx response.
+func isRetryableUploadError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
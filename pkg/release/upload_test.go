@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+func TestWithUploadRetries(t *testing.T) {
+	transient := &googleapi.Error{Code: 503}
+	tests := map[string]struct {
+		errs        []error
+		maxRetries  int
+		expAttempts int
+		expErr      bool
+	}{
+		"succeeds first time": {
+			errs:        []error{nil},
+			maxRetries:  3,
+			expAttempts: 1,
+		},
+		"succeeds after transient errors": {
+			errs:        []error{transient, io.ErrUnexpectedEOF, nil},
+			maxRetries:  3,
+			expAttempts: 3,
+		},
+		"gives up after max retries": {
+			errs:        []error{transient, transient, transient},
+			maxRetries:  2,
+			expAttempts: 3,
+			expErr:      true,
+		},
+		"does not retry permanent errors": {
+			errs:        []error{&googleapi.Error{Code: 412}, nil},
+			maxRetries:  3,
+			expAttempts: 1,
+			expErr:      true,
+		},
+		"does not retry when retries are disabled": {
+			errs:        []error{transient, nil},
+			maxRetries:  0,
+			expAttempts: 1,
+			expErr:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			opts := UploadOptions{MaxRetries: test.maxRetries, BaseDelay: time.Millisecond}
+			err := withUploadRetries(context.Background(), opts, "test", func() error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+			if test.expErr != (err != nil) {
+				t.Errorf("expErr=%v but got err: %v", test.expErr, err)
+			}
+			if attempts != test.expAttempts {
+				t.Errorf("expected %d attempts but got %d", test.expAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestIsRetryableUploadError(t *testing.T) {
+	tests := map[string]struct {
+		err error
+		exp bool
+	}{
+		"rate limited":      {err: &googleapi.Error{Code: 429}, exp: true},
+		"server error":      {err: fmt.Errorf("upload: %w", &googleapi.Error{Code: 502}), exp: true},
+		"unexpected EOF":    {err: io.ErrUnexpectedEOF, exp: true},
+		"network error":     {err: &net.OpError{Op: "write", Err: errors.New("connection reset by peer")}, exp: true},
+		"precondition":      {err: &googleapi.Error{Code: 412}},
+		"forbidden":         {err: &googleapi.Error{Code: 403}},
+		"cancelled":         {err: context.Canceled},
+		"unrelated failure": {err: errors.New("boom")},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isRetryableUploadError(test.err); got != test.exp {
+				t.Errorf("expected %v but got %v", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestVerifyUploadedObject(t *testing.T) {
+	size, crc, err := sizeAndCRC32C(strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CRC32C of "hello world"
+	if size != 11 || crc != 0xc99465aa {
+		t.Fatalf("unexpected size %d and checksum %08x", size, crc)
+	}
+
+	tests := map[string]struct {
+		attrs  *storage.ObjectAttrs
+		expErr bool
+	}{
+		"matching object": {
+			attrs: &storage.ObjectAttrs{Name: "a", Size: 11, CRC32C: 0xc99465aa},
+		},
+		"truncated object": {
+			attrs:  &storage.ObjectAttrs{Name: "a", Size: 5, CRC32C: 0xc99465aa},
+			expErr: true,
+		},
+		"corrupted object": {
+			attrs:  &storage.ObjectAttrs{Name: "a", Size: 11, CRC32C: 1},
+			expErr: true,
+		},
+		"missing attributes": {
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifyUploadedObject(test.attrs, size, crc)
+			if test.expErr != (err != nil) {
+				t.Errorf("expErr=%v but got err: %v", test.expErr, err)
+			}
+		})
+	}
+}
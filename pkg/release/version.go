@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// ValidateReleaseVersion returns an error if v is not a well-formed release
+// version of the form vX.Y.Z or vX.Y.Z-prerelease, e.g. v1.6.0 or
+// v1.6.0-beta.0.
+// Build metadata (e.g. v1.6.0+abc) is not permitted, as release versions are
+// also used as container image tags which cannot contain a '+' character.
+func ValidateReleaseVersion(v string) error {
+	if !strings.HasPrefix(v, "v") {
+		return fmt.Errorf("invalid release version %q: must have a leading 'v' character, e.g. v1.6.0", v)
+	}
+
+	version, err := semver.Parse(strings.TrimPrefix(v, "v"))
+	if err != nil {
+		return fmt.Errorf("invalid release version %q: must be of the form vX.Y.Z[-prerelease]: %w", v, err)
+	}
+
+	if len(version.Build) > 0 {
+		return fmt.Errorf("invalid release version %q: build metadata is not permitted", v)
+	}
+
+	return nil
+}
+
+// IsPrerelease returns true if v is a valid release version with a prerelease
+// component, e.g. v1.6.0-beta.0 or v1.6.0-alpha.1.
+func IsPrerelease(v string) bool {
+	if ValidateReleaseVersion(v) != nil {
+		return false
+	}
+	version, _ := semver.Parse(strings.TrimPrefix(v, "v"))
+	return len(version.Pre) > 0
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import "testing"
+
+func TestValidateReleaseVersion(t *testing.T) {
+	tests := map[string]struct {
+		version   string
+		expectErr bool
+	}{
+		"release": {
+			version: "v1.6.0",
+		},
+		"prerelease": {
+			version: "v1.6.0-beta.0",
+		},
+		"prerelease with multiple components": {
+			version: "v1.6.0-alpha.0.1",
+		},
+		"missing patch version": {
+			version:   "v0.14",
+			expectErr: true,
+		},
+		"missing leading v": {
+			version:   "1.6.0",
+			expectErr: true,
+		},
+		"empty": {
+			version:   "",
+			expectErr: true,
+		},
+		"build metadata": {
+			version:   "v1.6.0+abcdef",
+			expectErr: true,
+		},
+		"leading zero": {
+			version:   "v1.06.0",
+			expectErr: true,
+		},
+		"trailing garbage": {
+			version:   "v1.6.0 ",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateReleaseVersion(test.version)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestBuildTypeForVersion(t *testing.T) {
+	tests := map[string]struct {
+		version      string
+		expBuildType string
+		expPath      string
+	}{
+		"final release": {
+			version:      "v1.6.0",
+			expBuildType: BuildTypeRelease,
+			expPath:      "stage/gcb/release/v1.6.0-abc",
+		},
+		"beta release candidate": {
+			version:      "v1.15.0-beta.0",
+			expBuildType: BuildTypePrerelease,
+			expPath:      "stage/gcb/prerelease/v1.15.0-beta.0-abc",
+		},
+		"alpha release candidate": {
+			version:      "v1.6.0-alpha.0.1",
+			expBuildType: BuildTypePrerelease,
+			expPath:      "stage/gcb/prerelease/v1.6.0-alpha.0.1-abc",
+		},
+		"devel build": {
+			version:      "",
+			expBuildType: BuildTypeDevel,
+			expPath:      "stage/gcb/devel/abc",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buildType := BuildTypeForVersion(test.version)
+			if buildType != test.expBuildType {
+				t.Errorf("unexpected build type: got=%q, exp=%q", buildType, test.expBuildType)
+			}
+			if p := BucketPathForRelease("stage/gcb", buildType, test.version, "abc"); p != test.expPath {
+				t.Errorf("unexpected bucket path: got=%q, exp=%q", p, test.expPath)
+			}
+		})
+	}
+}
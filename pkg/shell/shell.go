@@ -24,7 +24,16 @@ import (
 
 // Command runs the given command with the given args
 func Command(ctx context.Context, workDir string, cmd string, args ...string) error {
+	return CommandWithEnv(ctx, workDir, nil, cmd, args...)
+}
+
+// CommandWithEnv runs the given command with the given args, adding env to
+// the environment inherited from the current process.
+func CommandWithEnv(ctx context.Context, workDir string, env []string, cmd string, args ...string) error {
 	c := exec.CommandContext(ctx, cmd, args...)
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
 
 	// redirect all output
 	// TODO: honour --debug flag
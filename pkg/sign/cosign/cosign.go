@@ -18,11 +18,41 @@ package cosign
 
 import (
 	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
 
 	"github.com/cert-manager/release/pkg/shell"
 	"github.com/cert-manager/release/pkg/sign"
 )
 
+// keylessEnv enables cosign's keyless signing mode, which is still marked as
+// experimental.
+var keylessEnv = []string{"COSIGN_EXPERIMENTAL=1"}
+
+// SigstoreAudience is the audience of the OIDC identity tokens accepted by
+// the Sigstore certificate authority for keyless signing.
+const SigstoreAudience = "sigstore"
+
+// getMetadata is overridden in tests
+var getMetadata = metadata.Get
+
+// MetadataIdentityToken returns an OIDC identity token for the default
+// service account of the GCE metadata server, e.g. that of the Cloud Build
+// job running this command, with the audience required for keyless signing.
+func MetadataIdentityToken() (string, error) {
+	token, err := getMetadata(fmt.Sprintf("instance/service-accounts/default/identity?audience=%s&format=full", SigstoreAudience))
+	if err != nil {
+		return "", fmt.Errorf("failed to get identity token from the metadata server: %w", err)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("metadata server returned an empty identity token")
+	}
+	return token, nil
+}
+
 // Sign calls out to cosign to sign a given container using the provided GCP key.
 func Sign(ctx context.Context, cosignPath string, containers []string, key sign.GCPKMSKey) error {
 	args := append([]string{
@@ -38,3 +68,74 @@ func Sign(ctx context.Context, cosignPath string, containers []string, key sign.
 func Version(ctx context.Context, cosignPath string) error {
 	return shell.Command(ctx, "", cosignPath, []string{"version"}...)
 }
+
+// KMSSigner is a sign.Signer which uses cosign to sign artifacts with a GCP
+// KMS key.
+type KMSSigner struct {
+	cosignPath string
+	key        sign.GCPKMSKey
+}
+
+var _ sign.Signer = &KMSSigner{}
+
+// NewKMSSigner returns a Signer which signs using the given GCP KMS key.
+func NewKMSSigner(cosignPath string, key sign.GCPKMSKey) *KMSSigner {
+	return &KMSSigner{cosignPath: cosignPath, key: key}
+}
+
+// SignImages signs the given container images using the KMS key.
+func (s *KMSSigner) SignImages(ctx context.Context, images []string) error {
+	return Sign(ctx, s.cosignPath, images, s.key)
+}
+
+// SignBlob writes a signature for the file at path to path+".sig".
+func (s *KMSSigner) SignBlob(ctx context.Context, path string) ([]string, error) {
+	sigPath := path + ".sig"
+	if err := shell.Command(ctx, "", s.cosignPath, "sign-blob", "--key", s.key.CosignFormat(), "--output-signature", sigPath, path); err != nil {
+		return nil, err
+	}
+	return []string{sigPath}, nil
+}
+
+// KeylessSigner is a sign.Signer which uses cosign's keyless mode, signing
+// with an ephemeral key certified using the OIDC identity of the caller and
+// recording each signature in the Rekor transparency log.
+type KeylessSigner struct {
+	cosignPath    string
+	identityToken string
+}
+
+var _ sign.Signer = &KeylessSigner{}
+
+// NewKeylessSigner returns a Signer which uses cosign's keyless mode,
+// identifying the signer with the given OIDC identity token, e.g. from
+// MetadataIdentityToken. If identityToken is empty cosign obtains one
+// itself, which requires an interactive browser flow outside of CI.
+func NewKeylessSigner(cosignPath, identityToken string) *KeylessSigner {
+	return &KeylessSigner{cosignPath: cosignPath, identityToken: identityToken}
+}
+
+// SignImages signs the given container images.
+func (s *KeylessSigner) SignImages(ctx context.Context, images []string) error {
+	args := append(append([]string{"sign"}, s.identityArgs()...), images...)
+	return shell.CommandWithEnv(ctx, "", keylessEnv, s.cosignPath, args...)
+}
+
+// SignBlob writes a signature for the file at path to path+".sig", and the
+// certificate for the ephemeral signing key to path+".pem". Both are needed
+// to verify the signature with 'cosign verify-blob'.
+func (s *KeylessSigner) SignBlob(ctx context.Context, path string) ([]string, error) {
+	sigPath, certPath := path+".sig", path+".pem"
+	args := append(append([]string{"sign-blob"}, s.identityArgs()...), "--output-signature", sigPath, "--output-certificate", certPath, path)
+	if err := shell.CommandWithEnv(ctx, "", keylessEnv, s.cosignPath, args...); err != nil {
+		return nil, err
+	}
+	return []string{sigPath, certPath}, nil
+}
+
+func (s *KeylessSigner) identityArgs() []string {
+	if s.identityToken == "" {
+		return nil
+	}
+	return []string{"--identity-token", s.identityToken}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataIdentityToken(t *testing.T) {
+	defer func(orig func(string) (string, error)) { getMetadata = orig }(getMetadata)
+
+	tests := map[string]struct {
+		token     string
+		err       error
+		expToken  string
+		expectErr bool
+	}{
+		"token is trimmed": {
+			token:    "eyJhbGciOi.abc.def\n",
+			expToken: "eyJhbGciOi.abc.def",
+		},
+		"metadata server error": {
+			err:       errors.New("not on GCE"),
+			expectErr: true,
+		},
+		"empty token": {
+			token:     "",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var suffix string
+			getMetadata = func(s string) (string, error) {
+				suffix = s
+				return test.token, test.err
+			}
+
+			token, err := MetadataIdentityToken()
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+			if token != test.expToken {
+				t.Errorf("unexpected token: got=%q, exp=%q", token, test.expToken)
+			}
+			if exp := "instance/service-accounts/default/identity?audience=sigstore&format=full"; suffix != exp {
+				t.Errorf("unexpected metadata path: got=%q, exp=%q", suffix, exp)
+			}
+		})
+	}
+}
+
+func TestKeylessSignerIdentityArgs(t *testing.T) {
+	if args := NewKeylessSigner("cosign", "").identityArgs(); args != nil {
+		t.Errorf("expected no identity args without a token but got %v", args)
+	}
+	if args := NewKeylessSigner("cosign", "tok").identityArgs(); !reflect.DeepEqual(args, []string{"--identity-token", "tok"}) {
+		t.Errorf("unexpected identity args: %v", args)
+	}
+}
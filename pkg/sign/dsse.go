@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// DSSEEnvelope is a payload signed using the Dead Simple Signing Envelope
+// format, as used to distribute in-toto attestations.
+type DSSEEnvelope struct {
+	// PayloadType is the media type of the payload.
+	PayloadType string `json:"payloadType"`
+
+	// Payload is the base64 encoded payload.
+	Payload string `json:"payload"`
+
+	// Signatures of the envelope's pre-authentication encoding.
+	Signatures []DSSESignature `json:"signatures"`
+}
+
+// DSSESignature is one of the signatures of a DSSEEnvelope.
+type DSSESignature struct {
+	// KeyID identifies the key which made the signature, which is the
+	// resource name of its KMS key version.
+	KeyID string `json:"keyid"`
+
+	// Sig is the base64 encoded signature.
+	Sig string `json:"sig"`
+}
+
+// DSSEPreAuthEncoding returns the pre-authentication encoding of payload,
+// which is what is actually signed for a DSSE envelope.
+func DSSEPreAuthEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// SignDSSE signs payload with each of the given KMS keys, returning a DSSE
+// envelope containing the payload and every signature.
+func SignDSSE(ctx context.Context, keys []GCPKMSKey, payloadType string, payload []byte) (*DSSEEnvelope, error) {
+	client, err := newKMSClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return signDSSE(ctx, client, keys, payloadType, payload)
+}
+
+func signDSSE(ctx context.Context, client kmsClient, keys []GCPKMSKey, payloadType string, payload []byte) (*DSSEEnvelope, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys to sign DSSE envelope with")
+	}
+
+	envelope := &DSSEEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+	}
+	pae := DSSEPreAuthEncoding(payloadType, payload)
+	for _, key := range keys {
+		sig, err := signBytes(ctx, client, key, pae)
+		if err != nil {
+			return nil, err
+		}
+		envelope.Signatures = append(envelope.Signatures, DSSESignature{
+			KeyID: key.String(),
+			Sig:   base64.StdEncoding.EncodeToString(sig),
+		})
+	}
+	return envelope, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestDSSEPreAuthEncoding(t *testing.T) {
+	// the example from the DSSE specification
+	exp := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got := string(DSSEPreAuthEncoding("http://example.com/HelloWorld", []byte("hello world"))); got != exp {
+		t.Errorf("unexpected encoding:\ngot: %q\nexp: %q", got, exp)
+	}
+}
+
+func TestSignDSSE(t *testing.T) {
+	keys, err := NewGCPKMSKeys([]string{
+		"projects/cert-manager-release/locations/europe-west1/keyRings/cert-manager-release/cryptoKeys/cert-manager-release-signing-key/cryptoKeyVersions/1",
+		"projects/cert-manager-release/locations/europe-west1/keyRings/cert-manager-release/cryptoKeys/cert-manager-release-signing-key/cryptoKeyVersions/2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeKMSClient{signer: ecKey, algorithm: "EC_SIGN_P256_SHA256"}
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`)
+	envelope, err := signDSSE(context.Background(), client, keys, "application/vnd.in-toto+json", payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(envelope.Payload); err != nil || string(decoded) != string(payload) {
+		t.Errorf("expected envelope to contain the encoded payload but got %q", envelope.Payload)
+	}
+	if len(envelope.Signatures) != len(keys) {
+		t.Fatalf("expected a signature for each key but got %d", len(envelope.Signatures))
+	}
+
+	pub, err := getPublicKey(context.Background(), client, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range envelope.Signatures {
+		if s.KeyID != keys[i].String() {
+			t.Errorf("expected signature %d to be made by %q but got %q", i, keys[i], s.KeyID)
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifySignature([]byte(pub.Pem), client.algorithm, DSSEPreAuthEncoding(envelope.PayloadType, payload), sig); err != nil {
+			t.Errorf("signature %d did not verify: %v", i, err)
+		}
+	}
+
+	if _, err := signDSSE(context.Background(), client, nil, "application/vnd.in-toto+json", payload); err == nil {
+		t.Errorf("expected an error signing without any keys")
+	}
+}
@@ -53,6 +53,27 @@ func NewGCPKMSKey(raw string) (GCPKMSKey, error) {
 	}, nil
 }
 
+// NewGCPKMSKeys parses and validates each of the given KMS keys as with
+// NewGCPKMSKey. Empty strings and duplicate keys are ignored, and the order of
+// the remaining keys is preserved.
+func NewGCPKMSKeys(raw []string) ([]GCPKMSKey, error) {
+	var keys []GCPKMSKey
+	seen := map[string]bool{}
+	for _, r := range raw {
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+
+		key, err := NewGCPKMSKey(r)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
 // String returns the key in GCP format
 func (g GCPKMSKey) String() string {
 	return g.GCPFormat()
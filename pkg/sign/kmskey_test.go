@@ -16,7 +16,10 @@ limitations under the License.
 
 package sign
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestGCPKMSKey(t *testing.T) {
 	tests := map[string]struct {
@@ -59,3 +62,52 @@ func TestGCPKMSKey(t *testing.T) {
 		})
 	}
 }
+
+func TestNewGCPKMSKeys(t *testing.T) {
+	const (
+		keyV1 = "projects/cert-manager-release/locations/europe-west1/keyRings/cert-manager-release/cryptoKeys/cert-manager-release-signing-key/cryptoKeyVersions/1"
+		keyV2 = "projects/cert-manager-release/locations/europe-west1/keyRings/cert-manager-release/cryptoKeys/cert-manager-release-signing-key/cryptoKeyVersions/2"
+	)
+
+	tests := map[string]struct {
+		input        []string
+		expectedKeys []string
+		shouldError  bool
+	}{
+		"no keys": {
+			input: nil,
+		},
+		"multiple keys preserve order": {
+			input:        []string{keyV2, keyV1},
+			expectedKeys: []string{keyV2, keyV1},
+		},
+		"empty and duplicate keys are ignored": {
+			input:        []string{keyV1, "", keyV2, keyV1},
+			expectedKeys: []string{keyV1, keyV2},
+		},
+		"invalid key errors": {
+			input:       []string{keyV1, "not-a-key"},
+			shouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			keys, err := NewGCPKMSKeys(test.input)
+
+			if (err != nil) != test.shouldError {
+				t.Errorf("shouldError=%v, err=%v", test.shouldError, err)
+				return
+			}
+
+			var got []string
+			for _, key := range keys {
+				got = append(got, key.GCPFormat())
+			}
+
+			if !reflect.DeepEqual(got, test.expectedKeys) {
+				t.Errorf("wanted keys %q but got %q", test.expectedKeys, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+// requiredSigningPermissions are the IAM permissions needed on a KMS key in
+// order to sign release artifacts with it.
+var requiredSigningPermissions = []string{
+	"cloudkms.cryptoKeyVersions.useToSign",
+	"cloudkms.cryptoKeyVersions.viewPublicKey",
+}
+
+// CheckSigningAccess uses the GCP KMS API to confirm that the caller's
+// credentials have the permissions required to sign using the key, and that
+// the public key of the key version can be fetched. It returns an error
+// describing any missing permissions if not.
+func (g GCPKMSKey) CheckSigningAccess(ctx context.Context) error {
+	svc, err := newKMSService(ctx)
+	if err != nil {
+		return err
+	}
+
+	cryptoKey := strings.TrimSuffix(g.GCPFormat(), "/cryptoKeyVersions/"+g.version)
+	resp, err := svc.Projects.Locations.KeyRings.CryptoKeys.TestIamPermissions(cryptoKey, &cloudkms.TestIamPermissionsRequest{
+		Permissions: requiredSigningPermissions,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to check permissions on KMS key %q: %w", cryptoKey, err)
+	}
+
+	if missing := missingPermissions(requiredSigningPermissions, resp.Permissions); len(missing) > 0 {
+		return fmt.Errorf("caller is missing permissions on KMS key %q: %s", cryptoKey, strings.Join(missing, ", "))
+	}
+
+	if _, err := svc.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(g.GCPFormat()).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("failed to fetch public key for KMS key version %q: %w", g.GCPFormat(), err)
+	}
+
+	return nil
+}
+
+// newKMSService creates a GCP KMS API client using default credentials.
+func newKMSService(ctx context.Context) (*cloudkms.Service, error) {
+	oauthClient, err := google.DefaultClient(ctx, cloudkms.CloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("could not create GCP OAuth2 client: %w", err)
+	}
+
+	svc, err := cloudkms.NewService(ctx, option.WithHTTPClient(oauthClient))
+	if err != nil {
+		return nil, fmt.Errorf("could not create GCP KMS client: %w", err)
+	}
+
+	return svc, nil
+}
+
+// missingPermissions returns the entries of required which are not in granted.
+func missingPermissions(required, granted []string) []string {
+	grantedSet := make(map[string]bool, len(granted))
+	for _, p := range granted {
+		grantedSet[p] = true
+	}
+
+	var missing []string
+	for _, p := range required {
+		if !grantedSet[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingPermissions(t *testing.T) {
+	tests := map[string]struct {
+		granted []string
+		exp     []string
+	}{
+		"all permissions granted": {
+			granted: requiredSigningPermissions,
+			exp:     nil,
+		},
+		"no permissions granted": {
+			granted: nil,
+			exp:     requiredSigningPermissions,
+		},
+		"sign permission missing": {
+			granted: []string{"cloudkms.cryptoKeyVersions.viewPublicKey"},
+			exp:     []string{"cloudkms.cryptoKeyVersions.useToSign"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := missingPermissions(requiredSigningPermissions, test.granted)
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("unexpected missing permissions: got=%v, exp=%v", got, test.exp)
+			}
+		})
+	}
+}
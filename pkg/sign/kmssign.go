@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// kmsClient is the subset of the GCP KMS API used to create detached
+// signatures, allowing it to be faked in tests.
+type kmsClient interface {
+	GetPublicKey(ctx context.Context, name string) (*cloudkms.PublicKey, error)
+	AsymmetricSign(ctx context.Context, name string, req *cloudkms.AsymmetricSignRequest) (*cloudkms.AsymmetricSignResponse, error)
+}
+
+// cloudKMSClient implements kmsClient using the GCP KMS API.
+type cloudKMSClient struct {
+	svc *cloudkms.Service
+}
+
+func (c *cloudKMSClient) GetPublicKey(ctx context.Context, name string) (*cloudkms.PublicKey, error) {
+	return c.svc.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(name).Context(ctx).Do()
+}
+
+func (c *cloudKMSClient) AsymmetricSign(ctx context.Context, name string, req *cloudkms.AsymmetricSignRequest) (*cloudkms.AsymmetricSignResponse, error) {
+	return c.svc.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.AsymmetricSign(name, req).Context(ctx).Do()
+}
+
+func newKMSClient(ctx context.Context) (kmsClient, error) {
+	svc, err := newKMSService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudKMSClient{svc: svc}, nil
+}
+
+// crc32cTable is used to compute the CRC32C checksums the KMS API uses to
+// detect corruption of requests and responses in transit.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SignBytes creates a detached signature of data using the KMS AsymmetricSign
+// API, returning the raw signature bytes. Any of the RSA or EC signing
+// algorithms supported by KMS may be used, and the signature can be verified
+// with VerifyKMS or against the key's public key as returned by PublicKeyPEM.
+func SignBytes(ctx context.Context, key GCPKMSKey, data []byte) ([]byte, error) {
+	client, err := newKMSClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return signBytes(ctx, client, key, data)
+}
+
+// SignFile creates a detached signature of the file at path, as with
+// SignBytes.
+func SignFile(ctx context.Context, key GCPKMSKey, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return SignBytes(ctx, key, data)
+}
+
+// PublicKeyPEM returns the PEM encoded public key of the KMS key version, so
+// that it can be distributed to verify signatures made by SignBytes without
+// access to KMS.
+func PublicKeyPEM(ctx context.Context, key GCPKMSKey) ([]byte, error) {
+	client, err := newKMSClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKeyPEM(ctx, client, key)
+}
+
+func publicKeyPEM(ctx context.Context, client kmsClient, key GCPKMSKey) ([]byte, error) {
+	pub, err := getPublicKey(ctx, client, key)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(pub.Pem))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("invalid public key for KMS key version %q: not a PEM encoded public key", key)
+	}
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("invalid public key for KMS key version %q: %w", key, err)
+	}
+
+	return []byte(pub.Pem), nil
+}
+
+func signBytes(ctx context.Context, client kmsClient, key GCPKMSKey, data []byte) ([]byte, error) {
+	pub, err := getPublicKey(ctx, client, key)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashForAlgorithm(pub.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign with KMS key %q: %w", key, err)
+	}
+
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	encodedDigest := base64.StdEncoding.EncodeToString(digest)
+	kmsDigest := &cloudkms.Digest{}
+	switch hash {
+	case crypto.SHA256:
+		kmsDigest.Sha256 = encodedDigest
+	case crypto.SHA384:
+		kmsDigest.Sha384 = encodedDigest
+	case crypto.SHA512:
+		kmsDigest.Sha512 = encodedDigest
+	}
+
+	resp, err := client.AsymmetricSign(ctx, key.GCPFormat(), &cloudkms.AsymmetricSignRequest{
+		Digest:       kmsDigest,
+		DigestCrc32c: int64(crc32.Checksum(digest, crc32cTable)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with KMS key %q: %w", key, err)
+	}
+
+	if resp.Name != key.GCPFormat() {
+		return nil, fmt.Errorf("failed to sign with KMS key %q: response was for key %q", key, resp.Name)
+	}
+	if !resp.VerifiedDigestCrc32c {
+		return nil, fmt.Errorf("failed to sign with KMS key %q: digest was corrupted in transit", key)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with KMS key %q: invalid signature encoding: %w", key, err)
+	}
+	if int64(crc32.Checksum(sig, crc32cTable)) != resp.SignatureCrc32c {
+		return nil, fmt.Errorf("failed to sign with KMS key %q: signature was corrupted in transit", key)
+	}
+
+	return sig, nil
+}
+
+func getPublicKey(ctx context.Context, client kmsClient, key GCPKMSKey) (*cloudkms.PublicKey, error) {
+	pub, err := client.GetPublicKey(ctx, key.GCPFormat())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch public key for KMS key version %q: %w", key, err)
+	}
+
+	if pub.PemCrc32c != 0 && int64(crc32.Checksum([]byte(pub.Pem), crc32cTable)) != pub.PemCrc32c {
+		return nil, fmt.Errorf("failed to fetch public key for KMS key version %q: public key was corrupted in transit", key)
+	}
+
+	return pub, nil
+}
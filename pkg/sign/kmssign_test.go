@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// fakeKMSClient signs requests using a local private key, as KMS would.
+type fakeKMSClient struct {
+	signer    crypto.Signer
+	algorithm string
+
+	// mutate, if set, is called on each response before it is returned
+	mutate func(resp *cloudkms.AsymmetricSignResponse)
+	err    error
+
+	// pem, if set, is returned as the public key instead of that of signer
+	pem string
+}
+
+func (f *fakeKMSClient) GetPublicKey(ctx context.Context, name string) (*cloudkms.PublicKey, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(f.signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if f.pem != "" {
+		pemData = []byte(f.pem)
+	}
+
+	return &cloudkms.PublicKey{
+		Name:      name,
+		Algorithm: f.algorithm,
+		Pem:       string(pemData),
+		PemCrc32c: int64(crc32.Checksum(pemData, crc32cTable)),
+	}, nil
+}
+
+func (f *fakeKMSClient) AsymmetricSign(ctx context.Context, name string, req *cloudkms.AsymmetricSignRequest) (*cloudkms.AsymmetricSignResponse, error) {
+	hash, err := hashForAlgorithm(f.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := map[crypto.Hash]string{
+		crypto.SHA256: req.Digest.Sha256,
+		crypto.SHA384: req.Digest.Sha384,
+		crypto.SHA512: req.Digest.Sha512,
+	}[hash]
+	digest, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("digest does not match key algorithm")
+	}
+
+	sig, err := f.signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &cloudkms.AsymmetricSignResponse{
+		Name:                 name,
+		Signature:            base64.StdEncoding.EncodeToString(sig),
+		SignatureCrc32c:      int64(crc32.Checksum(sig, crc32cTable)),
+		VerifiedDigestCrc32c: int64(crc32.Checksum(digest, crc32cTable)) == req.DigestCrc32c,
+	}
+	if f.mutate != nil {
+		f.mutate(resp)
+	}
+	return resp, nil
+}
+
+func TestSignBytes(t *testing.T) {
+	data := []byte("0123abcd  cert-manager-manifests.tar.gz\n")
+
+	key, err := NewGCPKMSKey("projects/cert-manager-release/locations/europe-west1/keyRings/cert-manager-release/cryptoKeys/cert-manager-release-signing-key/cryptoKeyVersions/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		client      *fakeKMSClient
+		expectedErr string
+	}{
+		"RSA PKCS#1 key": {
+			client: &fakeKMSClient{signer: rsaKey, algorithm: "RSA_SIGN_PKCS1_4096_SHA512"},
+		},
+		"EC key": {
+			client: &fakeKMSClient{signer: ecKey, algorithm: "EC_SIGN_P256_SHA256"},
+		},
+		"unsupported algorithm": {
+			client:      &fakeKMSClient{signer: rsaKey, algorithm: "RSA_DECRYPT_OAEP_2048_SHA1"},
+			expectedErr: "unsupported key algorithm",
+		},
+		"API error": {
+			client:      &fakeKMSClient{signer: rsaKey, algorithm: "RSA_SIGN_PKCS1_4096_SHA512", err: errors.New("permission denied")},
+			expectedErr: "permission denied",
+		},
+		"digest not verified by KMS": {
+			client: &fakeKMSClient{signer: rsaKey, algorithm: "RSA_SIGN_PKCS1_4096_SHA512", mutate: func(resp *cloudkms.AsymmetricSignResponse) {
+				resp.VerifiedDigestCrc32c = false
+			}},
+			expectedErr: "digest was corrupted",
+		},
+		"corrupted signature": {
+			client: &fakeKMSClient{signer: rsaKey, algorithm: "RSA_SIGN_PKCS1_4096_SHA512", mutate: func(resp *cloudkms.AsymmetricSignResponse) {
+				resp.SignatureCrc32c++
+			}},
+			expectedErr: "signature was corrupted",
+		},
+		"response for a different key": {
+			client: &fakeKMSClient{signer: rsaKey, algorithm: "RSA_SIGN_PKCS1_4096_SHA512", mutate: func(resp *cloudkms.AsymmetricSignResponse) {
+				resp.Name = "other"
+			}},
+			expectedErr: `response was for key "other"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sig, err := signBytes(context.Background(), test.client, key, data)
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			pub, err := getPublicKey(context.Background(), test.client, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifySignature([]byte(pub.Pem), test.client.algorithm, data, sig); err != nil {
+				t.Errorf("signature did not verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestPublicKeyPEM(t *testing.T) {
+	key, err := NewGCPKMSKey("projects/cert-manager-release/locations/europe-west1/keyRings/cert-manager-release/cryptoKeys/cert-manager-release-signing-key/cryptoKeyVersions/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		client      *fakeKMSClient
+		expectedErr string
+	}{
+		"valid public key": {
+			client: &fakeKMSClient{signer: ecKey, algorithm: "EC_SIGN_P256_SHA256"},
+		},
+		"not PEM encoded": {
+			client:      &fakeKMSClient{signer: ecKey, algorithm: "EC_SIGN_P256_SHA256", pem: "not a key"},
+			expectedErr: "not a PEM encoded public key",
+		},
+		"not a public key": {
+			client:      &fakeKMSClient{signer: ecKey, algorithm: "EC_SIGN_P256_SHA256", pem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")}))},
+			expectedErr: "invalid public key",
+		},
+		"API error": {
+			client:      &fakeKMSClient{err: errors.New("permission denied")},
+			expectedErr: "permission denied",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pub, err := publicKeyPEM(context.Background(), test.client, key)
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error containing %q but got: %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			block, _ := pem.Decode(pub)
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ecKey.PublicKey.Equal(parsed) {
+				t.Errorf("expected the public key of the KMS key version to be returned")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// VerifyKMS verifies that sig is a valid signature of data, as produced by
+// SignBytes, made with the GCP KMS key. The key's public key is fetched using
+// the KMS GetPublicKey API, so the caller needs only the viewPublicKey
+// permission on the key.
+func VerifyKMS(ctx context.Context, key GCPKMSKey, data, sig []byte) error {
+	client, err := newKMSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	pub, err := getPublicKey(ctx, client, key)
+	if err != nil {
+		return err
+	}
+
+	return verifySignature([]byte(pub.Pem), pub.Algorithm, data, sig)
+}
+
+// verifySignature verifies sig against data using the PEM encoded public key
+// of a KMS key with the given algorithm, e.g. RSA_SIGN_PKCS1_4096_SHA512.
+func verifySignature(pemData []byte, algorithm string, data, sig []byte) error {
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return fmt.Errorf("could not decode public key PEM")
+	}
+
+	pubkey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("could not parse public key: %w", err)
+	}
+
+	hash, err := hashForAlgorithm(algorithm)
+	if err != nil {
+		return err
+	}
+
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(algorithm, "RSA_SIGN_PKCS1_"):
+		rsaKey, ok := pubkey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("public key is not an RSA key as expected for algorithm %q", algorithm)
+		}
+		err = rsa.VerifyPKCS1v15(rsaKey, hash, digest, sig)
+	case strings.HasPrefix(algorithm, "RSA_SIGN_PSS_"):
+		rsaKey, ok := pubkey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("public key is not an RSA key as expected for algorithm %q", algorithm)
+		}
+		err = rsa.VerifyPSS(rsaKey, hash, digest, sig, nil)
+	case strings.HasPrefix(algorithm, "EC_SIGN_"):
+		ecKey, ok := pubkey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("public key is not an EC key as expected for algorithm %q", algorithm)
+		}
+		if !ecdsa.VerifyASN1(ecKey, digest, sig) {
+			err = fmt.Errorf("ecdsa verification error")
+		}
+	default:
+		return fmt.Errorf("unsupported key algorithm %q", algorithm)
+	}
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// hashForAlgorithm returns the digest algorithm used by a KMS key with the
+// given algorithm.
+func hashForAlgorithm(algorithm string) (crypto.Hash, error) {
+	switch {
+	case strings.HasSuffix(algorithm, "_SHA256"):
+		return crypto.SHA256, nil
+	case strings.HasSuffix(algorithm, "_SHA384"):
+		return crypto.SHA384, nil
+	case strings.HasSuffix(algorithm, "_SHA512"):
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported key algorithm %q", algorithm)
+	}
+}
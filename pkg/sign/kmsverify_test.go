@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	data := []byte("0123abcd  cert-manager-manifests.tar.gz\n")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha512Digest := sha512.Sum512(data)
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA512, sha512Digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha256Digest := sha256.Sum256(data)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, sha256Digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		pub         crypto.PublicKey
+		algorithm   string
+		data        []byte
+		sig         []byte
+		shouldError bool
+	}{
+		"valid RSA signature": {
+			pub:       &rsaKey.PublicKey,
+			algorithm: "RSA_SIGN_PKCS1_4096_SHA512",
+			data:      data,
+			sig:       rsaSig,
+		},
+		"valid EC signature": {
+			pub:       &ecKey.PublicKey,
+			algorithm: "EC_SIGN_P256_SHA256",
+			data:      data,
+			sig:       ecSig,
+		},
+		"RSA signature over different data": {
+			pub:         &rsaKey.PublicKey,
+			algorithm:   "RSA_SIGN_PKCS1_4096_SHA512",
+			data:        []byte("tampered"),
+			sig:         rsaSig,
+			shouldError: true,
+		},
+		"EC signature over different data": {
+			pub:         &ecKey.PublicKey,
+			algorithm:   "EC_SIGN_P256_SHA256",
+			data:        []byte("tampered"),
+			sig:         ecSig,
+			shouldError: true,
+		},
+		"RSA signature with the wrong digest algorithm": {
+			pub:         &rsaKey.PublicKey,
+			algorithm:   "RSA_SIGN_PKCS1_4096_SHA256",
+			data:        data,
+			sig:         rsaSig,
+			shouldError: true,
+		},
+		"key type which doesn't match the algorithm": {
+			pub:         &ecKey.PublicKey,
+			algorithm:   "RSA_SIGN_PKCS1_4096_SHA512",
+			data:        data,
+			sig:         rsaSig,
+			shouldError: true,
+		},
+		"unsupported algorithm": {
+			pub:         &rsaKey.PublicKey,
+			algorithm:   "GOOGLE_SYMMETRIC_ENCRYPTION",
+			data:        data,
+			sig:         rsaSig,
+			shouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			der, err := x509.MarshalPKIXPublicKey(test.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+			err = verifySignature(pemData, test.algorithm, test.data, test.sig)
+			if (err != nil) != test.shouldError {
+				t.Errorf("shouldError=%v, err=%v", test.shouldError, err)
+			}
+		})
+	}
+}
@@ -36,8 +36,16 @@ const manifestLocation = "deploy/chart/cert-manager.tgz"
 // memory and signs anything inside the archive which is signable; currently,
 // the helm chart located at "deploy/chart/cert-manager.tgz" is signed, and a
 // signature "deploy/chart/cert-manager.tgz.prov" will be added.
+// If more than one key is given, for example whilst rotating keys, the chart
+// is signed with each of them. The signature made with the first key is added
+// as above, and signatures made with subsequent keys are added with the names
+// returned by provPathForKey.
 // The cert-manifests.tar.gz file is changed in-place.
-func CertManagerManifests(ctx context.Context, key GCPKMSKey, path string, releaseVersion string) error {
+func CertManagerManifests(ctx context.Context, keys []GCPKMSKey, path string, releaseVersion string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys provided to sign %q", path)
+	}
+
 	// 1. Create temp dir for chart archive to be extracted to
 	// (Helm signing requires a filename, not a reader, so we have to write to disk here)
 	tmpDest, err := os.MkdirTemp("", "cmrel-extracted-manifests-")
@@ -74,10 +82,21 @@ func CertManagerManifests(ctx context.Context, key GCPKMSKey, path string, relea
 		return err
 	}
 
-	// 3. Sign chart
-	signatureBytes, err := HelmChart(ctx, key, chartPath)
-	if err != nil {
-		return fmt.Errorf("failed to sign helm chart at %q: %w", chartPath, err)
+	// 3. Sign chart with each key, storing each signature in its own tar
+	// archive to be appended to the original
+	var signatureTars [][]byte
+	for i, key := range keys {
+		signatureBytes, err := HelmChart(ctx, key, chartPath)
+		if err != nil {
+			return fmt.Errorf("failed to sign helm chart at %q with key %q: %w", chartPath, key, err)
+		}
+
+		newTar, err := signatureToTar(signatureBytes, provPathForKey(i), 0o644)
+		if err != nil {
+			return err
+		}
+
+		signatureTars = append(signatureTars, newTar)
 	}
 
 	// 4. Chmod the archive if needed so that it's writable, with a defer to reset its permissions
@@ -96,19 +115,22 @@ func CertManagerManifests(ctx context.Context, key GCPKMSKey, path string, relea
 	// We copy until the beginning of these empty blocks, then add our new header and our file,
 	// and then close the tar.Writer to complete the tar archive.
 	// See https://stackoverflow.com/a/18330903/1615417 for more details
+	// Each signature tar has its own pair of empty blocks, which are likewise
+	// trimmed from all but the last.
 
 	// NB: We can't just open the file as O_APPEND and seek back 1024 bytes because it's gzipped
-	provPath := manifestLocation + ".prov"
-
-	newTar, err := signatureToTar(signatureBytes, provPath, 0o644)
-	if err != nil {
-		return err
+	out := tarData[:len(tarData)-1024]
+	for i, newTar := range signatureTars {
+		if i < len(signatureTars)-1 {
+			newTar = newTar[:len(newTar)-1024]
+		}
+		out = append(out, newTar...)
 	}
 
 	targzOut := &bytes.Buffer{}
 	gzipWriter := gzip.NewWriter(targzOut)
 
-	_, err = gzipWriter.Write(append(tarData[:len(tarData)-1024], newTar...))
+	_, err = gzipWriter.Write(out)
 	if err != nil {
 		return fmt.Errorf("failed to compress tar output with helm signature: %w", err)
 	}
@@ -123,11 +145,24 @@ func CertManagerManifests(ctx context.Context, key GCPKMSKey, path string, relea
 		return fmt.Errorf("failed to write output tar file: %w", err)
 	}
 
-	log.Printf("successfully signed helm chart %q and added signature to %q as %q", chartPath, path, provPath)
+	for i, key := range keys {
+		log.Printf("successfully signed helm chart %q with key %q and added signature to %q as %q", chartPath, key, path, provPathForKey(i))
+	}
 
 	return nil
 }
 
+// provPathForKey returns the path within the manifests archive of the helm
+// chart signature made with the i'th signing key. The first key's signature
+// uses the standard name expected by helm, and subsequent signatures are
+// numbered from 2, e.g. "deploy/chart/cert-manager.tgz.2.prov".
+func provPathForKey(i int) string {
+	if i == 0 {
+		return manifestLocation + ".prov"
+	}
+	return fmt.Sprintf("%s.%d.prov", manifestLocation, i+1)
+}
+
 func setOwnerWritable(mode os.FileMode) os.FileMode {
 	//      r  w  x
 	// bits 2, 1, 0 are for world permissions
@@ -50,3 +50,33 @@ func TestSetOwnerWritable(t *testing.T) {
 		})
 	}
 }
+
+func TestProvPathForKey(t *testing.T) {
+	tests := map[string]struct {
+		index        int
+		expectedPath string
+	}{
+		"first key uses the standard helm prov path": {
+			index:        0,
+			expectedPath: "deploy/chart/cert-manager.tgz.prov",
+		},
+		"second key is numbered": {
+			index:        1,
+			expectedPath: "deploy/chart/cert-manager.tgz.2.prov",
+		},
+		"third key is numbered": {
+			index:        2,
+			expectedPath: "deploy/chart/cert-manager.tgz.3.prov",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := provPathForKey(test.index)
+
+			if path != test.expectedPath {
+				t.Errorf("wanted path %q but got %q", test.expectedPath, path)
+			}
+		})
+	}
+}
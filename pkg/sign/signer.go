@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SigningBackendKMS signs artifacts using a GCP KMS key.
+	SigningBackendKMS = "kms"
+
+	// SigningBackendCosign signs artifacts using cosign's keyless mode, where
+	// an ephemeral key is certified by Sigstore's Fulcio CA using the OIDC
+	// identity of the caller and signatures are recorded in the Rekor
+	// transparency log.
+	SigningBackendCosign = "cosign"
+)
+
+// SigningBackends is the list of all supported signing backends.
+var SigningBackends = []string{SigningBackendKMS, SigningBackendCosign}
+
+// Signer signs release artifacts.
+type Signer interface {
+	// SignImages signs each of the given container image references, pushing
+	// the resulting signatures to the registry.
+	SignImages(ctx context.Context, images []string) error
+
+	// SignBlob creates a detached signature for the file at the given path,
+	// returning the paths of all files written alongside it.
+	SignBlob(ctx context.Context, path string) ([]string, error)
+}
+
+// ValidateSigningBackend returns an error if backend is not the name of a
+// supported signing backend.
+func ValidateSigningBackend(backend string) error {
+	for _, b := range SigningBackends {
+		if backend == b {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid signing backend %q, must be one of: %s", backend, strings.Join(SigningBackends, ", "))
+}
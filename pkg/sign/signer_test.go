@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sign
+
+import "testing"
+
+func TestValidateSigningBackend(t *testing.T) {
+	tests := map[string]struct {
+		backend   string
+		expectErr bool
+	}{
+		"kms": {
+			backend: SigningBackendKMS,
+		},
+		"cosign": {
+			backend: SigningBackendCosign,
+		},
+		"empty": {
+			backend:   "",
+			expectErr: true,
+		},
+		"unknown": {
+			backend:   "gpg",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSigningBackend(test.backend)
+			if test.expectErr != (err != nil) {
+				t.Errorf("expectErr=%v but got err: %v", test.expectErr, err)
+			}
+		})
+	}
+}
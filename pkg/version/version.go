@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package version holds build information about the cmrel binary, which is
+// injected at build time using -ldflags, e.g.:
+//
+//	go build -ldflags "-X github.com/cert-manager/release/pkg/version.GitCommit=$(git rev-parse HEAD)" ./cmd/cmrel
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Version is the version of cmrel, e.g. a git tag.
+	Version = ""
+
+	// GitCommit is the git commit cmrel was built from.
+	GitCommit = ""
+
+	// BuildDate is the time at which cmrel was built, in RFC3339 format.
+	BuildDate = ""
+)
+
+// Info describes the build of the running cmrel binary.
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information of the running binary. Values which
+// weren't injected at build time are reported as "unknown", except that the
+// version falls back to the module version if cmrel was installed using
+// 'go install'.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if info.Version == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+	}
+
+	for _, v := range []*string{&info.Version, &info.GitCommit, &info.BuildDate} {
+		if *v == "" {
+			*v = "unknown"
+		}
+	}
+
+	return info
+}
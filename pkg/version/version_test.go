@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := map[string]struct {
+		version, gitCommit, buildDate string
+		exp                           Info
+	}{
+		"injected values are reported": {
+			version:   "v0.3.0",
+			gitCommit: "abc123",
+			buildDate: "2021-10-14T12:00:00Z",
+			exp:       Info{Version: "v0.3.0", GitCommit: "abc123", BuildDate: "2021-10-14T12:00:00Z", GoVersion: runtime.Version()},
+		},
+		"missing values are unknown": {
+			gitCommit: "abc123",
+			exp:       Info{Version: "unknown", GitCommit: "abc123", BuildDate: "unknown", GoVersion: runtime.Version()},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func(v, c, d string) { Version, GitCommit, BuildDate = v, c, d }(Version, GitCommit, BuildDate)
+			Version, GitCommit, BuildDate = test.version, test.gitCommit, test.buildDate
+
+			if got := Get(); got != test.exp {
+				t.Errorf("expected %+v but got %+v", test.exp, got)
+			}
+		})
+	}
+}